@@ -0,0 +1,301 @@
+package bot
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+	"github.com/tsolodov/wot/config"
+	"github.com/tsolodov/wot/internal/logging"
+	"github.com/tsolodov/wot/internal/rotate"
+)
+
+const (
+	auditOK      = "ok"
+	auditFailed  = "failed"
+	auditPartial = "partial"
+	auditDenied  = "denied"
+
+	auditSourceTelegram   = "telegram"
+	auditSourceMQTT       = "mqtt"
+	auditSourceFederation = "federation"
+	auditSourceConfig     = "config"
+
+	// defaultAuditEntries and maxAuditEntries bound what /audit lists
+	defaultAuditEntries = 10
+	maxAuditEntries     = 30
+)
+
+// AuditEntry is a command or automated action recorded in the audit log.
+// Outcome is ok, failed, partial (some targets failed) or denied (an
+// unauthorized user).
+type AuditEntry struct {
+	Time      time.Time `json:"time"`
+	Source    string    `json:"source"`
+	UserID    int64     `json:"user_id,omitempty"`
+	Username  string    `json:"username,omitempty"`
+	ChatID    int64     `json:"chat_id,omitempty"`
+	Command   string    `json:"command"`
+	Targets   []string  `json:"targets,omitempty"`
+	Outcome   string    `json:"outcome"`
+	Error     string    `json:"error,omitempty"`
+	LatencyMS int64     `json:"latency_ms"`
+}
+
+// AuditLog appends entries to a size-rotated JSON lines file. A nil
+// *AuditLog records nothing.
+type AuditLog struct {
+	file *rotate.File
+	now  func() time.Time
+}
+
+// NewAuditLog returns the audit log at path, or nil if it is disabled.
+func NewAuditLog(path string, cfg config.AuditConfig) *AuditLog {
+	if cfg.Disabled {
+		return nil
+	}
+	return &AuditLog{file: rotate.Open(path, int64(cfg.MaxSizeMB)<<20, cfg.MaxFiles), now: time.Now}
+}
+
+// Record appends entry, setting its time to now if it has none.
+func (a *AuditLog) Record(entry AuditEntry) {
+	if a == nil {
+		return
+	}
+	if entry.Time.IsZero() {
+		entry.Time = a.now()
+	}
+	entry.Error = logging.Redact(entry.Error)
+	line, err := json.Marshal(entry)
+	if err == nil {
+		_, err = a.file.Write(append(line, '\n'))
+	}
+	if err != nil {
+		slog.Error("Failed to write audit log", "error", err)
+	}
+}
+
+// Query returns the last n entries that match, oldest first, reading back
+// through the rotated files as far as needed.
+func (a *AuditLog) Query(n int, match func(AuditEntry) bool) ([]AuditEntry, error) {
+	var found []AuditEntry
+	for _, path := range a.file.Paths() {
+		entries, err := readAuditFile(path)
+		if err != nil {
+			return nil, err
+		}
+		for i := len(entries) - 1; i >= 0 && len(found) < n; i-- {
+			if match(entries[i]) {
+				found = append(found, entries[i])
+			}
+		}
+		if len(found) == n {
+			break
+		}
+	}
+	for i, j := 0, len(found)-1; i < j; i, j = i+1, j-1 {
+		found[i], found[j] = found[j], found[i]
+	}
+	return found, nil
+}
+
+func readAuditFile(path string) ([]AuditEntry, error) {
+	file, err := os.Open(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	var entries []AuditEntry
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		var entry AuditEntry
+		if err := json.Unmarshal(scanner.Bytes(), &entry); err != nil {
+			// A line cut short by a crash is skipped
+			continue
+		}
+		entries = append(entries, entry)
+	}
+	return entries, scanner.Err()
+}
+
+// auditKey carries the *auditRecord of the action being audited.
+type auditKey struct{}
+
+// auditRecord collects what an audited action acted on while it runs.
+type auditRecord struct {
+	mutex   sync.Mutex
+	targets []string
+	failed  int
+	errors  []string
+	denied  bool
+}
+
+// auditTarget notes that the action being audited acted on target, which
+// may be empty, and err if that failed. It does nothing outside of one.
+func auditTarget(ctx context.Context, target string, err error) {
+	record, ok := ctx.Value(auditKey{}).(*auditRecord)
+	if !ok {
+		return
+	}
+	record.mutex.Lock()
+	defer record.mutex.Unlock()
+	if target != "" && !slices.Contains(record.targets, target) {
+		record.targets = append(record.targets, target)
+	}
+	if err != nil {
+		if target != "" {
+			record.failed++
+			record.errors = append(record.errors, target+": "+err.Error())
+		} else {
+			record.errors = append(record.errors, err.Error())
+		}
+	}
+}
+
+// auditDeny notes that the action being audited was refused to its sender.
+func auditDeny(ctx context.Context) {
+	if record, ok := ctx.Value(auditKey{}).(*auditRecord); ok {
+		record.mutex.Lock()
+		record.denied = true
+		record.mutex.Unlock()
+	}
+}
+
+// audited runs action and records entry with the targets and errors it
+// noted through auditTarget and how long it took.
+func (d *Daemon) audited(ctx context.Context, entry AuditEntry, action func(ctx context.Context)) {
+	record := &auditRecord{}
+	start := time.Now()
+	action(context.WithValue(ctx, auditKey{}, record))
+	entry.LatencyMS = time.Since(start).Milliseconds()
+
+	record.mutex.Lock()
+	defer record.mutex.Unlock()
+	entry.Targets = record.targets
+	entry.Error = strings.Join(record.errors, "; ")
+	switch {
+	case record.denied:
+		entry.Outcome = auditDenied
+	case len(record.errors) == 0:
+		entry.Outcome = auditOK
+	case record.failed > 0 && record.failed < len(record.targets) && record.failed == len(record.errors):
+		entry.Outcome = auditPartial
+	default:
+		entry.Outcome = auditFailed
+	}
+	d.audit.Record(entry)
+}
+
+// telegramAuditEntry describes a command sent by user in chat.
+func telegramAuditEntry(chat *tgbotapi.Chat, user *tgbotapi.User, command string) AuditEntry {
+	entry := AuditEntry{Source: auditSourceTelegram, Command: command}
+	if chat != nil {
+		entry.ChatID = chat.ID
+	}
+	if user != nil {
+		entry.UserID, entry.Username = user.ID, user.UserName
+	}
+	return entry
+}
+
+// handleAuditCommand lists the last audit entries, optionally only those of
+// a user (name or ID) or about a server.
+func handleAuditCommand(ctx context.Context, bot Messenger, message *tgbotapi.Message, d *Daemon, command string) {
+	if d.audit == nil {
+		bot.Send(tgbotapi.NewMessage(message.Chat.ID, "ℹ️ The audit log is disabled"))
+		return
+	}
+
+	args := strings.Fields(message.Text)[1:]
+	n := defaultAuditEntries
+	if len(args) > 0 {
+		if count, err := strconv.Atoi(args[0]); err == nil && count > 0 {
+			n, args = min(count, maxAuditEntries), args[1:]
+		}
+	}
+	if len(args) > 1 {
+		bot.Send(tgbotapi.NewMessage(message.Chat.ID, "Usage: /audit [n] [user|server]\nExample: /audit 20 @alice"))
+		return
+	}
+
+	match := func(AuditEntry) bool { return true }
+	if len(args) == 1 {
+		filter := strings.TrimPrefix(args[0], "@")
+		server := filter
+		if found := config.MatchServer(d.Config().Servers, filter).Server; found != nil {
+			server = found.Name
+		}
+		match = func(entry AuditEntry) bool {
+			if strings.EqualFold(entry.Username, filter) || strconv.FormatInt(entry.UserID, 10) == filter {
+				return true
+			}
+			for _, target := range entry.Targets {
+				if strings.EqualFold(target, server) {
+					return true
+				}
+			}
+			return false
+		}
+	}
+
+	entries, err := d.audit.Query(n, match)
+	if err != nil {
+		bot.Send(tgbotapi.NewMessage(message.Chat.ID, fmt.Sprintf("❌ Failed to read the audit log: %v", err)))
+		return
+	}
+	if len(entries) == 0 {
+		bot.Send(tgbotapi.NewMessage(message.Chat.ID, "🧾 No matching audit entries"))
+		return
+	}
+
+	// Plain text, since user names and errors may contain Markdown
+	var response strings.Builder
+	response.WriteString("🧾 Audit log:\n\n")
+	for _, entry := range entries {
+		response.WriteString(formatAuditEntry(entry, d.messages) + "\n")
+	}
+	bot.Send(tgbotapi.NewMessage(message.Chat.ID, response.String()))
+}
+
+func formatAuditEntry(entry AuditEntry, messages *Messages) string {
+	who := entry.Username
+	switch {
+	case entry.Source == auditSourceTelegram && who != "":
+		who = "@" + who
+	case who == "" && entry.UserID != 0:
+		who = fmt.Sprintf("user %d", entry.UserID)
+	case who == "":
+		who = entry.Source
+	}
+
+	line := fmt.Sprintf("%s %s %s", messages.Clock(entry.Time), who, entry.Command)
+	if len(entry.Targets) > 0 && !strings.Contains(entry.Command, entry.Targets[0]) {
+		line += " (" + strings.Join(entry.Targets, ", ") + ")"
+	}
+	line += " → " + entry.Outcome
+	if entry.Error != "" {
+		errText := []rune(entry.Error)
+		if len(errText) > 80 {
+			errText = append(errText[:77], []rune("...")...)
+		}
+		line += ": " + string(errText)
+	}
+	if entry.Outcome != auditDenied {
+		line += fmt.Sprintf(" (%v)", time.Duration(entry.LatencyMS)*time.Millisecond)
+	}
+	return line
+}
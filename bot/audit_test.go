@@ -0,0 +1,79 @@
+package bot
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/tsolodov/wot/internal/rotate"
+)
+
+func TestTelegramAudit(t *testing.T) {
+	servers, _ := relayServers(t)
+	d, fake, _ := startTestBot(t, servers, "remote-up")
+
+	converse(t, fake, "/wake remote-down")
+	converse(t, fake, "/wake nowhere-near")
+	converse(t, fake, "/checkwake remote-up")
+	// Strangers get no reply, but their attempts are recorded
+	fake.SendText(testAdminChat+1, "mallory", "/wake remote-down")
+
+	reply := converse(t, fake, "/audit")
+	lines := strings.Split(strings.TrimSpace(reply), "\n")
+	if len(lines) != 6 || lines[0] != "🧾 Audit log:" {
+		t.Fatalf("/audit: %s", reply)
+	}
+	for i, want := range []string{
+		"@alice /wake remote-down → ok",
+		"@alice /wake nowhere-near → failed: server 'nowhere-near' not found",
+		"@alice /checkwake remote-up → ok",
+		"@mallory /wake remote-down → denied",
+	} {
+		if !strings.Contains(lines[i+2], want) {
+			t.Errorf("entry %d = %q, want %q", i, lines[i+2], want)
+		}
+	}
+
+	// Entries can be filtered by server and by user
+	if reply := converse(t, fake, "/audit remote-d"); strings.Count(strings.TrimSpace(reply), "\n") != 2 || !strings.Contains(reply, "/wake remote-down → ok") {
+		t.Errorf("/audit remote-d: %s", reply)
+	}
+	if reply := converse(t, fake, "/audit 5 @mallory"); strings.Count(strings.TrimSpace(reply), "\n") != 2 || !strings.Contains(reply, "denied") {
+		t.Errorf("/audit @mallory: %s", reply)
+	}
+
+	entries, err := d.audit.Query(1, func(entry AuditEntry) bool { return entry.Outcome == auditDenied })
+	if err != nil || len(entries) != 1 {
+		t.Fatalf("Query: %v, %v", entries, err)
+	}
+	if entry := entries[0]; entry.ChatID != testAdminChat+1 || entry.Source != auditSourceTelegram || entry.Time.IsZero() {
+		t.Errorf("denied entry %+v", entry)
+	}
+}
+
+func TestAuditLogQuery(t *testing.T) {
+	audit := &AuditLog{file: rotate.Open(filepath.Join(t.TempDir(), "audit.jsonl"), 300, 2), now: time.Now}
+	for i := 0; i < 10; i++ {
+		audit.Record(AuditEntry{Source: auditSourceMQTT, Command: "wake", Targets: []string{fmt.Sprintf("server%d", i)}, Outcome: auditOK})
+	}
+	if len(audit.file.Paths()) != 3 {
+		t.Fatalf("expected the log to rotate, got %v", audit.file.Paths())
+	}
+
+	// The last entries are read back across rotated files, oldest first
+	entries, err := audit.Query(4, func(AuditEntry) bool { return true })
+	if err != nil || len(entries) != 4 {
+		t.Fatalf("Query: %v, %v", entries, err)
+	}
+	for i, entry := range entries {
+		if want := fmt.Sprintf("server%d", 6+i); entry.Targets[0] != want {
+			t.Errorf("entry %d targets %v, want %s", i, entry.Targets, want)
+		}
+	}
+
+	// A nil log records nothing
+	var disabled *AuditLog
+	disabled.Record(AuditEntry{Command: "wake"})
+}
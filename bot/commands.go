@@ -0,0 +1,439 @@
+package bot
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"slices"
+	"sort"
+	"strings"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+	"github.com/tsolodov/wot/config"
+)
+
+const (
+	// maxInlineServers bounds the servers suggested for an inline query;
+	// Telegram accepts at most 50 results, two per server
+	maxInlineServers = 25
+	// inlineCacheTime is how many seconds Telegram may reuse an answer,
+	// kept short since the results show the current status
+	inlineCacheTime = 5
+	// runCallbackPrefix starts the callback data of buttons that run a
+	// command, such as "did you mean" suggestions
+	runCallbackPrefix = "run:"
+)
+
+// commandHandler runs a chat command. command is the lowercased text of the
+// message with the bot name removed.
+type commandHandler func(ctx context.Context, bot Messenger, message *tgbotapi.Message, d *Daemon, command string)
+
+// botCommand is a chat command. The list of them drives dispatch, /help and
+// the command menu registered with Telegram.
+type botCommand struct {
+	name string
+	// aliases are further names the command answers to; they are neither
+	// listed in /help nor in the menu
+	aliases     []string
+	args        string
+	description string
+	// usage lines are listed under the command in /help
+	usage []string
+	// admin commands change the configuration. In a group admin chat only
+	// group administrators may run them and get them in the command menu.
+	admin  bool
+	handle commandHandler
+}
+
+// botCommands is set in init, since /help lists it.
+var botCommands []botCommand
+
+func init() {
+	botCommands = []botCommand{
+		{
+			name: "help", aliases: []string{"start"},
+			description: "Show this help message",
+			handle: func(ctx context.Context, bot Messenger, message *tgbotapi.Message, d *Daemon, command string) {
+				handleHelpCommand(bot, message)
+			},
+		},
+		{
+			name:        "list",
+			description: "List all servers with status",
+			handle: func(ctx context.Context, bot Messenger, message *tgbotapi.Message, d *Daemon, command string) {
+				handleListCommand(ctx, bot, message, d)
+			},
+		},
+		{
+			name: "status", args: "[server]",
+			description: "Check status of all servers or one",
+			handle:      handleStatusCommand,
+		},
+		{
+			name:        "uptime",
+			description: "Show system uptime",
+			handle: func(ctx context.Context, bot Messenger, message *tgbotapi.Message, d *Daemon, command string) {
+				handleUptimeCommand(bot, message)
+			},
+		},
+		{
+			name:        "host",
+			description: "Temperature, power, disk, memory and load of the Pi",
+			handle: func(ctx context.Context, bot Messenger, message *tgbotapi.Message, d *Daemon, command string) {
+				handleHostCommand(bot, message, d)
+			},
+		},
+		{
+			name: "wake", args: "[server]",
+			description: "Wake server(s)",
+			usage: []string{
+				"/wake - Wake all servers",
+				"/wake servername - Wake specific server",
+				"/wake site/servername - Wake a server at another site",
+			},
+			handle: withSiteWake(handleWakeCommand),
+		},
+		{
+			name: "checkwake", args: "[server]",
+			description: "Check and wake if down",
+			usage: []string{
+				"/checkwake - Check and wake all down servers",
+				"/checkwake servername - Check and wake specific server",
+			},
+			handle: withSiteWake(handleCheckWakeCommand),
+		},
+		{
+			name: "reload", admin: true,
+			description: "Reload configuration file",
+			handle: func(ctx context.Context, bot Messenger, message *tgbotapi.Message, d *Daemon, command string) {
+				handleReloadCommand(ctx, bot, message, d)
+			},
+		},
+		{
+			name: "add", args: "name mac [ip|host|auto] [ports]", admin: true,
+			description: "Add a server",
+			usage: []string{
+				"/add nas aa:bb:cc:dd:ee:ff 192.168.1.20 22,445",
+				"/add nas aa:bb:cc:dd:ee:ff nas.local",
+			},
+			handle: func(ctx context.Context, bot Messenger, message *tgbotapi.Message, d *Daemon, command string) {
+				handleAddCommand(ctx, bot, message, d)
+			},
+		},
+		{
+			name: "remove", args: "name", admin: true,
+			description: "Remove a server",
+			handle: func(ctx context.Context, bot Messenger, message *tgbotapi.Message, d *Daemon, command string) {
+				handleRemoveCommand(ctx, bot, message, d)
+			},
+		},
+		{
+			name: "edit", args: "name field value", admin: true,
+			description: "Change a server",
+			usage:       []string{`fields: name, mac, ip, host, ports ("-" clears ip/host/ports)`},
+			handle: func(ctx context.Context, bot Messenger, message *tgbotapi.Message, d *Daemon, command string) {
+				handleEditCommand(ctx, bot, message, d)
+			},
+		},
+		{
+			name: "discover", args: "[subnet]", admin: true,
+			description: "Find hosts on the network",
+			usage:       []string{"/discover 192.168.1.0/24 - Sweep a subnet first"},
+			handle: func(ctx context.Context, bot Messenger, message *tgbotapi.Message, d *Daemon, command string) {
+				handleDiscoverCommand(ctx, bot, message, d)
+			},
+		},
+		{
+			name: "maintenance", args: "[server duration [reason]]",
+			description: "Maintenance mode",
+			usage: []string{
+				"/maintenance nas 2h disk swap - No alerts or automated wakes",
+				"/maintenance nas off - End maintenance early",
+			},
+			handle: func(ctx context.Context, bot Messenger, message *tgbotapi.Message, d *Daemon, command string) {
+				handleSuppressCommand(ctx, bot, message, d, suppressMaintenance)
+			},
+		},
+		{
+			name: "mute", args: "server duration",
+			description: "Silence alerts for a server",
+			usage:       []string{"/mute nas 30m, /mute nas off"},
+			handle: func(ctx context.Context, bot Messenger, message *tgbotapi.Message, d *Daemon, command string) {
+				handleSuppressCommand(ctx, bot, message, d, suppressMute)
+			},
+		},
+		{
+			name: "report", args: "[period]",
+			description: "Availability report",
+			usage:       []string{"/report week, /report 12h (default: last day)"},
+			handle: func(ctx context.Context, bot Messenger, message *tgbotapi.Message, d *Daemon, command string) {
+				handleReportCommand(bot, message, d)
+			},
+		},
+		{
+			name: "audit", args: "[n] [user|server]", admin: true,
+			description: "Recent commands and actions",
+			usage:       []string{"/audit 20 @alice, /audit nas"},
+			handle:      handleAuditCommand,
+		},
+	}
+}
+
+// withSiteWake forwards "/wake site/server" and "/checkwake site/server" to
+// the peer site and runs handler for everything else.
+func withSiteWake(handler commandHandler) commandHandler {
+	return func(ctx context.Context, bot Messenger, message *tgbotapi.Message, d *Daemon, command string) {
+		if d.peers != nil && isSiteWakeCommand(command) {
+			handleSiteWakeCommand(ctx, bot, message, d, command)
+			return
+		}
+		handler(ctx, bot, message, d, command)
+	}
+}
+
+// findCommand returns the command that command starts with, or nil if it
+// is not one.
+func findCommand(command string) *botCommand {
+	fields := strings.Fields(command)
+	if len(fields) == 0 || !strings.HasPrefix(fields[0], "/") {
+		return nil
+	}
+	name := strings.TrimPrefix(fields[0], "/")
+	for i := range botCommands {
+		if botCommands[i].name == name || slices.Contains(botCommands[i].aliases, name) {
+			return &botCommands[i]
+		}
+	}
+	return nil
+}
+
+// findServerFor looks up the server named by field arg of command, accepting
+// aliases and unique prefixes. If none matches, it replies with the servers
+// the name could mean, each with a button that runs command for it, and
+// returns nil.
+func findServerFor(ctx context.Context, bot Messenger, message *tgbotapi.Message, servers []config.Server, command string, arg int) *config.Server {
+	fields := strings.Fields(command)
+	name := fields[arg]
+	match := config.MatchServer(servers, name)
+	if match.Server != nil {
+		auditTarget(ctx, match.Server.Name, nil)
+		return match.Server
+	}
+	auditTarget(ctx, "", fmt.Errorf("server '%s' not found", name))
+
+	var names []string
+	for _, candidate := range match.Candidates {
+		names = append(names, candidate.Name)
+	}
+	text := fmt.Sprintf("❌ Server '%s' not found", name)
+	if match.Ambiguous {
+		text = fmt.Sprintf("🤔 '%s' matches several servers: %s", name, strings.Join(names, ", "))
+	} else if len(names) > 0 {
+		text += fmt.Sprintf(". Did you mean %s?", strings.Join(names, " or "))
+	}
+	reply := tgbotapi.NewMessage(message.Chat.ID, text)
+
+	// The command is run again as typed, without the bot name
+	fields[0], _, _ = strings.Cut(strings.ToLower(fields[0]), "@")
+	var rows [][]tgbotapi.InlineKeyboardButton
+	for _, candidate := range names {
+		fields[arg] = candidate
+		suggestion := strings.Join(fields, " ")
+		if data := runCallbackPrefix + suggestion; len(data) <= 64 {
+			rows = append(rows, tgbotapi.NewInlineKeyboardRow(tgbotapi.NewInlineKeyboardButtonData(suggestion, data)))
+		}
+	}
+	if len(rows) > 0 {
+		reply.ReplyMarkup = tgbotapi.NewInlineKeyboardMarkup(rows...)
+	}
+	bot.Send(reply)
+	return nil
+}
+
+// handleRunCallback runs the command of a suggestion button as if the user
+// who pressed it had typed it.
+func handleRunCallback(ctx context.Context, bot Messenger, query *tgbotapi.CallbackQuery, d *Daemon) {
+	text := strings.TrimPrefix(query.Data, runCallbackPrefix)
+	command := findCommand(strings.ToLower(text))
+	if command == nil {
+		bot.Request(tgbotapi.NewCallback(query.ID, ""))
+		return
+	}
+	bot.Request(tgbotapi.NewCallback(query.ID, text))
+
+	message := *query.Message
+	message.From = query.From
+	message.Text = text
+	if isGroupChat(message.Chat) {
+		bot = threadedReplies{Messenger: bot, message: &message}
+	}
+	slog.Info("Telegram command by button", "command", text, "chat_id", message.Chat.ID, "user_id", query.From.ID, "user", query.From.UserName)
+	if !permitted(ctx, bot, &message, d, command) {
+		return
+	}
+	command.handle(ctx, bot, &message, d, strings.ToLower(text))
+}
+
+// permitted reports whether the sender of message may run command. If not,
+// it tells them so and marks the audited action as denied.
+func permitted(ctx context.Context, bot Messenger, message *tgbotapi.Message, d *Daemon, command *botCommand) bool {
+	if !command.admin {
+		return true
+	}
+	denial := adminDenial(d.Config().Telegram, bot, message.Chat, message.From)
+	if denial == "" {
+		return true
+	}
+	slog.Warn("Admin command refused", "command", command.name, "reason", denial, "chat_id", message.Chat.ID, "user_id", message.From.ID, "user", message.From.UserName)
+	auditDeny(ctx)
+	bot.Send(tgbotapi.NewMessage(message.Chat.ID, fmt.Sprintf("🔒 /%s %s", command.name, denial)))
+	return false
+}
+
+// helpText lists the commands with their arguments and usage lines.
+func helpText() string {
+	var help strings.Builder
+	help.WriteString("🤖 *WoT Bot Commands*\n\n")
+	for _, command := range botCommands {
+		help.WriteString("/" + command.name)
+		if command.args != "" {
+			help.WriteString(" " + command.args)
+		}
+		help.WriteString(" - " + command.description + "\n")
+		for _, usage := range command.usage {
+			help.WriteString("  • " + usage + "\n")
+		}
+	}
+	return strings.TrimSuffix(help.String(), "\n")
+}
+
+func handleHelpCommand(bot Messenger, message *tgbotapi.Message) {
+	msg := tgbotapi.NewMessage(message.Chat.ID, helpText())
+	msg.ParseMode = "Markdown"
+	bot.Send(msg)
+}
+
+// menuCommands returns the commands for the Telegram command menu,
+// including admin commands only if admin is set.
+func menuCommands(admin bool) []tgbotapi.BotCommand {
+	var commands []tgbotapi.BotCommand
+	for _, command := range botCommands {
+		if command.admin && !admin {
+			continue
+		}
+		commands = append(commands, tgbotapi.BotCommand{Command: command.name, Description: command.description})
+	}
+	return commands
+}
+
+// registerCommands sets the command menu Telegram offers in the admin chat.
+// In a group, administrators also get the commands that change the
+// configuration. Without an admin chat every chat gets the commands, those
+// that change the configuration only with allowed_users; otherwise other
+// chats get none.
+func registerCommands(bot Messenger, cfg config.TelegramConfig) {
+	type menu struct {
+		scope    tgbotapi.BotCommandScope
+		commands []tgbotapi.BotCommand
+	}
+	var menus []menu
+	switch chat := cfg.AdminChatID; {
+	case chat == 0:
+		menus = []menu{{tgbotapi.NewBotCommandScopeDefault(), menuCommands(cfg.Restricted())}}
+	case chat < 0:
+		menus = []menu{
+			{tgbotapi.NewBotCommandScopeChat(chat), menuCommands(false)},
+			{tgbotapi.NewBotCommandScopeChatAdministrators(chat), menuCommands(true)},
+		}
+	default:
+		menus = []menu{{tgbotapi.NewBotCommandScopeChat(chat), menuCommands(true)}}
+	}
+
+	if cfg.AdminChatID != 0 {
+		scope := tgbotapi.NewBotCommandScopeDefault()
+		if _, err := bot.Request(tgbotapi.DeleteMyCommandsConfig{Scope: &scope}); err != nil {
+			slog.Warn("Failed to clear the default Telegram command menu", "error", err)
+		}
+	}
+	for _, menu := range menus {
+		if _, err := bot.Request(tgbotapi.NewSetMyCommandsWithScope(menu.scope, menu.commands...)); err != nil {
+			slog.Warn("Failed to register Telegram commands", "scope", menu.scope.Type, "error", err)
+		}
+	}
+}
+
+// inlineAuthorized reports whether the sender of an inline query may see the
+// servers. Inline queries carry no chat, so with a group admin chat only
+// allowed_users can use them.
+func inlineAuthorized(cfg config.TelegramConfig, from *tgbotapi.User) bool {
+	switch {
+	case from == nil:
+		return false
+	case len(cfg.AllowedUsers) > 0:
+		return cfg.UserAllowed(from.ID)
+	case cfg.AdminChatID > 0:
+		return from.ID == cfg.AdminChatID
+	default:
+		return cfg.AdminChatID == 0
+	}
+}
+
+// handleInlineQuery suggests servers whose name matches what was typed
+// after the bot name, each with a Wake and a Status action that sends the
+// command to the chat. botName is the bot's user name, which the commands
+// carry so they reach the bot in groups.
+func handleInlineQuery(bot Messenger, query *tgbotapi.InlineQuery, d *Daemon, botName string) {
+	cfg := d.Config()
+	results := []interface{}{}
+	if !inlineAuthorized(cfg.Telegram, query.From) {
+		entry := telegramAuditEntry(nil, query.From, "inline "+query.Query)
+		slog.Warn("Unauthorized inline query", "user_id", entry.UserID, "user", entry.Username)
+		entry.Outcome = auditDenied
+		d.audit.Record(entry)
+	} else {
+		states := d.monitor.GetServerStates()
+		for i, server := range matchServers(cfg.Servers, query.Query) {
+			description := "❓ Not checked yet"
+			if state, ok := states[server.Name]; ok && !state.LastChecked.IsZero() {
+				switch {
+				case state.Unknown:
+					description = "⚠️ UNKNOWN"
+				case state.IsUp:
+					description = "✅ UP"
+				default:
+					description = "❌ DOWN"
+				}
+			}
+
+			wake := tgbotapi.NewInlineQueryResultArticle(fmt.Sprintf("wake:%d", i), "⏰ Wake "+server.Name, fmt.Sprintf("/wake@%s %s", botName, server.Name))
+			wake.Description = description
+			status := tgbotapi.NewInlineQueryResultArticle(fmt.Sprintf("status:%d", i), "📊 Status of "+server.Name, fmt.Sprintf("/status@%s %s", botName, server.Name))
+			status.Description = description
+			results = append(results, wake, status)
+		}
+	}
+
+	answer := tgbotapi.InlineConfig{InlineQueryID: query.ID, Results: results, CacheTime: inlineCacheTime, IsPersonal: true}
+	if _, err := bot.Request(answer); err != nil {
+		slog.Warn("Failed to answer inline query", "error", err)
+	}
+}
+
+// matchServers returns the servers whose name contains text, ignoring case,
+// those starting with it first.
+func matchServers(servers []config.Server, text string) []config.Server {
+	text = strings.ToLower(strings.TrimSpace(text))
+	var matches []config.Server
+	for _, server := range servers {
+		if strings.Contains(strings.ToLower(server.Name), text) {
+			matches = append(matches, server)
+		}
+	}
+	sort.SliceStable(matches, func(i, j int) bool {
+		return strings.HasPrefix(strings.ToLower(matches[i].Name), text) && !strings.HasPrefix(strings.ToLower(matches[j].Name), text)
+	})
+	if len(matches) > maxInlineServers {
+		matches = matches[:maxInlineServers]
+	}
+	return matches
+}
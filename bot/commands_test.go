@@ -0,0 +1,161 @@
+package bot
+
+import (
+	"context"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+	"github.com/tsolodov/wot/config"
+	"github.com/tsolodov/wot/internal/telegramtest"
+)
+
+func TestCommandRegistry(t *testing.T) {
+	help := helpText()
+	for _, command := range botCommands {
+		if !strings.Contains(help, "/"+command.name) {
+			t.Errorf("/help does not list /%s", command.name)
+		}
+	}
+
+	tests := map[string]string{
+		"/start":            "help",
+		"/wake nas":         "wake",
+		"/checkwake":        "checkwake",
+		"/wakeall":          "",
+		"/maintenance-mode": "",
+		"wake nas":          "",
+		"":                  "",
+	}
+	for text, want := range tests {
+		got := ""
+		if command := findCommand(text); command != nil {
+			got = command.name
+		}
+		if got != want {
+			t.Errorf("findCommand(%q) = %q, want %q", text, got, want)
+		}
+	}
+}
+
+func TestRegisterCommands(t *testing.T) {
+	fake := telegramtest.NewServer("")
+	ts := httptest.NewServer(fake)
+	defer ts.Close()
+	defer fake.Close()
+	bot, err := tgbotapi.NewBotAPIWithAPIEndpoint("123:test", ts.URL+"/bot%s/%s")
+	if err != nil {
+		t.Fatal(err)
+	}
+	names := func(commands []tgbotapi.BotCommand) string {
+		var names []string
+		for _, command := range commands {
+			names = append(names, command.Command)
+		}
+		return strings.Join(names, " ")
+	}
+
+	// Everyone may use a bot without an admin chat, but not change its
+	// configuration unless allowed_users names who may
+	registerCommands(bot, config.TelegramConfig{})
+	if got := names(fake.Commands(tgbotapi.NewBotCommandScopeDefault())); !strings.Contains(got, "wake") || strings.Contains(got, "reload") {
+		t.Errorf("default menu: %s", got)
+	}
+	registerCommands(bot, config.TelegramConfig{AllowedUsers: []int64{7}})
+	if got := fake.Commands(tgbotapi.NewBotCommandScopeDefault()); len(got) != len(botCommands) {
+		t.Errorf("default menu with allowed_users: %s", names(got))
+	}
+
+	// In a group admin chat only administrators get the admin commands
+	registerCommands(bot, config.TelegramConfig{AdminChatID: -100})
+	if got := fake.Commands(tgbotapi.NewBotCommandScopeDefault()); len(got) != 0 {
+		t.Errorf("default menu not cleared: %s", names(got))
+	}
+	members := names(fake.Commands(tgbotapi.NewBotCommandScopeChat(-100)))
+	admins := names(fake.Commands(tgbotapi.NewBotCommandScopeChatAdministrators(-100)))
+	if !strings.Contains(members, "wake") || strings.Contains(members, "reload") || strings.Contains(members, "add") {
+		t.Errorf("member menu: %s", members)
+	}
+	if !strings.Contains(admins, "wake") || !strings.Contains(admins, "reload") {
+		t.Errorf("administrator menu: %s", admins)
+	}
+}
+
+func TestTelegramInlineQuery(t *testing.T) {
+	servers, _ := relayServers(t)
+	d, fake, _ := startTestBot(t, servers, "remote-up")
+	d.monitor.CheckAll(context.Background())
+
+	// Typing part of a name offers Wake and Status for each match
+	fake.SendInlineQuery(testAdminChat, "alice", "REMOTE-D")
+	answers, err := fake.WaitForInlineAnswers(1, 5*time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	results := answers[0].Results
+	if len(results) != 2 || results[0].Text != "/wake@"+telegramtest.BotUser.UserName+" remote-down" || results[0].Description != "❌ DOWN" {
+		t.Fatalf("results %+v", results)
+	}
+
+	fake.SendInlineQuery(testAdminChat, "alice", "up")
+	answers, err = fake.WaitForInlineAnswers(2, 5*time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	status := answers[1].Results[1]
+	if status.Title != "📊 Status of remote-up" || status.Description != "✅ UP" {
+		t.Fatalf("results %+v", answers[1].Results)
+	}
+
+	// Choosing a result sends its command to the chat
+	if reply := converse(t, fake, status.Text); !strings.Contains(reply, "*remote-up*") || strings.Contains(reply, "remote-down") {
+		t.Errorf("%s: %s", status.Text, reply)
+	}
+
+	// Strangers get no servers
+	fake.SendInlineQuery(testAdminChat+1, "mallory", "remote")
+	answers, err = fake.WaitForInlineAnswers(3, 5*time.Second)
+	if err != nil || len(answers[2].Results) != 0 {
+		t.Errorf("answer to a stranger %+v: %v", answers, err)
+	}
+}
+
+func TestTelegramServerSuggestions(t *testing.T) {
+	servers, woken := relayServers(t)
+	servers = strings.Replace(servers, "    relay: parents\n", "    relay: parents\n    aliases: [attic]\n", 1)
+	_, fake, _ := startTestBot(t, servers)
+
+	// Aliases and unique prefixes name a server
+	if reply := converse(t, fake, "/checkwake ATTIC"); !strings.Contains(reply, "*remote-up* is already UP") {
+		t.Errorf("/checkwake of an alias: %s", reply)
+	}
+	if reply := converse(t, fake, "/wake remote-d"); !strings.Contains(reply, "Magic packet sent to *remote-down*") {
+		t.Errorf("/wake of a prefix: %s", reply)
+	}
+
+	// An ambiguous prefix lists the candidates
+	if reply := converse(t, fake, "/wake remote"); reply != "🤔 'remote' matches several servers: remote-up, remote-down" {
+		t.Errorf("/wake of an ambiguous prefix: %s", reply)
+	}
+
+	// A typo gets a button that runs the command for the closest server
+	if reply := converse(t, fake, "/wake remotedown"); reply != "❌ Server 'remotedown' not found. Did you mean remote-down?" {
+		t.Errorf("/wake with a typo: %s", reply)
+	}
+	count := len(fake.Messages())
+	if _, err := fake.PressButton(testAdminChat, "alice", "run:/wake remote-down"); err != nil {
+		t.Fatal(err)
+	}
+	messages, err := fake.WaitForMessages(count+1, 5*time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if reply := messages[count].Text; !strings.Contains(reply, "Magic packet sent to *remote-down*") {
+		t.Errorf("suggestion button: %s", reply)
+	}
+	if got := woken(); len(got) != 2 {
+		t.Errorf("relay woke %v", got)
+	}
+}
@@ -0,0 +1,58 @@
+package bot
+
+import (
+	"fmt"
+
+	"github.com/tsolodov/wot/config"
+)
+
+// LoadConfig reads a config file like config.Load and also checks the parts
+// only the bot knows: relay and peer certificates, notifiers, severities and
+// message templates.
+func LoadConfig(path string) (*config.Config, error) {
+	cfg, err := config.Load(path)
+	if err != nil {
+		return nil, err
+	}
+	if err := validateConfig(cfg); err != nil {
+		return nil, fmt.Errorf("invalid config: %w", err)
+	}
+	return cfg, nil
+}
+
+// validateConfig checks the parts of a config that would otherwise only fail
+// at runtime, so a bad edit is rejected before anything is applied.
+func validateConfig(cfg *config.Config) error {
+	if err := cfg.Validate(); err != nil {
+		return err
+	}
+	for i, relay := range cfg.Relays {
+		if _, err := NewRelayClient(relay); err != nil {
+			return fmt.Errorf("relays[%d]: %w", i, err)
+		}
+	}
+	for i, peer := range cfg.Peers {
+		if _, err := newSignedClient(peer.URL, peer.Secret, peer.CACert); err != nil {
+			return fmt.Errorf("peers[%d]: %w", i, err)
+		}
+	}
+	for i, nc := range cfg.Notifiers {
+		if _, err := newNotifier(nc); err != nil {
+			return fmt.Errorf("notifiers[%d]: %w", i, err)
+		}
+		for _, severity := range nc.Severities {
+			if _, err := parseSeverity(severity); err != nil {
+				return fmt.Errorf("notifiers[%d]: %w", i, err)
+			}
+		}
+	}
+	for _, severity := range cfg.Telegram.NotifySeverities {
+		if _, err := parseSeverity(severity); err != nil {
+			return fmt.Errorf("telegram.notify_severities: %w", err)
+		}
+	}
+	if _, _, err := parseMessages(cfg); err != nil {
+		return err
+	}
+	return nil
+}
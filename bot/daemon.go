@@ -0,0 +1,251 @@
+package bot
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+	"syscall"
+	"time"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+	"github.com/tsolodov/wot/config"
+	"github.com/tsolodov/wot/internal/logging"
+	"github.com/tsolodov/wot/monitor"
+)
+
+// Pending notifications and wakes get this long to complete on shutdown,
+// well within the 90 seconds systemd waits before killing the process
+const shutdownTimeout = 15 * time.Second
+
+// Daemon holds the running components and the currently active
+// configuration. The config pointer is swapped atomically on reload; a
+// *Config obtained from Config() is never modified afterwards.
+type Daemon struct {
+	configPath string
+	noTelegram bool
+	config     atomic.Pointer[config.Config]
+
+	network  *Network
+	monitor  *monitor.ServerMonitor
+	notifier *NotificationDispatcher
+	bridge   *MQTTBridge
+	peers    *PeerMonitor
+	messages *Messages
+	history  *History
+	host     *HostMonitor
+	audit    *AuditLog
+
+	suppressions *Suppressions
+
+	discovery discoveryResults
+
+	reloadMutex sync.Mutex
+	editMutex   sync.Mutex
+}
+
+func (d *Daemon) Config() *config.Config {
+	return d.config.Load()
+}
+
+// Run starts monitoring and every configured integration and returns after
+// a graceful shutdown on SIGTERM or SIGINT. Telegram is optional: without a
+// bot token the daemon runs with the remaining notifiers only, and when the
+// Bot API is unreachable notifications are queued until it comes back. Every
+// channel delivers through a durable queue so nothing is lost while a channel
+// is unreachable.
+func Run(cfg *config.Config, configPath string, noTelegram bool) {
+	ctx := shutdownSignals()
+	d := &Daemon{configPath: configPath, noTelegram: noTelegram}
+	d.config.Store(cfg)
+	d.network = NewNetwork()
+	if err := d.network.Configure(cfg); err != nil {
+		logging.Fatal("Failed to configure relays", "error", err)
+	}
+
+	var telegram *TelegramNotifier
+	if cfg.Telegram.BotToken != "" && cfg.Telegram.AdminChatID != 0 {
+		telegram = NewTelegramNotifier(cfg.Telegram.AdminChatID)
+		telegram.topic = d.telegramTopic
+	}
+
+	notifier, queues, err := buildNotifiers(cfg, telegram)
+	if err != nil {
+		logging.Fatal("Failed to configure notifiers", "error", err)
+	}
+	for _, queue := range queues {
+		queue.Start()
+	}
+	d.notifier = notifier
+
+	d.messages, err = NewMessages(cfg)
+	if err != nil {
+		logging.Fatal("Failed to configure messages", "error", err)
+	}
+	d.suppressions = NewSuppressions(filepath.Join(cfg.StateDirectory(), "suppressions.json"), cfg.Maintenance)
+	d.history = NewHistory(filepath.Join(cfg.StateDirectory(), "history.jsonl"))
+	d.audit = NewAuditLog(filepath.Join(cfg.StateDirectory(), "audit.jsonl"), cfg.AuditLimits())
+	d.monitor = monitor.New(context.Background(), cfg.Servers, cfg.Interval(), d.network)
+	d.monitor.Notifier = statusNotifier{notifier: notifier, messages: d.messages}
+	d.monitor.Recorder = d.history
+	d.monitor.Silencer = d.suppressions
+	d.host = NewHostMonitor(d.Config, notifier, d.messages)
+
+	marker := filepath.Join(cfg.StateDirectory(), "running")
+	unclean, err := markRunning(marker)
+	if err != nil {
+		slog.Error("Failed to write the running marker", "path", marker, "error", err)
+	}
+
+	if cfg.MQTT != nil && cfg.MQTT.Broker != "" {
+		d.bridge = NewMQTTBridge(cfg, d.monitor, d.network)
+		d.bridge.suppressions = d.suppressions
+		d.bridge.audit = d.audit
+		d.bridge.Start()
+	}
+
+	if len(cfg.Peers) > 0 {
+		d.peers, err = NewPeerMonitor(cfg.SiteName(), cfg.Peers, notifier)
+		if err != nil {
+			logging.Fatal("Failed to configure peers", "error", err)
+		}
+		d.peers.messages = d.messages
+	}
+
+	d.monitor.Start(ctx)
+	d.host.Start(ctx)
+	if cfg.Federation != nil {
+		d.startFederationServer(ctx, cfg.Federation)
+	}
+	if d.peers != nil {
+		d.peers.Start(ctx)
+	}
+	d.watchReloadTriggers(ctx)
+	go d.runReportSchedule(ctx)
+
+	now := time.Now()
+	started := startedMessage{
+		Uptime:   getSystemUptime(),
+		Servers:  len(cfg.Servers),
+		Interval: d.monitor.Interval(),
+		Time:     now,
+	}
+	uptime, _ := d.host.reader.uptime()
+	startupState(&started, unclean, uptime, d.history.PreviousStop(), now)
+
+	severity, title := SeverityInfo, "WoT Bot started"
+	if started.PowerLoss {
+		severity, title = SeverityWarning, "WoT Bot started after a power loss"
+	} else if started.UncleanShutdown {
+		severity, title = SeverityWarning, "WoT Bot restarted after an unclean shutdown"
+	}
+	if severity == SeverityWarning {
+		slog.Warn(title)
+	} else {
+		slog.Info(title)
+	}
+	markdown := d.messages.Render("started", started)
+	notifier.Dispatch(Notification{
+		Severity: severity,
+		Title:    title,
+		Message:  plainText(markdown),
+		Markdown: markdown,
+		Time:     d.messages.In(now),
+	})
+
+	// Monitoring goes on even if the bot is disabled or its update loop ends
+	telegramDone := make(chan struct{})
+	if cfg.Telegram.BotToken != "" {
+		// The Bot API library logs failed update polls itself
+		tgbotapi.SetLogger(slog.NewLogLogger(slog.Default().Handler(), slog.LevelWarn))
+		go func() {
+			defer close(telegramDone)
+			runTelegramBot(ctx, d, telegram)
+		}()
+	} else {
+		slog.Info("Telegram bot token not configured, running in daemon mode")
+		close(telegramDone)
+	}
+
+	<-ctx.Done()
+	d.shutdown(context.Cause(ctx).Error(), now, telegramDone, queues)
+	if err := os.Remove(marker); err != nil {
+		slog.Error("Failed to remove the running marker", "path", marker, "error", err)
+	}
+	slog.Info("Shutdown complete")
+}
+
+// shutdownSignals returns a context that is cancelled on SIGTERM or SIGINT,
+// with the name of the signal as its cause. A second signal exits at once
+// without waiting for the graceful shutdown.
+func shutdownSignals() context.Context {
+	ctx, cancel := context.WithCancelCause(context.Background())
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGTERM, syscall.SIGINT)
+	go func() {
+		name := "SIGTERM"
+		if <-signals == syscall.SIGINT {
+			name = "SIGINT"
+		}
+		slog.Info("Shutting down", "signal", name)
+		cancel(errors.New(name))
+
+		<-signals
+		slog.Warn("Received a second signal, exiting immediately")
+		os.Exit(1)
+	}()
+	return ctx
+}
+
+// shutdown stops the running components once the daemon's context is done.
+// Wakes in progress are finished and the command being handled gets to
+// reply, then a shutdown notification is sent and the queues are given
+// shutdownTimeout to deliver it along with anything else still pending.
+// Finally a clean stop is recorded, so that the next start can tell it apart
+// from a crash or a power loss.
+func (d *Daemon) shutdown(reason string, started time.Time, telegramDone <-chan struct{}, queues []*NotificationQueue) {
+	ctx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+	defer cancel()
+
+	d.monitor.Stop()
+	if d.bridge != nil {
+		d.bridge.Stop()
+	}
+	select {
+	case <-telegramDone:
+	case <-ctx.Done():
+		slog.Warn("Gave up waiting for the Telegram command in progress")
+	}
+	if err := d.network.Drain(ctx); err != nil {
+		slog.Warn("Gave up waiting for wakes in progress", "error", err)
+	}
+
+	now := time.Now()
+	markdown := d.messages.Render("stopping", stoppingMessage{Reason: reason, Ran: now.Sub(started), Time: now})
+	d.notifier.Dispatch(Notification{
+		Severity: SeverityInfo,
+		Title:    "WoT Bot shutting down",
+		Message:  plainText(markdown),
+		Markdown: markdown,
+		Time:     d.messages.In(now),
+	})
+
+	var wg sync.WaitGroup
+	for _, queue := range queues {
+		wg.Add(1)
+		go func(queue *NotificationQueue) {
+			defer wg.Done()
+			if err := queue.Flush(ctx); err != nil {
+				slog.Warn("Notifications left in the queue are sent after the next start", "error", err)
+			}
+			queue.Stop()
+		}(queue)
+	}
+	wg.Wait()
+
+	d.history.Add(HistoryEvent{Type: eventStop})
+}
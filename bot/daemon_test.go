@@ -0,0 +1,57 @@
+package bot
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/tsolodov/wot/config"
+)
+
+func TestDaemonShutdown(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "config.yaml")
+	writeTestConfig(t, path, `
+servers:
+  - name: nas
+    mac_address: "00:11:22:33:44:55"
+`)
+	d := newTestDaemon(t, path)
+	d.history = NewHistory(filepath.Join(dir, "history.jsonl"))
+
+	recorder := &recordingNotifier{name: "test"}
+	queue := NewNotificationQueue(recorder, "")
+	queue.Start()
+	d.notifier = NewNotificationDispatcher()
+	d.notifier.Add(queue, nil)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	d.monitor.Start(ctx)
+	cancel()
+
+	telegramDone := make(chan struct{})
+	close(telegramDone)
+	d.shutdown("SIGTERM", time.Now().Add(-time.Hour), telegramDone, []*NotificationQueue{queue})
+
+	// The shutdown notification has been delivered before shutdown returns
+	if recorder.count() != 1 {
+		t.Fatalf("Expected the shutdown notification, got %d", recorder.count())
+	}
+	if got := recorder.got[0].Markdown; !strings.Contains(got, "shutting down (SIGTERM)") || !strings.Contains(got, "Ran for 1h") {
+		t.Errorf("Unexpected shutdown notification: %s", got)
+	}
+
+	events := d.history.Events()
+	if len(events) == 0 || events[len(events)-1].Type != eventStop {
+		t.Errorf("Expected a clean stop to be recorded, got %+v", events)
+	}
+
+	// Wakes requested after the shutdown began are refused
+	server := config.Server{Name: "nas", MACAddress: "00:11:22:33:44:55"}
+	if err := d.network.Wake(context.Background(), server, "127.0.0.1"); !errors.Is(err, errShuttingDown) {
+		t.Errorf("Expected the wake to be refused, got %v", err)
+	}
+}
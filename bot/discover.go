@@ -0,0 +1,395 @@
+package bot
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"log/slog"
+	"net"
+	"net/netip"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"text/tabwriter"
+	"time"
+
+	"github.com/tsolodov/wot/config"
+	"github.com/tsolodov/wot/wol"
+)
+
+const (
+	procNetARP = "/proc/net/arp"
+
+	// Largest subnet a sweep will probe (a /20)
+	maxSweepHosts = 4096
+
+	sweepWorkers      = 64
+	sweepSettleDelay  = 2 * time.Second
+	reverseDNSTimeout = 2 * time.Second
+)
+
+// Neighbor is an entry of the kernel neighbour (ARP/NDP) table.
+type Neighbor struct {
+	IP        netip.Addr
+	MAC       net.HardwareAddr
+	Interface string
+}
+
+// DiscoveredHost is a host found on the local network. Server is the name of
+// the configured server with the same MAC address, or empty for a new host.
+type DiscoveredHost struct {
+	IP       netip.Addr
+	MAC      net.HardwareAddr
+	Hostname string
+	Server   string
+}
+
+// readNeighbors returns the complete entries of the kernel neighbour table.
+// Netlink is used where available; /proc/net/arp is the fallback.
+func readNeighbors() ([]Neighbor, error) {
+	neighbors, err := readNetlinkNeighbors()
+	if err == nil {
+		return neighbors, nil
+	}
+
+	file, procErr := os.Open(procNetARP)
+	if procErr != nil {
+		return nil, fmt.Errorf("failed to read neighbour table: %v (netlink: %v)", procErr, err)
+	}
+	defer file.Close()
+	return parseProcNetARP(file)
+}
+
+// parseProcNetARP parses the format of /proc/net/arp:
+//
+//	IP address       HW type     Flags       HW address            Mask     Device
+//	192.168.1.10     0x1         0x2         aa:bb:cc:dd:ee:01     *        eth0
+//
+// Incomplete entries (flags 0x0) are skipped.
+func parseProcNetARP(r io.Reader) ([]Neighbor, error) {
+	var neighbors []Neighbor
+	scanner := bufio.NewScanner(r)
+	header := true
+	for scanner.Scan() {
+		if header {
+			header = false
+			continue
+		}
+		fields := strings.Fields(scanner.Text())
+		if len(fields) < 6 {
+			continue
+		}
+		if fields[2] == "0x0" {
+			continue
+		}
+
+		ip, err := netip.ParseAddr(fields[0])
+		if err != nil {
+			continue
+		}
+		mac, err := net.ParseMAC(fields[3])
+		if err != nil || !usableMAC(mac) {
+			continue
+		}
+		neighbors = append(neighbors, Neighbor{IP: ip, MAC: mac, Interface: fields[5]})
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to parse neighbour table: %w", err)
+	}
+	return neighbors, nil
+}
+
+// usableMAC filters out empty, broadcast and multicast link-layer addresses.
+func usableMAC(mac net.HardwareAddr) bool {
+	if len(mac) != 6 {
+		return false
+	}
+	if bytes.Equal(mac, make(net.HardwareAddr, 6)) {
+		return false
+	}
+	return mac[0]&1 == 0
+}
+
+// sweepSubnet sends a small UDP datagram to every address in prefix so the
+// kernel resolves their MAC addresses and fills the neighbour table. Hosts do
+// not need to answer; the ARP exchange alone creates the entry.
+func sweepSubnet(ctx context.Context, prefix netip.Prefix) error {
+	prefix = prefix.Masked()
+	if !prefix.Addr().Is4() {
+		return fmt.Errorf("only IPv4 subnets can be swept")
+	}
+	if prefix.Bits() < 32-12 {
+		return fmt.Errorf("subnet %s is too large to sweep (maximum %d addresses)", prefix, maxSweepHosts)
+	}
+
+	addrs := make(chan netip.Addr)
+	var wg sync.WaitGroup
+	for i := 0; i < sweepWorkers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for addr := range addrs {
+				dialer := net.Dialer{Timeout: time.Second}
+				conn, err := dialer.DialContext(ctx, "udp4", netip.AddrPortFrom(addr, 9).String())
+				if err != nil {
+					continue
+				}
+				conn.Write([]byte{0})
+				conn.Close()
+			}
+		}()
+	}
+
+	for addr := prefix.Addr(); prefix.Contains(addr) && ctx.Err() == nil; addr = addr.Next() {
+		addrs <- addr
+	}
+	close(addrs)
+	wg.Wait()
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	// Give outstanding ARP replies time to arrive
+	time.Sleep(sweepSettleDelay)
+	return nil
+}
+
+// matchNeighbors turns neighbour entries into discovered hosts: one per MAC
+// address (preferring IPv4), limited to prefix if it is valid, and marked
+// with the configured server that has the same MAC.
+func matchNeighbors(neighbors []Neighbor, servers []config.Server, prefix netip.Prefix) []DiscoveredHost {
+	byMAC := make(map[string]*DiscoveredHost)
+	var hosts []*DiscoveredHost
+	for _, neighbor := range neighbors {
+		if prefix.IsValid() && !prefix.Contains(neighbor.IP) {
+			continue
+		}
+		key := neighbor.MAC.String()
+		if host, ok := byMAC[key]; ok {
+			if !host.IP.Is4() && neighbor.IP.Is4() {
+				host.IP = neighbor.IP
+			}
+			continue
+		}
+		host := &DiscoveredHost{IP: neighbor.IP, MAC: neighbor.MAC, Server: serverWithMAC(servers, neighbor.MAC)}
+		byMAC[key] = host
+		hosts = append(hosts, host)
+	}
+
+	result := make([]DiscoveredHost, 0, len(hosts))
+	for _, host := range hosts {
+		result = append(result, *host)
+	}
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].IP.Less(result[j].IP)
+	})
+	return result
+}
+
+// serverWithMAC returns the name of the configured server with the given MAC
+// address, or an empty string.
+func serverWithMAC(servers []config.Server, mac net.HardwareAddr) string {
+	for _, server := range servers {
+		if configured, err := wol.ParseMAC(server.MACAddress); err == nil && bytes.Equal(configured, mac) {
+			return server.Name
+		}
+	}
+	return ""
+}
+
+// resolveHostnames fills in reverse DNS names concurrently.
+func resolveHostnames(ctx context.Context, hosts []DiscoveredHost) {
+	var wg sync.WaitGroup
+	for i := range hosts {
+		wg.Add(1)
+		go func(host *DiscoveredHost) {
+			defer wg.Done()
+			ctx, cancel := context.WithTimeout(ctx, reverseDNSTimeout)
+			defer cancel()
+			names, err := net.DefaultResolver.LookupAddr(ctx, host.IP.String())
+			if err == nil && len(names) > 0 {
+				host.Hostname = strings.TrimSuffix(names[0], ".")
+			}
+		}(&hosts[i])
+	}
+	wg.Wait()
+}
+
+// discoverHosts reads the neighbour table, after sweeping cidr first if it is
+// not empty, and returns the hosts found with their reverse DNS names.
+func discoverHosts(ctx context.Context, servers []config.Server, cidr string) ([]DiscoveredHost, error) {
+	var prefix netip.Prefix
+	if cidr != "" {
+		var err error
+		prefix, err = netip.ParsePrefix(cidr)
+		if err != nil {
+			return nil, fmt.Errorf("invalid subnet '%s': %w", cidr, err)
+		}
+		if err := sweepSubnet(ctx, prefix); err != nil {
+			return nil, err
+		}
+	}
+
+	neighbors, err := readNeighbors()
+	if err != nil {
+		return nil, err
+	}
+
+	hosts := matchNeighbors(neighbors, servers, prefix)
+	resolveHostnames(ctx, hosts)
+	return hosts, nil
+}
+
+// suggestServerName derives a config name for a discovered host from its
+// hostname, or its IP address when it has none, avoiding existing names.
+func suggestServerName(host DiscoveredHost, servers []config.Server) string {
+	name := strings.ToLower(strings.SplitN(host.Hostname, ".", 2)[0])
+	if name == "" {
+		name = "host-" + strings.NewReplacer(".", "-", ":", "-").Replace(host.IP.String())
+	}
+
+	taken := make(map[string]bool)
+	for _, server := range servers {
+		taken[strings.ToLower(server.Name)] = true
+	}
+	candidate := name
+	for i := 2; taken[candidate]; i++ {
+		candidate = fmt.Sprintf("%s-%d", name, i)
+	}
+	return candidate
+}
+
+// discoveredServer returns the config entry for a discovered host.
+func discoveredServer(host DiscoveredHost, name string) config.Server {
+	return config.Server{Name: name, MACAddress: host.MAC.String(), IPAddress: host.IP.String()}
+}
+
+// discoveryResults keeps the hosts found by the last /discover so the add
+// buttons can refer to them by index.
+type discoveryResults struct {
+	mutex      sync.Mutex
+	generation int
+	hosts      []DiscoveredHost
+	running    bool
+}
+
+// Begin claims the right to run a discovery, which fails while another one
+// is still sweeping. Finish releases it.
+func (r *discoveryResults) Begin() bool {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	if r.running {
+		return false
+	}
+	r.running = true
+	return true
+}
+
+func (r *discoveryResults) Finish() {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	r.running = false
+}
+
+func (r *discoveryResults) Store(hosts []DiscoveredHost) int {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	r.generation++
+	r.hosts = hosts
+	return r.generation
+}
+
+// Get returns a host of the given discovery run; results of older runs are
+// no longer available.
+func (r *discoveryResults) Get(generation, index int) (DiscoveredHost, bool) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	if generation != r.generation || index < 0 || index >= len(r.hosts) {
+		return DiscoveredHost{}, false
+	}
+	return r.hosts[index], true
+}
+
+// RunDiscoverCommand implements "wot discover": list the hosts on the local
+// network and optionally add the unknown ones to the config file.
+func RunDiscoverCommand(args []string) error {
+	flags := flag.NewFlagSet("discover", flag.ExitOnError)
+	configFile := flags.String("config", "config.yaml", "Configuration file path")
+	cidr := flags.String("cidr", "", "Subnet to sweep before reading the neighbour table, e.g. 192.168.1.0/24")
+	add := flags.Bool("add", false, "Ask to add each new host to the configuration file")
+	flags.Parse(args)
+
+	var servers []config.Server
+	loaded, err := config.Load(*configFile)
+	if err != nil {
+		if *add {
+			return err
+		}
+		slog.Warn("Not comparing with configured servers", "error", err)
+	} else {
+		servers = loaded.Servers
+	}
+
+	if *cidr != "" {
+		fmt.Printf("Sweeping %s...\n", *cidr)
+	}
+	hosts, err := discoverHosts(context.Background(), servers, *cidr)
+	if err != nil {
+		return err
+	}
+	if len(hosts) == 0 {
+		fmt.Println("No hosts found in the neighbour table")
+		return nil
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "IP\tMAC\tHOSTNAME\tSERVER")
+	for _, host := range hosts {
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\n", host.IP, host.MAC, orDash(host.Hostname), orDash(host.Server))
+	}
+	w.Flush()
+
+	if !*add {
+		return nil
+	}
+
+	input := bufio.NewScanner(os.Stdin)
+	for _, host := range hosts {
+		if host.Server != "" {
+			continue
+		}
+		name := suggestServerName(host, servers)
+		fmt.Printf("Add %s (%s) as '%s'? [y/N/other name] ", host.IP, host.MAC, name)
+		if !input.Scan() {
+			break
+		}
+		answer := strings.TrimSpace(input.Text())
+		switch strings.ToLower(answer) {
+		case "", "n", "no":
+			continue
+		case "y", "yes":
+		default:
+			name = answer
+		}
+
+		server := discoveredServer(host, name)
+		if err := config.AddServer(*configFile, server); err != nil {
+			fmt.Printf("Not added: %v\n", err)
+			continue
+		}
+		servers = append(servers, server)
+		fmt.Printf("Added %s\n", name)
+	}
+	return nil
+}
+
+func orDash(value string) string {
+	if value == "" {
+		return "-"
+	}
+	return value
+}
@@ -0,0 +1,94 @@
+package bot
+
+import (
+	"encoding/binary"
+	"fmt"
+	"net"
+	"net/netip"
+	"syscall"
+)
+
+const (
+	ndmsgLen = 12
+
+	ndaDst    = 1
+	ndaLLAddr = 2
+
+	nudIncomplete = 0x01
+	nudFailed     = 0x20
+	nudNoARP      = 0x40
+)
+
+// readNetlinkNeighbors dumps the neighbour table with an RTM_GETNEIGH request.
+func readNetlinkNeighbors() ([]Neighbor, error) {
+	data, err := syscall.NetlinkRIB(syscall.RTM_GETNEIGH, syscall.AF_UNSPEC)
+	if err != nil {
+		return nil, fmt.Errorf("netlink neighbour dump failed: %w", err)
+	}
+
+	names := make(map[int]string)
+	if interfaces, err := net.Interfaces(); err == nil {
+		for _, iface := range interfaces {
+			names[iface.Index] = iface.Name
+		}
+	}
+	return parseNeighborMessages(data, names)
+}
+
+// parseNeighborMessages parses an RTM_NEWNEIGH dump. Each message is a
+// struct ndmsg followed by route attributes; names maps interface indexes to
+// interface names.
+func parseNeighborMessages(data []byte, names map[int]string) ([]Neighbor, error) {
+	messages, err := syscall.ParseNetlinkMessage(data)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse netlink messages: %w", err)
+	}
+
+	var neighbors []Neighbor
+	for _, message := range messages {
+		if message.Header.Type == syscall.NLMSG_DONE {
+			break
+		}
+		if message.Header.Type != syscall.RTM_NEWNEIGH || len(message.Data) < ndmsgLen {
+			continue
+		}
+
+		ifindex := int32(binary.NativeEndian.Uint32(message.Data[4:8]))
+		state := binary.NativeEndian.Uint16(message.Data[8:10])
+		if state&(nudIncomplete|nudFailed|nudNoARP) != 0 {
+			continue
+		}
+
+		var neighbor Neighbor
+		attrs := message.Data[ndmsgLen:]
+		for len(attrs) >= 4 {
+			length := int(binary.NativeEndian.Uint16(attrs[0:2]))
+			kind := binary.NativeEndian.Uint16(attrs[2:4])
+			if length < 4 || length > len(attrs) {
+				break
+			}
+			value := attrs[4:length]
+			switch kind {
+			case ndaDst:
+				if addr, ok := netip.AddrFromSlice(value); ok {
+					neighbor.IP = addr.Unmap()
+				}
+			case ndaLLAddr:
+				neighbor.MAC = net.HardwareAddr(append([]byte(nil), value...))
+			}
+
+			aligned := (length + 3) &^ 3
+			if aligned > len(attrs) {
+				break
+			}
+			attrs = attrs[aligned:]
+		}
+
+		if !neighbor.IP.IsValid() || !usableMAC(neighbor.MAC) {
+			continue
+		}
+		neighbor.Interface = names[int(ifindex)]
+		neighbors = append(neighbors, neighbor)
+	}
+	return neighbors, nil
+}
@@ -0,0 +1,60 @@
+package bot
+
+import (
+	"encoding/binary"
+	"syscall"
+	"testing"
+)
+
+// neighborMessage builds an RTM_NEWNEIGH message as the kernel sends it.
+func neighborMessage(family uint8, ifindex int32, state uint16, ip, mac []byte) []byte {
+	attr := func(kind uint16, value []byte) []byte {
+		b := make([]byte, 4, 4+len(value)+3)
+		binary.NativeEndian.PutUint16(b[0:2], uint16(4+len(value)))
+		binary.NativeEndian.PutUint16(b[2:4], kind)
+		b = append(b, value...)
+		for len(b)%4 != 0 {
+			b = append(b, 0)
+		}
+		return b
+	}
+
+	body := make([]byte, ndmsgLen)
+	body[0] = family
+	binary.NativeEndian.PutUint32(body[4:8], uint32(ifindex))
+	binary.NativeEndian.PutUint16(body[8:10], state)
+	body = append(body, attr(ndaDst, ip)...)
+	if mac != nil {
+		body = append(body, attr(ndaLLAddr, mac)...)
+	}
+
+	header := make([]byte, syscall.NLMSG_HDRLEN)
+	binary.NativeEndian.PutUint32(header[0:4], uint32(len(header)+len(body)))
+	binary.NativeEndian.PutUint16(header[4:6], syscall.RTM_NEWNEIGH)
+	return append(header, body...)
+}
+
+func TestParseNeighborMessages(t *testing.T) {
+	mac := []byte{0xaa, 0xbb, 0xcc, 0xdd, 0xee, 0x01}
+	var data []byte
+	data = append(data, neighborMessage(syscall.AF_INET, 2, 0x02, []byte{192, 168, 1, 10}, mac)...)
+	// Incomplete and failed entries
+	data = append(data, neighborMessage(syscall.AF_INET, 2, nudIncomplete, []byte{192, 168, 1, 11}, nil)...)
+	data = append(data, neighborMessage(syscall.AF_INET, 2, nudFailed, []byte{192, 168, 1, 12}, mac)...)
+	ipv6 := []byte{0xfe, 0x80, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 1}
+	data = append(data, neighborMessage(syscall.AF_INET6, 3, 0x04, ipv6, []byte{0xaa, 0xbb, 0xcc, 0xdd, 0xee, 0x02})...)
+
+	neighbors, err := parseNeighborMessages(data, map[int]string{2: "eth0", 3: "wlan0"})
+	if err != nil {
+		t.Fatalf("parseNeighborMessages: %v", err)
+	}
+	if len(neighbors) != 2 {
+		t.Fatalf("expected 2 neighbours, got %+v", neighbors)
+	}
+	if neighbors[0].IP.String() != "192.168.1.10" || neighbors[0].MAC.String() != "aa:bb:cc:dd:ee:01" || neighbors[0].Interface != "eth0" {
+		t.Errorf("unexpected IPv4 neighbour: %+v", neighbors[0])
+	}
+	if neighbors[1].IP.String() != "fe80::1" || neighbors[1].Interface != "wlan0" {
+		t.Errorf("unexpected IPv6 neighbour: %+v", neighbors[1])
+	}
+}
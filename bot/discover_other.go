@@ -0,0 +1,9 @@
+//go:build !linux
+
+package bot
+
+import "errors"
+
+func readNetlinkNeighbors() ([]Neighbor, error) {
+	return nil, errors.New("netlink is only available on Linux")
+}
@@ -0,0 +1,136 @@
+package bot
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/netip"
+	"os"
+	"strings"
+	"testing"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+	"github.com/tsolodov/wot/config"
+)
+
+func TestParseProcNetARP(t *testing.T) {
+	file, err := os.Open("testdata/proc_net_arp")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+
+	neighbors, err := parseProcNetARP(file)
+	if err != nil {
+		t.Fatalf("parseProcNetARP: %v", err)
+	}
+
+	want := []struct{ ip, mac, iface string }{
+		{"192.168.1.10", "aa:bb:cc:dd:ee:01", "eth0"},
+		{"192.168.1.20", "aa:bb:cc:dd:ee:02", "eth0"},
+		{"192.168.1.40", "aa:bb:cc:dd:ee:04", "wlan0"},
+		{"10.0.0.1", "aa:bb:cc:dd:ee:05", "eth1"},
+	}
+	if len(neighbors) != len(want) {
+		t.Fatalf("expected %d neighbours, got %+v", len(want), neighbors)
+	}
+	for i, w := range want {
+		n := neighbors[i]
+		if n.IP.String() != w.ip || n.MAC.String() != w.mac || n.Interface != w.iface {
+			t.Errorf("neighbour %d: got %s %s %s, want %s %s %s", i, n.IP, n.MAC, n.Interface, w.ip, w.mac, w.iface)
+		}
+	}
+}
+
+func TestMatchNeighbors(t *testing.T) {
+	mac := func(s string) net.HardwareAddr {
+		m, _ := net.ParseMAC(s)
+		return m
+	}
+	neighbors := []Neighbor{
+		{IP: netip.MustParseAddr("192.168.1.20"), MAC: mac("aa:bb:cc:dd:ee:02")},
+		{IP: netip.MustParseAddr("fe80::1"), MAC: mac("aa:bb:cc:dd:ee:01")},
+		{IP: netip.MustParseAddr("192.168.1.10"), MAC: mac("aa:bb:cc:dd:ee:01")},
+		{IP: netip.MustParseAddr("10.0.0.1"), MAC: mac("aa:bb:cc:dd:ee:05")},
+	}
+	servers := []config.Server{{Name: "nas", MACAddress: "AA-BB-CC-DD-EE-01"}}
+
+	hosts := matchNeighbors(neighbors, servers, netip.Prefix{})
+	if len(hosts) != 3 {
+		t.Fatalf("expected one host per MAC, got %+v", hosts)
+	}
+	if hosts[0].IP.String() != "10.0.0.1" || hosts[1].IP.String() != "192.168.1.10" {
+		t.Errorf("hosts not sorted by IP or IPv4 not preferred: %+v", hosts)
+	}
+	if hosts[1].Server != "nas" || hosts[2].Server != "" {
+		t.Errorf("configured server not matched by MAC: %+v", hosts)
+	}
+
+	hosts = matchNeighbors(neighbors, servers, netip.MustParsePrefix("192.168.1.0/24"))
+	if len(hosts) != 2 {
+		t.Errorf("subnet filter not applied: %+v", hosts)
+	}
+}
+
+func TestSuggestServerName(t *testing.T) {
+	servers := []config.Server{{Name: "NAS"}, {Name: "host-192-168-1-30"}}
+	tests := []struct {
+		host DiscoveredHost
+		want string
+	}{
+		{DiscoveredHost{Hostname: "Desktop.lan", IP: netip.MustParseAddr("192.168.1.10")}, "desktop"},
+		{DiscoveredHost{Hostname: "nas.local", IP: netip.MustParseAddr("192.168.1.20")}, "nas-2"},
+		{DiscoveredHost{IP: netip.MustParseAddr("192.168.1.30")}, "host-192-168-1-30-2"},
+		{DiscoveredHost{IP: netip.MustParseAddr("192.168.1.40")}, "host-192-168-1-40"},
+	}
+	for _, tt := range tests {
+		if got := suggestServerName(tt.host, servers); got != tt.want {
+			t.Errorf("suggestServerName(%+v) = %q, want %q", tt.host, got, tt.want)
+		}
+	}
+}
+
+func TestSweepSubnetRejectsLargeSubnets(t *testing.T) {
+	for _, cidr := range []string{"10.0.0.0/8", "192.168.0.0/16", "fd00::/120"} {
+		if err := sweepSubnet(context.Background(), netip.MustParsePrefix(cidr)); err == nil {
+			t.Errorf("expected %s to be rejected", cidr)
+		}
+	}
+}
+
+func TestDiscoveryMessages(t *testing.T) {
+	var hosts []DiscoveredHost
+	for i := 0; i < 200; i++ {
+		hosts = append(hosts, DiscoveredHost{
+			IP:       netip.AddrFrom4([4]byte{192, 168, byte(i / 250), byte(i % 250)}),
+			MAC:      net.HardwareAddr{0xaa, 0xbb, 0xcc, 0xdd, byte(i / 256), byte(i)},
+			Hostname: fmt.Sprintf("%s-%d.lan", strings.Repeat("very-long-hostname", 8), i),
+		})
+	}
+	hosts[0].Server = "k8s_master"
+
+	messages := discoveryMessages(testAdminChat, hosts, nil, 3)
+	if len(messages) < 2 {
+		t.Fatalf("expected the list to be split, got %d message", len(messages))
+	}
+	buttons := make(map[string]bool)
+	for i, msg := range messages {
+		if len(msg.Text) > 4096 || !strings.Contains(msg.Text, fmt.Sprintf("(%d/%d)", i+1, len(messages))) {
+			t.Errorf("message %d has %d bytes: %.80s", i, len(msg.Text), msg.Text)
+		}
+		keyboard, _ := msg.ReplyMarkup.(tgbotapi.InlineKeyboardMarkup)
+		if len(keyboard.InlineKeyboard) > discoverHostsPerMessage {
+			t.Errorf("message %d has %d buttons", i, len(keyboard.InlineKeyboard))
+		}
+		for _, row := range keyboard.InlineKeyboard {
+			buttons[*row[0].CallbackData] = true
+		}
+	}
+	if !strings.Contains(messages[0].Text, `→ k8s\_master`) {
+		t.Errorf("server name not escaped: %.300s", messages[0].Text)
+	}
+	// Every new host keeps its index into the stored results
+	if len(buttons) != 199 || !buttons["discover:3:1"] || !buttons["discover:3:199"] {
+		t.Errorf("got %d add buttons", len(buttons))
+	}
+}
@@ -0,0 +1,86 @@
+package bot
+
+import (
+	"bufio"
+	"flag"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/tsolodov/wot/internal/telegramtest"
+)
+
+// RunFakeTelegramCommand implements "wot fake-telegram": serve a fake Bot
+// API on this machine and chat with a locally running bot from the
+// terminal. Every line read from stdin is sent as a message from the chat;
+// "press DATA" presses the inline button with that callback data.
+func RunFakeTelegramCommand(args []string) error {
+	flags := flag.NewFlagSet("fake-telegram", flag.ExitOnError)
+	listen := flags.String("listen", "127.0.0.1:8081", "Address to serve the fake Bot API on")
+	chatID := flags.Int64("chat", 1, "Chat ID the messages come from (use it as admin_chat_id)")
+	user := flags.String("user", "developer", "Telegram user name of the sender")
+	flags.Parse(args)
+
+	fake := telegramtest.NewServer("")
+	fake.OnMessage = func(message telegramtest.Message) {
+		fmt.Print(formatFakeMessage(message))
+	}
+
+	server := &http.Server{Addr: *listen, Handler: fake, ReadHeaderTimeout: 10 * time.Second}
+	errs := make(chan error, 1)
+	go func() { errs <- server.ListenAndServe() }()
+
+	fmt.Printf("Fake Telegram Bot API on http://%s\n", *listen)
+	fmt.Printf("Run WoT with telegram.api_endpoint: http://%s, admin_chat_id: %d and any bot_token.\n", *listen, *chatID)
+	fmt.Println(`Type commands such as /status; "press DATA" presses a button. Ctrl+D exits.`)
+
+	lines := make(chan string)
+	go func() {
+		scanner := bufio.NewScanner(os.Stdin)
+		for scanner.Scan() {
+			lines <- scanner.Text()
+		}
+		close(lines)
+	}()
+
+	for {
+		select {
+		case err := <-errs:
+			return err
+		case line, ok := <-lines:
+			if !ok {
+				fake.Close()
+				return server.Close()
+			}
+			line = strings.TrimSpace(line)
+			if line == "" {
+				continue
+			}
+			if data, ok := strings.CutPrefix(line, "press "); ok {
+				if _, err := fake.PressButton(*chatID, *user, strings.TrimSpace(data)); err != nil {
+					slog.Error("Failed to press button", "error", err)
+				}
+				continue
+			}
+			fake.SendText(*chatID, *user, line)
+		}
+	}
+}
+
+// formatFakeMessage shows a message from the bot with its buttons.
+func formatFakeMessage(message telegramtest.Message) string {
+	var text strings.Builder
+	if message.Edits > 0 {
+		text.WriteString("(edited) ")
+	}
+	text.WriteString(fmt.Sprintf("[chat %d] %s\n", message.ChatID, message.Text))
+	for _, row := range message.Buttons {
+		for _, button := range row {
+			text.WriteString(fmt.Sprintf("  [%s] press %s\n", button.Text, button.Data))
+		}
+	}
+	return text.String()
+}
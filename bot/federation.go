@@ -0,0 +1,371 @@
+package bot
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/tsolodov/wot/config"
+)
+
+const (
+	federationStatusPath = "/v1/site/status"
+	federationWakePath   = "/v1/site/wake"
+
+	peerPollInterval = time.Minute
+	// In-flight federation requests get this long to finish on shutdown
+	federationShutdownTimeout = 5 * time.Second
+	// A site is reported offline after this many failed polls in a row
+	peerOfflineAfter = 3
+)
+
+type siteServerStatus struct {
+	Name        string    `json:"name"`
+	Address     string    `json:"address,omitempty"`
+	Up          bool      `json:"up"`
+	Unknown     bool      `json:"unknown,omitempty"`
+	LastChanged time.Time `json:"last_changed"`
+}
+
+type siteStatusResponse struct {
+	Site    string             `json:"site"`
+	Servers []siteServerStatus `json:"servers"`
+}
+
+type siteWakeRequest struct {
+	Server string `json:"server"`
+	Check  bool   `json:"check"`
+	From   string `json:"from"`
+}
+
+type siteWakeResponse struct {
+	Server string `json:"server"`
+	Result string `json:"result"`
+}
+
+const (
+	siteWakeSent      = "woken"
+	siteWakeAlreadyUp = "already_up"
+)
+
+// federationHandler serves the signed federation API of a peer instance.
+func (d *Daemon) federationHandler(secret string) http.Handler {
+	verifier := newSignatureVerifier(secret)
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, ok := readSignedRequest(w, r, verifier)
+		if !ok {
+			return
+		}
+
+		switch r.URL.Path {
+		case federationStatusPath:
+			writeRelayJSON(w, d.siteStatus())
+		case federationWakePath:
+			var request siteWakeRequest
+			err := json.Unmarshal(body, &request)
+			if err != nil {
+				writeRelayError(w, http.StatusBadRequest, "invalid request")
+				return
+			}
+			command := "wake"
+			if request.Check {
+				command = "checkwake"
+			}
+			var response siteWakeResponse
+			var status int
+			entry := AuditEntry{Source: auditSourceFederation, Username: "site " + request.From, Command: command + " " + request.Server}
+			d.audited(r.Context(), entry, func(ctx context.Context) {
+				response, status, err = d.wakeForPeer(ctx, request)
+				auditTarget(ctx, response.Server, err)
+			})
+			if err != nil {
+				writeRelayError(w, status, err.Error())
+				return
+			}
+			writeRelayJSON(w, response)
+		default:
+			writeRelayError(w, http.StatusNotFound, "not found")
+		}
+	})
+}
+
+func (d *Daemon) siteStatus() siteStatusResponse {
+	cfg := d.Config()
+	states := d.monitor.GetServerStates()
+
+	response := siteStatusResponse{Site: cfg.SiteName(), Servers: []siteServerStatus{}}
+	for _, server := range cfg.Servers {
+		status := siteServerStatus{Name: server.Name}
+		if state, ok := states[server.Name]; ok {
+			status.Address = server.DisplayAddress(state.Address)
+			status.Up = state.IsUp
+			status.Unknown = state.Unknown
+			status.LastChanged = state.LastChanged
+		}
+		response.Servers = append(response.Servers, status)
+	}
+	return response
+}
+
+func (d *Daemon) wakeForPeer(ctx context.Context, request siteWakeRequest) (siteWakeResponse, int, error) {
+	cfg := d.Config()
+	// Peers may use aliases and unique prefixes, like the chat commands
+	match := config.MatchServer(cfg.Servers, request.Server)
+	server := match.Server
+	if match.Ambiguous {
+		return siteWakeResponse{}, http.StatusNotFound, fmt.Errorf("'%s' matches several servers at site %s", request.Server, cfg.SiteName())
+	}
+	if server == nil {
+		return siteWakeResponse{}, http.StatusNotFound, fmt.Errorf("server '%s' not found at site %s", request.Server, cfg.SiteName())
+	}
+
+	response := siteWakeResponse{Server: server.Name}
+	if maintenance, ok := d.suppressions.InMaintenance(server.Name); ok {
+		return response, http.StatusConflict, fmt.Errorf("%s is in maintenance until %s", server.Name, d.messages.Clock(maintenance.Until))
+	}
+	if request.Check && d.network.Up(ctx, *server) {
+		response.Result = siteWakeAlreadyUp
+		return response, 0, nil
+	}
+
+	slog.Info("Wake request from peer site", "server", server.Name, "site", request.From)
+	err := d.network.Wake(ctx, *server, cfg.BroadcastIP)
+	d.monitor.RecordWake(server.Name, "site "+request.From, err)
+	if err != nil {
+		return response, http.StatusBadGateway, err
+	}
+	response.Result = siteWakeSent
+
+	now := time.Now()
+	markdown := d.messages.Render("remote_wake", remoteWakeMessage{Server: server.Name, From: request.From, Time: now})
+	d.notifier.Dispatch(Notification{
+		Severity: SeverityInfo,
+		Title:    fmt.Sprintf("%s woken from site %s", server.Name, request.From),
+		Message:  plainText(markdown),
+		Markdown: markdown,
+		Server:   server.Name,
+		Time:     d.messages.In(now),
+	})
+	return response, 0, nil
+}
+
+// startFederationServer serves the federation API in the background until
+// ctx is done.
+func (d *Daemon) startFederationServer(ctx context.Context, cfg *config.FederationConfig) {
+	server := &http.Server{
+		Addr:              cfg.Listen,
+		Handler:           d.federationHandler(cfg.Secret),
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+
+	go func() {
+		var err error
+		if cfg.TLSCert != "" {
+			slog.Info("Federation API listening", "addr", cfg.Listen)
+			err = server.ListenAndServeTLS(cfg.TLSCert, cfg.TLSKey)
+		} else {
+			slog.Warn("Federation API listening without TLS; requests are signed but not encrypted", "addr", cfg.Listen)
+			err = server.ListenAndServe()
+		}
+		if err != http.ErrServerClosed {
+			slog.Error("Federation API stopped", "error", err)
+		}
+	}()
+	context.AfterFunc(ctx, func() {
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), federationShutdownTimeout)
+		defer cancel()
+		server.Shutdown(shutdownCtx)
+	})
+}
+
+// SiteSnapshot is the last known state of a peer site.
+type SiteSnapshot struct {
+	Name         string
+	Servers      []siteServerStatus
+	Online       bool
+	LastSeen     time.Time
+	OfflineSince time.Time
+	Error        string
+}
+
+type peerState struct {
+	name     string
+	client   *signedClient
+	snapshot SiteSnapshot
+	failures int
+	offline  bool
+}
+
+// PeerMonitor polls the peer sites of a primary instance and alerts when a
+// whole site goes offline, which usually means a power cut or an internet
+// outage there.
+type PeerMonitor struct {
+	site     string
+	notifier *NotificationDispatcher
+	messages *Messages
+	interval time.Duration
+	now      func() time.Time
+
+	mutex sync.RWMutex
+	peers []*peerState
+}
+
+func NewPeerMonitor(site string, peers []config.PeerConfig, notifier *NotificationDispatcher) (*PeerMonitor, error) {
+	pm := &PeerMonitor{
+		site:     site,
+		notifier: notifier,
+		interval: peerPollInterval,
+		now:      time.Now,
+	}
+	for _, peer := range peers {
+		client, err := newSignedClient(peer.URL, peer.Secret, peer.CACert)
+		if err != nil {
+			return nil, fmt.Errorf("peer '%s': %w", peer.Name, err)
+		}
+		pm.peers = append(pm.peers, &peerState{name: peer.Name, client: client, snapshot: SiteSnapshot{Name: peer.Name}})
+	}
+	return pm, nil
+}
+
+// Start polls the peer sites in the background until ctx is done.
+func (pm *PeerMonitor) Start(ctx context.Context) {
+	slog.Info("Polling peer sites", "count", len(pm.peers), "interval", pm.interval)
+	go func() {
+		pm.pollAll(ctx)
+		ticker := time.NewTicker(pm.interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				pm.pollAll(ctx)
+			}
+		}
+	}()
+}
+
+func (pm *PeerMonitor) pollAll(ctx context.Context) {
+	var wg sync.WaitGroup
+	for _, peer := range pm.peers {
+		wg.Add(1)
+		go func(peer *peerState) {
+			defer wg.Done()
+			pm.poll(ctx, peer)
+		}(peer)
+	}
+	wg.Wait()
+}
+
+func (pm *PeerMonitor) poll(ctx context.Context, peer *peerState) {
+	var status siteStatusResponse
+	err := peer.client.do(ctx, federationStatusPath, struct{}{}, &status)
+	if ctx.Err() != nil {
+		// A poll cut short by shutdown says nothing about the site
+		return
+	}
+	now := pm.now()
+
+	pm.mutex.Lock()
+	defer pm.mutex.Unlock()
+
+	if err != nil {
+		peer.failures++
+		peer.snapshot.Error = err.Error()
+		if peer.failures < peerOfflineAfter || peer.offline {
+			return
+		}
+		peer.offline = true
+		peer.snapshot.Online = false
+		peer.snapshot.OfflineSince = now
+		if !peer.snapshot.LastSeen.IsZero() {
+			peer.snapshot.OfflineSince = peer.snapshot.LastSeen
+		}
+		slog.Warn("Site is offline", "site", peer.name, "error", err)
+		markdown := pm.messages.Render("site_offline", siteMessage{Site: peer.name, Since: peer.snapshot.OfflineSince, Time: now})
+		pm.notifier.Dispatch(Notification{
+			Severity: SeverityCritical,
+			Title:    fmt.Sprintf("Site %s is offline", peer.name),
+			Message:  plainText(markdown),
+			Markdown: markdown,
+			Status:   "SITE DOWN",
+			Server:   "site " + peer.name,
+			Time:     pm.messages.In(now),
+		})
+		return
+	}
+
+	wasOffline := peer.offline
+	offlineSince := peer.snapshot.OfflineSince
+	peer.failures = 0
+	peer.offline = false
+	peer.snapshot = SiteSnapshot{Name: peer.name, Servers: status.Servers, Online: true, LastSeen: now}
+
+	if wasOffline {
+		downtime := now.Sub(offlineSince).Round(time.Minute)
+		slog.Info("Site is back online", "site", peer.name, "downtime", downtime)
+		markdown := pm.messages.Render("site_online", siteMessage{Site: peer.name, Since: offlineSince, Downtime: downtime, Time: now})
+		pm.notifier.Dispatch(Notification{
+			Severity: SeverityInfo,
+			Title:    fmt.Sprintf("Site %s is back online", peer.name),
+			Message:  plainText(markdown),
+			Markdown: markdown,
+			Status:   "SITE UP",
+			Server:   "site " + peer.name,
+			Time:     pm.messages.In(now),
+		})
+	}
+}
+
+// Sites returns the last known state of every peer site.
+func (pm *PeerMonitor) Sites() []SiteSnapshot {
+	pm.mutex.RLock()
+	defer pm.mutex.RUnlock()
+
+	sites := make([]SiteSnapshot, 0, len(pm.peers))
+	for _, peer := range pm.peers {
+		snapshot := peer.snapshot
+		snapshot.Servers = append([]siteServerStatus(nil), snapshot.Servers...)
+		sort.Slice(snapshot.Servers, func(i, j int) bool {
+			return snapshot.Servers[i].Name < snapshot.Servers[j].Name
+		})
+		sites = append(sites, snapshot)
+	}
+	return sites
+}
+
+// HasSite reports whether name is one of the peer sites.
+func (pm *PeerMonitor) HasSite(name string) bool {
+	return pm.peer(name) != nil
+}
+
+func (pm *PeerMonitor) peer(name string) *peerState {
+	for _, peer := range pm.peers {
+		if strings.EqualFold(peer.name, name) {
+			return peer
+		}
+	}
+	return nil
+}
+
+// Wake forwards a wake request to the peer site that owns the server. With
+// check set the peer only wakes the server if it is down.
+func (pm *PeerMonitor) Wake(ctx context.Context, site, server string, check bool) (siteWakeResponse, error) {
+	peer := pm.peer(site)
+	if peer == nil {
+		return siteWakeResponse{}, fmt.Errorf("unknown site '%s'", site)
+	}
+
+	var response siteWakeResponse
+	request := siteWakeRequest{Server: server, Check: check, From: pm.site}
+	if err := peer.client.do(ctx, federationWakePath, request, &response); err != nil {
+		return siteWakeResponse{}, fmt.Errorf("site %s: %w", peer.name, err)
+	}
+	return response, nil
+}
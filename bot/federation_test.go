@@ -0,0 +1,182 @@
+package bot
+
+import (
+	"context"
+	"encoding/pem"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/tsolodov/wot/config"
+)
+
+// startTestSite runs the federation API of a peer instance over TLS. The
+// returned switch makes the site look offline.
+func startTestSite(t *testing.T, secret string) (*Daemon, *recordingNotifier, config.PeerConfig, *atomic.Bool) {
+	t.Helper()
+
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	writeTestConfig(t, path, `
+site: cottage
+broadcast_ip: 127.0.0.1
+servers:
+  - name: nas
+    mac_address: "aa:bb:cc:dd:ee:01"
+    ip_address: 127.0.0.1
+    tcp_ports: [1]
+  - name: pump
+    mac_address: "aa:bb:cc:dd:ee:02"
+    host: pump.local
+`)
+	d := newTestDaemon(t, path, "nas")
+
+	recorder := &recordingNotifier{name: "peer"}
+	d.notifier = NewNotificationDispatcher()
+	d.notifier.Add(recorder, nil)
+
+	offline := &atomic.Bool{}
+	handler := d.federationHandler(secret)
+	ts := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if offline.Load() {
+			http.Error(w, "no power", http.StatusServiceUnavailable)
+			return
+		}
+		handler.ServeHTTP(w, r)
+	}))
+	t.Cleanup(ts.Close)
+
+	caFile := filepath.Join(t.TempDir(), "site-ca.pem")
+	certPEM := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: ts.Certificate().Raw})
+	if err := os.WriteFile(caFile, certPEM, 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	return d, recorder, config.PeerConfig{Name: "cottage", URL: ts.URL, Secret: secret, CACert: caFile}, offline
+}
+
+func TestFederationStatusAndWake(t *testing.T) {
+	_, peerRecorder, peer, _ := startTestSite(t, "correct horse battery staple")
+
+	pm, err := NewPeerMonitor("home", []config.PeerConfig{peer}, nil)
+	if err != nil {
+		t.Fatalf("NewPeerMonitor: %v", err)
+	}
+	pm.pollAll(context.Background())
+
+	sites := pm.Sites()
+	if len(sites) != 1 || !sites[0].Online {
+		t.Fatalf("site not online: %+v", sites)
+	}
+	servers := sites[0].Servers
+	if len(servers) != 2 || servers[0].Name != "nas" || !servers[0].Up || servers[0].Address != "127.0.0.1" {
+		t.Errorf("unexpected servers: %+v", servers)
+	}
+	if servers[1].Name != "pump" || !servers[1].Unknown || servers[1].Address != "pump.local" {
+		t.Errorf("unexpected servers: %+v", servers)
+	}
+
+	// 127.0.0.1 answers, so a checked wake leaves it alone
+	response, err := pm.Wake(context.Background(), "cottage", "nas", true)
+	if err != nil || response.Result != siteWakeAlreadyUp {
+		t.Fatalf("expected already up, got %+v, %v", response, err)
+	}
+
+	response, err = pm.Wake(context.Background(), "Cottage", "NAS", false)
+	if err != nil {
+		t.Fatalf("Wake: %v", err)
+	}
+	if response.Server != "nas" || response.Result != siteWakeSent {
+		t.Errorf("unexpected response: %+v", response)
+	}
+	if peerRecorder.count() != 1 || !strings.Contains(peerRecorder.got[0].Markdown, "site *home*") {
+		t.Errorf("peer did not announce the remote wake: %+v", peerRecorder.got)
+	}
+
+	if _, err := pm.Wake(context.Background(), "cottage", "printer", false); err == nil || !strings.Contains(err.Error(), "not found") {
+		t.Errorf("expected not found error, got %v", err)
+	}
+	if _, err := pm.Wake(context.Background(), "beach", "nas", false); err == nil {
+		t.Error("expected error for unknown site")
+	}
+
+	wrongSecret := peer
+	wrongSecret.Secret = "not the right secret at all"
+	other, err := NewPeerMonitor("home", []config.PeerConfig{wrongSecret}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := other.Wake(context.Background(), "cottage", "nas", false); err == nil {
+		t.Error("expected a request with the wrong secret to be rejected")
+	}
+}
+
+func TestPeerMonitorSiteOffline(t *testing.T) {
+	_, _, peer, offline := startTestSite(t, "correct horse battery staple")
+
+	recorder := &recordingNotifier{name: "primary"}
+	dispatcher := NewNotificationDispatcher()
+	dispatcher.Add(recorder, nil)
+
+	pm, err := NewPeerMonitor("home", []config.PeerConfig{peer}, dispatcher)
+	if err != nil {
+		t.Fatalf("NewPeerMonitor: %v", err)
+	}
+	now := time.Date(2024, 5, 1, 10, 0, 0, 0, time.UTC)
+	pm.now = func() time.Time { return now }
+
+	pm.pollAll(context.Background())
+	lastSeen := now
+
+	offline.Store(true)
+	for i := 0; i < peerOfflineAfter+2; i++ {
+		now = now.Add(time.Minute)
+		pm.pollAll(context.Background())
+		if i < peerOfflineAfter-1 && recorder.count() != 0 {
+			t.Fatalf("alert after %d failed polls", i+1)
+		}
+	}
+	if recorder.count() != 1 {
+		t.Fatalf("expected one offline alert, got %d", recorder.count())
+	}
+	alert := recorder.got[0]
+	if alert.Severity != SeverityCritical || alert.Status != "SITE DOWN" {
+		t.Errorf("unexpected alert: %+v", alert)
+	}
+
+	site := pm.Sites()[0]
+	if site.Online || !site.OfflineSince.Equal(lastSeen) || len(site.Servers) != 2 {
+		t.Errorf("unexpected offline snapshot: %+v", site)
+	}
+
+	offline.Store(false)
+	now = now.Add(time.Minute)
+	pm.pollAll(context.Background())
+	if recorder.count() != 2 {
+		t.Fatalf("expected a recovery notification, got %d", recorder.count())
+	}
+	recovered := recorder.got[1]
+	if recovered.Severity != SeverityInfo || !strings.Contains(recovered.Markdown, "Offline for 6m") {
+		t.Errorf("unexpected recovery notification: %+v", recovered)
+	}
+	if !pm.Sites()[0].Online {
+		t.Error("site not online after recovery")
+	}
+}
+
+func TestSplitSiteTarget(t *testing.T) {
+	site, server, ok := splitSiteTarget("/wake cottage/nas")
+	if !ok || site != "cottage" || server != "nas" {
+		t.Errorf("got %q %q %v", site, server, ok)
+	}
+	if isSiteWakeCommand("/wake nas") || isSiteWakeCommand("/status") {
+		t.Error("local commands treated as site commands")
+	}
+	if !isSiteWakeCommand("/checkwake cottage/nas") {
+		t.Error("/checkwake site/server not recognised")
+	}
+}
@@ -0,0 +1,136 @@
+package bot
+
+import (
+	"encoding/json"
+	"log/slog"
+	"strings"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+	"github.com/tsolodov/wot/config"
+)
+
+// isGroupChat reports whether chat is a group or supergroup.
+func isGroupChat(chat *tgbotapi.Chat) bool {
+	return chat != nil && (chat.IsGroup() || chat.IsSuperGroup())
+}
+
+// parseCommand returns the lowercased text of message with the "@botname"
+// suffix of its command entity removed, so "/status@WotBot" reads as
+// "/status". It reports false for commands addressed to another bot and, in
+// groups, for messages that are not commands.
+func parseCommand(message *tgbotapi.Message, botName string) (string, bool) {
+	if !message.IsCommand() {
+		// Groups are full of chatter that is not meant for the bot
+		return strings.ToLower(strings.TrimSpace(message.Text)), !isGroupChat(message.Chat)
+	}
+
+	// Entity offsets count UTF-16 units, but commands are ASCII
+	length := min(message.Entities[0].Length, len(message.Text))
+	command, mention, _ := strings.Cut(message.Text[:length], "@")
+	if mention != "" && !strings.EqualFold(mention, botName) {
+		return "", false
+	}
+	return strings.ToLower(strings.TrimSpace(command + message.Text[length:])), true
+}
+
+// authorizedSender reports whether message comes from the admin chat and, if
+// allowed_users is set, from one of those users.
+func authorizedSender(cfg config.TelegramConfig, chat *tgbotapi.Chat, from *tgbotapi.User) bool {
+	if cfg.AdminChatID != 0 && (chat == nil || chat.ID != cfg.AdminChatID) {
+		return false
+	}
+	if len(cfg.AllowedUsers) > 0 && (from == nil || !cfg.UserAllowed(from.ID)) {
+		return false
+	}
+	return true
+}
+
+// adminDenial returns why user may not run admin commands in chat, or an
+// empty string if they may. A bot that answers everybody never runs them,
+// since anyone who finds it could rewrite the config.
+func adminDenial(cfg config.TelegramConfig, bot Messenger, chat *tgbotapi.Chat, user *tgbotapi.User) string {
+	if !cfg.Restricted() {
+		return "is disabled until telegram.admin_chat_id or telegram.allowed_users is set"
+	}
+	if !isChatAdmin(bot, chat, user) {
+		return "is only for group administrators"
+	}
+	return ""
+}
+
+// isChatAdmin reports whether user may run admin commands in chat. In a
+// group only its administrators may; Telegram is asked every time, so a
+// promotion or demotion applies at once. A private chat has a single user.
+func isChatAdmin(bot Messenger, chat *tgbotapi.Chat, user *tgbotapi.User) bool {
+	if !isGroupChat(chat) {
+		return true
+	}
+	if user == nil {
+		return false
+	}
+	resp, err := bot.Request(tgbotapi.GetChatMemberConfig{ChatConfigWithUser: tgbotapi.ChatConfigWithUser{ChatID: chat.ID, UserID: user.ID}})
+	if err != nil {
+		slog.Error("Failed to look up chat member", "chat_id", chat.ID, "user_id", user.ID, "error", err)
+		return false
+	}
+	var member tgbotapi.ChatMember
+	if err := json.Unmarshal(resp.Result, &member); err != nil {
+		slog.Error("Failed to parse chat member", "chat_id", chat.ID, "user_id", user.ID, "error", err)
+		return false
+	}
+	return member.IsAdministrator() || member.IsCreator()
+}
+
+// threadedReplies makes every message a handler sends to the chat of the
+// triggering message a reply to it. In a busy group the answer stays
+// attached to the command, and in a forum it lands in the same topic.
+type threadedReplies struct {
+	Messenger
+	message *tgbotapi.Message
+}
+
+func (t threadedReplies) Send(c tgbotapi.Chattable) (tgbotapi.Message, error) {
+	if msg, ok := c.(tgbotapi.MessageConfig); ok && msg.ChatID == t.message.Chat.ID && msg.ReplyToMessageID == 0 {
+		msg.ReplyToMessageID = t.message.MessageID
+		msg.AllowSendingWithoutReply = true
+		c = msg
+	}
+	return t.Messenger.Send(c)
+}
+
+// handleChatMembership leaves groups the bot is added to unless they are the
+// admin chat, so that nobody else can use it from their own group.
+func handleChatMembership(bot Messenger, update *tgbotapi.ChatMemberUpdated, d *Daemon) {
+	status := update.NewChatMember.Status
+	if status != "member" && status != "administrator" {
+		return
+	}
+	adminChat := d.Config().Telegram.AdminChatID
+	if adminChat == 0 || update.Chat.ID == adminChat || update.Chat.IsPrivate() {
+		slog.Info("Added to chat", "chat_id", update.Chat.ID, "chat", update.Chat.Title, "user", update.From.UserName)
+		return
+	}
+
+	slog.Warn("Leaving chat that is not the admin chat", "chat_id", update.Chat.ID, "chat", update.Chat.Title, "user", update.From.UserName, "user_id", update.From.ID)
+	if _, err := bot.Request(tgbotapi.LeaveChatConfig{ChatID: update.Chat.ID}); err != nil {
+		slog.Error("Failed to leave chat", "chat_id", update.Chat.ID, "error", err)
+	}
+}
+
+// sendToTopic posts msg in a forum topic of its chat. The Bot API library
+// predates forum topics, so the request is built by hand.
+func sendToTopic(bot Messenger, msg tgbotapi.MessageConfig, threadID int) error {
+	params := tgbotapi.Params{"text": msg.Text}
+	params.AddNonZero64("chat_id", msg.ChatID)
+	params.AddNonZero("message_thread_id", threadID)
+	params.AddNonEmpty("parse_mode", msg.ParseMode)
+	_, err := bot.MakeRequest("sendMessage", params)
+	return err
+}
+
+// telegramTopic returns the forum topic alerts about the named server go
+// to, following its group in the current config.
+func (d *Daemon) telegramTopic(server string) int {
+	cfg := d.Config()
+	return cfg.Telegram.TopicFor(config.FindServer(cfg.Servers, server))
+}
@@ -0,0 +1,146 @@
+package bot
+
+import (
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+	"github.com/tsolodov/wot/config"
+	"github.com/tsolodov/wot/internal/telegramtest"
+)
+
+func TestParseCommand(t *testing.T) {
+	private := &tgbotapi.Chat{ID: 1, Type: "private"}
+	group := &tgbotapi.Chat{ID: -1, Type: "supergroup"}
+	command := func(chat *tgbotapi.Chat, text string) *tgbotapi.Message {
+		message := &tgbotapi.Message{Chat: chat, Text: text}
+		if strings.HasPrefix(text, "/") {
+			name, _, _ := strings.Cut(text, " ")
+			message.Entities = []tgbotapi.MessageEntity{{Type: "bot_command", Length: len(name)}}
+		}
+		return message
+	}
+
+	tests := []struct {
+		message *tgbotapi.Message
+		command string
+		ok      bool
+	}{
+		{command(private, "/Status"), "/status", true},
+		{command(group, "/status@WotBot"), "/status", true},
+		{command(group, "/wake@wotbot NAS"), "/wake nas", true},
+		{command(group, "/wake@OtherBot nas"), "", false},
+		{command(group, "good morning"), "good morning", false},
+		{command(private, "good morning"), "good morning", true},
+	}
+	for _, test := range tests {
+		command, ok := parseCommand(test.message, "WotBot")
+		if command != test.command || ok != test.ok {
+			t.Errorf("parseCommand(%q) = %q, %v", test.message.Text, command, ok)
+		}
+	}
+}
+
+func TestTelegramGroupChat(t *testing.T) {
+	servers, woken := relayServers(t)
+	servers = strings.Replace(servers, "    relay: parents\n", "    relay: parents\n    group: media\n", 1)
+	_, fake, notifier := startTestBotWith(t, servers, "  allowed_users: [7, 8]\n  topics:\n    Media: 12\n")
+
+	group := func(user int64, text string) int {
+		return fake.Send(telegramtest.Incoming{ChatID: testAdminChat, ChatType: "supergroup", ThreadID: 5, UserID: user, Username: "alice", Text: text})
+	}
+
+	// Chatter, commands for other bots and users not allowed are ignored
+	group(7, "good morning")
+	group(7, "/wake@other_bot remote-down")
+	group(9, "/wake remote-down")
+	id := group(7, "/wake@"+telegramtest.BotUser.UserName+" remote-down")
+	messages, err := fake.WaitForMessages(1, 5*time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	reply := messages[0]
+	if !strings.Contains(reply.Text, "Magic packet sent to *remote-down*") || reply.ReplyTo != id || reply.ThreadID != 5 {
+		t.Errorf("expected a reply in the topic, got %+v", reply)
+	}
+	if got := woken(); len(got) != 1 {
+		t.Errorf("relay woke %v", got)
+	}
+
+	// Alerts go to the topic of the server's group
+	notifier.Notify(Notification{Title: "remote-up is DOWN", Server: "remote-up"})
+	notifier.Notify(Notification{Title: "remote-down is DOWN", Server: "remote-down"})
+	messages, err = fake.WaitForMessages(3, 5*time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if messages[1].ThreadID != 12 || messages[2].ThreadID != 0 {
+		t.Errorf("alerts posted in topics %d and %d", messages[1].ThreadID, messages[2].ThreadID)
+	}
+
+	// The bot leaves groups other than the admin chat
+	fake.AddToChat(-42, "group", 7, "alice")
+	group(8, "/help")
+	if _, err := fake.WaitForMessages(4, 5*time.Second); err != nil {
+		t.Fatal(err)
+	}
+	if left := fake.LeftChats(); !slices.Equal(left, []int64{-42}) {
+		t.Errorf("left chats %v", left)
+	}
+}
+
+func TestTelegramGroupAdminCommands(t *testing.T) {
+	servers, _ := relayServers(t)
+	d, fake, _ := startTestBotWith(t, servers, "  allowed_users: [7, 8]\n")
+	fake.SetMemberStatus(testAdminChat, 7, "administrator")
+
+	group := func(user int64, username, text string) string {
+		t.Helper()
+		count := len(fake.Messages())
+		fake.Send(telegramtest.Incoming{ChatID: testAdminChat, ChatType: "supergroup", UserID: user, Username: username, Text: text})
+		messages, err := fake.WaitForMessages(count+1, 5*time.Second)
+		if err != nil {
+			t.Fatalf("%s: %v", text, err)
+		}
+		return messages[count].Text
+	}
+
+	// Members may use the bot but not change its configuration
+	if reply := group(8, "bob", "/remove remote-down"); reply != "🔒 /remove is only for group administrators" {
+		t.Errorf("/remove by a member: %s", reply)
+	}
+	if config.FindServer(d.Config().Servers, "remote-down") == nil {
+		t.Fatal("a member removed a server")
+	}
+	if reply := group(8, "bob", "/wake remote-down"); !strings.Contains(reply, "Magic packet sent") {
+		t.Errorf("/wake by a member: %s", reply)
+	}
+
+	if reply := group(7, "alice", "/audit"); !strings.Contains(reply, "@bob /remove remote-down → denied") {
+		t.Errorf("/audit by an administrator: %s", reply)
+	}
+	if reply := group(7, "alice", "/remove remote-down"); !strings.Contains(reply, "remote-down") || strings.Contains(reply, "🔒") {
+		t.Errorf("/remove by an administrator: %s", reply)
+	}
+}
+
+func TestTelegramAdminCommandsNeedRestriction(t *testing.T) {
+	servers, _ := relayServers(t)
+	d, fake, _ := startTestBot(t, servers)
+	open := *d.Config()
+	open.Telegram.AdminChatID = 0
+	d.config.Store(&open)
+
+	// A bot that answers everybody does not let them rewrite its config
+	if reply := converse(t, fake, "/remove remote-down"); !strings.HasPrefix(reply, "🔒 /remove is disabled") {
+		t.Errorf("/remove: %s", reply)
+	}
+	if config.FindServer(d.Config().Servers, "remote-down") == nil {
+		t.Fatal("server removed without an admin chat")
+	}
+	if reply := converse(t, fake, "/wake remote-down"); !strings.Contains(reply, "Magic packet sent") {
+		t.Errorf("/wake: %s", reply)
+	}
+}
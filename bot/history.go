@@ -0,0 +1,247 @@
+package bot
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"os"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/tsolodov/wot/internal/atomicfile"
+)
+
+const (
+	historyRetention = 35 * 24 * time.Hour
+
+	eventUp    = "up"
+	eventDown  = "down"
+	eventWake  = "wake"
+	eventStart = "start"
+	eventStop  = "stop"
+)
+
+// HistoryEvent is an observation recorded for reports: a server found up or
+// down, a wake packet sent (Error is set if it failed), or monitoring
+// starting and stopping.
+type HistoryEvent struct {
+	Time   time.Time `json:"time"`
+	Type   string    `json:"type"`
+	Server string    `json:"server,omitempty"`
+	By     string    `json:"by,omitempty"`
+	Error  string    `json:"error,omitempty"`
+}
+
+// History keeps the observed events of the last weeks in a JSON lines file
+// in the state directory. A heartbeat file written after every check round
+// tells, after a restart, until when the previous run was monitoring. A nil
+// *History records nothing.
+type History struct {
+	path string
+	now  func() time.Time
+
+	mutex  sync.Mutex
+	events []HistoryEvent
+}
+
+func NewHistory(path string) *History {
+	h := &History{path: path, now: time.Now}
+	if err := h.load(); err != nil {
+		slog.Error("Failed to load history", "path", path, "error", err)
+	}
+	h.Add(HistoryEvent{Type: eventStart})
+	return h
+}
+
+// load reads the history, drops events past the retention and records when
+// the previous run stopped monitoring.
+func (h *History) load() error {
+	if h.path == "" {
+		return nil
+	}
+
+	file, err := os.Open(h.path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		var event HistoryEvent
+		if err := json.Unmarshal(scanner.Bytes(), &event); err != nil {
+			// A line cut short by a crash is skipped
+			continue
+		}
+		h.events = append(h.events, event)
+	}
+	if err := scanner.Err(); err != nil {
+		return err
+	}
+	sort.SliceStable(h.events, func(i, j int) bool { return h.events[i].Time.Before(h.events[j].Time) })
+	h.events = pruneEvents(h.events, h.now().Add(-historyRetention))
+
+	if len(h.events) > 0 && h.events[len(h.events)-1].Type != eventStop {
+		stopped := h.events[len(h.events)-1].Time
+		if heartbeat, err := h.readHeartbeat(); err == nil && heartbeat.After(stopped) {
+			stopped = heartbeat
+		}
+		h.events = append(h.events, HistoryEvent{Time: stopped, Type: eventStop})
+	}
+	return h.rewrite()
+}
+
+// pruneEvents drops events before cutoff, except the last state of each
+// server, which is still needed to know the state at the start of a report.
+func pruneEvents(events []HistoryEvent, cutoff time.Time) []HistoryEvent {
+	lastState := make(map[string]int)
+	for i, event := range events {
+		if event.Time.Before(cutoff) && (event.Type == eventUp || event.Type == eventDown) {
+			lastState[event.Server] = i
+		}
+	}
+
+	var kept []HistoryEvent
+	for i, event := range events {
+		if j, ok := lastState[event.Server]; ok && j == i || !event.Time.Before(cutoff) {
+			kept = append(kept, event)
+		}
+	}
+	return kept
+}
+
+func (h *History) rewrite() error {
+	var data []byte
+	for _, event := range h.events {
+		line, err := json.Marshal(event)
+		if err != nil {
+			return err
+		}
+		data = append(append(data, line...), '\n')
+	}
+	return atomicfile.WriteFile(h.path, data, 0600)
+}
+
+// Add records event, setting its time to now if it has none.
+func (h *History) Add(event HistoryEvent) {
+	if h == nil {
+		return
+	}
+	if event.Time.IsZero() {
+		event.Time = h.now()
+	}
+
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+	h.events = append(h.events, event)
+
+	// Prune about once a day when running for longer than the retention
+	pruned := false
+	if h.events[0].Time.Before(event.Time.Add(-historyRetention - 24*time.Hour)) {
+		before := len(h.events)
+		h.events = pruneEvents(h.events, event.Time.Add(-historyRetention))
+		pruned = len(h.events) < before
+	}
+
+	if h.path == "" {
+		return
+	}
+	if pruned {
+		if err := h.rewrite(); err != nil {
+			slog.Error("Failed to write history", "error", err)
+		}
+		return
+	}
+	line, err := json.Marshal(event)
+	if err == nil {
+		err = appendLine(h.path, line)
+	}
+	if err != nil {
+		slog.Error("Failed to write history", "error", err)
+	}
+}
+
+// RecordState records a server found up or down.
+func (h *History) RecordState(server string, up bool, at time.Time) {
+	event := HistoryEvent{Time: at, Type: eventDown, Server: server}
+	if up {
+		event.Type = eventUp
+	}
+	h.Add(event)
+}
+
+// RecordWake records a wake packet sent to server by the given user, and the
+// error if sending failed.
+func (h *History) RecordWake(server, by string, err error, at time.Time) {
+	event := HistoryEvent{Time: at, Type: eventWake, Server: server, By: by}
+	if err != nil {
+		event.Error = err.Error()
+	}
+	h.Add(event)
+}
+
+func appendLine(path string, line []byte) error {
+	file, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0600)
+	if err != nil {
+		return err
+	}
+	if _, err := file.Write(append(line, '\n')); err != nil {
+		file.Close()
+		return err
+	}
+	return file.Close()
+}
+
+// Heartbeat notes that monitoring was still running at the given time.
+func (h *History) Heartbeat(now time.Time) {
+	if h == nil || h.path == "" {
+		return
+	}
+	data, _ := now.MarshalText()
+	if err := atomicfile.WriteFile(h.path+".heartbeat", data, 0600); err != nil {
+		slog.Error("Failed to write history heartbeat", "error", err)
+	}
+}
+
+func (h *History) readHeartbeat() (time.Time, error) {
+	var heartbeat time.Time
+	data, err := os.ReadFile(h.path + ".heartbeat")
+	if err != nil {
+		return heartbeat, err
+	}
+	err = heartbeat.UnmarshalText(data)
+	return heartbeat, err
+}
+
+// PreviousStop returns when the previous run stopped monitoring, as far as
+// known: its stop event, or its last heartbeat if it did not shut down.
+func (h *History) PreviousStop() time.Time {
+	if h == nil {
+		return time.Time{}
+	}
+
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+	for i := len(h.events) - 1; i >= 0; i-- {
+		if h.events[i].Type == eventStop {
+			return h.events[i].Time
+		}
+	}
+	return time.Time{}
+}
+
+// Events returns a copy of all recorded events in the order they happened.
+func (h *History) Events() []HistoryEvent {
+	if h == nil {
+		return nil
+	}
+
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+	return append([]HistoryEvent(nil), h.events...)
+}
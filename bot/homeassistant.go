@@ -0,0 +1,443 @@
+package bot
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/tsolodov/wot/config"
+	"github.com/tsolodov/wot/monitor"
+)
+
+const (
+	mqttPayloadOn      = "ON"
+	mqttPayloadOff     = "OFF"
+	mqttPayloadPress   = "PRESS"
+	mqttOnline         = "online"
+	mqttOffline        = "offline"
+	mqttKeepAlive      = 30 * time.Second
+	mqttMinBackoff     = 1 * time.Second
+	mqttMaxBackoff     = 2 * time.Minute
+	mqttStableDuration = 1 * time.Minute
+)
+
+// MQTTBridge publishes server status to MQTT, accepts wake commands on
+// <prefix>/<server>/wake and announces every server to Home Assistant via
+// MQTT discovery.
+type MQTTBridge struct {
+	config  *config.MQTTConfig
+	monitor *monitor.ServerMonitor
+	wake    func(server config.Server) error
+	// Wake requests for servers in maintenance are ignored
+	suppressions *Suppressions
+	audit        *AuditLog
+
+	minBackoff time.Duration
+	maxBackoff time.Duration
+	keepAlive  time.Duration
+
+	mutex       sync.Mutex
+	servers     []config.Server
+	broadcastIP string
+	client      *mqttClient
+	stop        chan struct{}
+	done        chan struct{}
+}
+
+type haDevice struct {
+	Identifiers  []string   `json:"identifiers"`
+	Name         string     `json:"name"`
+	Connections  [][]string `json:"connections,omitempty"`
+	Manufacturer string     `json:"manufacturer,omitempty"`
+	Model        string     `json:"model,omitempty"`
+}
+
+type haDiscovery struct {
+	Name              string   `json:"name"`
+	UniqueID          string   `json:"unique_id"`
+	ObjectID          string   `json:"object_id,omitempty"`
+	StateTopic        string   `json:"state_topic,omitempty"`
+	CommandTopic      string   `json:"command_topic,omitempty"`
+	PayloadOn         string   `json:"payload_on,omitempty"`
+	PayloadOff        string   `json:"payload_off,omitempty"`
+	PayloadPress      string   `json:"payload_press,omitempty"`
+	DeviceClass       string   `json:"device_class,omitempty"`
+	Icon              string   `json:"icon,omitempty"`
+	AvailabilityTopic string   `json:"availability_topic"`
+	Device            haDevice `json:"device"`
+}
+
+func NewMQTTBridge(cfg *config.Config, sm *monitor.ServerMonitor, network *Network) *MQTTBridge {
+	mqttConfig := *cfg.MQTT
+	if mqttConfig.TopicPrefix == "" {
+		mqttConfig.TopicPrefix = "wot"
+	}
+	if mqttConfig.DiscoveryPrefix == "" {
+		mqttConfig.DiscoveryPrefix = "homeassistant"
+	}
+	if mqttConfig.ClientID == "" {
+		mqttConfig.ClientID = "wot-bot"
+	}
+
+	bridge := &MQTTBridge{
+		config:      &mqttConfig,
+		servers:     cfg.Servers,
+		broadcastIP: cfg.BroadcastIP,
+		monitor:     sm,
+		minBackoff:  mqttMinBackoff,
+		maxBackoff:  mqttMaxBackoff,
+		keepAlive:   mqttKeepAlive,
+	}
+	bridge.wake = func(server config.Server) error {
+		bridge.mutex.Lock()
+		broadcastIP := bridge.broadcastIP
+		bridge.mutex.Unlock()
+		return network.Wake(context.Background(), server, broadcastIP)
+	}
+
+	if sm != nil {
+		sm.OnStatusChange(func(server config.Server, isUp bool, timestamp time.Time) {
+			bridge.publishState(server.Name, isUp)
+		})
+	}
+
+	return bridge
+}
+
+// Start connects to the broker in the background, reconnecting with
+// exponential backoff whenever the connection is lost.
+func (b *MQTTBridge) Start() {
+	b.stop = make(chan struct{})
+	b.done = make(chan struct{})
+
+	slog.Info("Starting MQTT bridge", "broker", b.config.Broker)
+	go b.run()
+}
+
+// Stop disconnects from the broker and waits for the bridge to exit.
+func (b *MQTTBridge) Stop() {
+	close(b.stop)
+
+	b.mutex.Lock()
+	if b.client != nil {
+		b.client.Close()
+	}
+	b.mutex.Unlock()
+
+	<-b.done
+}
+
+func (b *MQTTBridge) run() {
+	defer close(b.done)
+
+	backoff := b.minBackoff
+	for {
+		started := time.Now()
+		err := b.session()
+
+		select {
+		case <-b.stop:
+			return
+		default:
+		}
+
+		if time.Since(started) > mqttStableDuration {
+			backoff = b.minBackoff
+		}
+		slog.Warn("MQTT connection lost", "broker", b.config.Broker, "retry_in", backoff, "error", err)
+
+		select {
+		case <-b.stop:
+			return
+		case <-time.After(backoff):
+		}
+
+		backoff *= 2
+		if backoff > b.maxBackoff {
+			backoff = b.maxBackoff
+		}
+	}
+}
+
+func (b *MQTTBridge) session() error {
+	client, err := dialMQTT(mqttConnectOptions{
+		Broker:      b.config.Broker,
+		ClientID:    b.config.ClientID,
+		Username:    b.config.Username,
+		Password:    b.config.Password,
+		KeepAlive:   b.keepAlive,
+		WillTopic:   b.availabilityTopic(),
+		WillPayload: []byte(mqttOffline),
+		WillRetain:  true,
+	})
+	if err != nil {
+		return err
+	}
+	defer client.Close()
+
+	b.mutex.Lock()
+	select {
+	case <-b.stop:
+		b.mutex.Unlock()
+		return nil
+	default:
+	}
+	b.client = client
+	b.mutex.Unlock()
+
+	defer func() {
+		b.mutex.Lock()
+		b.client = nil
+		b.mutex.Unlock()
+	}()
+
+	slog.Info("Connected to MQTT broker", "broker", b.config.Broker)
+
+	if err := b.announce(client); err != nil {
+		return err
+	}
+
+	pingDone := make(chan struct{})
+	defer close(pingDone)
+	go func() {
+		ticker := time.NewTicker(b.keepAlive / 2)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-pingDone:
+				return
+			case <-ticker.C:
+				if err := client.Ping(); err != nil {
+					return
+				}
+			}
+		}
+	}()
+
+	return client.ReadLoop(b.handleMessage)
+}
+
+// announce publishes discovery payloads, availability and the last known
+// state of every server, then subscribes to wake commands.
+func (b *MQTTBridge) announce(client *mqttClient) error {
+	if err := b.publishDiscovery(client, b.currentServers()); err != nil {
+		return err
+	}
+
+	if err := client.Publish(b.availabilityTopic(), []byte(mqttOnline), true); err != nil {
+		return fmt.Errorf("failed to publish availability: %w", err)
+	}
+
+	if b.monitor != nil {
+		for name, state := range b.monitor.GetServerStates() {
+			if err := client.Publish(b.stateTopic(name), []byte(mqttStatePayload(state.IsUp)), true); err != nil {
+				return fmt.Errorf("failed to publish state: %w", err)
+			}
+		}
+	}
+
+	return client.Subscribe(b.config.TopicPrefix + "/+/wake")
+}
+
+func (b *MQTTBridge) publishDiscovery(client *mqttClient, servers []config.Server) error {
+	for _, server := range servers {
+		for topic, payload := range b.discoveryPayloads(server) {
+			data, err := json.Marshal(payload)
+			if err != nil {
+				return fmt.Errorf("failed to encode discovery payload: %w", err)
+			}
+			if err := client.Publish(topic, data, true); err != nil {
+				return fmt.Errorf("failed to publish discovery payload: %w", err)
+			}
+		}
+	}
+	return nil
+}
+
+// UpdateServers applies a reloaded server list. Servers that disappeared are
+// removed from Home Assistant by clearing their retained discovery and state
+// topics; new and changed servers are (re)announced.
+func (b *MQTTBridge) UpdateServers(servers []config.Server, broadcastIP string) {
+	b.mutex.Lock()
+	current := make(map[string]bool, len(servers))
+	for _, server := range servers {
+		current[mqttSlug(server.Name)] = true
+	}
+	var removed []config.Server
+	for _, server := range b.servers {
+		if !current[mqttSlug(server.Name)] {
+			removed = append(removed, server)
+		}
+	}
+	b.servers = servers
+	b.broadcastIP = broadcastIP
+	client := b.client
+	b.mutex.Unlock()
+
+	if client == nil {
+		// Everything is announced again on the next successful connect
+		return
+	}
+
+	for _, server := range removed {
+		for topic := range b.discoveryPayloads(server) {
+			client.Publish(topic, nil, true)
+		}
+		client.Publish(b.stateTopic(server.Name), nil, true)
+	}
+	if err := b.publishDiscovery(client, servers); err != nil {
+		slog.Error("Failed to update MQTT discovery", "error", err)
+	}
+}
+
+func (b *MQTTBridge) currentServers() []config.Server {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	return b.servers
+}
+
+func (b *MQTTBridge) discoveryPayloads(server config.Server) map[string]haDiscovery {
+	slug := mqttSlug(server.Name)
+	device := haDevice{
+		Identifiers:  []string{"wot_" + slug},
+		Name:         server.Name,
+		Manufacturer: "WoT",
+		Model:        "Wake-on-LAN host",
+	}
+	if mac := normalizeMAC(server.MACAddress); mac != "" {
+		device.Connections = [][]string{{"mac", mac}}
+	}
+
+	prefix := b.config.DiscoveryPrefix
+	return map[string]haDiscovery{
+		fmt.Sprintf("%s/binary_sensor/wot/%s/config", prefix, slug): {
+			Name:              "Status",
+			UniqueID:          "wot_" + slug + "_status",
+			ObjectID:          "wot_" + slug + "_status",
+			StateTopic:        b.stateTopic(server.Name),
+			PayloadOn:         mqttPayloadOn,
+			PayloadOff:        mqttPayloadOff,
+			DeviceClass:       "connectivity",
+			AvailabilityTopic: b.availabilityTopic(),
+			Device:            device,
+		},
+		fmt.Sprintf("%s/button/wot/%s_wake/config", prefix, slug): {
+			Name:              "Wake",
+			UniqueID:          "wot_" + slug + "_wake",
+			ObjectID:          "wot_" + slug + "_wake",
+			CommandTopic:      b.wakeTopic(server.Name),
+			PayloadPress:      mqttPayloadPress,
+			Icon:              "mdi:power",
+			AvailabilityTopic: b.availabilityTopic(),
+			Device:            device,
+		},
+	}
+}
+
+// handleMessage wakes a server for a PRESS on its wake topic. Retained
+// messages are ignored, since the broker delivers them again on every
+// reconnect.
+func (b *MQTTBridge) handleMessage(topic string, payload []byte, retained bool) {
+	for _, server := range b.currentServers() {
+		if topic != b.wakeTopic(server.Name) {
+			continue
+		}
+		if retained {
+			slog.Warn("Ignoring retained MQTT wake request", "server", server.Name, "topic", topic)
+			return
+		}
+		if string(payload) != mqttPayloadPress {
+			slog.Warn("Ignoring MQTT wake request with an unknown payload", "server", server.Name, "payload", string(payload))
+			return
+		}
+
+		entry := AuditEntry{Source: auditSourceMQTT, Username: "Home Assistant", Command: "wake", Targets: []string{server.Name}, Outcome: auditOK}
+		if maintenance, ok := b.suppressions.InMaintenance(server.Name); ok {
+			slog.Info("Ignoring MQTT wake request during maintenance", "server", server.Name, "until", maintenance.Until)
+			entry.Outcome, entry.Error = auditFailed, "in maintenance"
+			b.audit.Record(entry)
+			return
+		}
+		slog.Info("MQTT wake request", "server", server.Name)
+		// Waking through a relay can take seconds, which must not stall the
+		// read loop and with it the keepalive
+		go func() {
+			start := time.Now()
+			err := b.wake(server)
+			entry.LatencyMS = time.Since(start).Milliseconds()
+			if err != nil {
+				slog.Error("Failed to wake server via MQTT", "server", server.Name, "error", err)
+				entry.Outcome, entry.Error = auditFailed, err.Error()
+			}
+			if b.monitor != nil {
+				b.monitor.RecordWake(server.Name, "Home Assistant", err)
+			}
+			b.audit.Record(entry)
+		}()
+		return
+	}
+
+	slog.Debug("MQTT message on unknown topic", "topic", topic)
+}
+
+func (b *MQTTBridge) publishState(name string, isUp bool) {
+	b.mutex.Lock()
+	client := b.client
+	b.mutex.Unlock()
+
+	if client == nil {
+		// State is republished on the next successful connect
+		return
+	}
+
+	if err := client.Publish(b.stateTopic(name), []byte(mqttStatePayload(isUp)), true); err != nil {
+		slog.Warn("Failed to publish MQTT state", "server", name, "error", err)
+	}
+}
+
+func (b *MQTTBridge) availabilityTopic() string {
+	return b.config.TopicPrefix + "/availability"
+}
+
+func (b *MQTTBridge) stateTopic(name string) string {
+	return fmt.Sprintf("%s/%s/status", b.config.TopicPrefix, mqttSlug(name))
+}
+
+func (b *MQTTBridge) wakeTopic(name string) string {
+	return fmt.Sprintf("%s/%s/wake", b.config.TopicPrefix, mqttSlug(name))
+}
+
+func mqttStatePayload(isUp bool) string {
+	if isUp {
+		return mqttPayloadOn
+	}
+	return mqttPayloadOff
+}
+
+// mqttSlug turns a server name into something safe to use as an MQTT topic
+// level and Home Assistant object ID.
+func mqttSlug(name string) string {
+	var slug strings.Builder
+	for _, r := range strings.ToLower(name) {
+		switch {
+		case r >= 'a' && r <= 'z', r >= '0' && r <= '9', r == '-':
+			slug.WriteRune(r)
+		default:
+			slug.WriteRune('_')
+		}
+	}
+	return slug.String()
+}
+
+func normalizeMAC(macAddr string) string {
+	mac, err := net.ParseMAC(macAddr)
+	if err != nil {
+		return ""
+	}
+	return mac.String()
+}
@@ -0,0 +1,485 @@
+package bot
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/tsolodov/wot/config"
+	"github.com/tsolodov/wot/internal/atomicfile"
+)
+
+const (
+	hostCheckInterval = time.Minute
+
+	// A host that booted less than this long ago, with the previous run not
+	// shut down cleanly, is reported as having lost power
+	recentBoot = 15 * time.Minute
+
+	// The temperature alert clears this many degrees below the limit, so a
+	// SoC hovering around it does not alert every minute
+	temperatureHysteresis = 5.0
+
+	// Bits of the Raspberry Pi firmware's get_throttled value
+	throttleUnderVoltage    = 1 << 0
+	throttleFrequencyCapped = 1 << 1
+	throttleThrottled       = 1 << 2
+	throttleSoftTempLimit   = 1 << 3
+	throttleUnderVoltageOcc = 1 << 16
+)
+
+// HostMetrics is a snapshot of the machine WoT runs on. Values that could
+// not be read are left zero, with the Has flags telling which are missing.
+type HostMetrics struct {
+	Uptime    time.Duration
+	HasUptime bool
+
+	Load    [3]float64
+	HasLoad bool
+	CPUs    int
+
+	MemTotal     uint64
+	MemAvailable uint64
+
+	DiskPath  string
+	DiskTotal uint64
+	DiskFree  uint64
+
+	Temperature    float64
+	HasTemperature bool
+
+	// Throttled is the Raspberry Pi firmware's throttling bitmask
+	Throttled    uint32
+	HasThrottled bool
+}
+
+// hostReader reads host metrics below root, which is "/" except in tests.
+type hostReader struct {
+	root string
+}
+
+func (r hostReader) path(name string) string {
+	return filepath.Join(r.root, name)
+}
+
+func (r hostReader) read(diskPath string) HostMetrics {
+	m := HostMetrics{CPUs: runtime.NumCPU(), DiskPath: diskPath}
+	m.Uptime, m.HasUptime = r.uptime()
+	m.Load, m.HasLoad = r.load()
+	m.MemTotal, m.MemAvailable = r.memory()
+	m.Temperature, m.HasTemperature = r.temperature()
+	m.Throttled, m.HasThrottled = r.throttled()
+
+	total, free, err := diskUsage(diskPath)
+	if err != nil {
+		slog.Warn("Failed to read disk usage", "path", diskPath, "error", err)
+	}
+	m.DiskTotal, m.DiskFree = total, free
+	return m
+}
+
+func (r hostReader) uptime() (time.Duration, bool) {
+	data, err := os.ReadFile(r.path("proc/uptime"))
+	if err != nil {
+		return 0, false
+	}
+	fields := strings.Fields(string(data))
+	if len(fields) == 0 {
+		return 0, false
+	}
+	seconds, err := strconv.ParseFloat(fields[0], 64)
+	if err != nil {
+		return 0, false
+	}
+	return time.Duration(seconds) * time.Second, true
+}
+
+func (r hostReader) load() ([3]float64, bool) {
+	var load [3]float64
+	data, err := os.ReadFile(r.path("proc/loadavg"))
+	if err != nil {
+		return load, false
+	}
+	fields := strings.Fields(string(data))
+	if len(fields) < 3 {
+		return load, false
+	}
+	for i := range load {
+		if load[i], err = strconv.ParseFloat(fields[i], 64); err != nil {
+			return load, false
+		}
+	}
+	return load, true
+}
+
+// memory returns MemTotal and MemAvailable from /proc/meminfo in bytes.
+func (r hostReader) memory() (uint64, uint64) {
+	file, err := os.Open(r.path("proc/meminfo"))
+	if err != nil {
+		return 0, 0
+	}
+	defer file.Close()
+
+	var total, available uint64
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) < 2 {
+			continue
+		}
+		kb, err := strconv.ParseUint(fields[1], 10, 64)
+		if err != nil {
+			continue
+		}
+		switch fields[0] {
+		case "MemTotal:":
+			total = kb * 1024
+		case "MemAvailable:":
+			available = kb * 1024
+		}
+	}
+	return total, available
+}
+
+// temperature reads the CPU thermal zone in °C, falling back to the first
+// zone when none is named after the CPU or SoC.
+func (r hostReader) temperature() (float64, bool) {
+	zones, _ := filepath.Glob(r.path("sys/class/thermal/thermal_zone*"))
+	if len(zones) == 0 {
+		return 0, false
+	}
+	zone := zones[0]
+	for _, candidate := range zones {
+		kind, _ := os.ReadFile(filepath.Join(candidate, "type"))
+		name := strings.ToLower(string(kind))
+		if strings.Contains(name, "cpu") || strings.Contains(name, "soc") || strings.Contains(name, "x86_pkg") {
+			zone = candidate
+			break
+		}
+	}
+
+	data, err := os.ReadFile(filepath.Join(zone, "temp"))
+	if err != nil {
+		return 0, false
+	}
+	millidegrees, err := strconv.ParseFloat(strings.TrimSpace(string(data)), 64)
+	if err != nil {
+		return 0, false
+	}
+	return millidegrees / 1000, true
+}
+
+// throttled reads the firmware throttling flags of a Raspberry Pi. Kernels
+// without the firmware file still report under-voltage through hwmon.
+func (r hostReader) throttled() (uint32, bool) {
+	data, err := os.ReadFile(r.path("sys/devices/platform/soc/soc:firmware/get_throttled"))
+	if err == nil {
+		value, err := strconv.ParseUint(strings.TrimPrefix(strings.TrimSpace(string(data)), "0x"), 16, 32)
+		if err == nil {
+			return uint32(value), true
+		}
+	}
+
+	monitors, _ := filepath.Glob(r.path("sys/class/hwmon/hwmon*"))
+	for _, sm := range monitors {
+		name, _ := os.ReadFile(filepath.Join(sm, "name"))
+		if strings.TrimSpace(string(name)) != "rpi_volt" {
+			continue
+		}
+		alarm, err := os.ReadFile(filepath.Join(sm, "in0_lcrit_alarm"))
+		if err != nil {
+			return 0, false
+		}
+		if strings.TrimSpace(string(alarm)) == "1" {
+			return throttleUnderVoltage | throttleUnderVoltageOcc, true
+		}
+		return 0, true
+	}
+	return 0, false
+}
+
+// hostCondition is one alert of the host monitor, with the detail shown when
+// it starts and when it clears.
+type hostCondition struct {
+	Key    string
+	Title  string
+	Active bool
+	Detail string
+}
+
+// hostConditions evaluates metrics against the limits. active holds the
+// conditions alerted before, for hysteresis. Metrics that could not be read
+// yield no condition, so a missing sensor never alerts.
+func hostConditions(m HostMetrics, limits config.HostConfig, active map[string]bool) []hostCondition {
+	var conditions []hostCondition
+
+	if m.HasTemperature {
+		limit := limits.MaxTemperature
+		if active["temperature"] {
+			limit -= temperatureHysteresis
+		}
+		conditions = append(conditions, hostCondition{
+			Key:    "temperature",
+			Title:  "High temperature",
+			Active: m.Temperature >= limit,
+			Detail: fmt.Sprintf("🌡️ SoC at %.1f°C (limit %.0f°C)", m.Temperature, limits.MaxTemperature),
+		})
+	}
+	if m.DiskTotal > 0 {
+		free := percentOf(m.DiskFree, m.DiskTotal)
+		conditions = append(conditions, hostCondition{
+			Key:    "disk",
+			Title:  "Low disk space",
+			Active: free < limits.MinDiskFree,
+			Detail: fmt.Sprintf("💾 %s free on %s (%.0f%%, limit %.0f%%)", formatBytes(m.DiskFree), m.DiskPath, free, limits.MinDiskFree),
+		})
+	}
+	if m.MemTotal > 0 {
+		available := percentOf(m.MemAvailable, m.MemTotal)
+		conditions = append(conditions, hostCondition{
+			Key:    "memory",
+			Title:  "Low memory",
+			Active: available < limits.MinMemoryAvailable,
+			Detail: fmt.Sprintf("🧠 %s available (%.0f%%, limit %.0f%%)", formatBytes(m.MemAvailable), available, limits.MinMemoryAvailable),
+		})
+	}
+	if m.HasLoad && limits.MaxLoad > 0 && m.CPUs > 0 {
+		conditions = append(conditions, hostCondition{
+			Key:    "load",
+			Title:  "High load",
+			Active: m.Load[1]/float64(m.CPUs) > limits.MaxLoad,
+			Detail: fmt.Sprintf("📈 5 minute load %.2f on %d CPUs (limit %.2f per CPU)", m.Load[1], m.CPUs, limits.MaxLoad),
+		})
+	}
+	if m.HasThrottled {
+		// The firmware keeps the "occurred" bit until reboot, so under-voltage
+		// is reported once per boot
+		conditions = append(conditions, hostCondition{
+			Key:    "undervoltage",
+			Title:  "Under-voltage",
+			Active: m.Throttled&(throttleUnderVoltage|throttleUnderVoltageOcc) != 0,
+			Detail: "⚡ " + describeUnderVoltage(m.Throttled),
+		})
+		conditions = append(conditions, hostCondition{
+			Key:    "throttled",
+			Title:  "CPU throttled",
+			Active: m.Throttled&(throttleFrequencyCapped|throttleThrottled|throttleSoftTempLimit) != 0,
+			Detail: "🐢 " + describeThrottling(m.Throttled),
+		})
+	}
+	return conditions
+}
+
+func describeUnderVoltage(flags uint32) string {
+	switch {
+	case flags&throttleUnderVoltage != 0:
+		return "Under-voltage now, check the power supply"
+	case flags&throttleUnderVoltageOcc != 0:
+		return "Under-voltage occurred since boot, check the power supply"
+	}
+	return "Power supply OK"
+}
+
+func describeThrottling(flags uint32) string {
+	var reasons []string
+	if flags&throttleThrottled != 0 {
+		reasons = append(reasons, "throttled")
+	}
+	if flags&throttleFrequencyCapped != 0 {
+		reasons = append(reasons, "frequency capped")
+	}
+	if flags&throttleSoftTempLimit != 0 {
+		reasons = append(reasons, "soft temperature limit")
+	}
+	if len(reasons) == 0 {
+		return "Not throttled"
+	}
+	return "CPU " + strings.Join(reasons, ", ")
+}
+
+func percentOf(part, total uint64) float64 {
+	return 100 * float64(part) / float64(total)
+}
+
+func formatBytes(bytes uint64) string {
+	const unit = 1024
+	if bytes < unit {
+		return fmt.Sprintf("%d B", bytes)
+	}
+	value := float64(bytes) / unit
+	for _, suffix := range []string{"KB", "MB", "GB"} {
+		if value < unit {
+			return fmt.Sprintf("%.1f %s", value, suffix)
+		}
+		value /= unit
+	}
+	return fmt.Sprintf("%.1f TB", value)
+}
+
+// formatHostStatus renders the metrics for the /host command.
+func formatHostStatus(m HostMetrics) string {
+	var response strings.Builder
+	response.WriteString("🖥️ *Host Status*\n\n")
+
+	unknown := "unknown"
+	uptime := unknown
+	if m.HasUptime {
+		uptime = formatDuration(m.Uptime)
+	}
+	response.WriteString(fmt.Sprintf("⏱️ Uptime: %s\n", uptime))
+
+	load := unknown
+	if m.HasLoad {
+		load = fmt.Sprintf("%.2f %.2f %.2f (%d CPUs)", m.Load[0], m.Load[1], m.Load[2], m.CPUs)
+	}
+	response.WriteString(fmt.Sprintf("📈 Load: %s\n", load))
+
+	memory := unknown
+	if m.MemTotal > 0 {
+		memory = fmt.Sprintf("%s of %s available (%.0f%%)", formatBytes(m.MemAvailable), formatBytes(m.MemTotal), percentOf(m.MemAvailable, m.MemTotal))
+	}
+	response.WriteString(fmt.Sprintf("🧠 Memory: %s\n", memory))
+
+	disk := unknown
+	if m.DiskTotal > 0 {
+		disk = fmt.Sprintf("%s of %s free (%.0f%%)", formatBytes(m.DiskFree), formatBytes(m.DiskTotal), percentOf(m.DiskFree, m.DiskTotal))
+	}
+	response.WriteString(fmt.Sprintf("💾 Disk `%s`: %s\n", m.DiskPath, disk))
+
+	temperature := unknown
+	if m.HasTemperature {
+		temperature = fmt.Sprintf("%.1f°C", m.Temperature)
+	}
+	response.WriteString(fmt.Sprintf("🌡️ Temperature: %s\n", temperature))
+
+	if m.HasThrottled {
+		response.WriteString(fmt.Sprintf("⚡ %s\n", describeUnderVoltage(m.Throttled)))
+		response.WriteString(fmt.Sprintf("🐢 %s\n", describeThrottling(m.Throttled)))
+	}
+	return response.String()
+}
+
+// HostMonitor checks the host metrics every minute and alerts when one
+// crosses its threshold and again when it is back to normal.
+type HostMonitor struct {
+	reader   hostReader
+	config   func() *config.Config
+	notifier *NotificationDispatcher
+	messages *Messages
+	now      func() time.Time
+
+	mutex  sync.Mutex
+	active map[string]bool
+}
+
+func NewHostMonitor(cfg func() *config.Config, notifier *NotificationDispatcher, messages *Messages) *HostMonitor {
+	return &HostMonitor{
+		reader:   hostReader{root: "/"},
+		config:   cfg,
+		notifier: notifier,
+		messages: messages,
+		now:      time.Now,
+		active:   make(map[string]bool),
+	}
+}
+
+// Start checks the host in the background until ctx is done.
+func (hm *HostMonitor) Start(ctx context.Context) {
+	go func() {
+		hm.check()
+		ticker := time.NewTicker(hostCheckInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				hm.check()
+			}
+		}
+	}()
+}
+
+// Metrics reads the current host metrics.
+func (hm *HostMonitor) Metrics() HostMetrics {
+	return hm.reader.read(hm.config().HostLimits().DiskPath)
+}
+
+func (hm *HostMonitor) check() {
+	limits := hm.config().HostLimits()
+	if limits.DisableAlerts {
+		return
+	}
+	metrics := hm.reader.read(limits.DiskPath)
+
+	hm.mutex.Lock()
+	defer hm.mutex.Unlock()
+
+	now := hm.now()
+	for _, condition := range hostConditions(metrics, limits, hm.active) {
+		if condition.Active == hm.active[condition.Key] {
+			continue
+		}
+		hm.active[condition.Key] = condition.Active
+
+		name, severity, title, level := "host_alert", SeverityWarning, condition.Title, slog.LevelWarn
+		if !condition.Active {
+			name, severity, title, level = "host_ok", SeverityInfo, condition.Title+" resolved", slog.LevelInfo
+		}
+		slog.Log(context.Background(), level, "Host "+strings.ToLower(title), "detail", condition.Detail)
+		markdown := hm.messages.Render(name, hostMessage{Title: condition.Title, Detail: condition.Detail, Time: now})
+		hm.notifier.Dispatch(Notification{
+			Severity: severity,
+			Title:    title,
+			Message:  plainText(markdown),
+			Markdown: markdown,
+			Time:     hm.messages.In(now),
+		})
+	}
+}
+
+// markRunning creates the marker file that a clean shutdown removes, and
+// reports whether the previous run left it behind.
+func markRunning(path string) (unclean bool, err error) {
+	_, statErr := os.Stat(path)
+	unclean = statErr == nil
+	if statErr != nil && !errors.Is(statErr, os.ErrNotExist) {
+		return false, statErr
+	}
+	data, _ := time.Now().MarshalText()
+	return unclean, atomicfile.WriteFile(path, data, 0600)
+}
+
+// startupState fills in how the previous run ended for the started message.
+// A host that booted after WoT was last seen running, while WoT did not shut
+// down cleanly, lost power (or was reset); otherwise WoT itself crashed or
+// was killed. Without a record of the last run a recent boot counts.
+func startupState(message *startedMessage, unclean bool, uptime time.Duration, lastSeen, now time.Time) {
+	if !unclean {
+		return
+	}
+	message.UncleanShutdown = true
+	message.LastSeen = lastSeen
+	if !lastSeen.IsZero() {
+		message.Offline = now.Sub(lastSeen)
+	}
+
+	if uptime <= 0 {
+		return
+	}
+	booted := now.Add(-uptime)
+	if lastSeen.IsZero() {
+		message.PowerLoss = uptime < recentBoot
+	} else {
+		message.PowerLoss = booted.After(lastSeen)
+	}
+}
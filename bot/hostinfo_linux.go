@@ -0,0 +1,13 @@
+package bot
+
+import "syscall"
+
+// diskUsage returns the size of the file system holding path and the space
+// available to unprivileged users, in bytes.
+func diskUsage(path string) (uint64, uint64, error) {
+	var stat syscall.Statfs_t
+	if err := syscall.Statfs(path, &stat); err != nil {
+		return 0, 0, err
+	}
+	return stat.Blocks * uint64(stat.Bsize), stat.Bavail * uint64(stat.Bsize), nil
+}
@@ -0,0 +1,198 @@
+package bot
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/tsolodov/wot/config"
+)
+
+func writeHostFile(t *testing.T, root, name, content string) {
+	t.Helper()
+	path := filepath.Join(root, name)
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestHostReader(t *testing.T) {
+	root := t.TempDir()
+	writeHostFile(t, root, "proc/uptime", "272.35 1020.11\n")
+	writeHostFile(t, root, "proc/loadavg", "0.52 0.31 0.12 1/180 2345\n")
+	writeHostFile(t, root, "proc/meminfo", "MemTotal:        3884328 kB\nMemFree:          512000 kB\nMemAvailable:     194216 kB\n")
+	writeHostFile(t, root, "sys/class/thermal/thermal_zone0/type", "gpu-thermal\n")
+	writeHostFile(t, root, "sys/class/thermal/thermal_zone0/temp", "41000\n")
+	writeHostFile(t, root, "sys/class/thermal/thermal_zone1/type", "cpu-thermal\n")
+	writeHostFile(t, root, "sys/class/thermal/thermal_zone1/temp", "82312\n")
+	writeHostFile(t, root, "sys/devices/platform/soc/soc:firmware/get_throttled", "0x50005\n")
+
+	m := hostReader{root: root}.read(root)
+	if !m.HasUptime || m.Uptime != 272*time.Second {
+		t.Errorf("uptime = %v", m.Uptime)
+	}
+	if !m.HasLoad || m.Load != [3]float64{0.52, 0.31, 0.12} {
+		t.Errorf("load = %v", m.Load)
+	}
+	if m.MemTotal != 3884328*1024 || m.MemAvailable != 194216*1024 {
+		t.Errorf("memory = %d/%d", m.MemAvailable, m.MemTotal)
+	}
+	if !m.HasTemperature || m.Temperature != 82.312 {
+		t.Errorf("temperature = %v, want the cpu zone", m.Temperature)
+	}
+	if !m.HasThrottled || m.Throttled != 0x50005 {
+		t.Errorf("throttled = %#x", m.Throttled)
+	}
+	if m.DiskTotal == 0 || m.DiskFree > m.DiskTotal {
+		t.Errorf("disk = %d/%d", m.DiskFree, m.DiskTotal)
+	}
+
+	status := formatHostStatus(m)
+	for _, want := range []string{"Uptime: 4m", "Temperature: 82.3°C", "Under-voltage now", "CPU throttled", "(5%)"} {
+		if !strings.Contains(status, want) {
+			t.Errorf("status does not contain %q:\n%s", want, status)
+		}
+	}
+
+	// Missing files are reported as unknown, and hwmon reports under-voltage
+	empty := t.TempDir()
+	writeHostFile(t, empty, "sys/class/hwmon/hwmon0/name", "rpi_volt\n")
+	writeHostFile(t, empty, "sys/class/hwmon/hwmon0/in0_lcrit_alarm", "1\n")
+	m = hostReader{root: empty}.read(empty)
+	if m.HasUptime || m.HasLoad || m.HasTemperature || m.MemTotal != 0 {
+		t.Errorf("metrics from an empty tree: %+v", m)
+	}
+	if !m.HasThrottled || m.Throttled&throttleUnderVoltage == 0 {
+		t.Errorf("hwmon under-voltage not detected: %#x", m.Throttled)
+	}
+	if status := formatHostStatus(m); !strings.Contains(status, "Temperature: unknown") {
+		t.Errorf("status = %s", status)
+	}
+}
+
+func TestHostConditions(t *testing.T) {
+	limits := (&config.Config{Host: &config.HostConfig{MaxLoad: 1.5}}).HostLimits()
+	active := make(map[string]bool)
+	find := func(conditions []hostCondition, key string) hostCondition {
+		for _, condition := range conditions {
+			if condition.Key == key {
+				return condition
+			}
+		}
+		t.Fatalf("no %s condition", key)
+		return hostCondition{}
+	}
+
+	m := HostMetrics{
+		HasTemperature: true, Temperature: 81,
+		DiskPath: "/var/lib/wot", DiskTotal: 100, DiskFree: 5,
+		MemTotal: 100, MemAvailable: 50,
+		HasLoad: true, Load: [3]float64{4, 7, 2}, CPUs: 4,
+		HasThrottled: true, Throttled: throttleUnderVoltageOcc,
+	}
+	conditions := hostConditions(m, limits, active)
+	for key, want := range map[string]bool{"temperature": true, "disk": true, "memory": false, "load": true, "undervoltage": true, "throttled": false} {
+		if got := find(conditions, key).Active; got != want {
+			t.Errorf("%s active = %v, want %v", key, got, want)
+		}
+		active[key] = want
+	}
+	if detail := find(conditions, "undervoltage").Detail; !strings.Contains(detail, "since boot") {
+		t.Errorf("under-voltage detail = %q", detail)
+	}
+
+	// The temperature alert only clears 5°C below the limit
+	m.Temperature = 77
+	if !find(hostConditions(m, limits, active), "temperature").Active {
+		t.Error("temperature alert cleared within the hysteresis")
+	}
+	m.Temperature = 74.9
+	if find(hostConditions(m, limits, active), "temperature").Active {
+		t.Error("temperature alert did not clear")
+	}
+
+	// Without a load limit there is no load alert
+	if conditions := hostConditions(m, (&config.Config{}).HostLimits(), active); len(conditions) != 5 {
+		t.Errorf("got %d conditions without a load limit", len(conditions))
+	}
+}
+
+func TestHostMonitorAlerts(t *testing.T) {
+	root := t.TempDir()
+	writeHostFile(t, root, "sys/class/thermal/thermal_zone0/temp", "85000\n")
+
+	recorder := &recordingNotifier{name: "test"}
+	dispatcher := NewNotificationDispatcher()
+	dispatcher.Add(recorder, nil)
+	cfg := &config.Config{Host: &config.HostConfig{DiskPath: root}}
+	hm := NewHostMonitor(func() *config.Config { return cfg }, dispatcher, nil)
+	hm.reader = hostReader{root: root}
+
+	hm.check()
+	hm.check()
+	writeHostFile(t, root, "sys/class/thermal/thermal_zone0/temp", "60000\n")
+	hm.check()
+
+	got := recorder.got
+	if len(got) != 2 {
+		t.Fatalf("got %d notifications, want alert and recovery: %+v", len(got), got)
+	}
+	if got[0].Severity != SeverityWarning || !strings.Contains(got[0].Markdown, "High temperature") || !strings.Contains(got[0].Markdown, "85.0°C") {
+		t.Errorf("alert = %+v", got[0])
+	}
+	if got[1].Severity != SeverityInfo || got[1].Title != "High temperature resolved" {
+		t.Errorf("recovery = %+v", got[1])
+	}
+}
+
+func TestMarkRunning(t *testing.T) {
+	marker := filepath.Join(t.TempDir(), "running")
+	if unclean, err := markRunning(marker); err != nil || unclean {
+		t.Fatalf("first start: unclean = %v, err = %v", unclean, err)
+	}
+	if unclean, err := markRunning(marker); err != nil || !unclean {
+		t.Fatalf("start without clean shutdown: unclean = %v, err = %v", unclean, err)
+	}
+	os.Remove(marker)
+	if unclean, _ := markRunning(marker); unclean {
+		t.Fatal("start after clean shutdown reported as unclean")
+	}
+}
+
+func TestStartupState(t *testing.T) {
+	now := time.Date(2024, 3, 10, 12, 0, 0, 0, time.UTC)
+	lastSeen := now.Add(-2 * time.Hour)
+
+	tests := []struct {
+		name      string
+		unclean   bool
+		uptime    time.Duration
+		lastSeen  time.Time
+		powerLoss bool
+	}{
+		{"clean shutdown", false, 3 * time.Minute, lastSeen, false},
+		{"booted since last seen", true, 3 * time.Minute, lastSeen, true},
+		{"crash without reboot", true, 30 * 24 * time.Hour, lastSeen, false},
+		{"recent boot without history", true, 3 * time.Minute, time.Time{}, true},
+		{"old boot without history", true, 3 * time.Hour, time.Time{}, false},
+	}
+	for _, test := range tests {
+		var message startedMessage
+		startupState(&message, test.unclean, test.uptime, test.lastSeen, now)
+		if message.UncleanShutdown != test.unclean || message.PowerLoss != test.powerLoss {
+			t.Errorf("%s: unclean = %v, power loss = %v", test.name, message.UncleanShutdown, message.PowerLoss)
+		}
+	}
+
+	message := startedMessage{Uptime: "3m", Servers: 2, Interval: time.Minute, Time: now}
+	startupState(&message, true, 3*time.Minute, lastSeen, now)
+	text := (&Messages{location: time.UTC}).Render("started", message)
+	if !strings.Contains(text, "Booted after a power loss") || !strings.Contains(text, "not monitoring for 2h 0m") {
+		t.Errorf("started message = %s", text)
+	}
+}
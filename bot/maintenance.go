@@ -0,0 +1,194 @@
+package bot
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+	"github.com/tsolodov/wot/config"
+	"github.com/tsolodov/wot/internal/atomicfile"
+)
+
+const (
+	suppressMaintenance = "maintenance"
+	suppressMute        = "mute"
+
+	maxSuppression = 30 * 24 * time.Hour
+)
+
+// Suppression silences a server until it expires. Maintenance also stops
+// automated wakes; a mute only silences notifications.
+type Suppression struct {
+	Server    string    `json:"server"`
+	Kind      string    `json:"kind"`
+	Until     time.Time `json:"until"`
+	Reason    string    `json:"reason,omitempty"`
+	Recurring bool      `json:"-"`
+}
+
+// Suppressions holds the maintenance periods and mutes set from chat, which
+// are persisted across restarts, together with the recurring maintenance
+// windows from the config. A nil *Suppressions suppresses nothing.
+type Suppressions struct {
+	path string
+	now  func() time.Time
+
+	mutex   sync.Mutex
+	entries []Suppression
+	windows []config.MaintenanceWindow
+}
+
+func NewSuppressions(path string, windows []config.MaintenanceWindow) *Suppressions {
+	s := &Suppressions{path: path, windows: windows, now: time.Now}
+	if err := s.load(); err != nil {
+		slog.Error("Failed to load suppressions", "path", path, "error", err)
+	}
+	return s
+}
+
+func (s *Suppressions) SetWindows(windows []config.MaintenanceWindow) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.windows = windows
+}
+
+// Set starts or replaces a maintenance period or mute for server.
+func (s *Suppressions) Set(server, kind string, duration time.Duration, reason string) (Suppression, error) {
+	if duration > maxSuppression {
+		return Suppression{}, fmt.Errorf("duration must not exceed %d days", int(maxSuppression.Hours()/24))
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	entry := Suppression{Server: server, Kind: kind, Until: s.now().Add(duration).Truncate(time.Second), Reason: reason}
+	s.remove(server, kind)
+	s.entries = append(s.entries, entry)
+	return entry, s.save()
+}
+
+// Clear ends a maintenance period or mute early. It reports whether one was
+// active.
+func (s *Suppressions) Clear(server, kind string) (bool, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if !s.remove(server, kind) {
+		return false, nil
+	}
+	return true, s.save()
+}
+
+// remove deletes the entry for server and kind. Callers must hold s.mutex.
+func (s *Suppressions) remove(server, kind string) bool {
+	for i, entry := range s.entries {
+		if entry.Kind == kind && strings.EqualFold(entry.Server, server) {
+			s.entries = append(s.entries[:i], s.entries[i+1:]...)
+			return true
+		}
+	}
+	return false
+}
+
+// Active returns the unexpired suppressions of server, maintenance first.
+func (s *Suppressions) Active(server string) []Suppression {
+	if s == nil {
+		return nil
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	now := s.now()
+	var active []Suppression
+	for _, entry := range s.entries {
+		if strings.EqualFold(entry.Server, server) && now.Before(entry.Until) {
+			active = append(active, entry)
+		}
+	}
+	for _, window := range s.windows {
+		if until, ok := window.ActiveAt(server, now); ok {
+			active = append(active, Suppression{Server: server, Kind: suppressMaintenance, Until: until, Reason: window.Reason, Recurring: true})
+		}
+	}
+	sort.SliceStable(active, func(i, j int) bool {
+		return active[i].Kind == suppressMaintenance && active[j].Kind != suppressMaintenance
+	})
+	return active
+}
+
+// Silenced reports whether notifications about server are suppressed.
+func (s *Suppressions) Silenced(server string) bool {
+	return len(s.Active(server)) > 0
+}
+
+// InMaintenance returns the maintenance period of server if one is active.
+// Automated wakes are skipped during maintenance.
+func (s *Suppressions) InMaintenance(server string) (Suppression, bool) {
+	for _, entry := range s.Active(server) {
+		if entry.Kind == suppressMaintenance {
+			return entry, true
+		}
+	}
+	return Suppression{}, false
+}
+
+func (s *Suppressions) load() error {
+	if s.path == "" {
+		return nil
+	}
+
+	data, err := os.ReadFile(s.path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(data, &s.entries)
+}
+
+// save drops expired entries and writes the rest atomically. Callers must
+// hold s.mutex.
+func (s *Suppressions) save() error {
+	now := s.now()
+	entries := s.entries[:0]
+	for _, entry := range s.entries {
+		if now.Before(entry.Until) {
+			entries = append(entries, entry)
+		}
+	}
+	s.entries = entries
+
+	if s.path == "" {
+		return nil
+	}
+	data, err := json.Marshal(s.entries)
+	if err != nil {
+		return err
+	}
+	return atomicfile.WriteFile(s.path, data, 0600)
+}
+
+// describe formats a suppression for chat messages.
+func (e Suppression) describe(messages *Messages) string {
+	text := "🔇 muted"
+	if e.Kind == suppressMaintenance {
+		text = "🔧 maintenance"
+	}
+	text += " until " + messages.Clock(e.Until)
+	if e.Recurring {
+		text += " (scheduled)"
+	}
+	if e.Reason != "" {
+		text += ": " + tgbotapi.EscapeText(tgbotapi.ModeMarkdown, e.Reason)
+	}
+	return text
+}
@@ -0,0 +1,102 @@
+package bot
+
+import (
+	"context"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/tsolodov/wot/config"
+	"github.com/tsolodov/wot/monitor"
+)
+
+func TestSuppressionsPersist(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "suppressions.json")
+	now := time.Date(2024, 5, 1, 10, 0, 0, 0, time.UTC)
+
+	suppressions := NewSuppressions(path, nil)
+	suppressions.now = func() time.Time { return now }
+	if _, err := suppressions.Set("nas", suppressMaintenance, 2*time.Hour, "disk swap"); err != nil {
+		t.Fatalf("Set: %v", err)
+	}
+	if _, err := suppressions.Set("printer", suppressMute, 30*time.Minute, ""); err != nil {
+		t.Fatalf("Set: %v", err)
+	}
+	if _, err := suppressions.Set("nas", suppressMute, 31*24*time.Hour, ""); err == nil {
+		t.Error("expected an error for a suppression longer than the limit")
+	}
+
+	restarted := NewSuppressions(path, nil)
+	restarted.now = func() time.Time { return now.Add(time.Hour) }
+	maintenance, ok := restarted.InMaintenance("NAS")
+	if !ok || maintenance.Reason != "disk swap" || !maintenance.Until.Equal(now.Add(2*time.Hour)) {
+		t.Errorf("maintenance not restored: %+v %v", maintenance, ok)
+	}
+	if restarted.Silenced("printer") {
+		t.Error("expired mute still active")
+	}
+	if _, ok := restarted.InMaintenance("printer"); ok {
+		t.Error("a mute must not count as maintenance")
+	}
+
+	if cleared, err := restarted.Clear("nas", suppressMaintenance); !cleared || err != nil {
+		t.Errorf("Clear: %v %v", cleared, err)
+	}
+	if restarted.Silenced("nas") {
+		t.Error("cleared maintenance still active")
+	}
+
+	var none *Suppressions
+	if none.Silenced("nas") {
+		t.Error("nil suppressions must not silence anything")
+	}
+}
+
+func TestMonitorSuppressedNotifications(t *testing.T) {
+	agent, relay, _ := startTestRelay(t, "correct horse battery staple")
+	network := testNetwork(t, relay)
+	var up atomic.Bool
+	up.Store(true)
+	agent.probe = func(context.Context, config.Server) (string, bool, error) {
+		return "192.168.50.10", up.Load(), nil
+	}
+
+	recorder := &recordingNotifier{name: "test"}
+	dispatcher := NewNotificationDispatcher()
+	dispatcher.Add(recorder, nil)
+
+	cfg := &config.Config{Servers: []config.Server{{Name: "nas", MACAddress: "aa:bb:cc:dd:ee:01", Relay: "parents"}}}
+	sm := monitor.New(context.Background(), cfg.Servers, cfg.Interval(), network)
+	sm.Notifier = statusNotifier{notifier: dispatcher}
+	now := time.Date(2024, 5, 1, 10, 0, 0, 0, time.UTC)
+	suppressions := NewSuppressions("", nil)
+	suppressions.now = func() time.Time { return now }
+	sm.Silencer = suppressions
+
+	// Going down during maintenance is silent, but reported if it is still
+	// down when maintenance ends
+	suppressions.Set("nas", suppressMaintenance, time.Hour, "disk swap")
+	up.Store(false)
+	sm.CheckAll(context.Background())
+	if recorder.count() != 0 {
+		t.Fatalf("notification sent during maintenance: %+v", recorder.got)
+	}
+	now = now.Add(2 * time.Hour)
+	sm.CheckAll(context.Background())
+	if recorder.count() != 1 || recorder.got[0].Status != "DOWN" {
+		t.Fatalf("expected a DOWN notification after maintenance, got %+v", recorder.got)
+	}
+
+	// Changes that are undone while muted are never reported
+	suppressions.Set("nas", suppressMute, 30*time.Minute, "")
+	up.Store(true)
+	sm.CheckAll(context.Background())
+	up.Store(false)
+	sm.CheckAll(context.Background())
+	suppressions.Clear("nas", suppressMute)
+	sm.CheckAll(context.Background())
+	if recorder.count() != 1 {
+		t.Errorf("unexpected notifications while muted: %+v", recorder.got)
+	}
+}
@@ -0,0 +1,156 @@
+package bot
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"net"
+	"net/netip"
+	"strings"
+	"time"
+
+	"golang.org/x/net/dns/dnsmessage"
+)
+
+const (
+	mdnsGroupAddress = "224.0.0.251:5353"
+	mdnsTimeout      = 2 * time.Second
+	dnsTimeout       = 5 * time.Second
+
+	// The Go resolver does not expose record TTLs, so DNS answers are cached
+	// for a fixed time. mDNS answers use the TTL of the record.
+	dnsCacheTTL = 5 * time.Minute
+)
+
+var errNoAddress = errors.New("no address found")
+
+// isMDNSName reports whether host is resolved with multicast DNS.
+func isMDNSName(host string) bool {
+	return strings.HasSuffix(strings.ToLower(strings.TrimSuffix(host, ".")), ".local")
+}
+
+// lookupHostAddress resolves host with mDNS for .local names and with the
+// system resolver otherwise, preferring IPv4. It returns how long the answer
+// may be cached.
+func lookupHostAddress(ctx context.Context, host string) (string, time.Duration, error) {
+	if addr, err := netip.ParseAddr(host); err == nil {
+		return addr.String(), dnsCacheTTL, nil
+	}
+
+	if isMDNSName(host) {
+		addr, ttl, err := lookupMDNS(ctx, host, mdnsGroupAddress, mdnsTimeout)
+		if err != nil {
+			return "", 0, err
+		}
+		return addr.String(), ttl, nil
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, dnsTimeout)
+	defer cancel()
+	addrs, err := net.DefaultResolver.LookupNetIP(ctx, "ip", host)
+	if err != nil {
+		return "", 0, err
+	}
+	for _, addr := range addrs {
+		if addr.Unmap().Is4() {
+			return addr.Unmap().String(), dnsCacheTTL, nil
+		}
+	}
+	if len(addrs) == 0 {
+		return "", 0, errNoAddress
+	}
+	return addrs[0].String(), dnsCacheTTL, nil
+}
+
+// lookupMDNS sends a one-shot multicast DNS query (RFC 6762, section 5.1)
+// for the A record of host to server and waits for the first answer.
+// Because the query does not come from port 5353, responders answer by
+// unicast to our socket. It gives up after timeout or when ctx is done,
+// whichever comes first.
+func lookupMDNS(ctx context.Context, host, server string, timeout time.Duration) (netip.Addr, time.Duration, error) {
+	name, err := dnsmessage.NewName(strings.TrimSuffix(host, ".") + ".")
+	if err != nil {
+		return netip.Addr{}, 0, fmt.Errorf("invalid host name '%s': %w", host, err)
+	}
+	groupAddr, err := net.ResolveUDPAddr("udp4", server)
+	if err != nil {
+		return netip.Addr{}, 0, err
+	}
+
+	conn, err := net.ListenUDP("udp4", &net.UDPAddr{})
+	if err != nil {
+		return netip.Addr{}, 0, err
+	}
+	defer conn.Close()
+	conn.SetReadDeadline(time.Now().Add(timeout))
+	// Unblock the read below as soon as the caller gives up
+	stop := context.AfterFunc(ctx, func() { conn.SetReadDeadline(time.Now()) })
+	defer stop()
+
+	var idBytes [2]byte
+	rand.Read(idBytes[:])
+	id := binary.BigEndian.Uint16(idBytes[:])
+
+	query, err := buildMDNSQuery(name, id)
+	if err != nil {
+		return netip.Addr{}, 0, err
+	}
+	if _, err := conn.WriteTo(query, groupAddr); err != nil {
+		return netip.Addr{}, 0, fmt.Errorf("failed to send mDNS query: %w", err)
+	}
+
+	buf := make([]byte, 9000)
+	for {
+		n, _, err := conn.ReadFrom(buf)
+		if err != nil {
+			if ctx.Err() != nil {
+				return netip.Addr{}, 0, ctx.Err()
+			}
+			var netErr net.Error
+			if errors.As(err, &netErr) && netErr.Timeout() {
+				return netip.Addr{}, 0, fmt.Errorf("no mDNS answer for %s", host)
+			}
+			return netip.Addr{}, 0, err
+		}
+		if addr, ttl, ok := parseMDNSResponse(buf[:n], name); ok {
+			return addr, ttl, nil
+		}
+	}
+}
+
+func buildMDNSQuery(name dnsmessage.Name, id uint16) ([]byte, error) {
+	builder := dnsmessage.NewBuilder(nil, dnsmessage.Header{ID: id})
+	builder.EnableCompression()
+	if err := builder.StartQuestions(); err != nil {
+		return nil, err
+	}
+	if err := builder.Question(dnsmessage.Question{
+		Name:  name,
+		Type:  dnsmessage.TypeA,
+		Class: dnsmessage.ClassINET,
+	}); err != nil {
+		return nil, err
+	}
+	return builder.Finish()
+}
+
+// parseMDNSResponse returns the first A record for name in the answer or
+// additional section of msg.
+func parseMDNSResponse(msg []byte, name dnsmessage.Name) (netip.Addr, time.Duration, bool) {
+	var parsed dnsmessage.Message
+	if err := parsed.Unpack(msg); err != nil || !parsed.Header.Response {
+		return netip.Addr{}, 0, false
+	}
+
+	records := append(parsed.Answers, parsed.Additionals...)
+	for _, record := range records {
+		a, ok := record.Body.(*dnsmessage.AResource)
+		if !ok || !strings.EqualFold(record.Header.Name.String(), name.String()) {
+			continue
+		}
+		return netip.AddrFrom4(a.A), time.Duration(record.Header.TTL) * time.Second, true
+	}
+	return netip.Addr{}, 0, false
+}
@@ -0,0 +1,183 @@
+package bot
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/netip"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/tsolodov/wot/config"
+	"github.com/tsolodov/wot/monitor"
+	"golang.org/x/net/dns/dnsmessage"
+)
+
+// startMDNSResponder answers A queries for the given names like an mDNS
+// responder answering a one-shot query: by unicast to the source port.
+func startMDNSResponder(t *testing.T, records map[string]netip.Addr) string {
+	t.Helper()
+	conn, err := net.ListenUDP("udp4", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+
+	go func() {
+		buf := make([]byte, 1500)
+		for {
+			n, from, err := conn.ReadFrom(buf)
+			if err != nil {
+				return
+			}
+			var query dnsmessage.Message
+			if err := query.Unpack(buf[:n]); err != nil || len(query.Questions) != 1 {
+				continue
+			}
+			question := query.Questions[0]
+			addr, ok := records[strings.ToLower(question.Name.String())]
+			if !ok {
+				continue
+			}
+
+			response := dnsmessage.Message{
+				Header:    dnsmessage.Header{ID: query.ID, Response: true, Authoritative: true},
+				Questions: query.Questions,
+				Answers: []dnsmessage.Resource{
+					// An unrelated record first, as responders often include several
+					{
+						Header: dnsmessage.ResourceHeader{Name: dnsmessage.MustNewName("other.local."), Type: dnsmessage.TypeA, Class: dnsmessage.ClassINET, TTL: 10},
+						Body:   &dnsmessage.AResource{A: [4]byte{10, 0, 0, 9}},
+					},
+					{
+						Header: dnsmessage.ResourceHeader{Name: question.Name, Type: dnsmessage.TypeA, Class: dnsmessage.ClassINET | 0x8000, TTL: 120},
+						Body:   &dnsmessage.AResource{A: addr.As4()},
+					},
+				},
+			}
+			packed, err := response.Pack()
+			if err != nil {
+				continue
+			}
+			conn.WriteTo(packed, from)
+		}
+	}()
+	return conn.LocalAddr().String()
+}
+
+func TestLookupMDNS(t *testing.T) {
+	server := startMDNSResponder(t, map[string]netip.Addr{
+		"nas.local.": netip.MustParseAddr("192.168.1.20"),
+	})
+
+	addr, ttl, err := lookupMDNS(context.Background(), "NAS.local", server, time.Second)
+	if err != nil {
+		t.Fatalf("lookupMDNS: %v", err)
+	}
+	if addr.String() != "192.168.1.20" || ttl != 120*time.Second {
+		t.Errorf("got %s (ttl %v), want 192.168.1.20 (ttl 2m0s)", addr, ttl)
+	}
+
+	if _, _, err := lookupMDNS(context.Background(), "missing.local", server, 200*time.Millisecond); err == nil {
+		t.Error("expected a timeout for a name nobody answers")
+	}
+
+	// A probe round that is cancelled does not wait for the mDNS timeout
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	if _, _, err := lookupMDNS(ctx, "missing.local", server, 5*time.Second); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("expected the context deadline, got %v", err)
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("lookup took %v after the context expired", elapsed)
+	}
+}
+
+func TestIsMDNSName(t *testing.T) {
+	for host, want := range map[string]bool{
+		"nas.local":   true,
+		"NAS.LOCAL.":  true,
+		"nas.lan":     false,
+		"localhost":   false,
+		"example.com": false,
+	} {
+		if got := isMDNSName(host); got != want {
+			t.Errorf("isMDNSName(%q) = %v, want %v", host, got, want)
+		}
+	}
+}
+
+func TestAddressResolverHostCache(t *testing.T) {
+	now := time.Unix(1700000000, 0)
+	lookups := 0
+	answer, answerErr := "192.168.1.20", error(nil)
+
+	resolver := NewAddressResolver(nil)
+	resolver.now = func() time.Time { return now }
+	resolver.lookupHost = func(ctx context.Context, host string) (string, time.Duration, error) {
+		lookups++
+		return answer, time.Minute, answerErr
+	}
+
+	nas := config.Server{Name: "nas", MACAddress: "aa:bb:cc:dd:ee:01", Host: "nas.local"}
+	for i := 0; i < 3; i++ {
+		if got, err := resolver.Resolve(context.Background(), nas); err != nil || got != "192.168.1.20" {
+			t.Fatalf("Resolve: %q (%v)", got, err)
+		}
+	}
+	if lookups != 1 {
+		t.Errorf("expected the answer to be cached, got %d lookups", lookups)
+	}
+
+	// After the TTL a silent mDNS host keeps its last address
+	now = now.Add(2 * time.Minute)
+	answerErr = errors.New("no mDNS answer")
+	if got, err := resolver.Resolve(context.Background(), nas); err != nil || got != "192.168.1.20" {
+		t.Errorf("stale mDNS address not used: %q (%v)", got, err)
+	}
+	if lookups != 2 {
+		t.Errorf("expected a new lookup after the TTL, got %d lookups", lookups)
+	}
+
+	// DNS failures are reported as unresolvable
+	_, err := resolver.Resolve(context.Background(), config.Server{Name: "web", MACAddress: "aa:bb:cc:dd:ee:02", Host: "web.example.com"})
+	var unresolvable *unresolvableError
+	if !errors.As(err, &unresolvable) {
+		t.Errorf("expected an unresolvable error, got %v", err)
+	}
+}
+
+func TestMonitorUnresolvableState(t *testing.T) {
+	resolver := NewAddressResolver(nil)
+	resolver.lookupHost = func(ctx context.Context, host string) (string, time.Duration, error) {
+		return "", 0, errors.New("NXDOMAIN")
+	}
+	network := NewNetwork()
+	network.resolver = resolver
+
+	server := config.Server{Name: "web", MACAddress: "aa:bb:cc:dd:ee:02", Host: "web.invalid"}
+	cfg := &config.Config{Servers: []config.Server{server}}
+	sm := monitor.New(context.Background(), cfg.Servers, cfg.Interval(), network)
+
+	changes := 0
+	sm.OnStatusChange(func(config.Server, bool, time.Time) { changes++ })
+	sm.CheckAll(context.Background())
+
+	state := sm.GetServerStates()["web"]
+	if state == nil || !state.Unknown || state.IsUp {
+		t.Fatalf("expected an unresolvable state, got %+v", state)
+	}
+	if changes != 0 {
+		t.Errorf("an unresolvable server must not be reported as a status change")
+	}
+
+	resolver.lookupHost = func(ctx context.Context, host string) (string, time.Duration, error) {
+		return "127.0.0.1", time.Minute, nil
+	}
+	sm.CheckAll(context.Background())
+	if state := sm.GetServerStates()["web"]; state.Unknown || state.Address != "127.0.0.1" {
+		t.Errorf("expected the server to resolve again, got %+v", state)
+	}
+}
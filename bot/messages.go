@@ -0,0 +1,531 @@
+package bot
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"text/template"
+	"time"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+	"github.com/tsolodov/wot/config"
+	"github.com/tsolodov/wot/monitor"
+)
+
+// defaultTemplates are the notification texts and command replies in
+// Telegram Markdown. Each can be replaced with the templates section of the
+// config.
+var defaultTemplates = map[string]string{
+	"server_up": `🟢 *{{md .Server}}* is now *UP*
+
+📍 IP: ` + "`{{.Address}}`" + `
+⏰ Time: {{datetime .Time}}
+{{- if .Downtime}}
+⏱️ Down for {{duration .Downtime}}{{if .DownSinceStartup}} (since monitoring started){{end}}
+{{- end}}
+{{- if .WokenBy}}
+⚡ Woken by {{md .WokenBy}} at {{clock .WokenAt}}
+{{- end}}`,
+
+	"server_down": `🔴 *{{md .Server}}* is now *DOWN*
+
+📍 IP: ` + "`{{.Address}}`" + `
+⏰ Time: {{datetime .Time}}
+🔎 No answer to {{.Probes}}
+✅ Last successful check: {{if .LastUp.IsZero}}none since monitoring started{{else}}{{datetime .LastUp}}{{end}}`,
+
+	"server_unknown": `⚠️ *{{md .Server}}*: *{{.Status}}*
+
+🔎 {{md .Error}}
+⏰ Time: {{datetime .Time}}`,
+
+	"started": `🤖 WoT Bot started successfully!
+{{- if .PowerLoss}}
+
+🔌 *Booted after a power loss*
+{{- if not .LastSeen.IsZero}}
+Last seen running {{datetime .LastSeen}}, not monitoring for {{duration .Offline}}
+{{- end}}
+{{- else if .UncleanShutdown}}
+
+⚠️ *The previous run did not shut down cleanly*
+{{- if not .LastSeen.IsZero}}
+Last seen running {{datetime .LastSeen}}, not monitoring for {{duration .Offline}}
+{{- end}}
+{{- end}}
+
+⏱️ System uptime: {{.Uptime}}
+🔍 Monitoring {{.Servers}} servers every {{duration .Interval}}
+⏰ Time: {{datetime .Time}}`,
+
+	"stopping": `🛑 WoT Bot shutting down ({{.Reason}})
+
+⏱️ Ran for {{duration .Ran}}
+⏰ Time: {{datetime .Time}}`,
+
+	"site_offline": `🔌 *Site {{md .Site}} is offline*
+
+⏰ No answer since {{datetime .Since}}
+⚡ Power cut or internet outage there?`,
+
+	"site_online": `🔌 *Site {{md .Site}} is back online*
+
+⏱️ Offline for {{duration .Downtime}}`,
+
+	"host_alert": `⚠️ *{{.Title}}* on the WoT host
+
+{{.Detail}}
+⏰ Time: {{datetime .Time}}`,
+
+	"host_ok": `✅ *{{.Title}}* resolved on the WoT host
+
+{{.Detail}}
+⏰ Time: {{datetime .Time}}`,
+
+	"remote_wake": `🌐 Wake packet sent to *{{md .Server}}* on request of site *{{md .From}}*
+⏰ Time: {{datetime .Time}}`,
+
+	"list": `{{if not .Servers}}📝 No servers configured{{else}}🖥️ *Configured Servers:*
+{{range .Servers}}
+• *{{md .Name}}* - {{if .Up}}✅ UP{{else if .Error}}⚠️ {{.Error}}{{else if not .Address}}❓ NO IP{{else}}❌ DOWN{{end}}
+{{- if .Host}}
+  Host: ` + "`{{.Host}}`" + `
+{{- end}}
+{{- if .Address}}
+  IP: ` + "`{{.Address}}`" + `{{if .Auto}} (auto){{end}}
+{{- end}}
+  MAC: ` + "`{{.MAC}}`" + `
+{{end}}{{end}}`,
+
+	"status": `{{if not (or .Servers .Site)}}📝 No servers configured{{else}}📊 *Server Status:*
+{{if .Site}}
+📍 *{{md .Site}}*{{end}}
+{{- range .Servers}}
+{{if .Error}}• *{{md .Name}}* ({{md .Display}}): ⚠️ {{.Error}}
+{{- else if not .Address}}• *{{md .Name}}*: ❓ NO IP ADDRESS
+{{- else}}• *{{md .Name}}* ({{md .Display}}): {{if .Up}}✅ UP{{else}}❌ DOWN{{end}}{{end}}
+{{- range .Notes}}
+  {{.}}
+{{- end}}
+{{- end}}
+{{- range .Sites}}
+
+📍 *{{md .Name}}*{{if .Online}} (as of {{shortdate .LastSeen}}){{else if not .OfflineSince.IsZero}}: 🔌 OFFLINE since {{shortdate .OfflineSince}}{{else}}: ❓ no answer yet{{end}}
+{{- range .Servers}}
+• *{{md .Name}}* ({{md .Display}}): {{if .Unknown}}⚠️ UNKNOWN{{else if .Up}}✅ UP{{else}}❌ DOWN{{end}}
+{{- end}}
+{{- end}}{{end}}`,
+
+	"wake": `{{if .Error}}❌ Failed to wake *{{md .Server}}*: {{md .Error}}{{else}}✅ Magic packet sent to *{{md .Server}}* ({{.MAC}}){{end}}`,
+
+	"wake_all": `🌟 *Waking all servers:*
+{{range .Results}}
+{{if .Skipped}}🔧 *{{md .Server}}*: In maintenance, skipped
+{{- else if .Error}}❌ *{{md .Server}}*: {{md .Error}}
+{{- else}}✅ *{{md .Server}}*: Magic packet sent{{end}}
+{{- end}}`,
+
+	"checkwake": `{{if .NoAddress}}{{if .Error}}❌ *{{md .Server}}*: No IP address, wake failed - {{md .Error}}{{else}}📡 *{{md .Server}}*: No IP address, sent wake packet{{end}}
+{{- else if .Up}}✅ *{{md .Server}}* is already UP
+{{- else if .Error}}❌ *{{md .Server}}* is DOWN, wake failed: {{md .Error}}
+{{- else}}🌟 *{{md .Server}}* was DOWN, sent wake packet{{end}}`,
+
+	"checkwake_all": `🔍 *Check and Wake Results:*
+{{range .Results}}
+{{if .Skipped}}🔧 *{{md .Server}}*: In maintenance, skipped
+{{- else if .NoAddress}}{{if .Error}}❌ *{{md .Server}}*: No IP, wake failed - {{md .Error}}{{else}}📡 *{{md .Server}}*: No IP, sent wake packet{{end}}
+{{- else if .Up}}✅ *{{md .Server}}*: Already UP
+{{- else if .Error}}❌ *{{md .Server}}*: DOWN, wake failed - {{md .Error}}
+{{- else}}🌟 *{{md .Server}}*: DOWN, sent wake packet{{end}}
+{{- end}}`,
+
+	"report": `📋 *{{md .Title}}*
+{{shortdate .From}} – {{shortdate .To}}
+
+🖥️ Pi: up {{.Uptime}}, load {{.Load}}
+{{- if .Gaps}}
+🔌 Not monitoring {{.Gaps}} times for {{duration .NotMonitoring}} in total (power cut?)
+{{- end}}
+{{range .Servers}}
+• *{{md .Name}}*: {{if not .Observed}}no data{{else}}{{percent .Availability}} up
+{{- if .Outages}}, {{.Outages}} outage{{if ne .Outages 1}}s{{end}} (longest {{duration .Longest}}){{end}}
+{{- if .Wakes}}, {{.Wakes}} wakes{{if .WakeFailures}} ({{.WakeFailures}} failed){{end}}{{end}}
+{{- end}}
+{{- end}}
+
+⚡ Wakes: {{.Wakes}}{{if .WakeFailures}}, {{.WakeFailures}} failed{{end}}`,
+}
+
+type unknownMessage struct {
+	Server string
+	Status string
+	Error  string
+	Time   time.Time
+}
+
+type startedMessage struct {
+	Uptime   string
+	Servers  int
+	Interval time.Duration
+	Time     time.Time
+
+	// Set when the previous run did not shut down cleanly. PowerLoss means
+	// the host booted since WoT was last seen running.
+	UncleanShutdown bool
+	PowerLoss       bool
+	LastSeen        time.Time
+	Offline         time.Duration
+}
+
+type stoppingMessage struct {
+	Reason string
+	Ran    time.Duration
+	Time   time.Time
+}
+
+type hostMessage struct {
+	Title  string
+	Detail string
+	Time   time.Time
+}
+
+type siteMessage struct {
+	Site     string
+	Since    time.Time
+	Downtime time.Duration
+	Time     time.Time
+}
+
+type remoteWakeMessage struct {
+	Server string
+	From   string
+	Time   time.Time
+}
+
+// serverLine is one server in the /list and /status replies.
+type serverLine struct {
+	Name    string
+	Host    string
+	Address string // empty if the server has no known IP address
+	Display string // host name and address as /status shows them
+	Auto    bool   // the address was found automatically
+	MAC     string
+	Up      bool
+	Unknown bool     // a peer site could not determine the status
+	Error   string   // UNRESOLVABLE or RELAY UNREACHABLE when the probe failed
+	Notes   []string // active maintenance and mutes, already formatted
+}
+
+type listMessage struct {
+	Servers []serverLine
+}
+
+// statusMessage is the /status reply. Site is the name of this instance and
+// only set when peer sites are configured.
+type statusMessage struct {
+	Site    string
+	Servers []serverLine
+	Sites   []siteStatus
+}
+
+type siteStatus struct {
+	Name         string
+	Online       bool
+	LastSeen     time.Time
+	OfflineSince time.Time
+	Servers      []serverLine
+}
+
+// wakeResult is the outcome of /wake or /checkwake for one server.
+type wakeResult struct {
+	Server    string
+	MAC       string
+	Skipped   bool // in maintenance
+	NoAddress bool // /checkwake could not probe it and woke it anyway
+	Up        bool // /checkwake found it up and did not wake it
+	Error     string
+}
+
+type wakeAllMessage struct {
+	Results []wakeResult
+}
+
+type reportMessage struct {
+	Title         string
+	From          time.Time
+	To            time.Time
+	Uptime        string
+	Load          string
+	Gaps          int
+	NotMonitoring time.Duration
+	Servers       []serverReport
+	Wakes         int
+	WakeFailures  int
+}
+
+// templateSamples are used to check configured templates when the config is
+// loaded, so a template referring to a missing field is rejected up front.
+// The samples fill in every field and cover each branch of the default
+// templates, so fields used inside if and range are checked too.
+var templateSamples = func() map[string][]any {
+	now := time.Date(2024, 5, 1, 3, 12, 9, 0, time.UTC)
+	change := monitor.StatusChange{
+		Server:           "nas",
+		Address:          "192.168.1.100",
+		Up:               true,
+		Time:             now,
+		Downtime:         time.Hour,
+		DownSinceStartup: true,
+		WokenBy:          "@alice",
+		WokenAt:          now.Add(-time.Minute),
+		Probes:           "ping and TCP port 22",
+		LastUp:           now.Add(-time.Hour),
+	}
+	started := startedMessage{
+		Uptime: "3d 2h 1m", Servers: 2, Interval: time.Minute, Time: now,
+		UncleanShutdown: true, PowerLoss: true, LastSeen: now.Add(-time.Hour), Offline: time.Hour,
+	}
+	unclean := started
+	unclean.PowerLoss = false
+	site := siteMessage{Site: "parents", Since: now.Add(-time.Hour), Downtime: time.Hour, Time: now}
+	host := hostMessage{Title: "Disk almost full", Detail: "/ is 95% full", Time: now}
+
+	line := serverLine{
+		Name: "nas", Host: "nas.local", Address: "192.168.1.100", Display: "nas.local → 192.168.1.100",
+		Auto: true, MAC: "aa:bb:cc:dd:ee:ff", Up: true, Notes: []string{"🔧 maintenance until May 1 04:00"},
+	}
+	lines := []serverLine{
+		line,
+		{Name: "web", Address: "192.168.1.101", Display: "192.168.1.101", MAC: "aa:bb:cc:dd:ee:01"},
+		{Name: "printer", Display: "unknown", MAC: "aa:bb:cc:dd:ee:02"},
+		{Name: "backup", Host: "backup.local", Display: "backup.local", MAC: "aa:bb:cc:dd:ee:03", Error: "UNRESOLVABLE"},
+		{Name: "remote", Address: "10.0.0.5", Display: "10.0.0.5", MAC: "aa:bb:cc:dd:ee:04", Unknown: true},
+	}
+	sites := []siteStatus{
+		{Name: "parents", Online: true, LastSeen: now, Servers: lines},
+		{Name: "office", OfflineSince: now.Add(-time.Hour), Servers: lines},
+		{Name: "cabin"},
+	}
+	results := []wakeResult{
+		{Server: "nas", MAC: "aa:bb:cc:dd:ee:ff"},
+		{Server: "nas", MAC: "aa:bb:cc:dd:ee:ff", Skipped: true},
+		{Server: "nas", MAC: "aa:bb:cc:dd:ee:ff", Error: "network unreachable"},
+		{Server: "nas", MAC: "aa:bb:cc:dd:ee:ff", NoAddress: true},
+		{Server: "nas", MAC: "aa:bb:cc:dd:ee:ff", NoAddress: true, Error: "network unreachable"},
+		{Server: "nas", MAC: "aa:bb:cc:dd:ee:ff", Up: true},
+	}
+	wakes := make([]any, len(results))
+	for i, result := range results {
+		wakes[i] = result
+	}
+	report := reportMessage{
+		Title: "Daily report", From: now.Add(-24 * time.Hour), To: now, Uptime: "3d 2h 1m", Load: "0.10 0.05 0.01",
+		Gaps: 1, NotMonitoring: time.Hour,
+		Servers: []serverReport{
+			{Name: "nas", Observed: 23 * time.Hour, Up: 22 * time.Hour, Outages: 2, Longest: time.Hour, Wakes: 2, WakeFailures: 1},
+			{Name: "web", Observed: 23 * time.Hour, Up: 23 * time.Hour, Outages: 1, Longest: time.Hour},
+			{Name: "printer"},
+		},
+		Wakes: 2, WakeFailures: 1,
+	}
+
+	return map[string][]any{
+		"server_up":      {change},
+		"server_down":    {change},
+		"server_unknown": {unknownMessage{Server: "nas", Status: "UNRESOLVABLE", Error: "no such host", Time: now}},
+		"started":        {started, unclean},
+		"stopping":       {stoppingMessage{Reason: "SIGTERM", Ran: time.Hour, Time: now}},
+		"site_offline":   {site},
+		"site_online":    {site},
+		"remote_wake":    {remoteWakeMessage{Server: "nas", From: "parents", Time: now}},
+		"host_alert":     {host},
+		"host_ok":        {host},
+		"list":           {listMessage{Servers: lines}, listMessage{}},
+		"status":         {statusMessage{Site: "home", Servers: lines, Sites: sites}, statusMessage{}},
+		"wake":           wakes,
+		"wake_all":       {wakeAllMessage{Results: results}},
+		"checkwake":      wakes,
+		"checkwake_all":  {wakeAllMessage{Results: results}},
+		"report":         {report},
+	}
+}()
+
+// Messages renders notification texts in the configured time zone. A nil
+// *Messages uses the default templates and the local time zone.
+type Messages struct {
+	mutex     sync.RWMutex
+	location  *time.Location
+	templates map[string]*template.Template
+}
+
+func NewMessages(cfg *config.Config) (*Messages, error) {
+	m := &Messages{}
+	if err := m.Update(cfg); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+// Update switches to the time zone and templates of config.
+func (m *Messages) Update(cfg *config.Config) error {
+	apply, err := m.prepare(cfg)
+	if err != nil {
+		return err
+	}
+	apply()
+	return nil
+}
+
+// prepare parses the time zone and templates of cfg and returns a function
+// that switches to them, so a reload can check everything before it
+// applies anything.
+func (m *Messages) prepare(cfg *config.Config) (func(), error) {
+	location, templates, err := parseMessages(cfg)
+	if err != nil {
+		return nil, err
+	}
+	return func() {
+		m.mutex.Lock()
+		defer m.mutex.Unlock()
+		m.location = location
+		m.templates = templates
+	}, nil
+}
+
+func parseMessages(cfg *config.Config) (*time.Location, map[string]*template.Template, error) {
+	location := time.Local
+	if cfg.Timezone != "" {
+		var err error
+		location, err = time.LoadLocation(cfg.Timezone)
+		if err != nil {
+			return nil, nil, fmt.Errorf("timezone: %w", err)
+		}
+	}
+
+	for name := range cfg.Templates {
+		if _, ok := defaultTemplates[name]; !ok {
+			return nil, nil, fmt.Errorf("templates: unknown template '%s' (available: %s)", name, strings.Join(templateNames(), ", "))
+		}
+	}
+
+	funcs := templateFuncs(location)
+	templates := make(map[string]*template.Template, len(defaultTemplates))
+	for name, text := range defaultTemplates {
+		if custom, ok := cfg.Templates[name]; ok {
+			text = custom
+		}
+		tmpl, err := template.New(name).Funcs(funcs).Option("missingkey=error").Parse(text)
+		if err != nil {
+			return nil, nil, fmt.Errorf("templates.%s: %w", name, err)
+		}
+		for _, sample := range templateSamples[name] {
+			if err := tmpl.Execute(&strings.Builder{}, sample); err != nil {
+				return nil, nil, fmt.Errorf("templates.%s: %w", name, err)
+			}
+		}
+		templates[name] = tmpl
+	}
+	return location, templates, nil
+}
+
+func templateNames() []string {
+	names := make([]string, 0, len(defaultTemplates))
+	for name := range defaultTemplates {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func templateFuncs(location *time.Location) template.FuncMap {
+	return template.FuncMap{
+		"datetime":  func(t time.Time) string { return t.In(location).Format("2006-01-02 15:04:05 MST") },
+		"clock":     func(t time.Time) string { return t.In(location).Format("15:04") },
+		"shortdate": func(t time.Time) string { return t.In(location).Format(shortDateLayout) },
+		"duration":  formatDuration,
+		"percent":   formatPercent,
+		"md":        func(s string) string { return tgbotapi.EscapeText(tgbotapi.ModeMarkdown, s) },
+	}
+}
+
+// Render executes the named template. Errors cannot happen with validated
+// templates except for broken data, in which case the error is shown in the
+// message rather than dropping the notification.
+func (m *Messages) Render(name string, data any) string {
+	tmpl := m.template(name)
+	var text strings.Builder
+	if err := tmpl.Execute(&text, data); err != nil {
+		return fmt.Sprintf("%s (template %s failed: %v)", text.String(), name, err)
+	}
+	return text.String()
+}
+
+func (m *Messages) template(name string) *template.Template {
+	if m != nil {
+		m.mutex.RLock()
+		defer m.mutex.RUnlock()
+		if tmpl, ok := m.templates[name]; ok {
+			return tmpl
+		}
+	}
+	return template.Must(template.New(name).Funcs(templateFuncs(time.Local)).Parse(defaultTemplates[name]))
+}
+
+// In converts t to the configured time zone. Notifications carry their time
+// in it so that summaries built from them show local times too.
+func (m *Messages) In(t time.Time) time.Time {
+	if m == nil {
+		return t.In(time.Local)
+	}
+	m.mutex.RLock()
+	defer m.mutex.RUnlock()
+	return t.In(m.location)
+}
+
+// shortDateLayout is how chat replies show times.
+const shortDateLayout = "Jan 2 15:04"
+
+// Clock formats t for chat replies.
+func (m *Messages) Clock(t time.Time) string {
+	return m.In(t).Format(shortDateLayout)
+}
+
+// formatDuration formats d as e.g. "2d 3h 5m", "3h 5m" or "5m", and in
+// seconds below a minute.
+func formatDuration(d time.Duration) string {
+	if d < time.Minute {
+		return fmt.Sprintf("%ds", int(d.Seconds()))
+	}
+
+	days := int(d.Hours()) / 24
+	hours := int(d.Hours()) % 24
+	minutes := int(d.Minutes()) % 60
+
+	if days > 0 {
+		return fmt.Sprintf("%dd %dh %dm", days, hours, minutes)
+	} else if hours > 0 {
+		return fmt.Sprintf("%dh %dm", hours, minutes)
+	}
+	return fmt.Sprintf("%dm", minutes)
+}
+
+// plainText turns a rendered Markdown message into plain text for channels
+// that do not understand Telegram Markdown.
+func plainText(markdown string) string {
+	var text strings.Builder
+	escaped := false
+	for _, r := range markdown {
+		switch {
+		case escaped:
+			text.WriteRune(r)
+			escaped = false
+		case r == '\\':
+			escaped = true
+		case r == '*' || r == '_' || r == '`':
+		default:
+			text.WriteRune(r)
+		}
+	}
+	return text.String()
+}
@@ -0,0 +1,147 @@
+package bot
+
+import (
+	"context"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/tsolodov/wot/config"
+	"github.com/tsolodov/wot/monitor"
+)
+
+func TestMessagesTemplates(t *testing.T) {
+	cfg := &config.Config{
+		Timezone: "Europe/Berlin",
+		Templates: map[string]string{
+			"server_down": "{{.Server}} down at {{datetime .Time}}, last up {{clock .LastUp}}",
+			"wake":        "{{if .Error}}no luck with {{.Server}}{{else}}{{.Server}} is waking up{{end}}",
+		},
+	}
+	messages, err := NewMessages(cfg)
+	if err != nil {
+		t.Fatalf("NewMessages: %v", err)
+	}
+
+	down := time.Date(2024, 5, 1, 8, 30, 0, 0, time.UTC)
+	got := messages.Render("server_down", monitor.StatusChange{Server: "nas", Time: down, LastUp: down.Add(-5 * time.Minute)})
+	if want := "nas down at 2024-05-01 10:30:00 CEST, last up 10:25"; got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+
+	got = messages.Render("server_up", monitor.StatusChange{
+		Server:   "k8s_master",
+		Address:  "192.168.1.20",
+		Time:     down.Add(time.Hour),
+		Downtime: 65 * time.Minute,
+		WokenBy:  "@alice",
+		WokenAt:  down.Add(58 * time.Minute),
+	})
+	for _, want := range []string{`*k8s\_master* is now *UP*`, "2024-05-01 11:30:00 CEST", "Down for 1h 5m", `Woken by @alice at 11:28`} {
+		if !strings.Contains(got, want) {
+			t.Errorf("UP message %q does not contain %q", got, want)
+		}
+	}
+	if plain := plainText(got); !strings.Contains(plain, "k8s_master is now UP") {
+		t.Errorf("plain text not unescaped: %q", plain)
+	}
+
+	if got := messages.Render("wake", wakeResult{Server: "nas", Error: "network unreachable"}); got != "no luck with nas" {
+		t.Errorf("wake reply: got %q", got)
+	}
+
+	if got := messages.In(down).Format("15:04 MST"); got != "10:30 CEST" {
+		t.Errorf("In: got %s", got)
+	}
+}
+
+func TestMessagesValidation(t *testing.T) {
+	tests := []struct {
+		config  config.Config
+		wantErr string
+	}{
+		{config.Config{Timezone: "Mars/Olympus"}, "timezone"},
+		{config.Config{Templates: map[string]string{"server_sideways": "x"}}, "unknown template"},
+		{config.Config{Templates: map[string]string{"server_up": "{{.Server"}}, "templates.server_up"},
+		{config.Config{Templates: map[string]string{"server_up": "{{.Hostname}}"}}, "templates.server_up"},
+		{config.Config{Templates: map[string]string{"server_up": "{{nonsense .Server}}"}}, "templates.server_up"},
+		// Fields inside if and range are checked against filled-in samples
+		{config.Config{Templates: map[string]string{"server_up": "{{if .WokenBy}}{{.WokenByName}}{{end}}"}}, "templates.server_up"},
+		{config.Config{Templates: map[string]string{"list": "{{range .Servers}}{{.Nmae}}{{end}}"}}, "templates.list"},
+		{config.Config{Templates: map[string]string{"report": "{{range .Servers}}{{.Uptime}}{{end}}"}}, "templates.report"},
+	}
+	for _, tt := range tests {
+		_, err := NewMessages(&tt.config)
+		if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+			t.Errorf("%+v: expected error containing %q, got %v", tt.config, tt.wantErr, err)
+		}
+	}
+}
+
+func TestFormatDuration(t *testing.T) {
+	tests := map[time.Duration]string{
+		42 * time.Second:                  "42s",
+		5 * time.Minute:                   "5m",
+		3*time.Hour + 5*time.Minute:       "3h 5m",
+		50*time.Hour + 90*time.Second + 1: "2d 2h 1m",
+	}
+	for duration, want := range tests {
+		if got := formatDuration(duration); got != want {
+			t.Errorf("%v: got %q, want %q", duration, got, want)
+		}
+	}
+}
+
+func TestMonitorNotificationContext(t *testing.T) {
+	agent, relay, _ := startTestRelay(t, "correct horse battery staple")
+	network := testNetwork(t, relay)
+	var up atomic.Bool
+	up.Store(true)
+	agent.probe = func(context.Context, config.Server) (string, bool, error) {
+		return "192.168.50.10", up.Load(), nil
+	}
+
+	recorder := &recordingNotifier{name: "test"}
+	dispatcher := NewNotificationDispatcher()
+	dispatcher.Add(recorder, nil)
+
+	server := config.Server{Name: "nas", MACAddress: "aa:bb:cc:dd:ee:01", Relay: "parents", TCPPorts: []int{22, 445}}
+	cfg := &config.Config{Servers: []config.Server{server}}
+	sm := monitor.New(context.Background(), cfg.Servers, cfg.Interval(), network)
+	sm.Notifier = statusNotifier{notifier: dispatcher}
+
+	up.Store(false)
+	sm.CheckAll(context.Background())
+	if recorder.count() != 1 {
+		t.Fatalf("expected a DOWN notification, got %d", recorder.count())
+	}
+	down := recorder.got[0]
+	if !strings.Contains(down.Markdown, "No answer to ping and TCP ports 22, 445 via relay parents") ||
+		strings.Contains(down.Markdown, "none since monitoring started") {
+		t.Errorf("DOWN notification lacks probe context: %s", down.Markdown)
+	}
+
+	sm.RecordWake("nas", "@alice", nil)
+	up.Store(true)
+	sm.CheckAll(context.Background())
+	if recorder.count() != 2 {
+		t.Fatalf("expected an UP notification, got %d", recorder.count())
+	}
+	upMessage := recorder.got[1]
+	if !strings.Contains(upMessage.Markdown, "Down for") || !strings.Contains(upMessage.Markdown, "Woken by @alice") {
+		t.Errorf("UP notification lacks downtime or wake: %s", upMessage.Markdown)
+	}
+	if upMessage.Message != plainText(upMessage.Markdown) {
+		t.Errorf("plain message differs from the Markdown text: %q", upMessage.Message)
+	}
+
+	// A wake that was not followed by the server coming up is not reused
+	up.Store(false)
+	sm.CheckAll(context.Background())
+	up.Store(true)
+	sm.CheckAll(context.Background())
+	if strings.Contains(recorder.got[3].Markdown, "Woken by") {
+		t.Errorf("stale wake attributed: %s", recorder.got[3].Markdown)
+	}
+}
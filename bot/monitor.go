@@ -0,0 +1,54 @@
+package bot
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/tsolodov/wot/config"
+	"github.com/tsolodov/wot/monitor"
+)
+
+// statusNotifier renders the monitor's status changes with the configured
+// templates and dispatches them.
+type statusNotifier struct {
+	notifier *NotificationDispatcher
+	messages *Messages
+}
+
+func (s statusNotifier) StatusChanged(change monitor.StatusChange) {
+	status, template, severity := "DOWN", "server_down", SeverityCritical
+	if change.Up {
+		status, template, severity = "UP", "server_up", SeverityInfo
+	}
+
+	markdown := s.messages.Render(template, change)
+	s.notifier.Dispatch(Notification{
+		Severity: severity,
+		Title:    fmt.Sprintf("%s is now %s", change.Server, status),
+		Message:  plainText(markdown),
+		Markdown: markdown,
+		Server:   change.Server,
+		Status:   status,
+		Time:     s.messages.In(change.Time),
+	})
+}
+
+func (s statusNotifier) StatusUnknown(server config.Server, err error, timestamp time.Time) {
+	status := probeErrorStatus(err)
+	markdown := s.messages.Render("server_unknown", unknownMessage{
+		Server: server.Name,
+		Status: status,
+		Error:  err.Error(),
+		Time:   timestamp,
+	})
+	s.notifier.Dispatch(Notification{
+		Severity: SeverityWarning,
+		Title:    fmt.Sprintf("%s: %s", server.Name, strings.ToLower(status)),
+		Message:  plainText(markdown),
+		Markdown: markdown,
+		Server:   server.Name,
+		Status:   status,
+		Time:     s.messages.In(timestamp),
+	})
+}
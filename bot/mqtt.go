@@ -0,0 +1,324 @@
+package bot
+
+import (
+	"bufio"
+	"crypto/tls"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/url"
+	"sync"
+	"time"
+)
+
+// Minimal MQTT 3.1.1 client. Only the parts needed by the Home Assistant
+// bridge are implemented: QoS 0 publish/subscribe, retained messages,
+// last will and keepalive pings.
+
+const (
+	mqttConnect     = 1
+	mqttConnack     = 2
+	mqttPublish     = 3
+	mqttSubscribe   = 8
+	mqttSuback      = 9
+	mqttPingreq     = 12
+	mqttPingresp    = 13
+	mqttDisconnect  = 14
+	mqttDialTimeout = 10 * time.Second
+
+	// mqttMaxPacketSize caps what a broker can make us allocate; the bridge
+	// only receives short wake commands
+	mqttMaxPacketSize = 1 << 20
+)
+
+type mqttConnectOptions struct {
+	Broker      string
+	ClientID    string
+	Username    string
+	Password    string
+	KeepAlive   time.Duration
+	WillTopic   string
+	WillPayload []byte
+	WillRetain  bool
+}
+
+type mqttClient struct {
+	conn      net.Conn
+	reader    *bufio.Reader
+	writeMu   sync.Mutex
+	nextID    uint16
+	keepAlive time.Duration
+}
+
+type mqttPacket struct {
+	Type    byte
+	Flags   byte
+	Payload []byte
+}
+
+func dialMQTT(opts mqttConnectOptions) (*mqttClient, error) {
+	conn, err := dialMQTTBroker(opts.Broker)
+	if err != nil {
+		return nil, err
+	}
+
+	client := &mqttClient{
+		conn:      conn,
+		reader:    bufio.NewReader(conn),
+		keepAlive: opts.KeepAlive,
+	}
+
+	conn.SetDeadline(time.Now().Add(mqttDialTimeout))
+	if err := client.writePacket(mqttConnect, 0, encodeMQTTConnect(opts)); err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("failed to send CONNECT: %w", err)
+	}
+
+	packet, err := readMQTTPacket(client.reader)
+	if err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("failed to read CONNACK: %w", err)
+	}
+	if packet.Type != mqttConnack || len(packet.Payload) < 2 {
+		conn.Close()
+		return nil, fmt.Errorf("unexpected packet type %d while waiting for CONNACK", packet.Type)
+	}
+	if code := packet.Payload[1]; code != 0 {
+		conn.Close()
+		return nil, fmt.Errorf("broker refused connection: %s", mqttConnackReason(code))
+	}
+	conn.SetDeadline(time.Time{})
+
+	return client, nil
+}
+
+func dialMQTTBroker(broker string) (net.Conn, error) {
+	u, err := url.Parse(broker)
+	if err != nil || u.Host == "" {
+		// Plain host:port without scheme
+		return net.DialTimeout("tcp", broker, mqttDialTimeout)
+	}
+
+	dialer := &net.Dialer{Timeout: mqttDialTimeout}
+	switch u.Scheme {
+	case "tcp", "mqtt":
+		host := u.Host
+		if u.Port() == "" {
+			host = net.JoinHostPort(u.Hostname(), "1883")
+		}
+		return dialer.Dial("tcp", host)
+	case "ssl", "tls", "mqtts":
+		host := u.Host
+		if u.Port() == "" {
+			host = net.JoinHostPort(u.Hostname(), "8883")
+		}
+		return tls.DialWithDialer(dialer, "tcp", host, &tls.Config{ServerName: u.Hostname()})
+	default:
+		return nil, fmt.Errorf("unsupported MQTT broker scheme %q", u.Scheme)
+	}
+}
+
+func mqttConnackReason(code byte) string {
+	switch code {
+	case 1:
+		return "unacceptable protocol version"
+	case 2:
+		return "identifier rejected"
+	case 3:
+		return "server unavailable"
+	case 4:
+		return "bad username or password"
+	case 5:
+		return "not authorized"
+	default:
+		return fmt.Sprintf("return code %d", code)
+	}
+}
+
+func encodeMQTTConnect(opts mqttConnectOptions) []byte {
+	var flags byte = 0x02 // clean session
+	if opts.WillTopic != "" {
+		flags |= 0x04
+		if opts.WillRetain {
+			flags |= 0x20
+		}
+	}
+	if opts.Username != "" {
+		flags |= 0x80
+		if opts.Password != "" {
+			flags |= 0x40
+		}
+	}
+
+	var buf []byte
+	buf = appendMQTTString(buf, "MQTT")
+	buf = append(buf, 4, flags)
+	buf = binary.BigEndian.AppendUint16(buf, uint16(opts.KeepAlive/time.Second))
+	buf = appendMQTTString(buf, opts.ClientID)
+	if opts.WillTopic != "" {
+		buf = appendMQTTString(buf, opts.WillTopic)
+		buf = appendMQTTBytes(buf, opts.WillPayload)
+	}
+	if opts.Username != "" {
+		buf = appendMQTTString(buf, opts.Username)
+		if opts.Password != "" {
+			buf = appendMQTTString(buf, opts.Password)
+		}
+	}
+	return buf
+}
+
+func appendMQTTString(buf []byte, s string) []byte {
+	return appendMQTTBytes(buf, []byte(s))
+}
+
+func appendMQTTBytes(buf, b []byte) []byte {
+	buf = binary.BigEndian.AppendUint16(buf, uint16(len(b)))
+	return append(buf, b...)
+}
+
+func readMQTTString(b []byte) (string, []byte, error) {
+	if len(b) < 2 {
+		return "", nil, errors.New("malformed string")
+	}
+	n := int(binary.BigEndian.Uint16(b))
+	if len(b) < 2+n {
+		return "", nil, errors.New("malformed string")
+	}
+	return string(b[2 : 2+n]), b[2+n:], nil
+}
+
+func writeMQTTPacket(w io.Writer, packetType, flags byte, payload []byte) error {
+	header := []byte{packetType<<4 | flags}
+	length := len(payload)
+	for {
+		digit := byte(length % 128)
+		length /= 128
+		if length > 0 {
+			digit |= 0x80
+		}
+		header = append(header, digit)
+		if length == 0 {
+			break
+		}
+	}
+	_, err := w.Write(append(header, payload...))
+	return err
+}
+
+func readMQTTPacket(r *bufio.Reader) (*mqttPacket, error) {
+	first, err := r.ReadByte()
+	if err != nil {
+		return nil, err
+	}
+
+	length := 0
+	multiplier := 1
+	for i := 0; ; i++ {
+		if i == 4 {
+			return nil, errors.New("malformed remaining length")
+		}
+		digit, err := r.ReadByte()
+		if err != nil {
+			return nil, err
+		}
+		length += int(digit&0x7f) * multiplier
+		multiplier *= 128
+		if digit&0x80 == 0 {
+			break
+		}
+	}
+
+	if length > mqttMaxPacketSize {
+		return nil, fmt.Errorf("packet of %d bytes exceeds the %d byte limit", length, mqttMaxPacketSize)
+	}
+	payload := make([]byte, length)
+	if _, err := io.ReadFull(r, payload); err != nil {
+		return nil, err
+	}
+
+	return &mqttPacket{Type: first >> 4, Flags: first & 0x0f, Payload: payload}, nil
+}
+
+func (c *mqttClient) writePacket(packetType, flags byte, payload []byte) error {
+	c.writeMu.Lock()
+	defer c.writeMu.Unlock()
+
+	c.conn.SetWriteDeadline(time.Now().Add(mqttDialTimeout))
+	return writeMQTTPacket(c.conn, packetType, flags, payload)
+}
+
+func (c *mqttClient) Publish(topic string, payload []byte, retain bool) error {
+	var flags byte
+	if retain {
+		flags = 0x01
+	}
+	buf := appendMQTTString(nil, topic)
+	buf = append(buf, payload...)
+	return c.writePacket(mqttPublish, flags, buf)
+}
+
+func (c *mqttClient) Subscribe(topics ...string) error {
+	c.writeMu.Lock()
+	c.nextID++
+	if c.nextID == 0 {
+		c.nextID = 1
+	}
+	id := c.nextID
+	c.writeMu.Unlock()
+
+	buf := binary.BigEndian.AppendUint16(nil, id)
+	for _, topic := range topics {
+		buf = appendMQTTString(buf, topic)
+		buf = append(buf, 0) // QoS 0
+	}
+	return c.writePacket(mqttSubscribe, 0x02, buf)
+}
+
+func (c *mqttClient) Ping() error {
+	return c.writePacket(mqttPingreq, 0, nil)
+}
+
+// ReadLoop dispatches incoming PUBLISH packets to handler, telling it whether
+// the broker delivered a retained message, until the connection fails. A
+// missing PINGRESP within 1.5x keepalive is treated as a dead connection.
+func (c *mqttClient) ReadLoop(handler func(topic string, payload []byte, retained bool)) error {
+	for {
+		if c.keepAlive > 0 {
+			c.conn.SetReadDeadline(time.Now().Add(c.keepAlive * 3 / 2))
+		}
+
+		packet, err := readMQTTPacket(c.reader)
+		if err != nil {
+			return err
+		}
+
+		switch packet.Type {
+		case mqttPublish:
+			topic, rest, err := readMQTTString(packet.Payload)
+			if err != nil {
+				return fmt.Errorf("malformed PUBLISH: %w", err)
+			}
+			if qos := (packet.Flags >> 1) & 0x03; qos > 0 {
+				// Skip packet identifier; we only subscribe with QoS 0 so
+				// the broker should never deliver higher QoS messages.
+				if len(rest) < 2 {
+					return errors.New("malformed PUBLISH: missing packet identifier")
+				}
+				rest = rest[2:]
+			}
+			handler(topic, rest, packet.Flags&0x01 != 0)
+		case mqttSuback, mqttPingresp:
+			// Nothing to do
+		default:
+			return fmt.Errorf("unexpected packet type %d", packet.Type)
+		}
+	}
+}
+
+func (c *mqttClient) Close() error {
+	c.writePacket(mqttDisconnect, 0, nil)
+	return c.conn.Close()
+}
@@ -0,0 +1,341 @@
+package bot
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"net"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/tsolodov/wot/config"
+	"github.com/tsolodov/wot/monitor"
+)
+
+// testBroker is a tiny in-process MQTT broker supporting just enough of
+// MQTT 3.1.1 to exercise MQTTBridge.
+type testBroker struct {
+	listener  net.Listener
+	mutex     sync.Mutex
+	conns     map[net.Conn][]string
+	connects  int
+	published chan mqttMessage
+}
+
+type mqttMessage struct {
+	Topic   string
+	Payload string
+	Retain  bool
+}
+
+func newTestBroker(t *testing.T) *testBroker {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Failed to listen: %v", err)
+	}
+
+	broker := &testBroker{
+		listener:  listener,
+		conns:     make(map[net.Conn][]string),
+		published: make(chan mqttMessage, 100),
+	}
+	go broker.serve()
+	t.Cleanup(func() { listener.Close() })
+	return broker
+}
+
+func (b *testBroker) Addr() string {
+	return "tcp://" + b.listener.Addr().String()
+}
+
+func (b *testBroker) serve() {
+	for {
+		conn, err := b.listener.Accept()
+		if err != nil {
+			return
+		}
+		go b.handle(conn)
+	}
+}
+
+func (b *testBroker) handle(conn net.Conn) {
+	defer func() {
+		b.mutex.Lock()
+		delete(b.conns, conn)
+		b.mutex.Unlock()
+		conn.Close()
+	}()
+
+	reader := bufio.NewReader(conn)
+	for {
+		packet, err := readMQTTPacket(reader)
+		if err != nil {
+			return
+		}
+
+		switch packet.Type {
+		case mqttConnect:
+			b.mutex.Lock()
+			b.conns[conn] = nil
+			b.connects++
+			b.mutex.Unlock()
+			writeMQTTPacket(conn, mqttConnack, 0, []byte{0, 0})
+		case mqttSubscribe:
+			rest := packet.Payload[2:]
+			var topics []string
+			for len(rest) > 0 {
+				var topic string
+				topic, rest, _ = readMQTTString(rest)
+				rest = rest[1:]
+				topics = append(topics, topic)
+			}
+			b.mutex.Lock()
+			b.conns[conn] = append(b.conns[conn], topics...)
+			b.mutex.Unlock()
+			writeMQTTPacket(conn, mqttSuback, 0, append(packet.Payload[:2:2], 0))
+		case mqttPublish:
+			topic, payload, _ := readMQTTString(packet.Payload)
+			b.published <- mqttMessage{Topic: topic, Payload: string(payload), Retain: packet.Flags&0x01 != 0}
+		case mqttPingreq:
+			writeMQTTPacket(conn, mqttPingresp, 0, nil)
+		case mqttDisconnect:
+			return
+		}
+	}
+}
+
+// Inject delivers a message to every client subscribed to a matching topic.
+func (b *testBroker) Inject(topic, payload string) int {
+	return b.inject(topic, payload, 0)
+}
+
+// InjectRetained delivers a message as the broker delivers a retained one
+// after subscribing.
+func (b *testBroker) InjectRetained(topic, payload string) int {
+	return b.inject(topic, payload, 0x01)
+}
+
+func (b *testBroker) inject(topic, payload string, flags byte) int {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	delivered := 0
+	for conn, filters := range b.conns {
+		for _, filter := range filters {
+			if mqttTopicMatches(filter, topic) {
+				buf := appendMQTTString(nil, topic)
+				writeMQTTPacket(conn, mqttPublish, flags, append(buf, payload...))
+				delivered++
+				break
+			}
+		}
+	}
+	return delivered
+}
+
+func (b *testBroker) DropAll() {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	for conn := range b.conns {
+		conn.Close()
+	}
+}
+
+func (b *testBroker) Connects() int {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	return b.connects
+}
+
+func mqttTopicMatches(filter, topic string) bool {
+	filterParts := strings.Split(filter, "/")
+	topicParts := strings.Split(topic, "/")
+	for i, part := range filterParts {
+		if part == "#" {
+			return true
+		}
+		if i >= len(topicParts) || (part != "+" && part != topicParts[i]) {
+			return false
+		}
+	}
+	return len(filterParts) == len(topicParts)
+}
+
+// waitForMessages collects published messages until all wanted topics have
+// been seen or the timeout expires.
+func (b *testBroker) waitForMessages(t *testing.T, topics ...string) map[string]mqttMessage {
+	t.Helper()
+
+	seen := make(map[string]mqttMessage)
+	deadline := time.After(5 * time.Second)
+	for {
+		missing := false
+		for _, topic := range topics {
+			if _, ok := seen[topic]; !ok {
+				missing = true
+			}
+		}
+		if !missing {
+			return seen
+		}
+
+		select {
+		case msg := <-b.published:
+			seen[msg.Topic] = msg
+		case <-deadline:
+			t.Fatalf("Timed out waiting for topics %v, got %v", topics, seen)
+		}
+	}
+}
+
+func newTestMQTTBridge(broker *testBroker, sm *monitor.ServerMonitor) (*MQTTBridge, chan string) {
+	cfg := &config.Config{
+		Servers: []config.Server{
+			{Name: "server1", MACAddress: "aa:bb:cc:dd:ee:ff", IPAddress: "192.168.1.100"},
+			{Name: "Windows Box", MACAddress: "aa-bb-cc-dd-ee-f1"},
+		},
+		MQTT: &config.MQTTConfig{Broker: broker.Addr()},
+	}
+
+	woken := make(chan string, 10)
+	bridge := NewMQTTBridge(cfg, sm, nil)
+	bridge.wake = func(server config.Server) error {
+		woken <- server.Name
+		return nil
+	}
+	bridge.minBackoff = 10 * time.Millisecond
+	bridge.maxBackoff = 50 * time.Millisecond
+	return bridge, woken
+}
+
+func TestMQTTBridgeDiscoveryAndWake(t *testing.T) {
+	broker := newTestBroker(t)
+	servers := []config.Server{{Name: "server1"}}
+	sm := monitor.New(context.Background(), servers, time.Minute, monitor.ProberFunc(func(context.Context, config.Server) (string, bool, error) {
+		return "", true, nil
+	}))
+
+	bridge, woken := newTestMQTTBridge(broker, sm)
+	bridge.Start()
+	defer bridge.Stop()
+
+	messages := broker.waitForMessages(t,
+		"homeassistant/binary_sensor/wot/server1/config",
+		"homeassistant/button/wot/server1_wake/config",
+		"homeassistant/binary_sensor/wot/windows_box/config",
+		"homeassistant/button/wot/windows_box_wake/config",
+		"wot/availability",
+		"wot/server1/status",
+	)
+
+	var sensor haDiscovery
+	if err := json.Unmarshal([]byte(messages["homeassistant/binary_sensor/wot/server1/config"].Payload), &sensor); err != nil {
+		t.Fatalf("Invalid discovery payload: %v", err)
+	}
+	if sensor.StateTopic != "wot/server1/status" || sensor.DeviceClass != "connectivity" {
+		t.Errorf("Unexpected binary_sensor discovery payload: %+v", sensor)
+	}
+	if len(sensor.Device.Connections) != 1 || sensor.Device.Connections[0][1] != "aa:bb:cc:dd:ee:ff" {
+		t.Errorf("Expected device MAC connection, got %v", sensor.Device.Connections)
+	}
+
+	var button haDiscovery
+	if err := json.Unmarshal([]byte(messages["homeassistant/button/wot/windows_box_wake/config"].Payload), &button); err != nil {
+		t.Fatalf("Invalid discovery payload: %v", err)
+	}
+	if button.CommandTopic != "wot/windows_box/wake" {
+		t.Errorf("Expected command topic wot/windows_box/wake, got %s", button.CommandTopic)
+	}
+
+	if msg := messages["wot/server1/status"]; msg.Payload != "ON" || !msg.Retain {
+		t.Errorf("Expected retained ON state, got %+v", msg)
+	}
+	if msg := messages["wot/availability"]; msg.Payload != "online" {
+		t.Errorf("Expected online availability, got %+v", msg)
+	}
+
+	// Subscription is sent after the announcements; retry until delivered
+	deadline := time.Now().Add(5 * time.Second)
+	for broker.InjectRetained("wot/windows_box/wake", "PRESS") == 0 {
+		if time.Now().After(deadline) {
+			t.Fatal("Bridge never subscribed to wake topics")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	// A retained press would wake the server on every reconnect, and only
+	// the payload announced in discovery is a press
+	broker.Inject("wot/windows_box/wake", "ON")
+	broker.Inject("wot/windows_box/wake", "PRESS")
+
+	select {
+	case name := <-woken:
+		if name != "Windows Box" {
+			t.Errorf("Expected wake for 'Windows Box', got '%s'", name)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Timed out waiting for wake")
+	}
+	select {
+	case name := <-woken:
+		t.Errorf("Unexpected second wake for '%s'", name)
+	case <-time.After(50 * time.Millisecond):
+	}
+}
+
+func TestMQTTBridgeReconnectAndStateChange(t *testing.T) {
+	broker := newTestBroker(t)
+	var up atomic.Bool
+	up.Store(true)
+	sm := monitor.New(context.Background(), nil, time.Minute, monitor.ProberFunc(func(context.Context, config.Server) (string, bool, error) {
+		return "", up.Load(), nil
+	}))
+
+	bridge, _ := newTestMQTTBridge(broker, sm)
+	bridge.Start()
+	defer bridge.Stop()
+
+	broker.waitForMessages(t, "wot/availability")
+
+	broker.DropAll()
+	broker.waitForMessages(t, "wot/availability")
+	if connects := broker.Connects(); connects < 2 {
+		t.Errorf("Expected bridge to reconnect, got %d connects", connects)
+	}
+
+	sm.UpdateServers(context.Background(), []config.Server{{Name: "server1"}}, time.Minute)
+	up.Store(false)
+	sm.CheckAll(context.Background())
+
+	messages := broker.waitForMessages(t, "wot/server1/status")
+	if msg := messages["wot/server1/status"]; msg.Payload != "OFF" {
+		t.Errorf("Expected OFF state after change, got %+v", msg)
+	}
+}
+
+func TestMQTTSlug(t *testing.T) {
+	tests := map[string]string{
+		"server1":     "server1",
+		"K8s-Master":  "k8s-master",
+		"Windows Box": "windows_box",
+		"nas/backup":  "nas_backup",
+	}
+	for input, expected := range tests {
+		if got := mqttSlug(input); got != expected {
+			t.Errorf("mqttSlug(%q) = %q, expected %q", input, got, expected)
+		}
+	}
+}
+
+func TestReadMQTTPacketLimit(t *testing.T) {
+	// A remaining length of 256MB-1 is valid MQTT, but far more than a wake
+	// command needs
+	header := []byte{mqttPublish << 4, 0xff, 0xff, 0xff, 0x7f}
+	if _, err := readMQTTPacket(bufio.NewReader(bytes.NewReader(header))); err == nil || !strings.Contains(err.Error(), "exceeds") {
+		t.Errorf("expected the size limit, got %v", err)
+	}
+}
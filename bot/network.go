@@ -0,0 +1,149 @@
+package bot
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"sync"
+
+	"github.com/tsolodov/wot/config"
+	"github.com/tsolodov/wot/probe"
+	"github.com/tsolodov/wot/wol"
+)
+
+// errShuttingDown is returned for wakes requested after shutdown began.
+var errShuttingDown = errors.New("WoT is shutting down")
+
+// Network probes and wakes servers, directly or through their relay agent.
+// Lease files and relays are set from the config at startup and on reload.
+type Network struct {
+	resolver *AddressResolver
+	relays   *RelayPool
+
+	// prober and packets reach the local network; tests replace them with
+	// simulated hosts
+	prober  probe.Prober
+	packets wol.PacketSender
+
+	// wakes counts the wakes in progress so shutdown can wait for them
+	mutex    sync.Mutex
+	wakes    sync.WaitGroup
+	draining bool
+}
+
+func NewNetwork() *Network {
+	return &Network{
+		resolver: NewAddressResolver(nil),
+		relays:   &RelayPool{},
+		prober:   probe.NewDefault(),
+		packets:  wol.UDP{},
+	}
+}
+
+// Configure applies the lease files and relays of cfg.
+func (n *Network) Configure(cfg *config.Config) error {
+	apply, err := n.prepare(cfg)
+	if err != nil {
+		return err
+	}
+	apply()
+	return nil
+}
+
+// prepare sets up the relay clients of cfg and returns a function that
+// switches to them and to its lease files.
+func (n *Network) prepare(cfg *config.Config) (func(), error) {
+	applyRelays, err := n.relays.prepare(cfg.Relays)
+	if err != nil {
+		return nil, err
+	}
+	return func() {
+		applyRelays()
+		n.resolver.SetLeaseFiles(cfg.DHCPLeases)
+	}, nil
+}
+
+// Probe finds the server's current address and checks whether it is up,
+// through the server's relay if it has one. The address is empty if it could
+// not be determined. The error is set only when the status is unknown: the
+// host name could not be resolved or the relay could not be reached.
+func (n *Network) Probe(ctx context.Context, server config.Server) (string, bool, error) {
+	if server.Relay != "" {
+		client, err := n.relays.Get(server.Relay)
+		if err != nil {
+			return "", false, err
+		}
+		return client.Check(ctx, server)
+	}
+
+	address, err := n.resolver.Resolve(ctx, server)
+	if err != nil {
+		var unresolvable *unresolvableError
+		if errors.As(err, &unresolvable) {
+			return "", false, err
+		}
+		return "", false, nil
+	}
+	return address, n.prober.Host(ctx, address, server.TCPPorts), nil
+}
+
+// Up reports whether server answers, treating an unknown status as down.
+func (n *Network) Up(ctx context.Context, server config.Server) bool {
+	_, up, _ := n.Probe(ctx, server)
+	return up
+}
+
+// Wake sends a magic packet to server, through its relay agent if it has one.
+// A wake that has started is completed even if ctx is cancelled, so that a
+// shutdown does not cut off a packet someone asked for.
+func (n *Network) Wake(ctx context.Context, server config.Server, broadcastIP string) error {
+	n.mutex.Lock()
+	if n.draining {
+		n.mutex.Unlock()
+		return errShuttingDown
+	}
+	n.wakes.Add(1)
+	n.mutex.Unlock()
+	defer n.wakes.Done()
+	ctx = context.WithoutCancel(ctx)
+
+	if server.Relay != "" {
+		client, err := n.relays.Get(server.Relay)
+		if err != nil {
+			return err
+		}
+		slog.Info("Waking server through relay", "server", server.Name, "relay", server.Relay)
+		return client.Wake(ctx, server.MACAddress)
+	}
+	slog.Info("Sending magic packet", "server", server.Name, "mac", server.MACAddress, "broadcast", broadcastIP)
+	return wol.SendVia(ctx, n.packets, server.MACAddress, broadcastIP)
+}
+
+// Drain refuses further wakes and waits until those in progress are done or
+// ctx ends.
+func (n *Network) Drain(ctx context.Context) error {
+	n.mutex.Lock()
+	n.draining = true
+	n.mutex.Unlock()
+
+	done := make(chan struct{})
+	go func() {
+		n.wakes.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// probeErrorStatus labels an error from Probe for status messages.
+func probeErrorStatus(err error) string {
+	var relayErr *relayError
+	if errors.As(err, &relayErr) {
+		return "RELAY UNREACHABLE"
+	}
+	return "UNRESOLVABLE"
+}
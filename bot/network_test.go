@@ -0,0 +1,50 @@
+package bot
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/tsolodov/wot/clock"
+	"github.com/tsolodov/wot/config"
+	"github.com/tsolodov/wot/internal/simnet"
+	"github.com/tsolodov/wot/monitor"
+)
+
+func TestNetworkSimulatedWake(t *testing.T) {
+	ctx := context.Background()
+	clk := clock.NewVirtual(time.Date(2025, 1, 1, 8, 0, 0, 0, time.UTC))
+	sim := simnet.New(clk)
+	nas := sim.AddHost("192.168.1.10", "aa:bb:cc:dd:ee:01")
+	nas.BootDelay = 2 * time.Minute
+	nas.NoPing = true
+	nas.Ports = []int{22}
+
+	network := NewNetwork()
+	network.prober, network.packets = sim.Prober(), sim
+
+	recorder := &recordingNotifier{name: "test"}
+	dispatcher := NewNotificationDispatcher()
+	dispatcher.Add(recorder, nil)
+	server := config.Server{Name: "nas", MACAddress: "aa:bb:cc:dd:ee:01", IPAddress: "192.168.1.10"}
+	sm := monitor.NewWithClock(ctx, []config.Server{server}, time.Minute, network, clk)
+	sm.Notifier = statusNotifier{notifier: dispatcher}
+
+	err := network.Wake(ctx, server, "192.168.1.255")
+	sm.RecordWake("nas", "@alice", err)
+	if got := sim.MagicPackets(); len(got) != 1 || got[0] != server.MACAddress {
+		t.Fatalf("magic packets %v", got)
+	}
+
+	clk.Advance(time.Minute)
+	sm.CheckAll(ctx)
+	if network.Up(ctx, server) || recorder.count() != 0 {
+		t.Fatalf("nas came up before booting: %+v", recorder.got)
+	}
+	clk.Advance(time.Minute)
+	sm.CheckAll(ctx)
+	if recorder.count() != 1 || recorder.got[0].Status != "UP" || !strings.Contains(recorder.got[0].Markdown, "Woken by @alice at 08:00") {
+		t.Fatalf("expected an UP notification crediting the wake, got %+v", recorder.got)
+	}
+}
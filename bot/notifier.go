@@ -0,0 +1,332 @@
+package bot
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+	"github.com/tsolodov/wot/config"
+)
+
+type Severity int
+
+const (
+	SeverityInfo Severity = iota
+	SeverityWarning
+	SeverityCritical
+)
+
+func (s Severity) String() string {
+	switch s {
+	case SeverityWarning:
+		return "warning"
+	case SeverityCritical:
+		return "critical"
+	default:
+		return "info"
+	}
+}
+
+func parseSeverity(s string) (Severity, error) {
+	switch strings.ToLower(strings.TrimSpace(s)) {
+	case "info":
+		return SeverityInfo, nil
+	case "warning", "warn":
+		return SeverityWarning, nil
+	case "critical", "crit":
+		return SeverityCritical, nil
+	default:
+		return SeverityInfo, fmt.Errorf("unknown severity %q (expected info, warning or critical)", s)
+	}
+}
+
+// Notification is a channel-independent alert. Message is plain text;
+// Markdown is an optional Telegram-formatted variant of the same content.
+// Status is set to UP or DOWN for server state changes so a backlog of them
+// can be summarised.
+type Notification struct {
+	Severity Severity  `json:"severity"`
+	Title    string    `json:"title"`
+	Message  string    `json:"message,omitempty"`
+	Markdown string    `json:"markdown,omitempty"`
+	Server   string    `json:"server,omitempty"`
+	Status   string    `json:"status,omitempty"`
+	Time     time.Time `json:"time"`
+}
+
+// Notifier delivers notifications to a single channel.
+type Notifier interface {
+	Name() string
+	Notify(n Notification) error
+}
+
+type notifierRoute struct {
+	notifier   Notifier
+	severities map[Severity]bool
+}
+
+// NotificationDispatcher fans notifications out to every notifier whose
+// severity routing matches. Notifiers are called concurrently so a channel
+// that is down or slow never delays or blocks the others.
+type NotificationDispatcher struct {
+	routes []notifierRoute
+}
+
+func NewNotificationDispatcher() *NotificationDispatcher {
+	return &NotificationDispatcher{}
+}
+
+// Add registers a notifier for the given severities. An empty list routes
+// every severity to the notifier.
+func (d *NotificationDispatcher) Add(notifier Notifier, severities []string) error {
+	route := notifierRoute{notifier: notifier}
+	if len(severities) > 0 {
+		route.severities = make(map[Severity]bool)
+		for _, s := range severities {
+			severity, err := parseSeverity(s)
+			if err != nil {
+				return fmt.Errorf("notifier %s: %w", notifier.Name(), err)
+			}
+			route.severities[severity] = true
+		}
+	}
+
+	d.routes = append(d.routes, route)
+	return nil
+}
+
+func (d *NotificationDispatcher) Dispatch(n Notification) {
+	if d == nil {
+		return
+	}
+	if n.Time.IsZero() {
+		n.Time = time.Now()
+	}
+
+	var wg sync.WaitGroup
+	for _, route := range d.routes {
+		if route.severities != nil && !route.severities[n.Severity] {
+			continue
+		}
+
+		wg.Add(1)
+		go func(notifier Notifier) {
+			defer wg.Done()
+			if err := notifier.Notify(n); err != nil {
+				slog.Error("Failed to send notification", "notifier", notifier.Name(), "error", err)
+			}
+		}(route.notifier)
+	}
+	wg.Wait()
+}
+
+// buildNotifiers creates the dispatcher for a config. The Telegram admin chat
+// is included when telegram is non-nil; everything else comes from the
+// notifiers section. Every notifier is wrapped in a durable outbound queue
+// stored under the state directory; the queues are returned so the caller can
+// start them.
+func buildNotifiers(cfg *config.Config, telegram *TelegramNotifier) (*NotificationDispatcher, []*NotificationQueue, error) {
+	dispatcher := NewNotificationDispatcher()
+	queueDir := filepath.Join(cfg.StateDirectory(), "queue")
+	var queues []*NotificationQueue
+
+	add := func(notifier Notifier, file string, severities []string) error {
+		queue := NewNotificationQueue(notifier, filepath.Join(queueDir, file))
+		if err := dispatcher.Add(queue, severities); err != nil {
+			return err
+		}
+		queues = append(queues, queue)
+		return nil
+	}
+
+	if telegram != nil {
+		if err := add(telegram, "telegram.json", cfg.Telegram.NotifySeverities); err != nil {
+			return nil, nil, err
+		}
+	}
+
+	for i, nc := range cfg.Notifiers {
+		notifier, err := newNotifier(nc)
+		if err != nil {
+			return nil, nil, fmt.Errorf("notifiers[%d]: %w", i, err)
+		}
+		file := fmt.Sprintf("%02d-%s.json", i, strings.ToLower(nc.Type))
+		if err := add(notifier, file, nc.Severities); err != nil {
+			return nil, nil, err
+		}
+	}
+
+	if telegram != nil {
+		telegram.onReady = queues[0].Retry
+	}
+
+	return dispatcher, queues, nil
+}
+
+func newNotifier(nc config.NotifierConfig) (Notifier, error) {
+	name := nc.Name
+	if name == "" {
+		name = nc.Type
+	}
+
+	requireURL := func() error {
+		if nc.URL == "" {
+			return fmt.Errorf("%s notifier %q requires url", nc.Type, name)
+		}
+		return nil
+	}
+
+	switch strings.ToLower(nc.Type) {
+	case "webhook":
+		if err := requireURL(); err != nil {
+			return nil, err
+		}
+		return &WebhookNotifier{name: name, url: nc.URL, headers: nc.Headers}, nil
+	case "ntfy":
+		if err := requireURL(); err != nil {
+			return nil, err
+		}
+		return &NtfyNotifier{name: name, url: nc.URL, token: nc.Token}, nil
+	case "gotify":
+		if err := requireURL(); err != nil {
+			return nil, err
+		}
+		if nc.Token == "" {
+			return nil, fmt.Errorf("gotify notifier %q requires token", name)
+		}
+		return &GotifyNotifier{name: name, url: nc.URL, token: nc.Token}, nil
+	case "matrix":
+		if err := requireURL(); err != nil {
+			return nil, err
+		}
+		if nc.Token == "" || nc.RoomID == "" {
+			return nil, fmt.Errorf("matrix notifier %q requires token and room_id", name)
+		}
+		return &MatrixNotifier{name: name, homeserver: nc.URL, token: nc.Token, roomID: nc.RoomID}, nil
+	case "slack":
+		if err := requireURL(); err != nil {
+			return nil, err
+		}
+		return &SlackNotifier{name: name, url: nc.URL}, nil
+	case "discord":
+		if err := requireURL(); err != nil {
+			return nil, err
+		}
+		return &DiscordNotifier{name: name, url: nc.URL}, nil
+	case "email", "smtp":
+		if nc.SMTPHost == "" || nc.From == "" || len(nc.To) == 0 {
+			return nil, fmt.Errorf("email notifier %q requires smtp_host, from and to", name)
+		}
+		port := nc.SMTPPort
+		if port == 0 {
+			port = 587
+		}
+		return &EmailNotifier{
+			name:     name,
+			host:     nc.SMTPHost,
+			port:     port,
+			username: nc.Username,
+			password: nc.Password,
+			from:     nc.From,
+			to:       nc.To,
+		}, nil
+	default:
+		return nil, fmt.Errorf("unknown notifier type %q", nc.Type)
+	}
+}
+
+var errTelegramNotConnected = errors.New("telegram bot not connected yet")
+
+// TelegramNotifier sends notifications to a Telegram chat. Until a bot is
+// attached with SetBot every Notify fails, which leaves the notification in
+// the outbound queue for delivery once the Bot API becomes reachable.
+type TelegramNotifier struct {
+	chatID  int64
+	mutex   sync.Mutex
+	bot     Messenger
+	onReady func()
+	// topic returns the forum topic for alerts about a server, 0 for the
+	// general one; unset, everything goes to the general topic
+	topic func(server string) int
+}
+
+func NewTelegramNotifier(chatID int64) *TelegramNotifier {
+	return &TelegramNotifier{chatID: chatID}
+}
+
+func (t *TelegramNotifier) Name() string {
+	return "telegram"
+}
+
+// SetBot attaches a connected bot and triggers delivery of anything queued
+// while it was unavailable.
+func (t *TelegramNotifier) SetBot(bot Messenger) {
+	t.mutex.Lock()
+	t.bot = bot
+	onReady := t.onReady
+	t.mutex.Unlock()
+
+	if onReady != nil {
+		onReady()
+	}
+}
+
+func (t *TelegramNotifier) Notify(n Notification) error {
+	t.mutex.Lock()
+	bot := t.bot
+	t.mutex.Unlock()
+
+	if bot == nil {
+		return errTelegramNotConnected
+	}
+
+	var msg tgbotapi.MessageConfig
+	if n.Markdown != "" {
+		msg = tgbotapi.NewMessage(t.chatID, n.Markdown)
+		msg.ParseMode = "Markdown"
+	} else {
+		msg = tgbotapi.NewMessage(t.chatID, plainNotificationText(n))
+	}
+
+	err := t.send(bot, msg, n.Server)
+	var apiErr *tgbotapi.Error
+	if n.Markdown != "" && errors.As(err, &apiErr) && strings.Contains(apiErr.Message, "can't parse entities") {
+		// Rather plain text than losing the notification to a stray _ or *
+		slog.Warn("Telegram rejected notification Markdown, sending it as plain text", "title", n.Title, "error", err)
+		err = t.send(bot, tgbotapi.NewMessage(t.chatID, plainNotificationText(n)), n.Server)
+	}
+	if errors.As(err, &apiErr) && apiErr.Code == 400 {
+		return permanent(err)
+	}
+	return err
+}
+
+func (t *TelegramNotifier) send(bot Messenger, msg tgbotapi.MessageConfig, server string) error {
+	if thread := t.topicFor(server); thread != 0 {
+		return sendToTopic(bot, msg, thread)
+	}
+	_, err := bot.Send(msg)
+	return err
+}
+
+func (t *TelegramNotifier) topicFor(server string) int {
+	if t.topic == nil || server == "" {
+		return 0
+	}
+	return t.topic(server)
+}
+
+func plainNotificationText(n Notification) string {
+	if n.Message == "" {
+		return n.Title
+	}
+	if n.Title == "" {
+		return n.Message
+	}
+	return n.Title + "\n\n" + n.Message
+}
@@ -0,0 +1,119 @@
+package bot
+
+import (
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"mime"
+	"net"
+	"net/smtp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// emailTimeout bounds the whole SMTP conversation, so a server that stops
+// answering cannot stall the notification queue.
+const emailTimeout = 30 * time.Second
+
+// EmailNotifier sends notifications over SMTP. STARTTLS is used
+// automatically when the server offers it.
+type EmailNotifier struct {
+	name     string
+	host     string
+	port     int
+	username string
+	password string
+	from     string
+	to       []string
+	timeout  time.Duration // emailTimeout when zero
+}
+
+func (e *EmailNotifier) Name() string { return e.name }
+
+func (e *EmailNotifier) Notify(n Notification) error {
+	timeout := e.timeout
+	if timeout == 0 {
+		timeout = emailTimeout
+	}
+
+	addr := net.JoinHostPort(e.host, strconv.Itoa(e.port))
+	dialer := net.Dialer{Timeout: timeout}
+	conn, err := dialer.Dial("tcp", addr)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	if err := conn.SetDeadline(time.Now().Add(timeout)); err != nil {
+		return err
+	}
+
+	return e.send(conn, e.buildMessage(n))
+}
+
+// send drives the SMTP conversation the way smtp.SendMail does, but over
+// a connection whose deadline the caller controls.
+func (e *EmailNotifier) send(conn net.Conn, msg []byte) error {
+	client, err := smtp.NewClient(conn, e.host)
+	if err != nil {
+		return err
+	}
+	defer client.Close()
+
+	if ok, _ := client.Extension("STARTTLS"); ok {
+		if err := client.StartTLS(&tls.Config{ServerName: e.host}); err != nil {
+			return err
+		}
+	}
+	if e.username != "" {
+		if ok, _ := client.Extension("AUTH"); !ok {
+			return errors.New("smtp: server doesn't support AUTH")
+		}
+		if err := client.Auth(smtp.PlainAuth("", e.username, e.password, e.host)); err != nil {
+			return err
+		}
+	}
+
+	if err := client.Mail(e.from); err != nil {
+		return err
+	}
+	for _, to := range e.to {
+		if err := client.Rcpt(to); err != nil {
+			return err
+		}
+	}
+	w, err := client.Data()
+	if err != nil {
+		return err
+	}
+	if _, err := w.Write(msg); err != nil {
+		return err
+	}
+	if err := w.Close(); err != nil {
+		return err
+	}
+	return client.Quit()
+}
+
+func (e *EmailNotifier) buildMessage(n Notification) []byte {
+	subject := "[WoT] " + n.Title
+	if n.Title == "" {
+		subject = "[WoT] " + n.Severity.String() + " notification"
+	}
+
+	var msg strings.Builder
+	fmt.Fprintf(&msg, "From: %s\r\n", e.from)
+	fmt.Fprintf(&msg, "To: %s\r\n", strings.Join(e.to, ", "))
+	fmt.Fprintf(&msg, "Subject: %s\r\n", mime.QEncoding.Encode("utf-8", sanitizeHeader(subject)))
+	fmt.Fprintf(&msg, "Date: %s\r\n", n.Time.Format(time.RFC1123Z))
+	msg.WriteString("MIME-Version: 1.0\r\n")
+	msg.WriteString("Content-Type: text/plain; charset=UTF-8\r\n")
+	msg.WriteString("\r\n")
+	msg.WriteString(strings.ReplaceAll(n.Message, "\n", "\r\n"))
+	msg.WriteString("\r\n")
+	return []byte(msg.String())
+}
+
+func sanitizeHeader(value string) string {
+	return strings.NewReplacer("\r", " ", "\n", " ").Replace(value)
+}
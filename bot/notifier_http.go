@@ -0,0 +1,225 @@
+package bot
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+const notifierHTTPTimeout = 10 * time.Second
+
+func postNotification(method, endpoint string, body []byte, headers map[string]string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), notifierHTTPTimeout)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, method, endpoint, bytes.NewReader(body))
+	if err != nil {
+		return permanent(fmt.Errorf("failed to build request: %w", err))
+	}
+	for key, value := range headers {
+		// A value the transport refuses would fail the same way on every
+		// retry and block the queue behind it
+		if !validHeaderValue(value) {
+			return permanent(fmt.Errorf("invalid value for header %s", key))
+		}
+		req.Header.Set(key, value)
+	}
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		// Slack and Discord webhook URLs are credentials, so only the host
+		// goes into the error
+		var urlErr *url.Error
+		if errors.As(err, &urlErr) {
+			return fmt.Errorf("%s %s failed: %w", method, req.URL.Host, urlErr.Err)
+		}
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		detail, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		err := fmt.Errorf("unexpected status %s: %s", resp.Status, strings.TrimSpace(string(detail)))
+		if resp.StatusCode >= 400 && resp.StatusCode < 500 &&
+			resp.StatusCode != http.StatusRequestTimeout && resp.StatusCode != http.StatusTooManyRequests {
+			return permanent(err)
+		}
+		return err
+	}
+	return nil
+}
+
+// validHeaderValue reports whether net/http will send value, which refuses
+// control characters other than tab.
+func validHeaderValue(value string) bool {
+	for i := 0; i < len(value); i++ {
+		if c := value[i]; (c < ' ' && c != '\t') || c == 0x7f {
+			return false
+		}
+	}
+	return true
+}
+
+func postJSON(url string, payload any, headers map[string]string) error {
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return fmt.Errorf("failed to encode payload: %w", err)
+	}
+
+	all := map[string]string{"Content-Type": "application/json"}
+	for key, value := range headers {
+		all[key] = value
+	}
+	return postNotification(http.MethodPost, url, body, all)
+}
+
+// WebhookNotifier POSTs the notification as JSON to an arbitrary URL.
+type WebhookNotifier struct {
+	name    string
+	url     string
+	headers map[string]string
+}
+
+type webhookPayload struct {
+	Severity string    `json:"severity"`
+	Title    string    `json:"title"`
+	Message  string    `json:"message"`
+	Server   string    `json:"server,omitempty"`
+	Time     time.Time `json:"time"`
+}
+
+func (w *WebhookNotifier) Name() string { return w.name }
+
+func (w *WebhookNotifier) Notify(n Notification) error {
+	return postJSON(w.url, webhookPayload{
+		Severity: n.Severity.String(),
+		Title:    n.Title,
+		Message:  n.Message,
+		Server:   n.Server,
+		Time:     n.Time,
+	}, w.headers)
+}
+
+// NtfyNotifier publishes to an ntfy topic URL such as https://ntfy.sh/mytopic.
+type NtfyNotifier struct {
+	name  string
+	url   string
+	token string
+}
+
+func (n *NtfyNotifier) Name() string { return n.name }
+
+func (n *NtfyNotifier) Notify(notification Notification) error {
+	priority := map[Severity]string{
+		SeverityInfo:     "default",
+		SeverityWarning:  "high",
+		SeverityCritical: "urgent",
+	}[notification.Severity]
+
+	// ntfy decodes RFC 2047 header values, which keeps non-ASCII titles
+	// intact and line breaks out of the header
+	headers := map[string]string{
+		"Title":    mime.QEncoding.Encode("utf-8", sanitizeHeader(notification.Title)),
+		"Priority": priority,
+		"Tags":     notification.Severity.String(),
+	}
+	if n.token != "" {
+		headers["Authorization"] = "Bearer " + n.token
+	}
+	return postNotification(http.MethodPost, n.url, []byte(notification.Message), headers)
+}
+
+// GotifyNotifier sends to a Gotify server using an application token.
+type GotifyNotifier struct {
+	name  string
+	url   string
+	token string
+}
+
+func (g *GotifyNotifier) Name() string { return g.name }
+
+func (g *GotifyNotifier) Notify(n Notification) error {
+	priority := map[Severity]int{
+		SeverityInfo:     2,
+		SeverityWarning:  5,
+		SeverityCritical: 8,
+	}[n.Severity]
+
+	return postJSON(strings.TrimRight(g.url, "/")+"/message", map[string]any{
+		"title":    n.Title,
+		"message":  n.Message,
+		"priority": priority,
+	}, map[string]string{"X-Gotify-Key": g.token})
+}
+
+// MatrixNotifier posts an m.text message into a Matrix room.
+type MatrixNotifier struct {
+	name       string
+	homeserver string
+	token      string
+	roomID     string
+	txnCounter atomic.Int64
+}
+
+func (m *MatrixNotifier) Name() string { return m.name }
+
+func (m *MatrixNotifier) Notify(n Notification) error {
+	txnID := strconv.FormatInt(time.Now().UnixNano(), 10) + "-" + strconv.FormatInt(m.txnCounter.Add(1), 10)
+	endpoint := fmt.Sprintf("%s/_matrix/client/v3/rooms/%s/send/m.room.message/%s",
+		strings.TrimRight(m.homeserver, "/"), url.PathEscape(m.roomID), txnID)
+
+	body, err := json.Marshal(map[string]string{
+		"msgtype": "m.text",
+		"body":    plainNotificationText(n),
+	})
+	if err != nil {
+		return fmt.Errorf("failed to encode payload: %w", err)
+	}
+
+	return postNotification(http.MethodPut, endpoint, body, map[string]string{
+		"Content-Type":  "application/json",
+		"Authorization": "Bearer " + m.token,
+	})
+}
+
+// SlackNotifier posts to a Slack-compatible incoming webhook (Slack,
+// Mattermost, Rocket.Chat, ...).
+type SlackNotifier struct {
+	name string
+	url  string
+}
+
+func (s *SlackNotifier) Name() string { return s.name }
+
+func (s *SlackNotifier) Notify(n Notification) error {
+	text := n.Message
+	if n.Title != "" {
+		text = "*" + n.Title + "*\n" + n.Message
+	}
+	return postJSON(s.url, map[string]string{"text": text}, nil)
+}
+
+// DiscordNotifier posts to a Discord channel webhook.
+type DiscordNotifier struct {
+	name string
+	url  string
+}
+
+func (d *DiscordNotifier) Name() string { return d.name }
+
+func (d *DiscordNotifier) Notify(n Notification) error {
+	content := n.Message
+	if n.Title != "" {
+		content = "**" + n.Title + "**\n" + n.Message
+	}
+	return postJSON(d.url, map[string]string{"content": content}, nil)
+}
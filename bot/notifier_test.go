@@ -0,0 +1,352 @@
+package bot
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"mime"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+	"github.com/tsolodov/wot/config"
+)
+
+type recordingNotifier struct {
+	name  string
+	err   error
+	mutex sync.Mutex
+	got   []Notification
+}
+
+func (r *recordingNotifier) Name() string { return r.name }
+
+func (r *recordingNotifier) Notify(n Notification) error {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	r.got = append(r.got, n)
+	return r.err
+}
+
+func (r *recordingNotifier) count() int {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	return len(r.got)
+}
+
+func TestNotificationDispatcherRouting(t *testing.T) {
+	all := &recordingNotifier{name: "all"}
+	critical := &recordingNotifier{name: "critical"}
+	broken := &recordingNotifier{name: "broken", err: errors.New("telegram unreachable")}
+
+	dispatcher := NewNotificationDispatcher()
+	if err := dispatcher.Add(broken, nil); err != nil {
+		t.Fatal(err)
+	}
+	if err := dispatcher.Add(all, nil); err != nil {
+		t.Fatal(err)
+	}
+	if err := dispatcher.Add(critical, []string{"critical"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := dispatcher.Add(&recordingNotifier{name: "bad"}, []string{"loud"}); err == nil {
+		t.Error("Expected error for unknown severity")
+	}
+
+	dispatcher.Dispatch(Notification{Severity: SeverityInfo, Title: "started"})
+	dispatcher.Dispatch(Notification{Severity: SeverityCritical, Title: "server1 is now DOWN"})
+
+	if all.count() != 2 {
+		t.Errorf("Expected unrouted notifier to receive 2 notifications despite a failing sibling, got %d", all.count())
+	}
+	if critical.count() != 1 || critical.got[0].Title != "server1 is now DOWN" {
+		t.Errorf("Expected critical notifier to receive only the DOWN notification, got %+v", critical.got)
+	}
+	if critical.got[0].Time.IsZero() {
+		t.Error("Expected dispatcher to fill in notification time")
+	}
+}
+
+func TestHTTPNotifiers(t *testing.T) {
+	type request struct {
+		Method  string
+		Path    string
+		Headers http.Header
+		Body    string
+	}
+
+	requests := make(chan request, 1)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		requests <- request{Method: r.Method, Path: r.URL.Path, Headers: r.Header, Body: string(body)}
+	}))
+	defer server.Close()
+
+	notification := Notification{
+		Severity: SeverityCritical,
+		Title:    "server1 is now DOWN",
+		Message:  "IP: 192.168.1.100",
+		Server:   "server1",
+		Time:     time.Date(2025, 1, 2, 3, 4, 5, 0, time.UTC),
+	}
+
+	tests := []struct {
+		config config.NotifierConfig
+		check  func(t *testing.T, r request)
+	}{
+		{
+			config: config.NotifierConfig{Type: "webhook", URL: server.URL + "/hook", Headers: map[string]string{"X-Api-Key": "k"}},
+			check: func(t *testing.T, r request) {
+				var payload webhookPayload
+				if err := json.Unmarshal([]byte(r.Body), &payload); err != nil {
+					t.Fatalf("Invalid JSON: %v", err)
+				}
+				if payload.Severity != "critical" || payload.Server != "server1" || r.Headers.Get("X-Api-Key") != "k" {
+					t.Errorf("Unexpected webhook request: %+v %v", payload, r.Headers)
+				}
+			},
+		},
+		{
+			config: config.NotifierConfig{Type: "ntfy", URL: server.URL + "/wot", Token: "tk"},
+			check: func(t *testing.T, r request) {
+				if r.Path != "/wot" || r.Headers.Get("Priority") != "urgent" || r.Headers.Get("Authorization") != "Bearer tk" {
+					t.Errorf("Unexpected ntfy request: %s %v", r.Path, r.Headers)
+				}
+				if r.Headers.Get("Title") != notification.Title || r.Body != notification.Message {
+					t.Errorf("Unexpected ntfy content: %v %q", r.Headers, r.Body)
+				}
+			},
+		},
+		{
+			config: config.NotifierConfig{Type: "gotify", URL: server.URL + "/", Token: "app"},
+			check: func(t *testing.T, r request) {
+				if r.Path != "/message" || r.Headers.Get("X-Gotify-Key") != "app" || !strings.Contains(r.Body, `"priority":8`) {
+					t.Errorf("Unexpected gotify request: %s %v %s", r.Path, r.Headers, r.Body)
+				}
+			},
+		},
+		{
+			config: config.NotifierConfig{Type: "matrix", URL: server.URL, Token: "mx", RoomID: "!room:example.org"},
+			check: func(t *testing.T, r request) {
+				if r.Method != http.MethodPut || !strings.HasPrefix(r.Path, "/_matrix/client/v3/rooms/!room:example.org/send/m.room.message/") {
+					t.Errorf("Unexpected matrix request: %s %s", r.Method, r.Path)
+				}
+				if r.Headers.Get("Authorization") != "Bearer mx" || !strings.Contains(r.Body, "server1 is now DOWN") {
+					t.Errorf("Unexpected matrix content: %v %s", r.Headers, r.Body)
+				}
+			},
+		},
+		{
+			config: config.NotifierConfig{Type: "slack", URL: server.URL},
+			check: func(t *testing.T, r request) {
+				if !strings.Contains(r.Body, `"text":"*server1 is now DOWN*\nIP: 192.168.1.100"`) {
+					t.Errorf("Unexpected slack body: %s", r.Body)
+				}
+			},
+		},
+		{
+			config: config.NotifierConfig{Type: "discord", URL: server.URL},
+			check: func(t *testing.T, r request) {
+				if !strings.Contains(r.Body, `"content":"**server1 is now DOWN**\nIP: 192.168.1.100"`) {
+					t.Errorf("Unexpected discord body: %s", r.Body)
+				}
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.config.Type, func(t *testing.T) {
+			notifier, err := newNotifier(tt.config)
+			if err != nil {
+				t.Fatalf("Failed to create notifier: %v", err)
+			}
+			if err := notifier.Notify(notification); err != nil {
+				t.Fatalf("Notify failed: %v", err)
+			}
+			tt.check(t, <-requests)
+		})
+	}
+}
+
+func TestHTTPNotifierErrorHidesURL(t *testing.T) {
+	server := httptest.NewServer(http.NotFoundHandler())
+	hook := server.URL + "/services/T000/B000/XXXXSECRET"
+	server.Close()
+
+	notifier, err := newNotifier(config.NotifierConfig{Type: "slack", URL: hook})
+	if err != nil {
+		t.Fatalf("Failed to create notifier: %v", err)
+	}
+	err = notifier.Notify(Notification{Title: "server1 is now DOWN"})
+	if err == nil || strings.Contains(err.Error(), "XXXXSECRET") {
+		t.Errorf("expected an error without the webhook path, got %v", err)
+	}
+}
+
+func TestHTTPNotifierInvalidHeaderIsPermanent(t *testing.T) {
+	notifier, err := newNotifier(config.NotifierConfig{
+		Type:    "webhook",
+		URL:     "http://127.0.0.1:1/hook",
+		Headers: map[string]string{"X-Api-Key": "k\r\nX-Injected: 1"},
+	})
+	if err != nil {
+		t.Fatalf("Failed to create notifier: %v", err)
+	}
+	var perm *permanentError
+	if err := notifier.Notify(Notification{Title: "test"}); !errors.As(err, &perm) {
+		t.Errorf("Expected a permanent error for an invalid header, got %v", err)
+	}
+}
+
+func TestNtfyNotifierEncodesTitle(t *testing.T) {
+	titles := make(chan string, 1)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		titles <- r.Header.Get("Title")
+	}))
+	defer server.Close()
+
+	notifier, err := newNotifier(config.NotifierConfig{Type: "ntfy", URL: server.URL + "/wot"})
+	if err != nil {
+		t.Fatalf("Failed to create notifier: %v", err)
+	}
+	if err := notifier.Notify(Notification{Title: "сервер is now\nDOWN"}); err != nil {
+		t.Fatalf("Notify failed: %v", err)
+	}
+	title, err := new(mime.WordDecoder).DecodeHeader(<-titles)
+	if err != nil || title != "сервер is now DOWN" {
+		t.Errorf("Expected RFC 2047 encoded title, got %q (%v)", title, err)
+	}
+}
+
+func TestNewNotifierValidation(t *testing.T) {
+	invalid := []config.NotifierConfig{
+		{Type: "webhook"},
+		{Type: "gotify", URL: "http://gotify"},
+		{Type: "matrix", URL: "http://matrix", Token: "t"},
+		{Type: "email", SMTPHost: "smtp"},
+		{Type: "pager"},
+	}
+	for _, nc := range invalid {
+		if _, err := newNotifier(nc); err == nil {
+			t.Errorf("Expected error for %+v", nc)
+		}
+	}
+}
+
+func TestEmailNotifierMessage(t *testing.T) {
+	notifier := &EmailNotifier{from: "wot@example.org", to: []string{"a@example.org", "b@example.org"}}
+	msg := string(notifier.buildMessage(Notification{
+		Title:   "server1 is now\nDOWN",
+		Message: "line1\nline2",
+		Time:    time.Now(),
+	}))
+
+	if !strings.Contains(msg, "Subject: [WoT] server1 is now DOWN\r\n") {
+		t.Errorf("Expected sanitized subject, got %q", msg)
+	}
+	if !strings.Contains(msg, "To: a@example.org, b@example.org\r\n") || !strings.HasSuffix(msg, "line1\r\nline2\r\n") {
+		t.Errorf("Unexpected message: %q", msg)
+	}
+}
+
+func TestEmailNotifierEncodesSubject(t *testing.T) {
+	notifier := &EmailNotifier{from: "wot@example.org", to: []string{"a@example.org"}}
+	msg := string(notifier.buildMessage(Notification{Title: "сервер is now DOWN", Time: time.Now()}))
+
+	if !strings.Contains(msg, "Subject: =?utf-8?q?") {
+		t.Errorf("Expected Q-encoded subject, got %q", msg)
+	}
+}
+
+func TestEmailNotifierTimesOut(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer listener.Close()
+	// Accept connections but never send the SMTP greeting.
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			defer conn.Close()
+		}
+	}()
+
+	addr := listener.Addr().(*net.TCPAddr)
+	notifier := &EmailNotifier{
+		host:    "127.0.0.1",
+		port:    addr.Port,
+		from:    "wot@example.org",
+		to:      []string{"a@example.org"},
+		timeout: 200 * time.Millisecond,
+	}
+
+	done := make(chan error, 1)
+	go func() { done <- notifier.Notify(Notification{Title: "test", Time: time.Now()}) }()
+	select {
+	case err := <-done:
+		if err == nil {
+			t.Fatal("Expected a timeout error from a silent server")
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Notify did not time out")
+	}
+}
+
+func TestTelegramNotifierDeliversQueueOnConnect(t *testing.T) {
+	sent := make(chan string, 10)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		switch {
+		case strings.HasSuffix(r.URL.Path, "/getMe"):
+			io.WriteString(w, `{"ok":true,"result":{"id":1,"is_bot":true,"first_name":"WoT","username":"WotBot"}}`)
+		case strings.HasSuffix(r.URL.Path, "/sendMessage"):
+			r.ParseForm()
+			sent <- r.FormValue("text")
+			io.WriteString(w, `{"ok":true,"result":{"message_id":1,"date":0,"chat":{"id":42,"type":"private"}}}`)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer server.Close()
+
+	telegram := NewTelegramNotifier(42)
+	if err := telegram.Notify(Notification{Title: "first"}); !errors.Is(err, errTelegramNotConnected) {
+		t.Fatalf("Expected errTelegramNotConnected before the bot is attached, got %v", err)
+	}
+
+	queue := NewNotificationQueue(telegram, "")
+	queue.minBackoff = time.Hour
+	telegram.onReady = queue.Retry
+	queue.Start()
+	defer queue.Stop()
+
+	queue.Notify(Notification{Title: "first"})
+	queue.Notify(Notification{Title: "second", Markdown: "*second*"})
+
+	select {
+	case text := <-sent:
+		t.Fatalf("Nothing should be sent before the bot is attached, got %q", text)
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	bot, err := tgbotapi.NewBotAPIWithClient("test-token", server.URL+"/bot%s/%s", server.Client())
+	if err != nil {
+		t.Fatalf("Failed to create bot: %v", err)
+	}
+	telegram.SetBot(bot)
+
+	for _, expected := range []string{"first", "*second*"} {
+		if got := <-sent; got != expected {
+			t.Errorf("Expected %q, got %q", expected, got)
+		}
+	}
+}
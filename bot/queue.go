@@ -0,0 +1,335 @@
+package bot
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+	"github.com/tsolodov/wot/internal/atomicfile"
+)
+
+const (
+	queueMinBackoff = 5 * time.Second
+	queueMaxBackoff = 10 * time.Minute
+	queueMaxLength  = 500
+	queueFlushPoll  = 50 * time.Millisecond
+)
+
+// permanentError marks a delivery failure that retrying cannot fix, such as a
+// message the remote side rejects as malformed. The queue drops such entries
+// instead of blocking everything behind them.
+type permanentError struct {
+	err error
+}
+
+func (e *permanentError) Error() string { return e.err.Error() }
+func (e *permanentError) Unwrap() error { return e.err }
+
+func permanent(err error) error {
+	if err == nil {
+		return nil
+	}
+	return &permanentError{err: err}
+}
+
+type queuedNotification struct {
+	Notification Notification `json:"notification"`
+	Attempts     int          `json:"attempts"`
+}
+
+// NotificationQueue is a durable, ordered outbound queue in front of a
+// Notifier. Notify only enqueues; a background worker delivers entries one at
+// a time and retries failures with exponential backoff. The queue is written
+// to disk after every change so nothing is lost across restarts.
+//
+// When delivery resumes after failures, a backlog of server status changes is
+// coalesced into a single "while offline" summary instead of replaying every
+// transition.
+type NotificationQueue struct {
+	notifier Notifier
+	path     string
+
+	minBackoff time.Duration
+	maxBackoff time.Duration
+
+	mutex  sync.Mutex
+	items  []queuedNotification
+	signal chan struct{}
+	stop   chan struct{}
+	done   chan struct{}
+}
+
+func NewNotificationQueue(notifier Notifier, path string) *NotificationQueue {
+	q := &NotificationQueue{
+		notifier:   notifier,
+		path:       path,
+		minBackoff: queueMinBackoff,
+		maxBackoff: queueMaxBackoff,
+		signal:     make(chan struct{}, 1),
+	}
+
+	if err := q.load(); err != nil {
+		slog.Error("Failed to load notification queue", "path", path, "error", err)
+	} else if len(q.items) > 0 {
+		slog.Info("Loaded pending notifications", "notifier", notifier.Name(), "count", len(q.items))
+	}
+
+	return q
+}
+
+func (q *NotificationQueue) Name() string {
+	return q.notifier.Name()
+}
+
+// Notify appends n to the queue. It only fails if the queue cannot be
+// persisted, and even then the notification is kept in memory.
+func (q *NotificationQueue) Notify(n Notification) error {
+	q.mutex.Lock()
+	if len(q.items) >= queueMaxLength {
+		slog.Warn("Notification queue is full, dropping oldest entry", "notifier", q.notifier.Name())
+		q.items = q.items[1:]
+	}
+	q.items = append(q.items, queuedNotification{Notification: n})
+	err := q.save()
+	q.mutex.Unlock()
+
+	q.Retry()
+	return err
+}
+
+// Retry wakes the worker so it attempts delivery immediately instead of
+// waiting for the current backoff to expire.
+func (q *NotificationQueue) Retry() {
+	select {
+	case q.signal <- struct{}{}:
+	default:
+	}
+}
+
+func (q *NotificationQueue) Len() int {
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+	return len(q.items)
+}
+
+// Flush asks the worker to deliver the queue now and waits until it is empty
+// or ctx ends. Whatever is left stays on disk and is sent after the next start.
+func (q *NotificationQueue) Flush(ctx context.Context) error {
+	q.Retry()
+	ticker := time.NewTicker(queueFlushPoll)
+	defer ticker.Stop()
+	for q.Len() > 0 {
+		select {
+		case <-ctx.Done():
+			return fmt.Errorf("%d %s notifications left undelivered: %w", q.Len(), q.notifier.Name(), ctx.Err())
+		case <-ticker.C:
+		}
+	}
+	return nil
+}
+
+func (q *NotificationQueue) Start() {
+	q.stop = make(chan struct{})
+	q.done = make(chan struct{})
+	go q.run()
+}
+
+func (q *NotificationQueue) Stop() {
+	close(q.stop)
+	<-q.done
+}
+
+func (q *NotificationQueue) run() {
+	defer close(q.done)
+
+	backoff := q.minBackoff
+	for {
+		item, ok := q.head()
+		if !ok {
+			select {
+			case <-q.stop:
+				return
+			case <-q.signal:
+				continue
+			}
+		}
+
+		err := q.notifier.Notify(item.Notification)
+		var permErr *permanentError
+		if err == nil || errors.As(err, &permErr) {
+			if err != nil {
+				slog.Error("Dropping notification", "notifier", q.notifier.Name(), "title", item.Notification.Title, "error", err)
+			}
+			q.pop()
+			backoff = q.minBackoff
+			continue
+		}
+
+		attempts := q.markFailed()
+		if attempts == 1 || !errors.Is(err, errTelegramNotConnected) {
+			slog.Warn("Failed to deliver notification", "notifier", q.notifier.Name(), "attempt", attempts, "retry_in", backoff, "error", err)
+		}
+
+		select {
+		case <-q.stop:
+			return
+		case <-q.signal:
+		case <-time.After(backoff):
+			backoff *= 2
+			if backoff > q.maxBackoff {
+				backoff = q.maxBackoff
+			}
+		}
+	}
+}
+
+// head returns the next notification to deliver, coalescing the backlog
+// first if earlier attempts have failed.
+func (q *NotificationQueue) head() (queuedNotification, bool) {
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+
+	if len(q.items) == 0 {
+		return queuedNotification{}, false
+	}
+	if q.items[0].Attempts > 0 {
+		if coalesced := coalesceNotifications(q.items); len(coalesced) < len(q.items) {
+			q.items = coalesced
+			if err := q.save(); err != nil {
+				slog.Error("Failed to persist notification queue", "error", err)
+			}
+		}
+	}
+	return q.items[0], true
+}
+
+func (q *NotificationQueue) pop() {
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+
+	if len(q.items) > 0 {
+		q.items = q.items[1:]
+	}
+	if err := q.save(); err != nil {
+		slog.Error("Failed to persist notification queue", "error", err)
+	}
+}
+
+func (q *NotificationQueue) markFailed() int {
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+
+	if len(q.items) == 0 {
+		return 0
+	}
+	q.items[0].Attempts++
+	if err := q.save(); err != nil {
+		slog.Error("Failed to persist notification queue", "error", err)
+	}
+	return q.items[0].Attempts
+}
+
+func (q *NotificationQueue) load() error {
+	if q.path == "" {
+		return nil
+	}
+
+	data, err := os.ReadFile(q.path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(data, &q.items)
+}
+
+// save writes the queue atomically. Callers must hold q.mutex.
+func (q *NotificationQueue) save() error {
+	if q.path == "" {
+		return nil
+	}
+
+	if len(q.items) == 0 {
+		if err := os.Remove(q.path); err != nil && !errors.Is(err, os.ErrNotExist) {
+			return err
+		}
+		return nil
+	}
+
+	data, err := json.Marshal(q.items)
+	if err != nil {
+		return err
+	}
+	return atomicfile.WriteFile(q.path, data, 0600)
+}
+
+// coalesceNotifications replaces all server status notifications in items
+// with one summary placed where the first of them was. Other notifications
+// keep their relative order. Nothing changes unless there are at least two
+// status notifications.
+func coalesceNotifications(items []queuedNotification) []queuedNotification {
+	var statuses []Notification
+	first := -1
+	for i, item := range items {
+		if item.Notification.Status != "" {
+			if first < 0 {
+				first = i
+			}
+			statuses = append(statuses, item.Notification)
+		}
+	}
+	if len(statuses) < 2 {
+		return items
+	}
+
+	summary := summarizeStatusNotifications(statuses)
+	result := make([]queuedNotification, 0, len(items)-len(statuses)+1)
+	for i, item := range items {
+		if i == first {
+			result = append(result, queuedNotification{Notification: summary, Attempts: item.Attempts})
+		}
+		if item.Notification.Status == "" {
+			result = append(result, item)
+		}
+	}
+	return result
+}
+
+// summarizeStatusNotifications builds e.g.
+// "While offline: server1 DOWN 03:12, UP 03:40; server2 DOWN 03:12".
+func summarizeStatusNotifications(statuses []Notification) Notification {
+	var order []string
+	events := make(map[string][]string)
+	severity := SeverityInfo
+	for _, n := range statuses {
+		if _, ok := events[n.Server]; !ok {
+			order = append(order, n.Server)
+		}
+		events[n.Server] = append(events[n.Server], fmt.Sprintf("%s %s", n.Status, n.Time.Format("15:04")))
+		if n.Severity > severity {
+			severity = n.Severity
+		}
+	}
+
+	var plain, markdown []string
+	for _, server := range order {
+		plain = append(plain, fmt.Sprintf("%s %s", server, strings.Join(events[server], ", ")))
+		markdown = append(markdown, fmt.Sprintf("• *%s* %s", tgbotapi.EscapeText(tgbotapi.ModeMarkdown, server), strings.Join(events[server], ", ")))
+	}
+
+	return Notification{
+		Severity: severity,
+		Title:    "Missed status changes",
+		Message:  "While offline: " + strings.Join(plain, "; "),
+		Markdown: "📬 *While offline:*\n" + strings.Join(markdown, "\n"),
+		Time:     statuses[len(statuses)-1].Time,
+	}
+}
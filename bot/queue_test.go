@@ -0,0 +1,223 @@
+package bot
+
+import (
+	"context"
+	"errors"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+	"github.com/tsolodov/wot/internal/telegramtest"
+)
+
+type flakyNotifier struct {
+	recordingNotifier
+	failures int
+}
+
+func (f *flakyNotifier) Notify(n Notification) error {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	if f.failures > 0 {
+		f.failures--
+		return errors.New("network unreachable")
+	}
+	f.got = append(f.got, n)
+	return nil
+}
+
+func statusNotification(server, status string, hour, minute int) Notification {
+	return Notification{
+		Severity: SeverityCritical,
+		Title:    server + " is now " + status,
+		Server:   server,
+		Status:   status,
+		Time:     time.Date(2025, 3, 1, hour, minute, 0, 0, time.UTC),
+	}
+}
+
+func waitForCount(t *testing.T, r *recordingNotifier, expected int) {
+	t.Helper()
+
+	deadline := time.Now().Add(5 * time.Second)
+	for r.count() < expected {
+		if time.Now().After(deadline) {
+			t.Fatalf("Expected %d deliveries, got %d", expected, r.count())
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+func TestNotificationQueueCoalescesBacklog(t *testing.T) {
+	notifier := &flakyNotifier{recordingNotifier: recordingNotifier{name: "flaky"}, failures: 1}
+	queue := NewNotificationQueue(notifier, "")
+	queue.minBackoff = time.Hour
+
+	// Enqueue the whole backlog before the worker starts so the first
+	// attempt fails with everything already queued.
+	queue.Notify(statusNotification("server1", "DOWN", 3, 12))
+	queue.Notify(statusNotification("server2", "DOWN", 3, 12))
+	queue.Notify(Notification{Title: "WoT Bot started"})
+	queue.Notify(statusNotification("server1", "UP", 3, 40))
+
+	queue.Start()
+
+	// First attempt fails; retrying delivers the coalesced backlog
+	time.Sleep(20 * time.Millisecond)
+	queue.Retry()
+	waitForCount(t, &notifier.recordingNotifier, 2)
+	queue.Stop()
+
+	summary := notifier.got[0]
+	expected := "While offline: server1 DOWN 03:12, UP 03:40; server2 DOWN 03:12"
+	if summary.Message != expected {
+		t.Errorf("Expected summary %q, got %q", expected, summary.Message)
+	}
+	if summary.Severity != SeverityCritical {
+		t.Errorf("Expected summary to keep the highest severity, got %v", summary.Severity)
+	}
+	if notifier.got[1].Title != "WoT Bot started" {
+		t.Errorf("Expected non-status notification to be delivered after the summary, got %+v", notifier.got[1])
+	}
+	if queue.Len() != 0 {
+		t.Errorf("Expected empty queue, got %d", queue.Len())
+	}
+}
+
+func TestNotificationQueueDoesNotCoalesceWhenHealthy(t *testing.T) {
+	notifier := &recordingNotifier{name: "ok"}
+	queue := NewNotificationQueue(notifier, "")
+	queue.Notify(statusNotification("server1", "DOWN", 3, 12))
+	queue.Notify(statusNotification("server2", "DOWN", 3, 12))
+
+	queue.Start()
+	defer queue.Stop()
+
+	waitForCount(t, notifier, 2)
+	if notifier.got[0].Server != "server1" || notifier.got[1].Server != "server2" {
+		t.Errorf("Expected individual notifications in order, got %+v", notifier.got)
+	}
+}
+
+func TestNotificationQueuePersistence(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "queue", "telegram.json")
+
+	queue := NewNotificationQueue(&flakyNotifier{failures: 100}, path)
+	queue.Notify(Notification{Title: "first"})
+	queue.Notify(Notification{Title: "second"})
+
+	notifier := &recordingNotifier{name: "restored"}
+	restored := NewNotificationQueue(notifier, path)
+	if restored.Len() != 2 {
+		t.Fatalf("Expected 2 persisted notifications, got %d", restored.Len())
+	}
+
+	restored.Start()
+	defer restored.Stop()
+
+	waitForCount(t, notifier, 2)
+	if notifier.got[0].Title != "first" || notifier.got[1].Title != "second" {
+		t.Errorf("Expected persisted order to be kept, got %+v", notifier.got)
+	}
+}
+
+func TestNotificationQueueDropsPermanentFailures(t *testing.T) {
+	notifier := &recordingNotifier{name: "rejecting", err: permanent(errors.New("bad request"))}
+	queue := NewNotificationQueue(notifier, "")
+	queue.Notify(Notification{Title: "malformed"})
+	queue.Notify(Notification{Title: "next"})
+
+	queue.Start()
+	defer queue.Stop()
+
+	waitForCount(t, notifier, 2)
+	if !strings.Contains(notifier.got[1].Title, "next") {
+		t.Errorf("Expected permanent failure to be dropped without blocking the queue")
+	}
+}
+
+func TestNotificationQueueFlush(t *testing.T) {
+	notifier := &flakyNotifier{recordingNotifier: recordingNotifier{name: "flaky"}, failures: 2}
+	queue := NewNotificationQueue(notifier, "")
+	queue.minBackoff = time.Hour
+	queue.Notify(Notification{Title: "WoT Bot shutting down"})
+	queue.Start()
+	defer queue.Stop()
+
+	// Wait until the worker has given up and is backing off
+	for {
+		notifier.mutex.Lock()
+		failures := notifier.failures
+		notifier.mutex.Unlock()
+		if failures == 0 {
+			break
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := queue.Flush(ctx); err != nil {
+		t.Fatalf("Flush: %v", err)
+	}
+	if notifier.count() != 1 {
+		t.Errorf("Expected the notification to be delivered, got %d", notifier.count())
+	}
+
+	// An unreachable channel keeps its notifications for the next start
+	notifier.mutex.Lock()
+	notifier.failures = 100
+	notifier.mutex.Unlock()
+	queue.Notify(Notification{Title: "undeliverable"})
+	ctx, cancel = context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	if err := queue.Flush(ctx); err == nil || queue.Len() != 1 {
+		t.Errorf("Expected Flush to give up with the notification queued, got %v and %d queued", err, queue.Len())
+	}
+}
+
+func TestNotificationQueueSummaryWithMarkdownInNames(t *testing.T) {
+	fake := telegramtest.NewServer("")
+	ts := httptest.NewServer(fake)
+	defer ts.Close()
+	defer fake.Close()
+
+	telegram := NewTelegramNotifier(testAdminChat)
+	queue := NewNotificationQueue(telegram, "")
+	queue.minBackoff = time.Hour
+	telegram.onReady = queue.Retry
+
+	// The backlog built up while Telegram was unreachable is summarized
+	queue.Notify(statusNotification("k8s_master", "DOWN", 3, 12))
+	queue.Notify(statusNotification("k8s_master", "UP", 3, 40))
+	queue.Start()
+	defer queue.Stop()
+	time.Sleep(20 * time.Millisecond)
+
+	bot, err := tgbotapi.NewBotAPIWithAPIEndpoint("123:test", ts.URL+"/bot%s/%s")
+	if err != nil {
+		t.Fatal(err)
+	}
+	telegram.SetBot(bot)
+	messages, err := fake.WaitForMessages(1, 5*time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := messages[0]; got.ParseMode != tgbotapi.ModeMarkdown || !strings.Contains(got.Text, `*k8s\_master* DOWN 03:12, UP 03:40`) {
+		t.Errorf("summary %+v", got)
+	}
+
+	// Markdown that Telegram cannot parse is sent as plain text
+	queue.Notify(Notification{Title: "k8s_master is now DOWN", Markdown: "_k8s_master_ is now DOWN"})
+	messages, err = fake.WaitForMessages(2, 5*time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := messages[1]; got.ParseMode != "" || got.Text != "k8s_master is now DOWN" {
+		t.Errorf("fallback %+v", got)
+	}
+}
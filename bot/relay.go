@@ -0,0 +1,449 @@
+package bot
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/tsolodov/wot/config"
+	"github.com/tsolodov/wot/internal/logging"
+	"github.com/tsolodov/wot/wol"
+)
+
+const (
+	relayWakePath  = "/v1/wake"
+	relayCheckPath = "/v1/check"
+
+	relayTimestampHeader = "X-WoT-Timestamp"
+	relayNonceHeader     = "X-WoT-Nonce"
+	relaySignatureHeader = "X-WoT-Signature"
+
+	// Requests older or newer than this are rejected, and nonces are
+	// remembered for as long to reject replays.
+	relayMaxClockSkew = 60 * time.Second
+	relayTimeout      = 15 * time.Second
+	relayMaxBody      = 64 << 10
+)
+
+type relayWakeRequest struct {
+	MACAddress string `json:"mac_address"`
+}
+
+type relayCheckRequest struct {
+	Server config.Server `json:"server"`
+}
+
+type relayCheckResponse struct {
+	Address      string `json:"address,omitempty"`
+	Up           bool   `json:"up"`
+	Unresolvable string `json:"unresolvable,omitempty"`
+}
+
+type relayErrorResponse struct {
+	Error string `json:"error"`
+}
+
+// relayError reports that a relay agent could not be reached or refused a
+// request. The state of servers behind it is unknown, not DOWN.
+type relayError struct {
+	relay string
+	err   error
+}
+
+func (e *relayError) Error() string {
+	return fmt.Sprintf("relay %s: %v", e.relay, e.err)
+}
+
+func (e *relayError) Unwrap() error {
+	return e.err
+}
+
+// signRelayRequest computes the request signature: an HMAC-SHA256 over the
+// method, path, timestamp, nonce and body.
+func signRelayRequest(secret []byte, method, path, timestamp, nonce string, body []byte) string {
+	mac := hmac.New(sha256.New, secret)
+	fmt.Fprintf(mac, "%s\n%s\n%s\n%s\n", method, path, timestamp, nonce)
+	mac.Write(body)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// signedClient sends JSON requests signed with a shared secret to a relay
+// agent or a federation peer.
+type signedClient struct {
+	url    string
+	secret []byte
+	client *http.Client
+	now    func() time.Time
+}
+
+func newSignedClient(rawURL, secret, caCert string) (*signedClient, error) {
+	parsed, err := url.Parse(rawURL)
+	if err != nil || (parsed.Scheme != "https" && parsed.Scheme != "http") || parsed.Host == "" {
+		return nil, fmt.Errorf("url must be an http(s) URL")
+	}
+	if len(secret) < 16 {
+		return nil, fmt.Errorf("secret must be at least 16 characters")
+	}
+
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	if caCert != "" {
+		pem, err := os.ReadFile(caCert)
+		if err != nil {
+			return nil, err
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("no certificates found in %s", caCert)
+		}
+		transport.TLSClientConfig = &tls.Config{RootCAs: pool}
+	}
+
+	return &signedClient{
+		url:    strings.TrimSuffix(rawURL, "/"),
+		secret: []byte(secret),
+		client: &http.Client{Timeout: relayTimeout, Transport: transport},
+		now:    time.Now,
+	}, nil
+}
+
+func (c *signedClient) do(ctx context.Context, path string, request, response any) error {
+	body, err := json.Marshal(request)
+	if err != nil {
+		return err
+	}
+
+	var nonceBytes [16]byte
+	rand.Read(nonceBytes[:])
+	nonce := hex.EncodeToString(nonceBytes[:])
+	timestamp := strconv.FormatInt(c.now().Unix(), 10)
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, c.url+path, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(relayTimestampHeader, timestamp)
+	req.Header.Set(relayNonceHeader, nonce)
+	req.Header.Set(relaySignatureHeader, signRelayRequest(c.secret, http.MethodPost, path, timestamp, nonce, body))
+
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	data, err := io.ReadAll(io.LimitReader(resp.Body, relayMaxBody))
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode != http.StatusOK {
+		var failure relayErrorResponse
+		if json.Unmarshal(data, &failure) == nil && failure.Error != "" {
+			return errors.New(failure.Error)
+		}
+		return fmt.Errorf("HTTP %d", resp.StatusCode)
+	}
+	if response != nil {
+		if err := json.Unmarshal(data, response); err != nil {
+			return fmt.Errorf("invalid response: %w", err)
+		}
+	}
+	return nil
+}
+
+// signatureVerifier checks requests sent by a signedClient.
+type signatureVerifier struct {
+	secret []byte
+	now    func() time.Time
+
+	mutex  sync.Mutex
+	nonces map[string]time.Time
+}
+
+func newSignatureVerifier(secret string) *signatureVerifier {
+	return &signatureVerifier{
+		secret: []byte(secret),
+		now:    time.Now,
+		nonces: make(map[string]time.Time),
+	}
+}
+
+// verify checks the signature, the timestamp and that the nonce has not
+// been used before.
+func (v *signatureVerifier) verify(r *http.Request, body []byte) error {
+	timestamp := r.Header.Get(relayTimestampHeader)
+	nonce := r.Header.Get(relayNonceHeader)
+	signature := r.Header.Get(relaySignatureHeader)
+	if timestamp == "" || nonce == "" || signature == "" {
+		return errors.New("missing signature headers")
+	}
+
+	expected := signRelayRequest(v.secret, r.Method, r.URL.Path, timestamp, nonce, body)
+	if !hmac.Equal([]byte(signature), []byte(expected)) {
+		return errors.New("signature mismatch")
+	}
+
+	seconds, err := strconv.ParseInt(timestamp, 10, 64)
+	if err != nil {
+		return errors.New("invalid timestamp")
+	}
+	now := v.now()
+	skew := now.Sub(time.Unix(seconds, 0))
+	if skew > relayMaxClockSkew || skew < -relayMaxClockSkew {
+		return fmt.Errorf("timestamp off by %v", skew.Round(time.Second))
+	}
+
+	v.mutex.Lock()
+	defer v.mutex.Unlock()
+	for seen, at := range v.nonces {
+		if now.Sub(at) > 2*relayMaxClockSkew {
+			delete(v.nonces, seen)
+		}
+	}
+	if _, replayed := v.nonces[nonce]; replayed {
+		return errors.New("replayed request")
+	}
+	v.nonces[nonce] = now
+	return nil
+}
+
+// readSignedRequest reads and verifies a signed POST request, writing the
+// error response itself if it is rejected.
+func readSignedRequest(w http.ResponseWriter, r *http.Request, verifier *signatureVerifier) ([]byte, bool) {
+	if r.Method != http.MethodPost {
+		writeRelayError(w, http.StatusMethodNotAllowed, "method not allowed")
+		return nil, false
+	}
+
+	body, err := io.ReadAll(io.LimitReader(r.Body, relayMaxBody))
+	if err != nil {
+		writeRelayError(w, http.StatusBadRequest, "failed to read request")
+		return nil, false
+	}
+	if err := verifier.verify(r, body); err != nil {
+		slog.Warn("Rejected request with an invalid signature", "remote_addr", r.RemoteAddr, "error", err)
+		writeRelayError(w, http.StatusUnauthorized, "invalid signature")
+		return nil, false
+	}
+	return body, true
+}
+
+// RelayClient sends signed requests to one relay agent.
+type RelayClient struct {
+	*signedClient
+	name string
+}
+
+func NewRelayClient(cfg config.RelayConfig) (*RelayClient, error) {
+	if cfg.Name == "" {
+		return nil, fmt.Errorf("relay name is required")
+	}
+	client, err := newSignedClient(cfg.URL, cfg.Secret, cfg.CACert)
+	if err != nil {
+		return nil, fmt.Errorf("relay '%s': %w", cfg.Name, err)
+	}
+	return &RelayClient{signedClient: client, name: cfg.Name}, nil
+}
+
+// Wake asks the relay to send a magic packet on its network.
+func (c *RelayClient) Wake(ctx context.Context, mac string) error {
+	if err := c.do(ctx, relayWakePath, relayWakeRequest{MACAddress: mac}, nil); err != nil {
+		return &relayError{relay: c.name, err: err}
+	}
+	return nil
+}
+
+// Check asks the relay to probe server from its network. The relay resolves
+// DHCP and host name addresses itself.
+func (c *RelayClient) Check(ctx context.Context, server config.Server) (string, bool, error) {
+	server.Relay = ""
+	var response relayCheckResponse
+	if err := c.do(ctx, relayCheckPath, relayCheckRequest{Server: server}, &response); err != nil {
+		return "", false, &relayError{relay: c.name, err: err}
+	}
+	if response.Unresolvable != "" {
+		return "", false, &unresolvableError{host: server.Host, err: errors.New(response.Unresolvable)}
+	}
+	return response.Address, response.Up, nil
+}
+
+// RelayPool holds a client for every configured relay. It is reconfigured
+// at startup and on reload.
+type RelayPool struct {
+	mutex   sync.RWMutex
+	clients map[string]*RelayClient
+}
+
+func (p *RelayPool) Configure(relays []config.RelayConfig) error {
+	apply, err := p.prepare(relays)
+	if err != nil {
+		return err
+	}
+	apply()
+	return nil
+}
+
+// prepare creates clients for relays and returns a function that switches
+// to them.
+func (p *RelayPool) prepare(relays []config.RelayConfig) (func(), error) {
+	clients := make(map[string]*RelayClient, len(relays))
+	for _, relay := range relays {
+		client, err := NewRelayClient(relay)
+		if err != nil {
+			return nil, err
+		}
+		clients[strings.ToLower(relay.Name)] = client
+	}
+	return func() {
+		p.mutex.Lock()
+		defer p.mutex.Unlock()
+		p.clients = clients
+	}, nil
+}
+
+func (p *RelayPool) Get(name string) (*RelayClient, error) {
+	p.mutex.RLock()
+	defer p.mutex.RUnlock()
+	client, ok := p.clients[strings.ToLower(name)]
+	if !ok {
+		return nil, &relayError{relay: name, err: errors.New("not configured")}
+	}
+	return client, nil
+}
+
+// RelayAgent is the server side of "wot relay": it verifies signed requests
+// and wakes or checks servers on its own network.
+type RelayAgent struct {
+	verifier    *signatureVerifier
+	broadcastIP string
+	wake        func(ctx context.Context, mac, broadcastIP string) error
+	probe       func(ctx context.Context, server config.Server) (string, bool, error)
+}
+
+func NewRelayAgent(secret, broadcastIP string) *RelayAgent {
+	return &RelayAgent{
+		verifier:    newSignatureVerifier(secret),
+		broadcastIP: broadcastIP,
+		wake:        wol.Send,
+		probe:       NewNetwork().Probe,
+	}
+}
+
+func (a *RelayAgent) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	body, ok := readSignedRequest(w, r, a.verifier)
+	if !ok {
+		return
+	}
+
+	switch r.URL.Path {
+	case relayWakePath:
+		var request relayWakeRequest
+		if err := json.Unmarshal(body, &request); err != nil {
+			writeRelayError(w, http.StatusBadRequest, "invalid request")
+			return
+		}
+		if _, err := wol.ParseMAC(request.MACAddress); err != nil {
+			writeRelayError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		slog.Info("Relay wake request", "mac", request.MACAddress)
+		if err := a.wake(r.Context(), request.MACAddress, a.broadcastIP); err != nil {
+			writeRelayError(w, http.StatusBadGateway, err.Error())
+			return
+		}
+		writeRelayJSON(w, struct{}{})
+
+	case relayCheckPath:
+		var request relayCheckRequest
+		if err := json.Unmarshal(body, &request); err != nil {
+			writeRelayError(w, http.StatusBadRequest, "invalid request")
+			return
+		}
+		if err := request.Server.Validate(); err != nil {
+			writeRelayError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		address, up, err := a.probe(r.Context(), request.Server)
+		response := relayCheckResponse{Address: address, Up: up}
+		if err != nil {
+			response.Unresolvable = err.Error()
+		}
+		writeRelayJSON(w, response)
+
+	default:
+		writeRelayError(w, http.StatusNotFound, "not found")
+	}
+}
+
+func writeRelayJSON(w http.ResponseWriter, value any) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(value)
+}
+
+func writeRelayError(w http.ResponseWriter, status int, message string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(relayErrorResponse{Error: message})
+}
+
+// RunRelayCommand implements "wot relay": serve signed wake and check
+// requests for servers on this network.
+func RunRelayCommand(args []string) error {
+	flags := flag.NewFlagSet("relay", flag.ExitOnError)
+	listen := flags.String("listen", ":8443", "Address to listen on")
+	secretFile := flags.String("secret-file", "", "File containing the shared secret (default: $WOT_RELAY_SECRET)")
+	certFile := flags.String("cert", "", "TLS certificate file")
+	keyFile := flags.String("key", "", "TLS private key file")
+	broadcastIP := flags.String("broadcast-ip", "", "Broadcast address for magic packets on this network")
+	logLevel := flags.String("log-level", "", "Log level: debug, info, warn or error")
+	logFormat := flags.String("log-format", "text", "Log format: text or json")
+	flags.Parse(args)
+
+	if _, err := logging.Setup(config.LogConfig{Format: *logFormat}, *logLevel); err != nil {
+		return err
+	}
+
+	secret := os.Getenv("WOT_RELAY_SECRET")
+	if *secretFile != "" {
+		data, err := os.ReadFile(*secretFile)
+		if err != nil {
+			return fmt.Errorf("failed to read secret: %w", err)
+		}
+		secret = strings.TrimSpace(string(data))
+	}
+	if len(secret) < 16 {
+		return fmt.Errorf("a shared secret of at least 16 characters is required (-secret-file or WOT_RELAY_SECRET)")
+	}
+	logging.AddSecrets(secret)
+
+	server := &http.Server{
+		Addr:              *listen,
+		Handler:           NewRelayAgent(secret, *broadcastIP),
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+
+	if *certFile == "" || *keyFile == "" {
+		slog.Warn("Relay listening without TLS; requests are signed but not encrypted", "addr", *listen)
+		return server.ListenAndServe()
+	}
+	slog.Info("Relay listening", "addr", *listen)
+	return server.ListenAndServeTLS(*certFile, *keyFile)
+}
@@ -0,0 +1,191 @@
+package bot
+
+import (
+	"bytes"
+	"context"
+	"encoding/pem"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/tsolodov/wot/config"
+)
+
+// startTestRelay runs a relay agent over TLS and returns the config the main
+// instance needs to reach it. Woken MAC addresses are recorded instead of
+// sending packets.
+func startTestRelay(t *testing.T, secret string) (*RelayAgent, config.RelayConfig, func() []string) {
+	t.Helper()
+
+	var mutex sync.Mutex
+	var woken []string
+	agent := NewRelayAgent(secret, "192.168.50.255")
+	agent.wake = func(ctx context.Context, mac, broadcastIP string) error {
+		mutex.Lock()
+		defer mutex.Unlock()
+		woken = append(woken, mac+"@"+broadcastIP)
+		return nil
+	}
+	agent.probe = func(ctx context.Context, server config.Server) (string, bool, error) {
+		if server.Host == "broken.example" {
+			return "", false, &unresolvableError{host: server.Host, err: errors.New("NXDOMAIN")}
+		}
+		return "192.168.50.10", server.Name == "remote-up", nil
+	}
+
+	ts := httptest.NewTLSServer(agent)
+	t.Cleanup(ts.Close)
+
+	caFile := filepath.Join(t.TempDir(), "relay-ca.pem")
+	certPEM := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: ts.Certificate().Raw})
+	if err := os.WriteFile(caFile, certPEM, 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	cfg := config.RelayConfig{Name: "parents", URL: ts.URL, Secret: secret, CACert: caFile}
+	return agent, cfg, func() []string {
+		mutex.Lock()
+		defer mutex.Unlock()
+		return append([]string(nil), woken...)
+	}
+}
+
+// testNetwork returns a Network that reaches servers through relays.
+func testNetwork(t *testing.T, relays ...config.RelayConfig) *Network {
+	t.Helper()
+	network := NewNetwork()
+	if err := network.Configure(&config.Config{Relays: relays}); err != nil {
+		t.Fatalf("Configure: %v", err)
+	}
+	return network
+}
+
+func TestRelayWakeAndCheck(t *testing.T) {
+	_, relay, woken := startTestRelay(t, "correct horse battery staple")
+	network := testNetwork(t, relay)
+	ctx := context.Background()
+
+	cfg := &config.Config{
+		Relays: []config.RelayConfig{relay},
+		Servers: []config.Server{
+			{Name: "remote-up", MACAddress: "aa:bb:cc:dd:ee:01", IPAddress: "auto", Relay: "parents"},
+			{Name: "remote-down", MACAddress: "aa-bb-cc-dd-ee-02", Relay: "Parents"},
+			{Name: "remote-dns", MACAddress: "aa:bb:cc:dd:ee:03", Host: "broken.example", Relay: "parents"},
+		},
+	}
+	if err := validateConfig(cfg); err != nil {
+		t.Fatalf("validateConfig: %v", err)
+	}
+
+	if err := network.Wake(ctx, cfg.Servers[1], "255.255.255.255"); err != nil {
+		t.Fatalf("wake through relay: %v", err)
+	}
+	if got := woken(); len(got) != 1 || got[0] != "aa-bb-cc-dd-ee-02@192.168.50.255" {
+		t.Errorf("relay woke %v, want the MAC on the relay's broadcast address", got)
+	}
+
+	address, up, err := network.Probe(ctx, cfg.Servers[0])
+	if err != nil || !up || address != "192.168.50.10" {
+		t.Errorf("check remote-up: %q %v %v", address, up, err)
+	}
+	if _, up, err := network.Probe(ctx, cfg.Servers[1]); err != nil || up {
+		t.Errorf("check remote-down: %v %v", up, err)
+	}
+	_, _, err = network.Probe(ctx, cfg.Servers[2])
+	var unresolvable *unresolvableError
+	if !errors.As(err, &unresolvable) {
+		t.Errorf("expected the relay's resolution failure to be passed on, got %v", err)
+	}
+}
+
+func TestRelayRejectsBadRequests(t *testing.T) {
+	agent, relay, woken := startTestRelay(t, "correct horse battery staple")
+
+	// Wrong secret
+	wrong := relay
+	wrong.Secret = "incorrect horse battery staple"
+	client, err := NewRelayClient(wrong)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := client.Wake(context.Background(), "aa:bb:cc:dd:ee:01"); err == nil {
+		t.Error("request with the wrong secret was accepted")
+	}
+
+	// Clock too far off
+	client, err = NewRelayClient(relay)
+	if err != nil {
+		t.Fatal(err)
+	}
+	client.now = func() time.Time { return time.Now().Add(-5 * time.Minute) }
+	if err := client.Wake(context.Background(), "aa:bb:cc:dd:ee:01"); err == nil {
+		t.Error("request with an old timestamp was accepted")
+	}
+
+	// Replayed request
+	body := []byte(`{"mac_address":"aa:bb:cc:dd:ee:01"}`)
+	timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+	signature := signRelayRequest([]byte(relay.Secret), http.MethodPost, relayWakePath, timestamp, "nonce-1", body)
+	send := func() int {
+		req := httptest.NewRequest(http.MethodPost, relayWakePath, bytes.NewReader(body))
+		req.Header.Set(relayTimestampHeader, timestamp)
+		req.Header.Set(relayNonceHeader, "nonce-1")
+		req.Header.Set(relaySignatureHeader, signature)
+		rec := httptest.NewRecorder()
+		agent.ServeHTTP(rec, req)
+		return rec.Code
+	}
+	if code := send(); code != http.StatusOK {
+		t.Fatalf("signed request rejected with %d", code)
+	}
+	if code := send(); code != http.StatusUnauthorized {
+		t.Errorf("replayed request answered with %d", code)
+	}
+
+	if got := woken(); len(got) != 1 {
+		t.Errorf("expected only the first signed request to wake, got %v", got)
+	}
+}
+
+func TestRelayUnreachable(t *testing.T) {
+	_, relay, _ := startTestRelay(t, "correct horse battery staple")
+	relay.URL = "https://127.0.0.1:1"
+	network := testNetwork(t, relay)
+
+	server := config.Server{Name: "remote", MACAddress: "aa:bb:cc:dd:ee:01", Relay: "parents"}
+	_, _, err := network.Probe(context.Background(), server)
+	var relayErr *relayError
+	if !errors.As(err, &relayErr) {
+		t.Fatalf("expected a relay error, got %v", err)
+	}
+	if status := probeErrorStatus(err); status != "RELAY UNREACHABLE" {
+		t.Errorf("unexpected status %q", status)
+	}
+	if err := network.Wake(context.Background(), server, ""); err == nil {
+		t.Error("expected the wake to fail")
+	}
+}
+
+func TestValidateConfigRelays(t *testing.T) {
+	relay := config.RelayConfig{Name: "parents", URL: "https://relay.example:8443", Secret: "0123456789abcdef"}
+	tests := []struct {
+		name   string
+		config config.Config
+	}{
+		{"unknown relay", config.Config{Servers: []config.Server{{Name: "a", MACAddress: "aa:bb:cc:dd:ee:01", Relay: "nowhere"}}}},
+		{"short secret", config.Config{Relays: []config.RelayConfig{{Name: "x", URL: "https://relay.example", Secret: "short"}}}},
+		{"bad url", config.Config{Relays: []config.RelayConfig{{Name: "x", URL: "ftp://relay.example", Secret: "0123456789abcdef"}}}},
+		{"duplicate", config.Config{Relays: []config.RelayConfig{relay, relay}}},
+	}
+	for _, tt := range tests {
+		if err := validateConfig(&tt.config); err == nil {
+			t.Errorf("%s: expected an error", tt.name)
+		}
+	}
+}
@@ -0,0 +1,383 @@
+package bot
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+	"syscall"
+	"time"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+	"github.com/tsolodov/wot/config"
+	"github.com/tsolodov/wot/internal/atomicfile"
+	"github.com/tsolodov/wot/internal/logging"
+)
+
+const configWatchInterval = 5 * time.Second
+
+// ConfigDiff describes what a reload changed.
+type ConfigDiff struct {
+	Added           []string
+	Removed         []string
+	Changed         []string
+	RestartRequired []string
+}
+
+func (d ConfigDiff) Empty() bool {
+	return len(d.Added) == 0 && len(d.Removed) == 0 && len(d.Changed) == 0 && len(d.RestartRequired) == 0
+}
+
+func (d ConfigDiff) String() string {
+	if d.Empty() {
+		return "No changes"
+	}
+
+	var lines []string
+	if len(d.Added) > 0 {
+		lines = append(lines, "Added: "+strings.Join(d.Added, ", "))
+	}
+	if len(d.Removed) > 0 {
+		lines = append(lines, "Removed: "+strings.Join(d.Removed, ", "))
+	}
+	if len(d.Changed) > 0 {
+		lines = append(lines, "Changed: "+strings.Join(d.Changed, ", "))
+	}
+	if len(d.RestartRequired) > 0 {
+		lines = append(lines, "Restart required to apply: "+strings.Join(d.RestartRequired, ", "))
+	}
+	return strings.Join(lines, "\n")
+}
+
+func (d ConfigDiff) Markdown() string {
+	if d.Empty() {
+		return "🔄 Configuration reloaded, no changes"
+	}
+
+	// Server names and settings like broadcast_ip are full of underscores
+	list := func(names []string) string {
+		escaped := make([]string, len(names))
+		for i, name := range names {
+			escaped[i] = tgbotapi.EscapeText(tgbotapi.ModeMarkdown, name)
+		}
+		return strings.Join(escaped, ", ")
+	}
+
+	var response strings.Builder
+	response.WriteString("🔄 *Configuration reloaded*\n\n")
+	if len(d.Added) > 0 {
+		response.WriteString(fmt.Sprintf("➕ Added: %s\n", list(d.Added)))
+	}
+	if len(d.Removed) > 0 {
+		response.WriteString(fmt.Sprintf("➖ Removed: %s\n", list(d.Removed)))
+	}
+	if len(d.Changed) > 0 {
+		response.WriteString(fmt.Sprintf("✏️ Changed: %s\n", list(d.Changed)))
+	}
+	if len(d.RestartRequired) > 0 {
+		response.WriteString(fmt.Sprintf("⚠️ Restart required to apply: %s\n", list(d.RestartRequired)))
+	}
+	return response.String()
+}
+
+func diffConfigs(oldConfig, newConfig *config.Config) ConfigDiff {
+	var diff ConfigDiff
+
+	oldServers := make(map[string]config.Server)
+	for _, server := range oldConfig.Servers {
+		oldServers[server.Name] = server
+	}
+	newServers := make(map[string]bool)
+	for _, server := range newConfig.Servers {
+		newServers[server.Name] = true
+		old, ok := oldServers[server.Name]
+		if !ok {
+			diff.Added = append(diff.Added, server.Name)
+		} else if !reflect.DeepEqual(old, server) {
+			diff.Changed = append(diff.Changed, server.Name)
+		}
+	}
+	for _, server := range oldConfig.Servers {
+		if !newServers[server.Name] {
+			diff.Removed = append(diff.Removed, server.Name)
+		}
+	}
+
+	if oldConfig.BroadcastIP != newConfig.BroadcastIP {
+		diff.Changed = append(diff.Changed, "broadcast_ip")
+	}
+	if oldConfig.MonitoringInterval != newConfig.MonitoringInterval {
+		diff.Changed = append(diff.Changed, "monitoring_interval")
+	}
+	if !reflect.DeepEqual(oldConfig.DHCPLeases, newConfig.DHCPLeases) {
+		diff.Changed = append(diff.Changed, "dhcp_leases")
+	}
+	if !reflect.DeepEqual(oldConfig.Relays, newConfig.Relays) {
+		diff.Changed = append(diff.Changed, "relays")
+	}
+	if oldConfig.Timezone != newConfig.Timezone {
+		diff.Changed = append(diff.Changed, "timezone")
+	}
+	if !reflect.DeepEqual(oldConfig.Templates, newConfig.Templates) {
+		diff.Changed = append(diff.Changed, "templates")
+	}
+	if !reflect.DeepEqual(oldConfig.Report, newConfig.Report) {
+		diff.Changed = append(diff.Changed, "report")
+	}
+	if !reflect.DeepEqual(oldConfig.Host, newConfig.Host) {
+		diff.Changed = append(diff.Changed, "host")
+	}
+	if !reflect.DeepEqual(oldConfig.Maintenance, newConfig.Maintenance) {
+		diff.Changed = append(diff.Changed, "maintenance")
+	}
+	if oldConfig.Telegram.AdminChatID != newConfig.Telegram.AdminChatID {
+		// Authorization switches immediately; notifications follow after restart
+		diff.Changed = append(diff.Changed, "telegram.admin_chat_id")
+	}
+	if !reflect.DeepEqual(oldConfig.Telegram.AllowedUsers, newConfig.Telegram.AllowedUsers) {
+		diff.Changed = append(diff.Changed, "telegram.allowed_users")
+	}
+	if !reflect.DeepEqual(oldConfig.Telegram.Topics, newConfig.Telegram.Topics) {
+		diff.Changed = append(diff.Changed, "telegram.topics")
+	}
+
+	// Settings that are bound to long-lived connections or files
+	if oldConfig.Telegram.BotToken != newConfig.Telegram.BotToken ||
+		oldConfig.Telegram.AdminChatID != newConfig.Telegram.AdminChatID ||
+		oldConfig.Telegram.APIEndpoint != newConfig.Telegram.APIEndpoint ||
+		!reflect.DeepEqual(oldConfig.Telegram.NotifySeverities, newConfig.Telegram.NotifySeverities) ||
+		!reflect.DeepEqual(oldConfig.Telegram.Webhook, newConfig.Telegram.Webhook) {
+		diff.RestartRequired = append(diff.RestartRequired, "telegram")
+	}
+	if !reflect.DeepEqual(oldConfig.MQTT, newConfig.MQTT) {
+		diff.RestartRequired = append(diff.RestartRequired, "mqtt")
+	}
+	if !reflect.DeepEqual(oldConfig.Notifiers, newConfig.Notifiers) {
+		diff.RestartRequired = append(diff.RestartRequired, "notifiers")
+	}
+	oldLog, newLog := oldConfig.Logging(), newConfig.Logging()
+	oldLevel, _ := config.ParseLogLevel(oldLog.Level)
+	newLevel, _ := config.ParseLogLevel(newLog.Level)
+	if oldLevel != newLevel {
+		diff.Changed = append(diff.Changed, "log.level")
+	}
+	oldLog.Level, newLog.Level = "", ""
+	if oldLog != newLog {
+		diff.RestartRequired = append(diff.RestartRequired, "log")
+	}
+	if !reflect.DeepEqual(oldConfig.Audit, newConfig.Audit) {
+		diff.RestartRequired = append(diff.RestartRequired, "audit")
+	}
+	if oldConfig.StateDir != newConfig.StateDir {
+		diff.RestartRequired = append(diff.RestartRequired, "state_dir")
+	}
+	if oldConfig.Site != newConfig.Site {
+		diff.RestartRequired = append(diff.RestartRequired, "site")
+	}
+	if !reflect.DeepEqual(oldConfig.Federation, newConfig.Federation) {
+		diff.RestartRequired = append(diff.RestartRequired, "federation")
+	}
+	if !reflect.DeepEqual(oldConfig.Peers, newConfig.Peers) {
+		diff.RestartRequired = append(diff.RestartRequired, "peers")
+	}
+
+	sort.Strings(diff.Added)
+	sort.Strings(diff.Removed)
+	return diff
+}
+
+// Reload re-reads the config file, validates it and applies it to the
+// running components. On any error the current config stays active. ctx
+// bounds the first check of servers that were added.
+func (d *Daemon) Reload(ctx context.Context) (ConfigDiff, error) {
+	d.reloadMutex.Lock()
+	defer d.reloadMutex.Unlock()
+
+	newConfig, err := LoadConfig(d.configPath)
+	if err != nil {
+		return ConfigDiff{}, err
+	}
+	logging.AddSecrets(newConfig.Secrets()...)
+	if d.noTelegram {
+		newConfig.Telegram.BotToken = ""
+	}
+
+	oldConfig := d.Config()
+	diff := diffConfigs(oldConfig, newConfig)
+	if diff.Empty() {
+		return diff, nil
+	}
+
+	// Everything that can fail is set up before anything is switched, so a
+	// bad template or relay leaves the running config untouched
+	applyMessages := func() {}
+	if d.messages != nil {
+		if applyMessages, err = d.messages.prepare(newConfig); err != nil {
+			return ConfigDiff{}, err
+		}
+	}
+	applyNetwork, err := d.network.prepare(newConfig)
+	if err != nil {
+		return ConfigDiff{}, err
+	}
+
+	applyMessages()
+	applyNetwork()
+	if d.suppressions != nil {
+		d.suppressions.SetWindows(newConfig.Maintenance)
+	}
+	d.monitor.UpdateServers(ctx, newConfig.Servers, newConfig.Interval())
+	if d.bridge != nil {
+		d.bridge.UpdateServers(newConfig.Servers, newConfig.BroadcastIP)
+	}
+	logging.SetLevel(newConfig.Logging().Level)
+	d.config.Store(newConfig)
+
+	slog.Info("Configuration reloaded", "changes", strings.ReplaceAll(diff.String(), "\n", "; "))
+	return diff, nil
+}
+
+// reloadAndNotify runs a reload triggered outside of chat and reports the
+// outcome through the notification channels.
+func (d *Daemon) reloadAndNotify(ctx context.Context, trigger string) {
+	var diff ConfigDiff
+	var err error
+	d.audited(ctx, AuditEntry{Source: auditSourceConfig, Username: trigger, Command: "reload"}, func(ctx context.Context) {
+		diff, err = d.Reload(ctx)
+		auditTarget(ctx, "", err)
+	})
+	if err != nil {
+		slog.Error("Config reload failed, keeping current config", "trigger", trigger, "error", err)
+		d.notifier.Dispatch(Notification{
+			Severity: SeverityWarning,
+			Title:    "Configuration reload failed",
+			Message:  fmt.Sprintf("Trigger: %s\n%v\nThe previous configuration is still active.", trigger, err),
+		})
+		return
+	}
+	if diff.Empty() {
+		return
+	}
+
+	d.notifier.Dispatch(Notification{
+		Severity: SeverityInfo,
+		Title:    "Configuration reloaded",
+		Message:  fmt.Sprintf("Trigger: %s\n%s", trigger, diff.String()),
+		Markdown: diff.Markdown(),
+	})
+}
+
+// watchReloadTriggers reloads the config on SIGHUP and whenever the config
+// file changes on disk, until ctx is done.
+func (d *Daemon) watchReloadTriggers(ctx context.Context) {
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+	go func() {
+		defer signal.Stop(hup)
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-hup:
+				slog.Info("Received SIGHUP, reloading configuration")
+				d.reloadAndNotify(ctx, "SIGHUP")
+			}
+		}
+	}()
+
+	go watchFile(ctx, d.configPath, configWatchInterval, func() {
+		slog.Info("Config file changed, reloading", "path", d.configPath)
+		d.reloadAndNotify(ctx, "file change")
+	})
+}
+
+// watchFile polls path and calls onChange once its modification time or size
+// has changed and then stayed the same for one more interval, so editors
+// that write in several steps only trigger a single reload. It returns once
+// ctx is done.
+func watchFile(ctx context.Context, path string, interval time.Duration, onChange func()) {
+	stat := func() (time.Time, int64, bool) {
+		info, err := os.Stat(path)
+		if err != nil {
+			return time.Time{}, 0, false
+		}
+		return info.ModTime(), info.Size(), true
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	lastMod, lastSize, _ := stat()
+	pending := false
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		mod, size, ok := stat()
+		if !ok {
+			continue
+		}
+		if !mod.Equal(lastMod) || size != lastSize {
+			lastMod, lastSize = mod, size
+			pending = true
+			continue
+		}
+		if pending {
+			pending = false
+			onChange()
+		}
+	}
+}
+
+// EditConfig applies a change to the config file and then reloads it, so the
+// running monitor picks it up without a restart. The change is made to a
+// copy next to the file, which only replaces it once it passes the same
+// checks as a reload; a rejected edit leaves the file untouched.
+func (d *Daemon) EditConfig(ctx context.Context, edit func(path string) error) (ConfigDiff, error) {
+	d.editMutex.Lock()
+	defer d.editMutex.Unlock()
+
+	info, err := os.Stat(d.configPath)
+	if err != nil {
+		return ConfigDiff{}, err
+	}
+	original, err := os.ReadFile(d.configPath)
+	if err != nil {
+		return ConfigDiff{}, err
+	}
+	staged, err := os.CreateTemp(filepath.Dir(d.configPath), "."+filepath.Base(d.configPath)+".edit*")
+	if err != nil {
+		return ConfigDiff{}, err
+	}
+	defer os.Remove(staged.Name())
+	_, err = staged.Write(original)
+	if closeErr := staged.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return ConfigDiff{}, err
+	}
+
+	if err := edit(staged.Name()); err != nil {
+		return ConfigDiff{}, err
+	}
+	if _, err := LoadConfig(staged.Name()); err != nil {
+		return ConfigDiff{}, err
+	}
+	edited, err := os.ReadFile(staged.Name())
+	if err != nil {
+		return ConfigDiff{}, err
+	}
+	if err := atomicfile.WriteFile(d.configPath, edited, info.Mode().Perm()); err != nil {
+		return ConfigDiff{}, fmt.Errorf("failed to write config file: %w", err)
+	}
+	return d.Reload(ctx)
+}
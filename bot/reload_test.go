@@ -0,0 +1,243 @@
+package bot
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/tsolodov/wot/config"
+	"github.com/tsolodov/wot/monitor"
+)
+
+func writeTestConfig(t *testing.T, path, content string) {
+	t.Helper()
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatalf("Failed to write config: %v", err)
+	}
+}
+
+// testProber reports the servers it lists as up and the others as down.
+// Servers with a host name are unresolvable.
+type testProber []string
+
+func (p testProber) Probe(ctx context.Context, server config.Server) (string, bool, error) {
+	if server.Host != "" {
+		return "", false, &unresolvableError{host: server.Host, err: errors.New("NXDOMAIN")}
+	}
+	return server.IPAddress, slices.Contains(p, server.Name), nil
+}
+
+// newTestDaemon loads the config at path with a monitor that finds the
+// servers named in up up.
+func newTestDaemon(t *testing.T, path string, up ...string) *Daemon {
+	t.Helper()
+
+	cfg, err := LoadConfig(path)
+	if err != nil {
+		t.Fatalf("Failed to load config: %v", err)
+	}
+
+	d := &Daemon{configPath: path, network: NewNetwork()}
+	d.config.Store(cfg)
+	d.monitor = monitor.New(context.Background(), cfg.Servers, cfg.Interval(), testProber(up))
+	return d
+}
+
+func TestDaemonReload(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	writeTestConfig(t, path, `
+servers:
+  - name: keep
+    mac_address: "00:11:22:33:44:55"
+    ip_address: "127.0.0.1"
+  - name: gone
+    mac_address: "00:11:22:33:44:56"
+monitoring_interval: 5
+`)
+
+	d := newTestDaemon(t, path, "keep")
+	d.monitor.CheckAll(context.Background())
+
+	writeTestConfig(t, path, `
+servers:
+  - name: keep
+    mac_address: "00:11:22:33:44:55"
+    ip_address: "127.0.0.1"
+    tcp_ports: [22]
+  - name: new
+    mac_address: "aa-bb-cc-dd-ee-ff"
+monitoring_interval: 2
+`)
+
+	diff, err := d.Reload(context.Background())
+	if err != nil {
+		t.Fatalf("Reload failed: %v", err)
+	}
+
+	if !reflect.DeepEqual(diff.Added, []string{"new"}) || !reflect.DeepEqual(diff.Removed, []string{"gone"}) {
+		t.Errorf("Unexpected added/removed: %+v", diff)
+	}
+	if !reflect.DeepEqual(diff.Changed, []string{"keep", "monitoring_interval"}) {
+		t.Errorf("Unexpected changed: %v", diff.Changed)
+	}
+	if len(diff.RestartRequired) != 0 {
+		t.Errorf("Expected no restart-required sections, got %v", diff.RestartRequired)
+	}
+	if markdown := diff.Markdown(); !strings.Contains(markdown, "Changed: keep, monitoring\\_interval") {
+		t.Errorf("Expected escaped names in %q", markdown)
+	}
+
+	if len(d.Config().Servers) != 2 || d.Config().Servers[1].Name != "new" {
+		t.Errorf("Expected new config to be active, got %+v", d.Config().Servers)
+	}
+
+	states := d.monitor.GetServerStates()
+	if state := states["keep"]; state == nil || !state.IsUp || state.CheckCount != 2 {
+		t.Errorf("Expected state of surviving server to be carried over, got %+v", state)
+	}
+	if _, ok := states["gone"]; ok {
+		t.Error("Expected state of removed server to be dropped")
+	}
+	if d.monitor.Interval() != 2*time.Minute {
+		t.Errorf("Expected interval to be updated, got %v", d.monitor.Interval())
+	}
+}
+
+func TestDaemonReloadKeepsConfigOnError(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	writeTestConfig(t, path, `
+servers:
+  - name: server1
+    mac_address: "00:11:22:33:44:55"
+`)
+
+	d := newTestDaemon(t, path)
+	original := d.Config()
+
+	writeTestConfig(t, path, `
+servers:
+  - name: server1
+    mac_address: "not-a-mac"
+`)
+
+	if _, err := d.Reload(context.Background()); err == nil {
+		t.Fatal("Expected reload of invalid config to fail")
+	}
+	if d.Config() != original {
+		t.Error("Expected previous config to stay active after a failed reload")
+	}
+
+	// Nor are the time zone and templates of a config that fails switched
+	messages, err := NewMessages(original)
+	if err != nil {
+		t.Fatal(err)
+	}
+	d.messages = messages
+	writeTestConfig(t, path, `
+timezone: Asia/Tokyo
+relays:
+  - name: parents
+    url: https://parents.example:8443
+    secret: "correct horse battery staple"
+    ca_cert: `+filepath.Join(t.TempDir(), "missing.pem")+`
+servers:
+  - name: server1
+    mac_address: "00:11:22:33:44:55"
+`)
+	if _, err := d.Reload(context.Background()); err == nil {
+		t.Fatal("Expected reload with a missing relay CA certificate to fail")
+	}
+	if location := d.messages.In(time.Now()).Location(); location != time.Local {
+		t.Errorf("Expected the time zone to stay local, got %v", location)
+	}
+}
+
+func TestDiffConfigsRestartRequired(t *testing.T) {
+	oldConfig := &config.Config{Telegram: config.TelegramConfig{BotToken: "a"}}
+	newConfig := &config.Config{
+		Telegram:  config.TelegramConfig{BotToken: "b"},
+		MQTT:      &config.MQTTConfig{Broker: "tcp://broker"},
+		Notifiers: []config.NotifierConfig{{Type: "ntfy", URL: "https://ntfy.sh/x"}},
+		Log:       &config.LogConfig{Level: "debug", Format: "json"},
+	}
+
+	diff := diffConfigs(oldConfig, newConfig)
+	if !reflect.DeepEqual(diff.RestartRequired, []string{"telegram", "mqtt", "notifiers", "log"}) {
+		t.Errorf("Unexpected restart-required sections: %v", diff.RestartRequired)
+	}
+	// The log level applies without a restart
+	if !reflect.DeepEqual(diff.Changed, []string{"log.level"}) {
+		t.Errorf("Unexpected changes: %v", diff.Changed)
+	}
+	if !diffConfigs(oldConfig, &config.Config{Telegram: oldConfig.Telegram, Log: &config.LogConfig{Level: "info"}}).Empty() {
+		t.Error("Expected the default log settings to produce an empty diff")
+	}
+	if diffConfigs(newConfig, newConfig).Empty() != true {
+		t.Error("Expected identical configs to produce an empty diff")
+	}
+}
+
+func TestDaemonEditConfigReloads(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	writeTestConfig(t, path, `
+servers:
+  - name: nas
+    mac_address: "aa:bb:cc:dd:ee:01"
+`)
+	d := newTestDaemon(t, path)
+
+	diff, err := d.EditConfig(context.Background(), func(path string) error {
+		return config.AddServer(path, config.Server{Name: "printer", MACAddress: "aa:bb:cc:dd:ee:03", IPAddress: "127.0.0.1", TCPPorts: []int{1}})
+	})
+	if err != nil {
+		t.Fatalf("EditConfig: %v", err)
+	}
+	if len(diff.Added) != 1 || diff.Added[0] != "printer" {
+		t.Errorf("unexpected diff: %+v", diff)
+	}
+	if len(d.Config().Servers) != 2 {
+		t.Errorf("running config not updated: %+v", d.Config().Servers)
+	}
+	if _, ok := d.monitor.GetServerStates()["printer"]; !ok {
+		t.Error("monitor does not track the added server")
+	}
+	if data, _ := os.ReadFile(path); !strings.Contains(string(data), "printer") {
+		t.Error("config file not updated")
+	}
+}
+
+func TestDaemonEditConfigRejectsInvalidEdit(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	original := `
+servers:
+  - name: nas
+    mac_address: "aa:bb:cc:dd:ee:01"
+`
+	writeTestConfig(t, path, original)
+	d := newTestDaemon(t, path)
+
+	// The template is fine for config.Validate, but not for the bot
+	_, err := d.EditConfig(context.Background(), func(path string) error {
+		edited := original + "templates:\n  server_down: \"{{ .Missing\"\n"
+		cfg, err := config.Parse([]byte(edited))
+		if err != nil || cfg.Validate() != nil {
+			t.Fatalf("edit rejected by config.Validate: %v", err)
+		}
+		return os.WriteFile(path, []byte(edited), 0600)
+	})
+	if err == nil || !strings.Contains(err.Error(), "templates.server_down") {
+		t.Fatalf("expected the template error, got %v", err)
+	}
+	if data, _ := os.ReadFile(path); string(data) != original {
+		t.Errorf("config file changed by a rejected edit:\n%s", data)
+	}
+	if entries, _ := os.ReadDir(filepath.Dir(path)); len(entries) != 1 {
+		t.Errorf("staged copy left behind: %v", entries)
+	}
+}
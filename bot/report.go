@@ -0,0 +1,234 @@
+package bot
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"strings"
+	"time"
+
+	"github.com/tsolodov/wot/config"
+)
+
+// runReportSchedule sends the digest report whenever a scheduled time
+// passes. It follows config reloads; a report missed while the daemon was
+// not running is not sent afterwards. It returns once ctx is done.
+func (d *Daemon) runReportSchedule(ctx context.Context) {
+	ticker := time.NewTicker(30 * time.Second)
+	defer ticker.Stop()
+
+	lastSent := time.Now()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		report := d.Config().Report
+		if report == nil {
+			continue
+		}
+
+		now := d.messages.In(time.Now())
+		run := report.LastRun(now)
+		if !run.After(lastSent) {
+			continue
+		}
+		lastSent = now
+
+		title := "Daily report"
+		if report.Schedule == "weekly" {
+			title = "Weekly report"
+		}
+		slog.Info("Sending report", "title", title)
+		markdown := d.buildReport(title, run.Add(-report.Period()), run)
+		d.notifier.Dispatch(Notification{
+			Severity: SeverityInfo,
+			Title:    title,
+			Message:  plainText(markdown),
+			Markdown: markdown,
+			Time:     run,
+		})
+	}
+}
+
+// serverReport summarizes the history of one server over a report period.
+type serverReport struct {
+	Name         string
+	Observed     time.Duration
+	Up           time.Duration
+	Outages      int
+	Longest      time.Duration
+	Wakes        int
+	WakeFailures int
+}
+
+// Availability is the percentage of the observed time the server was up.
+func (r serverReport) Availability() float64 {
+	if r.Observed == 0 {
+		return 0
+	}
+	return 100 * r.Up.Seconds() / r.Observed.Seconds()
+}
+
+// monitoringGaps sums up the time within [from, to) in which WoT itself was
+// not running, e.g. because the Pi lost power.
+func monitoringGaps(events []HistoryEvent, from, to time.Time) (int, time.Duration) {
+	count := 0
+	var total time.Duration
+	var stopped time.Time
+	for _, event := range events {
+		switch event.Type {
+		case eventStop:
+			stopped = event.Time
+		case eventStart:
+			if stopped.IsZero() {
+				continue
+			}
+			if gap := overlap(stopped, event.Time, from, to); gap > 0 {
+				count++
+				total += gap
+			}
+			stopped = time.Time{}
+		}
+	}
+	return count, total
+}
+
+// summarizeServer replays the history of server. Time in which WoT was not
+// running is left out of the availability, and an outage that was already
+// going on at the start of the period counts as one.
+func summarizeServer(events []HistoryEvent, server string, from, to time.Time) serverReport {
+	report := serverReport{Name: server}
+
+	known, up := false, false
+	var since, downSince time.Time
+	account := func(until time.Time) {
+		if !known {
+			return
+		}
+		observed := overlap(since, until, from, to)
+		report.Observed += observed
+		if up {
+			report.Up += observed
+		}
+	}
+	endOutage := func(until time.Time) {
+		if length := overlap(downSince, until, from, to); length > 0 {
+			report.Outages++
+			if length > report.Longest {
+				report.Longest = length
+			}
+		}
+	}
+
+	for _, event := range events {
+		if !event.Time.Before(to) {
+			break
+		}
+		switch {
+		case event.Type == eventStop:
+			account(event.Time)
+			known = false
+		case event.Server != server:
+		case event.Type == eventWake:
+			if !event.Time.Before(from) {
+				report.Wakes++
+				if event.Error != "" {
+					report.WakeFailures++
+				}
+			}
+		case event.Type == eventUp || event.Type == eventDown:
+			account(event.Time)
+			wasDown := !downSince.IsZero()
+			if event.Type == eventDown && !wasDown {
+				downSince = event.Time
+			}
+			if event.Type == eventUp && wasDown {
+				endOutage(event.Time)
+				downSince = time.Time{}
+			}
+			known, up, since = true, event.Type == eventUp, event.Time
+		}
+	}
+	account(to)
+	if !downSince.IsZero() {
+		endOutage(to)
+	}
+	return report
+}
+
+// overlap returns how much of [start, end) lies within [from, to).
+func overlap(start, end, from, to time.Time) time.Duration {
+	if start.Before(from) {
+		start = from
+	}
+	if end.After(to) {
+		end = to
+	}
+	if !end.After(start) {
+		return 0
+	}
+	return end.Sub(start)
+}
+
+// buildReport renders the digest for [from, to) from the monitor's history.
+func (d *Daemon) buildReport(title string, from, to time.Time) string {
+	events := d.history.Events()
+
+	report := reportMessage{
+		Title:  title,
+		From:   from,
+		To:     to,
+		Uptime: getSystemUptime(),
+		Load:   getLoadAverage(),
+	}
+	report.Gaps, report.NotMonitoring = monitoringGaps(events, from, to)
+	for _, server := range d.Config().Servers {
+		summary := summarizeServer(events, server.Name, from, to)
+		report.Wakes += summary.Wakes
+		report.WakeFailures += summary.WakeFailures
+		report.Servers = append(report.Servers, summary)
+	}
+	return d.messages.Render("report", report)
+}
+
+// formatPercent shows availability with one decimal, without rounding a
+// server that was down at all up to 100%.
+func formatPercent(percent float64) string {
+	if percent < 100 && percent > 99.9 {
+		return "99.9%"
+	}
+	if percent == 100 {
+		return "100%"
+	}
+	return fmt.Sprintf("%.1f%%", percent)
+}
+
+func getLoadAverage() string {
+	load, ok := hostReader{root: "/"}.load()
+	if !ok {
+		return "unknown"
+	}
+	return fmt.Sprintf("%.2f %.2f %.2f", load[0], load[1], load[2])
+}
+
+// parseReportPeriod parses the argument of /report: day, week or a duration
+// such as 12h or 3d.
+func parseReportPeriod(value string) (time.Duration, error) {
+	switch strings.ToLower(value) {
+	case "day", "daily":
+		return 24 * time.Hour, nil
+	case "week", "weekly":
+		return 7 * 24 * time.Hour, nil
+	}
+	period, err := config.ParseDuration(value)
+	if err != nil {
+		return 0, err
+	}
+	if period > historyRetention-24*time.Hour {
+		return 0, fmt.Errorf("history is only kept for %d days", int(historyRetention.Hours()/24)-1)
+	}
+	return period, nil
+}
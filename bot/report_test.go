@@ -0,0 +1,124 @@
+package bot
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestSummarizeServer(t *testing.T) {
+	base := time.Date(2024, 5, 1, 0, 0, 0, 0, time.UTC)
+	at := func(hours float64) time.Time { return base.Add(time.Duration(hours * float64(time.Hour))) }
+
+	events := []HistoryEvent{
+		{Time: at(-10), Type: eventStart},
+		{Time: at(-10), Type: eventDown, Server: "nas"},
+		{Time: at(-10), Type: eventUp, Server: "web"},
+		{Time: at(2), Type: eventWake, Server: "nas", By: "@alice"},
+		{Time: at(2), Type: eventUp, Server: "nas"},
+		{Time: at(6), Type: eventDown, Server: "nas"},
+		{Time: at(7), Type: eventUp, Server: "nas"},
+		// The Pi loses power for two hours
+		{Time: at(10), Type: eventStop},
+		{Time: at(12), Type: eventStart},
+		{Time: at(12), Type: eventUp, Server: "nas"},
+		{Time: at(12), Type: eventUp, Server: "web"},
+		{Time: at(20), Type: eventWake, Server: "nas", By: "Home Assistant", Error: "network unreachable"},
+	}
+	from, to := base, at(24)
+
+	nas := summarizeServer(events, "nas", from, to)
+	if nas.Observed != 22*time.Hour || nas.Up != 19*time.Hour {
+		t.Errorf("nas: observed %v, up %v", nas.Observed, nas.Up)
+	}
+	// The outage going on at the start of the period counts
+	if nas.Outages != 2 || nas.Longest != 2*time.Hour {
+		t.Errorf("nas: %d outages, longest %v", nas.Outages, nas.Longest)
+	}
+	if nas.Wakes != 2 || nas.WakeFailures != 1 {
+		t.Errorf("nas: %d wakes, %d failed", nas.Wakes, nas.WakeFailures)
+	}
+
+	web := summarizeServer(events, "web", from, to)
+	if web.Observed != 22*time.Hour || web.Up != web.Observed || web.Outages != 0 {
+		t.Errorf("web: %+v", web)
+	}
+	report := (*Messages)(nil).Render("report", reportMessage{
+		Servers: []serverReport{nas, summarizeServer(events, "my_printer", from, to)},
+	})
+	for _, want := range []string{"\n• *nas*: 86.4% up, 2 outages (longest 2h 0m), 2 wakes (1 failed)\n", "\n• *my\\_printer*: no data\n"} {
+		if !strings.Contains(report, want) {
+			t.Errorf("report %q does not contain %q", report, want)
+		}
+	}
+
+	if gaps, total := monitoringGaps(events, from, to); gaps != 1 || total != 2*time.Hour {
+		t.Errorf("gaps: %d, %v", gaps, total)
+	}
+}
+
+func TestHistoryRestart(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "history.jsonl")
+	now := time.Date(2024, 5, 1, 10, 0, 0, 0, time.UTC)
+
+	history := &History{path: path, now: func() time.Time { return now }}
+	history.Add(HistoryEvent{Time: now.Add(-40 * 24 * time.Hour), Type: eventUp, Server: "nas"})
+	history.Add(HistoryEvent{Time: now.Add(-39 * 24 * time.Hour), Type: eventDown, Server: "nas"})
+	history.Add(HistoryEvent{Time: now.Add(-38 * 24 * time.Hour), Type: eventWake, Server: "nas"})
+	history.Add(HistoryEvent{Time: now.Add(-time.Hour), Type: eventUp, Server: "web"})
+	history.Heartbeat(now.Add(-10 * time.Minute))
+
+	// A half-written line from a crash is ignored
+	file, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND, 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+	file.WriteString(`{"time":"2024-05`)
+	file.Close()
+
+	restarted := &History{path: path, now: func() time.Time { return now }}
+	if err := restarted.load(); err != nil {
+		t.Fatalf("load: %v", err)
+	}
+	events := restarted.Events()
+
+	var types []string
+	for _, event := range events {
+		types = append(types, event.Type+":"+event.Server)
+	}
+	// Only the last state of nas survives the retention, and the previous
+	// run is marked as stopped at its last heartbeat
+	if got := strings.Join(types, ","); got != "down:nas,up:web,stop:" {
+		t.Fatalf("unexpected events %s", got)
+	}
+	if !events[2].Time.Equal(now.Add(-10 * time.Minute)) {
+		t.Errorf("stop not taken from the heartbeat: %v", events[2].Time)
+	}
+}
+
+func TestParseReportPeriod(t *testing.T) {
+	for value, want := range map[string]time.Duration{"day": 24 * time.Hour, "Week": 7 * 24 * time.Hour, "12h": 12 * time.Hour, "30d": 30 * 24 * time.Hour} {
+		if got, err := parseReportPeriod(value); err != nil || got != want {
+			t.Errorf("%s: got %v (%v)", value, got, err)
+		}
+	}
+	if _, err := parseReportPeriod("60d"); err == nil {
+		t.Error("expected an error for a period beyond the history")
+	}
+}
+
+func TestTelegramReportEscapesNames(t *testing.T) {
+	_, fake, _ := startTestBot(t, `
+servers:
+  - name: my_nas
+    mac_address: "aa:bb:cc:dd:ee:01"
+    ip_address: "192.0.2.1"
+`)
+
+	// The fake rejects broken Markdown, so an unescaped _ would lose the reply
+	if reply := converse(t, fake, "/report"); !strings.Contains(reply, `*my\_nas*`) {
+		t.Errorf("/report: %s", reply)
+	}
+}
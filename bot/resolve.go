@@ -0,0 +1,351 @@
+package bot
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"net"
+	"net/netip"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/tsolodov/wot/config"
+	"github.com/tsolodov/wot/wol"
+)
+
+// unresolvableError reports that a server's host name could not be resolved.
+// Such servers are shown as unresolvable instead of DOWN.
+type unresolvableError struct {
+	host string
+	err  error
+}
+
+func (e *unresolvableError) Error() string {
+	return fmt.Sprintf("cannot resolve %s: %v", e.host, e.err)
+}
+
+func (e *unresolvableError) Unwrap() error {
+	return e.err
+}
+
+type hostCacheEntry struct {
+	address string
+	expires time.Time
+}
+
+// AddressResolver finds the current IP address of servers: from the MAC
+// address for hosts that get their address by DHCP, and by DNS or mDNS for
+// servers configured with a host name.
+type AddressResolver struct {
+	mutex      sync.Mutex
+	leaseFiles []string
+	lastKnown  map[string]string
+	hosts      map[string]hostCacheEntry
+	neighbors  func() ([]Neighbor, error)
+	lookupHost func(ctx context.Context, host string) (string, time.Duration, error)
+	now        func() time.Time
+}
+
+func NewAddressResolver(leaseFiles []string) *AddressResolver {
+	return &AddressResolver{
+		leaseFiles: leaseFiles,
+		lastKnown:  make(map[string]string),
+		hosts:      make(map[string]hostCacheEntry),
+		neighbors:  readNeighbors,
+		lookupHost: lookupHostAddress,
+		now:        time.Now,
+	}
+}
+
+func (r *AddressResolver) SetLeaseFiles(files []string) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	r.leaseFiles = files
+}
+
+// Resolve returns the address to probe for server. Configured addresses are
+// returned as is and host names are resolved through the cache. Otherwise
+// the DHCP lease files are consulted first, then the kernel neighbour table,
+// and finally the last address seen for the MAC so a host that dropped out
+// of the neighbour table while powered off is still probed (and reported
+// DOWN) at its previous address.
+func (r *AddressResolver) Resolve(ctx context.Context, server config.Server) (string, error) {
+	if server.Host != "" {
+		return r.resolveHost(ctx, server.Host)
+	}
+	if !server.UsesAutoAddress() {
+		return server.IPAddress, nil
+	}
+
+	mac, err := wol.ParseMAC(server.MACAddress)
+	if err != nil {
+		return "", err
+	}
+
+	r.mutex.Lock()
+	leaseFiles := r.leaseFiles
+	previous := r.lastKnown[mac.String()]
+	r.mutex.Unlock()
+
+	address := r.fromLeases(leaseFiles, mac)
+	if address == "" {
+		address = r.fromNeighbors(mac)
+	}
+	if address == "" {
+		if previous != "" {
+			return previous, nil
+		}
+		return "", fmt.Errorf("no address found for %s", mac)
+	}
+
+	if address != previous {
+		slog.Info("Found server address", "server", server.Name, "mac", mac, "address", address)
+		r.mutex.Lock()
+		r.lastKnown[mac.String()] = address
+		r.mutex.Unlock()
+	}
+	return address, nil
+}
+
+// resolveHost resolves a host name, caching the answer for its TTL. When an
+// mDNS name stops answering the expired address is still returned: the host
+// answers for itself, so silence usually means it is switched off and should
+// be probed (and reported DOWN) rather than shown as unresolvable.
+func (r *AddressResolver) resolveHost(ctx context.Context, host string) (string, error) {
+	key := strings.ToLower(host)
+	now := r.now()
+
+	r.mutex.Lock()
+	entry, cached := r.hosts[key]
+	r.mutex.Unlock()
+	if cached && now.Before(entry.expires) {
+		return entry.address, nil
+	}
+
+	address, ttl, err := r.lookupHost(ctx, host)
+	if err != nil {
+		if cached && isMDNSName(host) {
+			return entry.address, nil
+		}
+		return "", &unresolvableError{host: host, err: err}
+	}
+	if ttl <= 0 {
+		ttl = dnsCacheTTL
+	}
+
+	if !cached || entry.address != address {
+		slog.Info("Resolved host name", "host", host, "address", address)
+	}
+	r.mutex.Lock()
+	r.hosts[key] = hostCacheEntry{address: address, expires: now.Add(ttl)}
+	r.mutex.Unlock()
+	return address, nil
+}
+
+func (r *AddressResolver) fromLeases(files []string, mac net.HardwareAddr) string {
+	now := r.now()
+	address := ""
+	for _, path := range files {
+		leases, err := readLeaseFile(path)
+		if err != nil {
+			slog.Warn("Failed to read DHCP leases", "path", path, "error", err)
+			continue
+		}
+		// Later entries are newer in both formats
+		for _, lease := range leases {
+			if bytes.Equal(lease.MAC, mac) && (lease.Expires.IsZero() || lease.Expires.After(now)) {
+				address = lease.IP.String()
+			}
+		}
+	}
+	return address
+}
+
+func (r *AddressResolver) fromNeighbors(mac net.HardwareAddr) string {
+	neighbors, err := r.neighbors()
+	if err != nil {
+		return ""
+	}
+	address := ""
+	for _, neighbor := range neighbors {
+		if !bytes.Equal(neighbor.MAC, mac) {
+			continue
+		}
+		if neighbor.IP.Is4() {
+			return neighbor.IP.String()
+		}
+		if address == "" && !neighbor.IP.IsLinkLocalUnicast() {
+			address = neighbor.IP.String()
+		}
+	}
+	return address
+}
+
+// dhcpLease is an address assignment read from a DHCP server's lease file.
+// A zero Expires means the lease does not expire.
+type dhcpLease struct {
+	IP       netip.Addr
+	MAC      net.HardwareAddr
+	Hostname string
+	Expires  time.Time
+}
+
+func readLeaseFile(path string) ([]dhcpLease, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	leases, err := parseLeases(bytes.NewReader(data))
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return leases, nil
+}
+
+var iscLeaseStart = regexp.MustCompile(`(?m)^\s*lease\s+\S+\s*\{`)
+
+// parseLeases parses a dnsmasq or ISC dhcpd lease file, detecting the format
+// from the content.
+func parseLeases(r io.Reader) ([]dhcpLease, error) {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	if iscLeaseStart.Match(data) {
+		return parseISCLeases(data)
+	}
+	return parseDnsmasqLeases(data)
+}
+
+// parseDnsmasqLeases parses dnsmasq.leases, one lease per line:
+//
+//	1700000000 aa:bb:cc:dd:ee:01 192.168.1.20 nas 01:aa:bb:cc:dd:ee:01
+//
+// The first field is the expiry as a Unix timestamp, 0 for infinite leases.
+func parseDnsmasqLeases(data []byte) ([]dhcpLease, error) {
+	var leases []dhcpLease
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for line := 1; scanner.Scan(); line++ {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) == 0 || strings.HasPrefix(fields[0], "#") {
+			continue
+		}
+		// DHCPv6 leases start with a "duid" line and use DUIDs instead of MACs
+		if fields[0] == "duid" || len(fields) < 3 {
+			continue
+		}
+
+		expiry, err := strconv.ParseInt(fields[0], 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: invalid expiry '%s'", line, fields[0])
+		}
+		mac, err := net.ParseMAC(fields[1])
+		if err != nil {
+			continue
+		}
+		ip, err := netip.ParseAddr(fields[2])
+		if err != nil {
+			return nil, fmt.Errorf("line %d: invalid address '%s'", line, fields[2])
+		}
+
+		lease := dhcpLease{IP: ip, MAC: mac}
+		if expiry > 0 {
+			lease.Expires = time.Unix(expiry, 0)
+		}
+		if len(fields) > 3 && fields[3] != "*" {
+			lease.Hostname = fields[3]
+		}
+		leases = append(leases, lease)
+	}
+	return leases, scanner.Err()
+}
+
+// parseISCLeases parses the dhcpd.leases format of the ISC DHCP server:
+//
+//	lease 192.168.1.20 {
+//	  ends 3 2023/10/11 22:00:00;
+//	  binding state active;
+//	  hardware ethernet aa:bb:cc:dd:ee:01;
+//	  client-hostname "nas";
+//	}
+//
+// Each block replaces earlier blocks for the same address, and leases that
+// are not in the active state are skipped. Times are UTC, or
+// Unix timestamps with db-time-format local ("ends epoch 1697061600;").
+func parseISCLeases(data []byte) ([]dhcpLease, error) {
+	var leases []dhcpLease
+	var current *dhcpLease
+	active := true
+
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for line := 1; scanner.Scan(); line++ {
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" || strings.HasPrefix(text, "#") {
+			continue
+		}
+		fields := strings.Fields(strings.TrimSuffix(text, ";"))
+
+		if current == nil {
+			if len(fields) >= 3 && fields[0] == "lease" && fields[2] == "{" {
+				ip, err := netip.ParseAddr(fields[1])
+				if err != nil {
+					return nil, fmt.Errorf("line %d: invalid address '%s'", line, fields[1])
+				}
+				current = &dhcpLease{IP: ip}
+				active = true
+			}
+			continue
+		}
+
+		switch {
+		case text == "}":
+			// A later block for the same address replaces the earlier one
+			for i := range leases {
+				if leases[i].IP == current.IP {
+					leases = append(leases[:i], leases[i+1:]...)
+					break
+				}
+			}
+			if active && current.MAC != nil {
+				leases = append(leases, *current)
+			}
+			current = nil
+		case len(fields) >= 3 && fields[0] == "hardware" && fields[1] == "ethernet":
+			if mac, err := net.ParseMAC(fields[2]); err == nil {
+				current.MAC = mac
+			}
+		case len(fields) >= 3 && fields[0] == "binding" && fields[1] == "state":
+			active = fields[2] == "active"
+		case len(fields) >= 2 && fields[0] == "client-hostname":
+			current.Hostname = strings.Trim(fields[1], `"`)
+		case len(fields) >= 2 && fields[0] == "ends":
+			if fields[1] == "never" {
+				break
+			}
+			if fields[1] == "epoch" && len(fields) >= 3 {
+				seconds, err := strconv.ParseInt(fields[2], 10, 64)
+				if err != nil {
+					return nil, fmt.Errorf("line %d: invalid end time '%s'", line, fields[2])
+				}
+				current.Expires = time.Unix(seconds, 0)
+				break
+			}
+			if len(fields) < 4 {
+				break
+			}
+			ends, err := time.Parse("2006/01/02 15:04:05", fields[2]+" "+fields[3])
+			if err != nil {
+				return nil, fmt.Errorf("line %d: invalid end time: %w", line, err)
+			}
+			current.Expires = ends
+		}
+	}
+	return leases, scanner.Err()
+}
@@ -0,0 +1,126 @@
+package bot
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/netip"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/tsolodov/wot/config"
+)
+
+func readLeaseFixture(t *testing.T, name string) []dhcpLease {
+	t.Helper()
+	leases, err := readLeaseFile(filepath.Join("testdata", name))
+	if err != nil {
+		t.Fatalf("readLeaseFile(%s): %v", name, err)
+	}
+	return leases
+}
+
+func TestParseDnsmasqLeases(t *testing.T) {
+	leases := readLeaseFixture(t, "dnsmasq.leases")
+	if len(leases) != 3 {
+		t.Fatalf("expected 3 IPv4 leases, got %+v", leases)
+	}
+
+	if leases[0].IP.String() != "192.168.1.20" || leases[0].MAC.String() != "aa:bb:cc:dd:ee:01" ||
+		leases[0].Hostname != "nas" || !leases[0].Expires.Equal(time.Unix(1700003600, 0)) {
+		t.Errorf("unexpected first lease: %+v", leases[0])
+	}
+	if leases[1].Hostname != "desktop" {
+		t.Errorf("unexpected hostname: %+v", leases[1])
+	}
+	if leases[2].Hostname != "" || !leases[2].Expires.IsZero() {
+		t.Errorf("infinite lease without hostname parsed as %+v", leases[2])
+	}
+}
+
+func TestParseISCLeases(t *testing.T) {
+	leases := readLeaseFixture(t, "dhcpd.leases")
+	if len(leases) != 2 {
+		t.Fatalf("expected 2 active leases, got %+v", leases)
+	}
+
+	want := time.Date(2023, 11, 14, 23, 0, 0, 0, time.UTC)
+	if leases[0].IP.String() != "192.168.1.50" || leases[0].MAC.String() != "aa:bb:cc:dd:ee:10" ||
+		leases[0].Hostname != "nas" || !leases[0].Expires.Equal(want) {
+		t.Errorf("unexpected first lease: %+v", leases[0])
+	}
+	if leases[1].IP.String() != "192.168.1.52" || !leases[1].Expires.Equal(time.Unix(1700006400, 0)) {
+		t.Errorf("unexpected epoch lease: %+v", leases[1])
+	}
+}
+
+func TestAddressResolver(t *testing.T) {
+	mac := func(s string) net.HardwareAddr {
+		m, _ := net.ParseMAC(s)
+		return m
+	}
+	neighbors := []Neighbor{
+		{IP: netip.MustParseAddr("fe80::1"), MAC: mac("aa:bb:cc:dd:ee:05")},
+		{IP: netip.MustParseAddr("192.168.1.60"), MAC: mac("aa:bb:cc:dd:ee:05")},
+		{IP: netip.MustParseAddr("192.168.1.99"), MAC: mac("aa:bb:cc:dd:ee:01")},
+	}
+
+	resolver := NewAddressResolver([]string{filepath.Join("testdata", "dnsmasq.leases")})
+	resolver.neighbors = func() ([]Neighbor, error) { return neighbors, nil }
+	resolver.now = func() time.Time { return time.Unix(1700000000, 0) }
+
+	tests := []struct {
+		server config.Server
+		want   string
+	}{
+		// Configured addresses are used as is
+		{config.Server{Name: "static", MACAddress: "aa:bb:cc:dd:ee:01", IPAddress: "10.0.0.5"}, "10.0.0.5"},
+		// Leases take precedence over the neighbour table
+		{config.Server{Name: "nas", MACAddress: "AA-BB-CC-DD-EE-01", IPAddress: "auto"}, "192.168.1.20"},
+		{config.Server{Name: "forever", MACAddress: "aabbccddee03"}, "192.168.1.22"},
+		// Expired lease, IPv4 neighbour preferred over IPv6
+		{config.Server{Name: "desktop", MACAddress: "aa:bb:cc:dd:ee:02"}, ""},
+		{config.Server{Name: "pi", MACAddress: "aa:bb:cc:dd:ee:05"}, "192.168.1.60"},
+	}
+	for _, tt := range tests {
+		got, err := resolver.Resolve(context.Background(), tt.server)
+		if tt.want == "" {
+			if err == nil {
+				t.Errorf("%s: expected no address, got %s", tt.server.Name, got)
+			}
+			continue
+		}
+		if err != nil || got != tt.want {
+			t.Errorf("%s: got %q (%v), want %q", tt.server.Name, got, err, tt.want)
+		}
+	}
+
+	// The last known address is kept when the host disappears
+	resolver.neighbors = func() ([]Neighbor, error) { return nil, errors.New("unavailable") }
+	if got, err := resolver.Resolve(context.Background(), config.Server{Name: "pi", MACAddress: "aa:bb:cc:dd:ee:05"}); err != nil || got != "192.168.1.60" {
+		t.Errorf("last known address not used: %q (%v)", got, err)
+	}
+}
+
+func TestValidateConfigAutoAddress(t *testing.T) {
+	cfg := &config.Config{Servers: []config.Server{
+		{Name: "dhcp", MACAddress: "aa:bb:cc:dd:ee:01", IPAddress: "auto"},
+		{Name: "mac-only", MACAddress: "aa:bb:cc:dd:ee:02"},
+	}}
+	if err := validateConfig(cfg); err != nil {
+		t.Errorf("auto addresses rejected: %v", err)
+	}
+	if !cfg.Servers[0].UsesAutoAddress() || !cfg.Servers[1].UsesAutoAddress() {
+		t.Error("servers without a fixed IP should use auto addresses")
+	}
+}
+
+func TestAddressResolverMissingLeaseFile(t *testing.T) {
+	resolver := NewAddressResolver([]string{filepath.Join(t.TempDir(), "missing.leases")})
+	resolver.neighbors = func() ([]Neighbor, error) { return nil, os.ErrNotExist }
+	if _, err := resolver.Resolve(context.Background(), config.Server{Name: "nas", MACAddress: "aa:bb:cc:dd:ee:01"}); err == nil {
+		t.Error("expected an error without any address source")
+	}
+}
@@ -0,0 +1,827 @@
+package bot
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+	"github.com/tsolodov/wot/config"
+	"github.com/tsolodov/wot/internal/logging"
+)
+
+const (
+	telegramMinBackoff = 5 * time.Second
+	telegramMaxBackoff = 5 * time.Minute
+
+	// /discover results are split into messages of at most this many hosts
+	// and bytes, below Telegram's 4096 characters with room for the header
+	discoverHostsPerMessage = 30
+	discoverMessageLength   = 3500
+)
+
+// Messenger is the part of the Bot API that command handlers and the
+// Telegram notifier use. *tgbotapi.BotAPI implements it.
+type Messenger interface {
+	Send(c tgbotapi.Chattable) (tgbotapi.Message, error)
+	Request(c tgbotapi.Chattable) (*tgbotapi.APIResponse, error)
+	MakeRequest(endpoint string, params tgbotapi.Params) (*tgbotapi.APIResponse, error)
+}
+
+// runTelegramBot connects to the Bot API and serves commands until ctx is
+// done, receiving updates by long polling or through the configured
+// webhook. Connection failures are retried with exponential backoff; only a
+// rejected token disables the bot, and in that case the rest of the daemon
+// keeps running. A command being handled when ctx ends is finished first.
+func runTelegramBot(ctx context.Context, d *Daemon, notifier *TelegramNotifier) {
+	bot, err := connectTelegram(ctx, d.Config().Telegram)
+	if ctx.Err() != nil {
+		return
+	}
+	if err != nil {
+		slog.Error("Telegram bot disabled", "error", err)
+		return
+	}
+
+	bot.Debug = false
+	slog.Info("Authorized on Telegram", "account", bot.Self.UserName)
+
+	registerCommands(bot, d.Config().Telegram)
+	if notifier != nil {
+		notifier.SetBot(bot)
+	}
+
+	var updates <-chan tgbotapi.Update
+	if webhook := d.Config().Telegram.Webhook; webhook != nil {
+		var stop func()
+		updates, stop, err = startWebhook(ctx, bot, webhook)
+		if ctx.Err() != nil {
+			return
+		}
+		if err != nil {
+			slog.Error("Telegram bot disabled", "error", err)
+			return
+		}
+		defer stop()
+	} else {
+		deleteStaleWebhook(bot)
+		u := tgbotapi.NewUpdate(0)
+		u.Timeout = 60
+
+		updates = bot.GetUpdatesChan(u)
+		defer bot.StopReceivingUpdates()
+	}
+
+	for {
+		var update tgbotapi.Update
+		var ok bool
+		select {
+		case <-ctx.Done():
+			return
+		case update, ok = <-updates:
+			if !ok {
+				return
+			}
+		}
+
+		if update.CallbackQuery != nil {
+			handleTelegramCallback(ctx, bot, update.CallbackQuery, d)
+			continue
+		}
+		if update.InlineQuery != nil {
+			handleInlineQuery(bot, update.InlineQuery, d, bot.Self.UserName)
+			continue
+		}
+		if update.MyChatMember != nil {
+			handleChatMembership(bot, update.MyChatMember, d)
+			continue
+		}
+		if update.Message == nil {
+			continue
+		}
+
+		handleTelegramMessage(ctx, bot, update.Message, d, bot.Self.UserName)
+	}
+}
+
+func connectTelegram(ctx context.Context, cfg config.TelegramConfig) (*tgbotapi.BotAPI, error) {
+	endpoint := tgbotapi.APIEndpoint
+	if cfg.APIEndpoint != "" {
+		endpoint = strings.TrimSuffix(cfg.APIEndpoint, "/") + "/bot%s/%s"
+		slog.Info("Using custom Telegram Bot API", "url", cfg.APIEndpoint)
+	}
+
+	backoff := telegramMinBackoff
+	for {
+		bot, err := tgbotapi.NewBotAPIWithClient(cfg.BotToken, endpoint, tokenSafeClient{client: &http.Client{}, token: cfg.BotToken})
+		if err == nil {
+			return bot, nil
+		}
+
+		var apiErr *tgbotapi.Error
+		if errors.As(err, &apiErr) && (apiErr.Code == 401 || apiErr.Code == 404) {
+			return nil, fmt.Errorf("bot token rejected by Telegram: %w", err)
+		}
+
+		slog.Warn("Telegram API unreachable", "retry_in", backoff, "error", err)
+		if !waitTelegramBackoff(ctx, &backoff) {
+			return nil, ctx.Err()
+		}
+	}
+}
+
+// tokenSafeClient keeps the bot token, which is part of every Bot API URL,
+// out of the errors of failed requests.
+type tokenSafeClient struct {
+	client *http.Client
+	token  string
+}
+
+func (c tokenSafeClient) Do(request *http.Request) (*http.Response, error) {
+	response, err := c.client.Do(request)
+	var urlErr *url.Error
+	if c.token != "" && errors.As(err, &urlErr) {
+		urlErr.URL = strings.ReplaceAll(urlErr.URL, c.token, logging.Redacted)
+	}
+	return response, err
+}
+
+// waitTelegramBackoff waits for *backoff and doubles it up to
+// telegramMaxBackoff. It reports false if ctx ended first.
+func waitTelegramBackoff(ctx context.Context, backoff *time.Duration) bool {
+	select {
+	case <-ctx.Done():
+		return false
+	case <-time.After(*backoff):
+	}
+	*backoff = min(*backoff*2, telegramMaxBackoff)
+	return true
+}
+
+// handleTelegramMessage runs the command in message. botName is the bot's
+// user name, which commands in groups may carry as a suffix.
+func handleTelegramMessage(ctx context.Context, bot Messenger, message *tgbotapi.Message, d *Daemon, botName string) {
+	command, ok := parseCommand(message, botName)
+	if !ok {
+		return
+	}
+
+	cfg := d.Config()
+	entry := telegramAuditEntry(message.Chat, message.From, command)
+	if !authorizedSender(cfg.Telegram, message.Chat, message.From) {
+		slog.Warn("Unauthorized command", "chat_id", message.Chat.ID, "user_id", entry.UserID, "user", entry.Username, "command", command)
+		entry.Outcome = auditDenied
+		d.audit.Record(entry)
+		return
+	}
+	if isGroupChat(message.Chat) {
+		bot = threadedReplies{Messenger: bot, message: message}
+	}
+
+	slog.Info("Telegram command", "command", command, "chat_id", message.Chat.ID, "user_id", entry.UserID, "user", entry.Username)
+
+	if site, name, ok := splitSiteTarget(command); ok && strings.EqualFold(site, cfg.SiteName()) {
+		// The own site as prefix addresses a local server
+		command = strings.Fields(command)[0] + " " + name
+	}
+
+	d.audited(ctx, entry, func(ctx context.Context) {
+		if cmd := findCommand(command); cmd != nil {
+			if permitted(ctx, bot, message, d, cmd) {
+				cmd.handle(ctx, bot, message, d, command)
+			}
+			return
+		}
+		auditTarget(ctx, "", errors.New("unknown command"))
+		reply := tgbotapi.NewMessage(message.Chat.ID, "❓ Unknown command. Use /help for available commands.")
+		bot.Send(reply)
+	})
+}
+
+func handleListCommand(ctx context.Context, bot Messenger, message *tgbotapi.Message, d *Daemon) {
+	var list listMessage
+	for _, server := range d.Config().Servers {
+		list.Servers = append(list.Servers, probeServerLine(ctx, d, server))
+	}
+
+	msg := tgbotapi.NewMessage(message.Chat.ID, d.messages.Render("list", list))
+	msg.ParseMode = "Markdown"
+	bot.Send(msg)
+}
+
+// handleStatusCommand reports every server, including those of peer sites,
+// or only the one named in the command.
+func handleStatusCommand(ctx context.Context, bot Messenger, message *tgbotapi.Message, d *Daemon, command string) {
+	cfg := d.Config()
+	var status statusMessage
+	if parts := strings.Fields(command); len(parts) > 1 {
+		server := findServerFor(ctx, bot, message, cfg.Servers, command, 1)
+		if server == nil {
+			return
+		}
+		status.Servers = []serverLine{probeServerLine(ctx, d, *server)}
+	} else {
+		for _, server := range cfg.Servers {
+			status.Servers = append(status.Servers, probeServerLine(ctx, d, server))
+		}
+		if d.peers != nil {
+			status.Site = cfg.SiteName()
+			for _, site := range d.peers.Sites() {
+				status.Sites = append(status.Sites, siteStatusOf(site))
+			}
+		}
+	}
+
+	msg := tgbotapi.NewMessage(message.Chat.ID, d.messages.Render("status", status))
+	msg.ParseMode = "Markdown"
+	bot.Send(msg)
+}
+
+// probeServerLine checks server for the /list and /status replies.
+func probeServerLine(ctx context.Context, d *Daemon, server config.Server) serverLine {
+	address, isUp, err := d.network.Probe(ctx, server)
+	line := serverLine{
+		Name:    server.Name,
+		Host:    server.Host,
+		Address: address,
+		Display: server.DisplayAddress(address),
+		Auto:    server.UsesAutoAddress(),
+		MAC:     server.MACAddress,
+		Up:      isUp,
+	}
+	if err != nil {
+		line.Error = probeErrorStatus(err)
+	}
+	for _, suppression := range d.suppressions.Active(server.Name) {
+		line.Notes = append(line.Notes, suppression.describe(d.messages))
+	}
+	return line
+}
+
+// siteStatusOf lists the servers of a peer site as of its last answer.
+func siteStatusOf(site SiteSnapshot) siteStatus {
+	status := siteStatus{
+		Name:         site.Name,
+		Online:       site.Online,
+		LastSeen:     site.LastSeen,
+		OfflineSince: site.OfflineSince,
+	}
+	for _, server := range site.Servers {
+		display := server.Address
+		if display == "" {
+			display = "unknown"
+		}
+		status.Servers = append(status.Servers, serverLine{
+			Name:    server.Name,
+			Address: server.Address,
+			Display: display,
+			Up:      server.Up,
+			Unknown: server.Unknown,
+		})
+	}
+	return status
+}
+
+func handleWakeCommand(ctx context.Context, bot Messenger, message *tgbotapi.Message, d *Daemon, command string) {
+	cfg := d.Config()
+	servers := cfg.Servers
+	parts := strings.Fields(command)
+
+	if len(parts) == 1 {
+		var wakes wakeAllMessage
+		for _, server := range servers {
+			result := wakeResult{Server: server.Name, MAC: server.MACAddress}
+			if _, ok := d.suppressions.InMaintenance(server.Name); ok {
+				result.Skipped = true
+			} else if err := wakeFromChat(ctx, d, message, server); err != nil {
+				result.Error = err.Error()
+			}
+			wakes.Results = append(wakes.Results, result)
+		}
+
+		msg := tgbotapi.NewMessage(message.Chat.ID, d.messages.Render("wake_all", wakes))
+		msg.ParseMode = "Markdown"
+		bot.Send(msg)
+		return
+	}
+
+	server := findServerFor(ctx, bot, message, servers, command, 1)
+	if server == nil {
+		return
+	}
+	result := wakeResult{Server: server.Name, MAC: server.MACAddress}
+	if err := wakeFromChat(ctx, d, message, *server); err != nil {
+		result.Error = err.Error()
+	}
+
+	msg := tgbotapi.NewMessage(message.Chat.ID, d.messages.Render("wake", result))
+	msg.ParseMode = "Markdown"
+	bot.Send(msg)
+}
+
+// splitSiteTarget splits the argument of "/wake site/server" into the site
+// and the server name.
+func splitSiteTarget(command string) (site, server string, ok bool) {
+	parts := strings.Fields(command)
+	if len(parts) != 2 {
+		return "", "", false
+	}
+	return strings.Cut(parts[1], "/")
+}
+
+func isSiteWakeCommand(command string) bool {
+	if !strings.HasPrefix(command, "/wake ") && !strings.HasPrefix(command, "/checkwake ") {
+		return false
+	}
+	_, _, ok := splitSiteTarget(command)
+	return ok
+}
+
+// handleSiteWakeCommand forwards /wake and /checkwake for a server at a peer
+// site to that site's instance.
+func handleSiteWakeCommand(ctx context.Context, bot Messenger, message *tgbotapi.Message, d *Daemon, command string) {
+	site, name, _ := splitSiteTarget(command)
+	check := strings.HasPrefix(command, "/checkwake")
+
+	var responseText string
+	response, err := d.peers.Wake(ctx, site, name, check)
+	auditTarget(ctx, site+"/"+name, err)
+	switch {
+	case err != nil:
+		responseText = fmt.Sprintf("❌ Failed to wake *%s/%s*: %v", site, name, err)
+	case response.Result == siteWakeAlreadyUp:
+		responseText = fmt.Sprintf("✅ *%s/%s* is already UP", site, response.Server)
+	default:
+		responseText = fmt.Sprintf("🌐 Magic packet sent to *%s/%s* by site %s", site, response.Server, site)
+	}
+
+	msg := tgbotapi.NewMessage(message.Chat.ID, responseText)
+	msg.ParseMode = "Markdown"
+	bot.Send(msg)
+}
+
+// wakeFromChat sends a wake packet and records who asked for it, so the UP
+// notification and the reports can mention them.
+func wakeFromChat(ctx context.Context, d *Daemon, message *tgbotapi.Message, server config.Server) error {
+	err := d.network.Wake(ctx, server, d.Config().BroadcastIP)
+	d.monitor.RecordWake(server.Name, chatUser(message), err)
+	auditTarget(ctx, server.Name, err)
+	return err
+}
+
+// chatUser names the sender of message for notifications.
+func chatUser(message *tgbotapi.Message) string {
+	user := message.From
+	if user == nil {
+		return "Telegram"
+	}
+	if user.UserName != "" {
+		return "@" + user.UserName
+	}
+	return strings.TrimSpace(user.FirstName + " " + user.LastName)
+}
+
+func handleReloadCommand(ctx context.Context, bot Messenger, message *tgbotapi.Message, d *Daemon) {
+	diff, err := d.Reload(ctx)
+	auditTarget(ctx, "", err)
+	if err != nil {
+		reply := tgbotapi.NewMessage(message.Chat.ID, fmt.Sprintf("❌ Reload failed, keeping current configuration:\n%v", err))
+		bot.Send(reply)
+		return
+	}
+
+	msg := tgbotapi.NewMessage(message.Chat.ID, diff.Markdown())
+	msg.ParseMode = "Markdown"
+	bot.Send(msg)
+}
+
+func handleAddCommand(ctx context.Context, bot Messenger, message *tgbotapi.Message, d *Daemon) {
+	args := strings.Fields(message.Text)[1:]
+	if len(args) < 2 || len(args) > 4 {
+		reply := tgbotapi.NewMessage(message.Chat.ID, "Usage: /add name mac [ip|host|auto] [ports]\nExample: /add nas aa:bb:cc:dd:ee:ff 192.168.1.20 22,445")
+		bot.Send(reply)
+		return
+	}
+
+	server := config.Server{Name: args[0], MACAddress: args[1]}
+	if len(args) > 2 && args[2] != "-" {
+		if net.ParseIP(args[2]) == nil && !strings.EqualFold(args[2], config.AutoAddress) {
+			server.Host = args[2]
+		} else {
+			server.IPAddress = args[2]
+		}
+	}
+	if len(args) > 3 {
+		ports, err := config.ParsePorts(args[3])
+		if err != nil {
+			bot.Send(tgbotapi.NewMessage(message.Chat.ID, fmt.Sprintf("❌ %v", err)))
+			return
+		}
+		server.TCPPorts = ports
+	}
+
+	diff, err := d.EditConfig(ctx, func(path string) error {
+		return config.AddServer(path, server)
+	})
+	auditTarget(ctx, server.Name, err)
+	sendConfigEditResult(bot, message, diff, err)
+}
+
+func handleRemoveCommand(ctx context.Context, bot Messenger, message *tgbotapi.Message, d *Daemon) {
+	args := strings.Fields(message.Text)[1:]
+	if len(args) != 1 {
+		bot.Send(tgbotapi.NewMessage(message.Chat.ID, "Usage: /remove name"))
+		return
+	}
+
+	diff, err := d.EditConfig(ctx, func(path string) error {
+		return config.RemoveServer(path, args[0])
+	})
+	auditTarget(ctx, args[0], err)
+	sendConfigEditResult(bot, message, diff, err)
+}
+
+func handleEditCommand(ctx context.Context, bot Messenger, message *tgbotapi.Message, d *Daemon) {
+	args := strings.Fields(message.Text)[1:]
+	if len(args) != 3 {
+		bot.Send(tgbotapi.NewMessage(message.Chat.ID, "Usage: /edit name field value\nFields: name, mac, ip, host, ports (use - to clear ip, host or ports)"))
+		return
+	}
+
+	diff, err := d.EditConfig(ctx, func(path string) error {
+		return config.EditServer(path, args[0], args[1], args[2])
+	})
+	auditTarget(ctx, args[0], err)
+	sendConfigEditResult(bot, message, diff, err)
+}
+
+func sendConfigEditResult(bot Messenger, message *tgbotapi.Message, diff ConfigDiff, err error) {
+	if err != nil {
+		bot.Send(tgbotapi.NewMessage(message.Chat.ID, fmt.Sprintf("❌ Configuration not changed: %v", err)))
+		return
+	}
+
+	msg := tgbotapi.NewMessage(message.Chat.ID, diff.Markdown())
+	msg.ParseMode = "Markdown"
+	bot.Send(msg)
+}
+
+// handleSuppressCommand handles /maintenance and /mute. Without arguments
+// /maintenance lists every active maintenance period and mute.
+func handleSuppressCommand(ctx context.Context, bot Messenger, message *tgbotapi.Message, d *Daemon, kind string) {
+	args := strings.Fields(message.Text)[1:]
+	usage := "Usage: /maintenance server duration [reason]\nExample: /maintenance nas 2h disk swap"
+	if kind == suppressMute {
+		usage = "Usage: /mute server duration\nExample: /mute nas 30m"
+	}
+
+	if len(args) == 0 && kind == suppressMaintenance {
+		sendSuppressionList(bot, message, d)
+		return
+	}
+	if len(args) < 2 {
+		bot.Send(tgbotapi.NewMessage(message.Chat.ID, usage))
+		return
+	}
+
+	server := findServerFor(ctx, bot, message, d.Config().Servers, message.Text, 1)
+	if server == nil {
+		return
+	}
+
+	if strings.EqualFold(args[1], "off") {
+		cleared, err := d.suppressions.Clear(server.Name, kind)
+		auditTarget(ctx, "", err)
+		switch {
+		case err != nil:
+			bot.Send(tgbotapi.NewMessage(message.Chat.ID, fmt.Sprintf("❌ Failed to save: %v", err)))
+		case !cleared:
+			bot.Send(tgbotapi.NewMessage(message.Chat.ID, fmt.Sprintf("ℹ️ No %s set for %s", kind, server.Name)))
+		default:
+			slog.Info("Suppression ended early", "kind", kind, "server", server.Name)
+			bot.Send(tgbotapi.NewMessage(message.Chat.ID, fmt.Sprintf("✅ %s of %s ended", strings.ToUpper(kind[:1])+kind[1:], server.Name)))
+		}
+		return
+	}
+
+	duration, err := config.ParseDuration(args[1])
+	if err != nil {
+		bot.Send(tgbotapi.NewMessage(message.Chat.ID, fmt.Sprintf("❌ %v\n%s", err, usage)))
+		return
+	}
+	suppression, err := d.suppressions.Set(server.Name, kind, duration, strings.Join(args[2:], " "))
+	auditTarget(ctx, "", err)
+	if err != nil {
+		bot.Send(tgbotapi.NewMessage(message.Chat.ID, fmt.Sprintf("❌ %v", err)))
+		return
+	}
+
+	slog.Info("Suppression set", "kind", kind, "server", server.Name, "until", suppression.Until)
+	text := fmt.Sprintf("*%s*: %s", server.Name, suppression.describe(d.messages))
+	if kind == suppressMaintenance {
+		text += "\n\nNo notifications or automated wakes until then."
+	}
+	msg := tgbotapi.NewMessage(message.Chat.ID, text)
+	msg.ParseMode = "Markdown"
+	bot.Send(msg)
+}
+
+func sendSuppressionList(bot Messenger, message *tgbotapi.Message, d *Daemon) {
+	var response strings.Builder
+	for _, server := range d.Config().Servers {
+		for _, suppression := range d.suppressions.Active(server.Name) {
+			response.WriteString(fmt.Sprintf("• *%s*: %s\n", server.Name, suppression.describe(d.messages)))
+		}
+	}
+	if response.Len() == 0 {
+		bot.Send(tgbotapi.NewMessage(message.Chat.ID, "✅ No servers in maintenance or muted"))
+		return
+	}
+
+	msg := tgbotapi.NewMessage(message.Chat.ID, "🔧 *Maintenance and mutes:*\n\n"+response.String())
+	msg.ParseMode = "Markdown"
+	bot.Send(msg)
+}
+
+func handleReportCommand(bot Messenger, message *tgbotapi.Message, d *Daemon) {
+	args := strings.Fields(message.Text)[1:]
+	period := 24 * time.Hour
+	if report := d.Config().Report; report != nil {
+		period = report.Period()
+	}
+	if len(args) > 0 {
+		var err error
+		period, err = parseReportPeriod(args[0])
+		if err != nil {
+			bot.Send(tgbotapi.NewMessage(message.Chat.ID, fmt.Sprintf("❌ %v\nUsage: /report [day|week|duration]", err)))
+			return
+		}
+	}
+
+	now := time.Now()
+	title := "Daily report"
+	switch {
+	case period == 7*24*time.Hour:
+		title = "Weekly report"
+	case period != 24*time.Hour:
+		title = "Report for the last " + args[0]
+	}
+	markdown := d.buildReport(title, now.Add(-period), now)
+	msg := tgbotapi.NewMessage(message.Chat.ID, markdown)
+	msg.ParseMode = "Markdown"
+	if _, err := bot.Send(msg); err != nil {
+		slog.Warn("Failed to send report, retrying as plain text", "error", err)
+		if _, err := bot.Send(tgbotapi.NewMessage(message.Chat.ID, plainText(markdown))); err != nil {
+			slog.Error("Failed to send report", "error", err)
+		}
+	}
+}
+
+func handleDiscoverCommand(ctx context.Context, bot Messenger, message *tgbotapi.Message, d *Daemon) {
+	args := strings.Fields(message.Text)[1:]
+	cidr := ""
+	if len(args) > 0 {
+		cidr = args[0]
+	}
+
+	if !d.discovery.Begin() {
+		bot.Send(tgbotapi.NewMessage(message.Chat.ID, "🔎 A discovery is already running, wait for its results"))
+		return
+	}
+
+	status := "🔎 Reading neighbour table..."
+	if cidr != "" {
+		status = fmt.Sprintf("🔎 Sweeping %s...", cidr)
+	}
+	bot.Send(tgbotapi.NewMessage(message.Chat.ID, status))
+
+	// A subnet sweep takes a while, so it runs off the update loop to keep
+	// the bot answering other commands
+	go func() {
+		defer d.discovery.Finish()
+		runDiscovery(ctx, bot, message, d, cidr)
+	}()
+}
+
+// runDiscovery finds the hosts on the network and offers to add them.
+func runDiscovery(ctx context.Context, bot Messenger, message *tgbotapi.Message, d *Daemon, cidr string) {
+	servers := d.Config().Servers
+	hosts, err := discoverHosts(ctx, servers, cidr)
+	if err != nil {
+		bot.Send(tgbotapi.NewMessage(message.Chat.ID, fmt.Sprintf("❌ Discovery failed: %v", err)))
+		return
+	}
+	if len(hosts) == 0 {
+		bot.Send(tgbotapi.NewMessage(message.Chat.ID, "🔎 No hosts found. Try /discover with a subnet, e.g. /discover 192.168.1.0/24"))
+		return
+	}
+
+	generation := d.discovery.Store(hosts)
+	for _, msg := range discoveryMessages(message.Chat.ID, hosts, servers, generation) {
+		if _, err := bot.Send(msg); err != nil {
+			slog.Error("Failed to send discovery results", "error", err)
+			bot.Send(tgbotapi.NewMessage(message.Chat.ID, fmt.Sprintf("❌ Failed to send the discovery results: %v", err)))
+			return
+		}
+	}
+}
+
+// discoveryMessages lists hosts with an add button for each new one, split
+// into as many messages as needed to stay within Telegram's limits on text
+// length and buttons.
+func discoveryMessages(chatID int64, hosts []DiscoveredHost, servers []config.Server, generation int) []tgbotapi.MessageConfig {
+	type page struct {
+		text  strings.Builder
+		count int
+		rows  [][]tgbotapi.InlineKeyboardButton
+	}
+	pages := []*page{{}}
+	for i, host := range hosts {
+		hostname := ""
+		if host.Hostname != "" {
+			hostname = fmt.Sprintf(" `%s`", host.Hostname)
+		}
+		var line string
+		var row []tgbotapi.InlineKeyboardButton
+		if host.Server != "" {
+			line = fmt.Sprintf("✅ `%s` `%s`%s → %s\n", host.IP, host.MAC, hostname, tgbotapi.EscapeText(tgbotapi.ModeMarkdown, host.Server))
+		} else {
+			line = fmt.Sprintf("🆕 `%s` `%s`%s\n", host.IP, host.MAC, hostname)
+			name := suggestServerName(host, servers)
+			row = tgbotapi.NewInlineKeyboardRow(
+				tgbotapi.NewInlineKeyboardButtonData(fmt.Sprintf("➕ %s (%s)", name, host.IP), fmt.Sprintf("discover:%d:%d", generation, i)),
+			)
+		}
+
+		current := pages[len(pages)-1]
+		if current.count == discoverHostsPerMessage || current.text.Len()+len(line) > discoverMessageLength {
+			current = &page{}
+			pages = append(pages, current)
+		}
+		current.text.WriteString(line)
+		current.count++
+		if row != nil {
+			current.rows = append(current.rows, row)
+		}
+	}
+
+	messages := make([]tgbotapi.MessageConfig, 0, len(pages))
+	for i, page := range pages {
+		header := fmt.Sprintf("🔎 *Discovered %d hosts*\n\n", len(hosts))
+		if len(pages) > 1 {
+			header = fmt.Sprintf("🔎 *Discovered %d hosts* (%d/%d)\n\n", len(hosts), i+1, len(pages))
+		}
+		msg := tgbotapi.NewMessage(chatID, header+page.text.String())
+		msg.ParseMode = "Markdown"
+		if len(page.rows) > 0 {
+			msg.ReplyMarkup = tgbotapi.NewInlineKeyboardMarkup(page.rows...)
+		}
+		messages = append(messages, msg)
+	}
+	return messages
+}
+
+func handleTelegramCallback(ctx context.Context, bot Messenger, query *tgbotapi.CallbackQuery, d *Daemon) {
+	cfg := d.Config()
+	var chat *tgbotapi.Chat
+	if query.Message != nil {
+		chat = query.Message.Chat
+	}
+	entry := telegramAuditEntry(chat, query.From, strings.TrimPrefix(query.Data, runCallbackPrefix))
+	if chat == nil || !authorizedSender(cfg.Telegram, chat, query.From) {
+		slog.Warn("Unauthorized button press", "chat_id", entry.ChatID, "user_id", entry.UserID, "user", entry.Username, "data", query.Data)
+		entry.Outcome = auditDenied
+		d.audit.Record(entry)
+		return
+	}
+
+	d.audited(ctx, entry, func(ctx context.Context) {
+		switch {
+		case strings.HasPrefix(query.Data, "discover:"):
+			handleDiscoverCallback(ctx, bot, query, d)
+		case strings.HasPrefix(query.Data, runCallbackPrefix):
+			handleRunCallback(ctx, bot, query, d)
+		default:
+			bot.Request(tgbotapi.NewCallback(query.ID, ""))
+		}
+	})
+}
+
+func handleDiscoverCallback(ctx context.Context, bot Messenger, query *tgbotapi.CallbackQuery, d *Daemon) {
+	var generation, index int
+	if _, err := fmt.Sscanf(query.Data, "discover:%d:%d", &generation, &index); err != nil {
+		bot.Request(tgbotapi.NewCallback(query.ID, ""))
+		return
+	}
+
+	if denial := adminDenial(d.Config().Telegram, bot, query.Message.Chat, query.From); denial != "" {
+		auditDeny(ctx)
+		bot.Request(tgbotapi.NewCallback(query.ID, "Adding servers "+denial))
+		return
+	}
+
+	host, ok := d.discovery.Get(generation, index)
+	if !ok {
+		bot.Request(tgbotapi.NewCallback(query.ID, "These results are outdated, run /discover again"))
+		return
+	}
+
+	servers := d.Config().Servers
+	if existing := serverWithMAC(servers, host.MAC); existing != "" {
+		bot.Request(tgbotapi.NewCallback(query.ID, fmt.Sprintf("Already configured as %s", existing)))
+		return
+	}
+
+	name := suggestServerName(host, servers)
+	diff, err := d.EditConfig(ctx, func(path string) error {
+		return config.AddServer(path, discoveredServer(host, name))
+	})
+	auditTarget(ctx, name, err)
+	if err != nil {
+		bot.Request(tgbotapi.NewCallback(query.ID, "Not added"))
+	} else {
+		bot.Request(tgbotapi.NewCallback(query.ID, fmt.Sprintf("Added %s", name)))
+	}
+	sendConfigEditResult(bot, query.Message, diff, err)
+}
+
+func handleUptimeCommand(bot Messenger, message *tgbotapi.Message) {
+	uptime := getSystemUptime()
+	responseText := fmt.Sprintf("⏱️ *System Uptime:* %s", uptime)
+
+	msg := tgbotapi.NewMessage(message.Chat.ID, responseText)
+	msg.ParseMode = "Markdown"
+	bot.Send(msg)
+}
+
+func handleHostCommand(bot Messenger, message *tgbotapi.Message, d *Daemon) {
+	msg := tgbotapi.NewMessage(message.Chat.ID, formatHostStatus(d.host.Metrics()))
+	msg.ParseMode = "Markdown"
+	bot.Send(msg)
+}
+
+func handleCheckWakeCommand(ctx context.Context, bot Messenger, message *tgbotapi.Message, d *Daemon, command string) {
+	cfg := d.Config()
+	servers := cfg.Servers
+	parts := strings.Fields(command)
+
+	if len(parts) == 1 {
+		var wakes wakeAllMessage
+		for _, server := range servers {
+			if _, ok := d.suppressions.InMaintenance(server.Name); ok {
+				wakes.Results = append(wakes.Results, wakeResult{Server: server.Name, MAC: server.MACAddress, Skipped: true})
+				continue
+			}
+			wakes.Results = append(wakes.Results, checkAndWake(ctx, d, message, server))
+		}
+
+		msg := tgbotapi.NewMessage(message.Chat.ID, d.messages.Render("checkwake_all", wakes))
+		msg.ParseMode = "Markdown"
+		bot.Send(msg)
+		return
+	}
+
+	server := findServerFor(ctx, bot, message, servers, command, 1)
+	if server == nil {
+		return
+	}
+
+	result := checkAndWake(ctx, d, message, *server)
+	if result.Up {
+		auditTarget(ctx, server.Name, nil)
+	}
+
+	msg := tgbotapi.NewMessage(message.Chat.ID, d.messages.Render("checkwake", result))
+	msg.ParseMode = "Markdown"
+	bot.Send(msg)
+}
+
+// checkAndWake wakes server unless it answers. A server without a known
+// address is woken, as it cannot be checked.
+func checkAndWake(ctx context.Context, d *Daemon, message *tgbotapi.Message, server config.Server) wakeResult {
+	result := wakeResult{Server: server.Name, MAC: server.MACAddress}
+	address, isUp, _ := d.network.Probe(ctx, server)
+	if address != "" && isUp {
+		result.Up = true
+		return result
+	}
+	result.NoAddress = address == ""
+	if err := wakeFromChat(ctx, d, message, server); err != nil {
+		result.Error = err.Error()
+	}
+	return result
+}
+
+func getSystemUptime() string {
+	uptime, ok := hostReader{root: "/"}.uptime()
+	if !ok {
+		return "Unknown"
+	}
+	return formatDuration(uptime)
+}
@@ -0,0 +1,273 @@
+package bot
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+	"github.com/tsolodov/wot/config"
+	"github.com/tsolodov/wot/internal/telegramtest"
+)
+
+const testAdminChat = 1
+
+// startTestBot loads servers (a YAML config without the telegram section)
+// and runs the Telegram update loop against a fake Bot API, returning once
+// the bot is connected. Notifications are sent straight to the fake.
+func startTestBot(t *testing.T, servers string, up ...string) (*Daemon, *telegramtest.Server, *TelegramNotifier) {
+	t.Helper()
+	return startTestBotWith(t, servers, "", up...)
+}
+
+// startTestBotWith is startTestBot with extra YAML for the telegram section,
+// indented by two spaces.
+func startTestBotWith(t *testing.T, servers, telegram string, up ...string) (*Daemon, *telegramtest.Server, *TelegramNotifier) {
+	t.Helper()
+
+	fake := telegramtest.NewServer("123:test")
+	ts := httptest.NewServer(fake)
+
+	dir := t.TempDir()
+	path := filepath.Join(dir, "config.yaml")
+	writeTestConfig(t, path, fmt.Sprintf("%s\nstate_dir: %s\ntelegram:\n  bot_token: \"123:test\"\n  admin_chat_id: %d\n  api_endpoint: %s\n%s",
+		servers, dir, testAdminChat, ts.URL, telegram))
+	d := newTestDaemon(t, path, up...)
+	d.audit = NewAuditLog(filepath.Join(dir, "audit.jsonl"), d.Config().AuditLimits())
+	if err := d.network.Configure(d.Config()); err != nil {
+		t.Fatalf("Configure: %v", err)
+	}
+
+	notifier := NewTelegramNotifier(testAdminChat)
+	notifier.topic = d.telegramTopic
+	d.notifier = NewNotificationDispatcher()
+	d.notifier.Add(notifier, nil)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		runTelegramBot(ctx, d, notifier)
+	}()
+	t.Cleanup(func() {
+		cancel()
+		<-done
+		fake.Close()
+		ts.Close()
+	})
+
+	for deadline := time.Now().Add(5 * time.Second); ; time.Sleep(5 * time.Millisecond) {
+		notifier.mutex.Lock()
+		connected := notifier.bot != nil
+		notifier.mutex.Unlock()
+		if connected {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("bot did not connect to the fake Bot API")
+		}
+	}
+	return d, fake, notifier
+}
+
+// relayServers configures servers behind a test relay, which records wakes
+// and reports "remote-up" as up.
+func relayServers(t *testing.T) (string, func() []string) {
+	t.Helper()
+	_, relay, woken := startTestRelay(t, "correct horse battery staple")
+	return fmt.Sprintf(`
+relays:
+  - name: parents
+    url: %s
+    secret: %q
+    ca_cert: %s
+servers:
+  - name: remote-up
+    mac_address: "aa:bb:cc:dd:ee:01"
+    relay: parents
+  - name: remote-down
+    mac_address: "aa:bb:cc:dd:ee:02"
+    relay: parents
+`, relay.URL, relay.Secret, relay.CACert), woken
+}
+
+// converse sends text from the admin chat and returns the bot's reply.
+func converse(t *testing.T, fake *telegramtest.Server, text string) string {
+	t.Helper()
+	count := len(fake.Messages())
+	fake.SendText(testAdminChat, "alice", text)
+	messages, err := fake.WaitForMessages(count+1, 5*time.Second)
+	if err != nil {
+		t.Fatalf("%s: %v", text, err)
+	}
+	reply := messages[count]
+	if reply.ChatID != testAdminChat {
+		t.Errorf("%s: reply sent to chat %d", text, reply.ChatID)
+	}
+	return reply.Text
+}
+
+func TestTelegramWakeCommands(t *testing.T) {
+	servers, woken := relayServers(t)
+	d, fake, _ := startTestBot(t, servers)
+
+	if reply := converse(t, fake, "/wake remote-down"); !strings.Contains(reply, "Magic packet sent to *remote-down*") {
+		t.Errorf("/wake: %s", reply)
+	}
+	if got := woken(); len(got) != 1 || !strings.HasPrefix(got[0], "aa:bb:cc:dd:ee:02") {
+		t.Errorf("relay woke %v", got)
+	}
+
+	if reply := converse(t, fake, "/checkwake remote-up"); !strings.Contains(reply, "already UP") {
+		t.Errorf("/checkwake of an UP server: %s", reply)
+	}
+	if reply := converse(t, fake, "/checkwake REMOTE-DOWN"); !strings.Contains(reply, "was DOWN, sent wake packet") {
+		t.Errorf("/checkwake of a DOWN server: %s", reply)
+	}
+	if reply := converse(t, fake, "/wake printer"); !strings.Contains(reply, "Server 'printer' not found") {
+		t.Errorf("/wake of an unknown server: %s", reply)
+	}
+
+	// Servers in maintenance are skipped when waking everything
+	d.suppressions = NewSuppressions(filepath.Join(t.TempDir(), "suppressions.json"), nil)
+	if _, err := d.suppressions.Set("remote-up", suppressMaintenance, time.Hour, ""); err != nil {
+		t.Fatal(err)
+	}
+	reply := converse(t, fake, "/wake")
+	if !strings.Contains(reply, "*remote-up*: In maintenance, skipped") || !strings.Contains(reply, "*remote-down*: Magic packet sent") {
+		t.Errorf("/wake: %s", reply)
+	}
+	if got := woken(); len(got) != 3 {
+		t.Errorf("expected 3 wakes, relay woke %v", got)
+	}
+}
+
+func TestTelegramIgnoresOtherChats(t *testing.T) {
+	servers, woken := relayServers(t)
+	_, fake, _ := startTestBot(t, servers)
+
+	fake.SendText(testAdminChat+1, "mallory", "/wake remote-down")
+	if reply := converse(t, fake, "/help"); !strings.Contains(reply, "/wake") {
+		t.Errorf("/help: %s", reply)
+	}
+	if messages := fake.Messages(); len(messages) != 1 {
+		t.Errorf("expected only the reply to the admin, got %+v", messages)
+	}
+	if got := woken(); len(got) != 0 {
+		t.Errorf("wake from another chat was sent: %v", got)
+	}
+}
+
+func TestTelegramTokenNotInErrors(t *testing.T) {
+	ts := httptest.NewServer(telegramtest.NewServer(""))
+	ts.Close()
+
+	// Failed requests report the URL, which contains the token
+	token := "123456:not-for-the-logs"
+	_, err := tgbotapi.NewBotAPIWithClient(token, ts.URL+"/bot%s/%s", tokenSafeClient{client: &http.Client{}, token: token})
+	if err == nil || strings.Contains(err.Error(), token) {
+		t.Fatalf("expected an error without the token, got %v", err)
+	}
+}
+
+func TestTelegramNotifications(t *testing.T) {
+	servers, _ := relayServers(t)
+	_, fake, telegram := startTestBot(t, servers)
+
+	if err := telegram.Notify(Notification{Title: "k8s_master is DOWN", Markdown: "🔴 *k8s\\_master* is now *DOWN*"}); err != nil {
+		t.Fatalf("Notify: %v", err)
+	}
+	messages := fake.Messages()
+	if len(messages) != 1 || messages[0].ChatID != testAdminChat || messages[0].ParseMode != "Markdown" {
+		t.Errorf("unexpected notification %+v", messages)
+	}
+
+	// Markdown Telegram cannot parse is sent as plain text instead
+	if err := telegram.Notify(Notification{Title: "broken", Markdown: "*k8s_master is DOWN"}); err != nil {
+		t.Fatalf("Notify: %v", err)
+	}
+	if messages := fake.Messages(); len(messages) != 2 || messages[1].Text != "broken" || messages[1].ParseMode != "" {
+		t.Errorf("unexpected fallback %+v", messages)
+	}
+
+	// Other rejected messages are dropped instead of retried forever
+	err := telegram.Notify(Notification{Title: " "})
+	var permErr *permanentError
+	if !errors.As(err, &permErr) {
+		t.Errorf("expected a permanent error, got %v", err)
+	}
+}
+
+func TestTelegramDiscoverButtons(t *testing.T) {
+	servers, _ := relayServers(t)
+	d, fake, _ := startTestBot(t, servers)
+
+	// A button left over from before a restart refers to lost results
+	bot, err := tgbotapi.NewBotAPIWithAPIEndpoint("123:test", d.Config().Telegram.APIEndpoint+"/bot%s/%s")
+	if err != nil {
+		t.Fatal(err)
+	}
+	offer := tgbotapi.NewMessage(testAdminChat, "🔎 Discovered 1 hosts")
+	offer.ReplyMarkup = tgbotapi.NewInlineKeyboardMarkup(tgbotapi.NewInlineKeyboardRow(
+		tgbotapi.NewInlineKeyboardButtonData("➕ printer", "discover:1:0"),
+	))
+	if _, err := bot.Send(offer); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := fake.PressButton(testAdminChat, "alice", "discover:1:0"); err != nil {
+		t.Fatal(err)
+	}
+	answers, err := fake.WaitForAnswers(1, 5*time.Second)
+	if err != nil || !strings.Contains(answers[0].Text, "outdated") {
+		t.Fatalf("answers %+v: %v", answers, err)
+	}
+
+	mac, _ := net.ParseMAC("aa:bb:cc:dd:ee:50")
+	d.discovery.Store([]DiscoveredHost{{IP: netip.MustParseAddr("192.168.1.50"), MAC: mac, Hostname: "printer.lan"}})
+	if _, err := fake.PressButton(testAdminChat, "alice", "discover:1:0"); err != nil {
+		t.Fatal(err)
+	}
+	answers, err = fake.WaitForAnswers(2, 5*time.Second)
+	if err != nil || answers[1].Text != "Added printer" {
+		t.Fatalf("answers %+v: %v", answers, err)
+	}
+	messages, err := fake.WaitForMessages(2, 5*time.Second)
+	if err != nil || !strings.Contains(messages[1].Text, "printer") {
+		t.Errorf("expected the config change to be reported, got %+v: %v", messages, err)
+	}
+	if config.FindServer(d.Config().Servers, "printer") == nil {
+		t.Error("printer was not added to the config")
+	}
+}
+
+func TestTelegramDiscoverInBackground(t *testing.T) {
+	servers, _ := relayServers(t)
+	d, fake, _ := startTestBot(t, servers)
+
+	if reply := converse(t, fake, "/discover not-a-subnet"); !strings.Contains(reply, "Sweeping not-a-subnet") {
+		t.Errorf("/discover: %s", reply)
+	}
+	messages, err := fake.WaitForMessages(2, 5*time.Second)
+	if err != nil || !strings.Contains(messages[1].Text, "invalid subnet") {
+		t.Fatalf("expected the discovery error, got %+v: %v", messages, err)
+	}
+
+	// Only one sweep runs at a time
+	for deadline := time.Now().Add(5 * time.Second); !d.discovery.Begin(); time.Sleep(5 * time.Millisecond) {
+		if time.Now().After(deadline) {
+			t.Fatal("the failed discovery did not finish")
+		}
+	}
+	if reply := converse(t, fake, "/discover"); !strings.Contains(reply, "already running") {
+		t.Errorf("/discover during a discovery: %s", reply)
+	}
+	d.discovery.Finish()
+}
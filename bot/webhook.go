@@ -0,0 +1,189 @@
+package bot
+
+import (
+	"context"
+	"crypto/subtle"
+	"crypto/tls"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net"
+	"net/http"
+	"net/netip"
+	"time"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+	"github.com/tsolodov/wot/config"
+)
+
+const (
+	// telegramSecretHeader carries the webhook secret in requests from
+	// Telegram
+	telegramSecretHeader = "X-Telegram-Bot-Api-Secret-Token"
+	// webhookQueueSize bounds the updates received but not handled yet;
+	// beyond it Telegram is asked to retry later
+	webhookQueueSize       = 100
+	webhookMaxBody         = 1 << 20
+	webhookShutdownTimeout = 5 * time.Second
+)
+
+// startWebhook serves cfg.Listen and registers cfg.URL with Telegram, so
+// that updates are pushed to the returned channel instead of being polled.
+// The returned stop function deletes the webhook and closes the listener.
+func startWebhook(ctx context.Context, bot *tgbotapi.BotAPI, cfg *config.WebhookConfig) (<-chan tgbotapi.Update, func(), error) {
+	trusted, err := cfg.TrustedPrefixes()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	updates := make(chan tgbotapi.Update, webhookQueueSize)
+	server := &http.Server{
+		Handler:           &webhookHandler{secret: cfg.Secret, trusted: trusted, updates: updates, done: ctx.Done()},
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+	if cfg.TLSCert != "" {
+		certificate, err := tls.LoadX509KeyPair(cfg.TLSCert, cfg.TLSKey)
+		if err != nil {
+			return nil, nil, fmt.Errorf("webhook certificate: %w", err)
+		}
+		server.TLSConfig = &tls.Config{Certificates: []tls.Certificate{certificate}}
+	}
+
+	listener, err := net.Listen("tcp", cfg.Listen)
+	if err != nil {
+		return nil, nil, fmt.Errorf("webhook: %w", err)
+	}
+	go func() {
+		var err error
+		if server.TLSConfig != nil {
+			err = server.ServeTLS(listener, "", "")
+		} else {
+			err = server.Serve(listener)
+		}
+		if err != http.ErrServerClosed {
+			slog.Error("Telegram webhook stopped", "error", err)
+		}
+	}()
+
+	if err := setWebhook(ctx, bot, cfg); err != nil {
+		server.Close()
+		return nil, nil, err
+	}
+	slog.Info("Receiving Telegram updates by webhook", "url", cfg.URL, "addr", cfg.Listen)
+
+	stop := func() {
+		if _, err := bot.Request(tgbotapi.DeleteWebhookConfig{}); err != nil {
+			slog.Warn("Failed to delete the Telegram webhook", "error", err)
+		}
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), webhookShutdownTimeout)
+		defer cancel()
+		server.Shutdown(shutdownCtx)
+	}
+	return updates, stop, nil
+}
+
+// setWebhook registers the webhook with Telegram, retrying with backoff
+// while the Bot API is unreachable. A self-signed certificate is uploaded so
+// Telegram trusts it.
+func setWebhook(ctx context.Context, bot *tgbotapi.BotAPI, cfg *config.WebhookConfig) error {
+	params := tgbotapi.Params{"url": cfg.URL, "secret_token": cfg.Secret}
+
+	backoff := telegramMinBackoff
+	for {
+		var err error
+		if cfg.SelfSigned {
+			certificate := tgbotapi.RequestFile{Name: "certificate", Data: tgbotapi.FilePath(cfg.TLSCert)}
+			_, err = bot.UploadFiles("setWebhook", params, []tgbotapi.RequestFile{certificate})
+		} else {
+			_, err = bot.MakeRequest("setWebhook", params)
+		}
+		if err == nil {
+			return nil
+		}
+
+		var apiErr *tgbotapi.Error
+		if errors.As(err, &apiErr) {
+			return fmt.Errorf("webhook rejected by Telegram: %w", err)
+		}
+		slog.Warn("Failed to set the Telegram webhook", "retry_in", backoff, "error", err)
+		if !waitTelegramBackoff(ctx, &backoff) {
+			return ctx.Err()
+		}
+	}
+}
+
+// deleteStaleWebhook removes a webhook left over from running in webhook
+// mode, which would make polling fail.
+func deleteStaleWebhook(bot *tgbotapi.BotAPI) {
+	info, err := bot.GetWebhookInfo()
+	if err != nil || info.URL == "" {
+		return
+	}
+	slog.Info("Deleting the Telegram webhook to poll for updates", "url", info.URL)
+	if _, err := bot.Request(tgbotapi.DeleteWebhookConfig{}); err != nil {
+		slog.Warn("Failed to delete the Telegram webhook", "error", err)
+	}
+}
+
+// webhookHandler accepts updates posted by Telegram. Requests must carry the
+// secret token and, if trusted proxies are configured, come from one of them.
+type webhookHandler struct {
+	secret  string
+	trusted []netip.Prefix
+	updates chan<- tgbotapi.Update
+	done    <-chan struct{}
+}
+
+func (h *webhookHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if !h.trustedClient(r.RemoteAddr) {
+		slog.Warn("Rejected Telegram webhook request from an untrusted address", "remote_addr", r.RemoteAddr)
+		http.Error(w, "forbidden", http.StatusForbidden)
+		return
+	}
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if subtle.ConstantTimeCompare([]byte(r.Header.Get(telegramSecretHeader)), []byte(h.secret)) != 1 {
+		slog.Warn("Rejected Telegram webhook request with a wrong secret token", "remote_addr", r.RemoteAddr)
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	var update tgbotapi.Update
+	if err := json.NewDecoder(io.LimitReader(r.Body, webhookMaxBody)).Decode(&update); err != nil {
+		http.Error(w, "invalid update", http.StatusBadRequest)
+		return
+	}
+
+	// Telegram retries updates that are not acknowledged, so one that
+	// cannot be queued is left to it
+	select {
+	case h.updates <- update:
+		w.WriteHeader(http.StatusOK)
+	case <-h.done:
+		http.Error(w, "shutting down", http.StatusServiceUnavailable)
+	case <-r.Context().Done():
+	}
+}
+
+// trustedClient reports whether remoteAddr may post updates. Everyone may
+// if no trusted proxies are configured.
+func (h *webhookHandler) trustedClient(remoteAddr string) bool {
+	if len(h.trusted) == 0 {
+		return true
+	}
+	addrPort, err := netip.ParseAddrPort(remoteAddr)
+	if err != nil {
+		return false
+	}
+	addr := addrPort.Addr().Unmap()
+	for _, prefix := range h.trusted {
+		if prefix.Contains(addr) {
+			return true
+		}
+	}
+	return false
+}
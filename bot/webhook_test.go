@@ -0,0 +1,191 @@
+package bot
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"fmt"
+	"math/big"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+	"github.com/tsolodov/wot/config"
+	"github.com/tsolodov/wot/internal/telegramtest"
+)
+
+// selfSignedCert writes a certificate and key for 127.0.0.1 and returns
+// their paths.
+func selfSignedCert(t *testing.T) (string, string) {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "127.0.0.1"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IPAddresses:           []net.IP{net.IPv4(127, 0, 0, 1)},
+		KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	dir := t.TempDir()
+	certFile, keyFile := filepath.Join(dir, "wot.crt"), filepath.Join(dir, "wot.key")
+	os.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0o600)
+	os.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}), 0o600)
+	return certFile, keyFile
+}
+
+func freePort(t *testing.T) int {
+	t.Helper()
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer listener.Close()
+	return listener.Addr().(*net.TCPAddr).Port
+}
+
+func TestTelegramWebhook(t *testing.T) {
+	servers, woken := relayServers(t)
+	certFile, keyFile := selfSignedCert(t)
+	port := freePort(t)
+	url := fmt.Sprintf("https://127.0.0.1:%d/telegram", port)
+	_, fake, _ := startTestBotWith(t, servers, fmt.Sprintf(`  webhook:
+    url: %s
+    listen: 127.0.0.1:%d
+    secret: webhook-secret
+    tls_cert: %s
+    tls_key: %s
+    self_signed: true
+`, url, port, certFile, keyFile))
+
+	// Commands arrive through the webhook once the bot has registered it
+	if reply := converse(t, fake, "/wake remote-down"); !strings.Contains(reply, "Magic packet sent to *remote-down*") {
+		t.Errorf("/wake: %s", reply)
+	}
+	if fake.Webhook() != url {
+		t.Errorf("webhook = %q", fake.Webhook())
+	}
+	if got := woken(); len(got) != 1 {
+		t.Errorf("relay woke %v", got)
+	}
+}
+
+func TestWebhookStartAndStop(t *testing.T) {
+	fake := telegramtest.NewServer("")
+	ts := httptest.NewServer(fake)
+	defer ts.Close()
+	defer fake.Close()
+	bot, err := tgbotapi.NewBotAPIWithAPIEndpoint("123:test", ts.URL+"/bot%s/%s")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	cfg := &config.WebhookConfig{
+		URL:            "https://wot.example.com/telegram",
+		Listen:         "127.0.0.1:0",
+		Secret:         "webhook-secret",
+		TrustedProxies: []string{"127.0.0.1"},
+	}
+	_, stop, err := startWebhook(ctx, bot, cfg)
+	if err != nil {
+		t.Fatalf("startWebhook: %v", err)
+	}
+	if fake.Webhook() != cfg.URL {
+		t.Errorf("webhook = %q", fake.Webhook())
+	}
+	stop()
+	if fake.Webhook() != "" {
+		t.Errorf("webhook not deleted: %q", fake.Webhook())
+	}
+
+	// A webhook left behind is removed before polling
+	if _, err := bot.MakeRequest("setWebhook", tgbotapi.Params{"url": cfg.URL}); err != nil {
+		t.Fatal(err)
+	}
+	deleteStaleWebhook(bot)
+	if fake.Webhook() != "" {
+		t.Errorf("stale webhook not deleted: %q", fake.Webhook())
+	}
+
+	// Telegram rejecting the URL disables the webhook instead of retrying
+	cfg.URL = "http://wot.example.com/telegram"
+	if _, _, err := startWebhook(ctx, bot, cfg); err == nil || !strings.Contains(err.Error(), "rejected") {
+		t.Errorf("expected the webhook to be rejected, got %v", err)
+	}
+}
+
+func TestWebhookHandler(t *testing.T) {
+	updates := make(chan tgbotapi.Update, 1)
+	done := make(chan struct{})
+	handler := &webhookHandler{
+		secret:  "webhook-secret",
+		trusted: []netip.Prefix{netip.MustParsePrefix("10.0.0.0/8")},
+		updates: updates,
+		done:    done,
+	}
+	post := func(from, secret, body string) int {
+		request := httptest.NewRequest(http.MethodPost, "/telegram", strings.NewReader(body))
+		request.RemoteAddr = from
+		if secret != "" {
+			request.Header.Set(telegramSecretHeader, secret)
+		}
+		recorder := httptest.NewRecorder()
+		handler.ServeHTTP(recorder, request)
+		return recorder.Code
+	}
+
+	update := `{"update_id": 7, "message": {"message_id": 1, "text": "/status", "chat": {"id": 1}}}`
+	if code := post("192.168.1.5:4000", "webhook-secret", update); code != http.StatusForbidden {
+		t.Errorf("untrusted proxy: %d", code)
+	}
+	if code := post("10.1.2.3:4000", "wrong", update); code != http.StatusUnauthorized {
+		t.Errorf("wrong secret: %d", code)
+	}
+	if code := post("10.1.2.3:4000", "", update); code != http.StatusUnauthorized {
+		t.Errorf("missing secret: %d", code)
+	}
+	if code := post("10.1.2.3:4000", "webhook-secret", "{"); code != http.StatusBadRequest {
+		t.Errorf("invalid body: %d", code)
+	}
+	if code := post("[::ffff:10.1.2.3]:4000", "webhook-secret", update); code != http.StatusOK {
+		t.Errorf("valid update: %d", code)
+	}
+	if got := <-updates; got.UpdateID != 7 || got.Message.Text != "/status" {
+		t.Errorf("queued update %+v", got)
+	}
+
+	// Updates that cannot be queued during shutdown are left to Telegram
+	updates <- tgbotapi.Update{}
+	close(done)
+	if code := post("10.1.2.3:4000", "webhook-secret", update); code != http.StatusServiceUnavailable {
+		t.Errorf("update during shutdown: %d", code)
+	}
+}
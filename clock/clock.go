@@ -0,0 +1,131 @@
+// Package clock abstracts the passing of time so that code which checks
+// things periodically can run on a virtual clock in tests.
+package clock
+
+import (
+	"sync"
+	"time"
+)
+
+// Clock tells the time and creates tickers.
+type Clock interface {
+	Now() time.Time
+	NewTicker(d time.Duration) Ticker
+}
+
+// Ticker delivers ticks on C like a time.Ticker.
+type Ticker interface {
+	C() <-chan time.Time
+	Reset(d time.Duration)
+	Stop()
+}
+
+// Real is the system clock.
+type Real struct{}
+
+func (Real) Now() time.Time { return time.Now() }
+
+func (Real) NewTicker(d time.Duration) Ticker { return realTicker{time.NewTicker(d)} }
+
+type realTicker struct {
+	ticker *time.Ticker
+}
+
+func (t realTicker) C() <-chan time.Time   { return t.ticker.C }
+func (t realTicker) Reset(d time.Duration) { t.ticker.Reset(d) }
+func (t realTicker) Stop()                 { t.ticker.Stop() }
+
+// Virtual is a clock that only moves when Advance is called. Its tickers
+// fire as the time passes their next tick and, like time.Ticker, drop ticks
+// nobody received.
+type Virtual struct {
+	mutex   sync.Mutex
+	now     time.Time
+	tickers []*virtualTicker
+}
+
+// NewVirtual returns a virtual clock set to start.
+func NewVirtual(start time.Time) *Virtual {
+	return &Virtual{now: start}
+}
+
+func (v *Virtual) Now() time.Time {
+	v.mutex.Lock()
+	defer v.mutex.Unlock()
+	return v.now
+}
+
+func (v *Virtual) NewTicker(d time.Duration) Ticker {
+	if d <= 0 {
+		panic("clock: non-positive interval for NewTicker")
+	}
+	v.mutex.Lock()
+	defer v.mutex.Unlock()
+	ticker := &virtualTicker{clock: v, c: make(chan time.Time, 1), period: d, next: v.now.Add(d)}
+	v.tickers = append(v.tickers, ticker)
+	return ticker
+}
+
+// Advance moves the clock forward by d, firing every tick due on the way in
+// order.
+func (v *Virtual) Advance(d time.Duration) {
+	v.mutex.Lock()
+	defer v.mutex.Unlock()
+
+	target := v.now.Add(d)
+	for {
+		var due *virtualTicker
+		for _, ticker := range v.tickers {
+			if !ticker.next.After(target) && (due == nil || ticker.next.Before(due.next)) {
+				due = ticker
+			}
+		}
+		if due == nil {
+			break
+		}
+		v.now = due.next
+		due.next = due.next.Add(due.period)
+		select {
+		case due.c <- v.now:
+		default:
+		}
+	}
+	v.now = target
+}
+
+type virtualTicker struct {
+	clock  *Virtual
+	c      chan time.Time
+	period time.Duration
+	next   time.Time
+}
+
+func (t *virtualTicker) C() <-chan time.Time { return t.c }
+
+func (t *virtualTicker) Reset(d time.Duration) {
+	if d <= 0 {
+		panic("clock: non-positive interval for Reset")
+	}
+	t.clock.mutex.Lock()
+	defer t.clock.mutex.Unlock()
+	t.period = d
+	t.next = t.clock.now.Add(d)
+	t.clock.remove(t)
+	t.clock.tickers = append(t.clock.tickers, t)
+}
+
+func (t *virtualTicker) Stop() {
+	t.clock.mutex.Lock()
+	defer t.clock.mutex.Unlock()
+	t.clock.remove(t)
+}
+
+// remove forgets ticker. Callers must hold v.mutex.
+func (v *Virtual) remove(ticker *virtualTicker) {
+	for i, other := range v.tickers {
+		if other == ticker {
+			v.tickers = append(v.tickers[:i], v.tickers[i+1:]...)
+			return
+		}
+	}
+}
@@ -0,0 +1,53 @@
+package clock
+
+import (
+	"testing"
+	"time"
+)
+
+func TestVirtual(t *testing.T) {
+	start := time.Date(2025, 1, 1, 12, 0, 0, 0, time.UTC)
+	clock := NewVirtual(start)
+	ticker := clock.NewTicker(time.Minute)
+
+	clock.Advance(30 * time.Second)
+	select {
+	case <-ticker.C():
+		t.Fatal("ticked early")
+	default:
+	}
+
+	// Ticks nobody received are dropped
+	clock.Advance(3 * time.Minute)
+	if tick := <-ticker.C(); !tick.Equal(start.Add(time.Minute)) {
+		t.Errorf("tick at %v", tick)
+	}
+	select {
+	case tick := <-ticker.C():
+		t.Errorf("unexpected second tick at %v", tick)
+	default:
+	}
+	if now := clock.Now(); !now.Equal(start.Add(210 * time.Second)) {
+		t.Errorf("now = %v", now)
+	}
+
+	ticker.Reset(time.Hour)
+	clock.Advance(59 * time.Minute)
+	select {
+	case tick := <-ticker.C():
+		t.Errorf("ticked at %v after Reset", tick)
+	default:
+	}
+	clock.Advance(time.Minute)
+	if tick := <-ticker.C(); !tick.Equal(start.Add(210*time.Second + time.Hour)) {
+		t.Errorf("tick after Reset at %v", tick)
+	}
+
+	ticker.Stop()
+	clock.Advance(2 * time.Hour)
+	select {
+	case tick := <-ticker.C():
+		t.Errorf("stopped ticker ticked at %v", tick)
+	default:
+	}
+}
@@ -0,0 +1,35 @@
+package config
+
+import "fmt"
+
+// AuditConfig sizes the audit log of commands and actions, which is kept in
+// the state directory unless disabled.
+type AuditConfig struct {
+	// The log is rotated once it reaches MaxSizeMB (default 5), keeping
+	// MaxFiles rotated logs (default 3)
+	MaxSizeMB int  `json:"max_size_mb,omitempty" yaml:"max_size_mb,omitempty"`
+	MaxFiles  int  `json:"max_files,omitempty" yaml:"max_files,omitempty"`
+	Disabled  bool `json:"disabled,omitempty" yaml:"disabled,omitempty"`
+}
+
+func (a *AuditConfig) validate() error {
+	if a.MaxSizeMB < 0 || a.MaxFiles < 0 {
+		return fmt.Errorf("audit: max_size_mb and max_files must not be negative")
+	}
+	return nil
+}
+
+// AuditLimits returns the audit section of c with defaults filled in.
+func (c *Config) AuditLimits() AuditConfig {
+	var audit AuditConfig
+	if c.Audit != nil {
+		audit = *c.Audit
+	}
+	if audit.MaxSizeMB == 0 {
+		audit.MaxSizeMB = 5
+	}
+	if audit.MaxFiles == 0 {
+		audit.MaxFiles = 3
+	}
+	return audit
+}
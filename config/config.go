@@ -0,0 +1,448 @@
+// Package config defines the WoT configuration file, loads and validates it,
+// and edits the server list in place.
+package config
+
+import (
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net"
+	"net/netip"
+	"net/url"
+	"os"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// DefaultInterval is the monitoring interval when none is configured.
+const DefaultInterval = 5 * time.Minute
+
+type TelegramConfig struct {
+	BotToken         string   `json:"bot_token" yaml:"bot_token"`
+	AdminChatID      int64    `json:"admin_chat_id" yaml:"admin_chat_id"`
+	NotifySeverities []string `json:"notify_severities,omitempty" yaml:"notify_severities,omitempty"`
+	// APIEndpoint is the base URL of the Bot API, for a local Bot API server
+	// or the fake one of "wot fake-telegram"
+	APIEndpoint string `json:"api_endpoint,omitempty" yaml:"api_endpoint,omitempty"`
+	// Webhook makes Telegram push updates instead of WoT polling for them
+	Webhook *WebhookConfig `json:"webhook,omitempty" yaml:"webhook,omitempty"`
+	// AllowedUsers restricts commands to these user IDs, e.g. in a group
+	AllowedUsers []int64 `json:"allowed_users,omitempty" yaml:"allowed_users,omitempty"`
+	// Topics maps server groups to the forum topics of the admin chat their
+	// alerts are posted in
+	Topics map[string]int `json:"topics,omitempty" yaml:"topics,omitempty"`
+}
+
+// TopicFor returns the forum topic for alerts about server, or 0 for the
+// chat's general topic.
+func (t TelegramConfig) TopicFor(server *Server) int {
+	if server == nil || server.Group == "" {
+		return 0
+	}
+	for group, thread := range t.Topics {
+		if strings.EqualFold(group, server.Group) {
+			return thread
+		}
+	}
+	return 0
+}
+
+// Restricted reports whether the bot only answers a configured chat or
+// users. Commands that change the configuration are refused otherwise.
+func (t TelegramConfig) Restricted() bool {
+	return t.AdminChatID != 0 || len(t.AllowedUsers) > 0
+}
+
+// UserAllowed reports whether the Telegram user may send commands.
+func (t TelegramConfig) UserAllowed(userID int64) bool {
+	return len(t.AllowedUsers) == 0 || slices.Contains(t.AllowedUsers, userID)
+}
+
+// WebhookConfig is where WoT receives updates pushed by Telegram. Either WoT
+// terminates TLS itself or it sits behind one of TrustedProxies.
+type WebhookConfig struct {
+	// URL is the public HTTPS address Telegram posts updates to
+	URL    string `json:"url" yaml:"url"`
+	Listen string `json:"listen" yaml:"listen"`
+	// Secret is sent by Telegram with every update and checked by WoT
+	Secret  string `json:"secret" yaml:"secret"`
+	TLSCert string `json:"tls_cert,omitempty" yaml:"tls_cert,omitempty"`
+	TLSKey  string `json:"tls_key,omitempty" yaml:"tls_key,omitempty"`
+	// SelfSigned uploads TLSCert to Telegram so that it trusts it
+	SelfSigned bool `json:"self_signed,omitempty" yaml:"self_signed,omitempty"`
+	// TrustedProxies are the addresses or CIDR ranges allowed to connect
+	TrustedProxies []string `json:"trusted_proxies,omitempty" yaml:"trusted_proxies,omitempty"`
+}
+
+// webhookSecretPattern is what Telegram accepts as a secret token
+var webhookSecretPattern = regexp.MustCompile(`^[A-Za-z0-9_-]{1,256}$`)
+
+func (w *WebhookConfig) validate() error {
+	parsed, err := url.Parse(w.URL)
+	if err != nil || parsed.Scheme != "https" || parsed.Host == "" {
+		return fmt.Errorf("telegram.webhook.url must be an https URL")
+	}
+	if w.Listen == "" {
+		return fmt.Errorf("telegram.webhook.listen is required")
+	}
+	if !webhookSecretPattern.MatchString(w.Secret) {
+		return fmt.Errorf("telegram.webhook.secret must be 1-256 letters, digits, '_' or '-'")
+	}
+	if (w.TLSCert == "") != (w.TLSKey == "") {
+		return fmt.Errorf("telegram.webhook.tls_cert and telegram.webhook.tls_key must be set together")
+	}
+	if w.SelfSigned && w.TLSCert == "" {
+		return fmt.Errorf("telegram.webhook.self_signed requires tls_cert")
+	}
+	if w.TLSCert == "" && len(w.TrustedProxies) == 0 {
+		return fmt.Errorf("telegram.webhook.trusted_proxies is required without tls_cert and tls_key")
+	}
+	_, err = w.TrustedPrefixes()
+	return err
+}
+
+// TrustedPrefixes parses TrustedProxies; single addresses become
+// one-address prefixes.
+func (w *WebhookConfig) TrustedPrefixes() ([]netip.Prefix, error) {
+	var prefixes []netip.Prefix
+	for _, proxy := range w.TrustedProxies {
+		prefix, err := netip.ParsePrefix(proxy)
+		if err != nil {
+			addr, addrErr := netip.ParseAddr(proxy)
+			if addrErr != nil {
+				return nil, fmt.Errorf("telegram.webhook.trusted_proxies: invalid address or CIDR range '%s'", proxy)
+			}
+			prefix = netip.PrefixFrom(addr, addr.BitLen())
+		}
+		prefixes = append(prefixes, prefix.Masked())
+	}
+	return prefixes, nil
+}
+
+type MQTTConfig struct {
+	Broker          string `json:"broker" yaml:"broker"`
+	ClientID        string `json:"client_id,omitempty" yaml:"client_id,omitempty"`
+	Username        string `json:"username,omitempty" yaml:"username,omitempty"`
+	Password        string `json:"password,omitempty" yaml:"password,omitempty"`
+	TopicPrefix     string `json:"topic_prefix,omitempty" yaml:"topic_prefix,omitempty"`
+	DiscoveryPrefix string `json:"discovery_prefix,omitempty" yaml:"discovery_prefix,omitempty"`
+}
+
+// NotifierConfig is a notification channel besides Telegram. Which fields
+// apply depends on Type.
+type NotifierConfig struct {
+	Name       string            `json:"name,omitempty" yaml:"name,omitempty"`
+	Type       string            `json:"type" yaml:"type"`
+	Severities []string          `json:"severities,omitempty" yaml:"severities,omitempty"`
+	URL        string            `json:"url,omitempty" yaml:"url,omitempty"`
+	Token      string            `json:"token,omitempty" yaml:"token,omitempty"`
+	Headers    map[string]string `json:"headers,omitempty" yaml:"headers,omitempty"`
+	RoomID     string            `json:"room_id,omitempty" yaml:"room_id,omitempty"`
+	SMTPHost   string            `json:"smtp_host,omitempty" yaml:"smtp_host,omitempty"`
+	SMTPPort   int               `json:"smtp_port,omitempty" yaml:"smtp_port,omitempty"`
+	Username   string            `json:"username,omitempty" yaml:"username,omitempty"`
+	Password   string            `json:"password,omitempty" yaml:"password,omitempty"`
+	From       string            `json:"from,omitempty" yaml:"from,omitempty"`
+	To         []string          `json:"to,omitempty" yaml:"to,omitempty"`
+}
+
+// RelayConfig describes a relay agent on another network that sends magic
+// packets and checks servers on behalf of this instance.
+type RelayConfig struct {
+	Name   string `json:"name" yaml:"name"`
+	URL    string `json:"url" yaml:"url"`
+	Secret string `json:"secret" yaml:"secret"`
+	CACert string `json:"ca_cert,omitempty" yaml:"ca_cert,omitempty"`
+}
+
+// FederationConfig lets a primary instance query this instance's servers
+// and forward wake requests to it.
+type FederationConfig struct {
+	Listen  string `json:"listen" yaml:"listen"`
+	Secret  string `json:"secret" yaml:"secret"`
+	TLSCert string `json:"tls_cert,omitempty" yaml:"tls_cert,omitempty"`
+	TLSKey  string `json:"tls_key,omitempty" yaml:"tls_key,omitempty"`
+}
+
+// PeerConfig is another WoT instance whose servers this instance shows in
+// /status and wakes on request.
+type PeerConfig struct {
+	Name   string `json:"name" yaml:"name"`
+	URL    string `json:"url" yaml:"url"`
+	Secret string `json:"secret" yaml:"secret"`
+	CACert string `json:"ca_cert,omitempty" yaml:"ca_cert,omitempty"`
+}
+
+type Config struct {
+	Servers            []Server            `json:"servers" yaml:"servers"`
+	Telegram           TelegramConfig      `json:"telegram,omitempty" yaml:"telegram,omitempty"`
+	MQTT               *MQTTConfig         `json:"mqtt,omitempty" yaml:"mqtt,omitempty"`
+	Notifiers          []NotifierConfig    `json:"notifiers,omitempty" yaml:"notifiers,omitempty"`
+	BroadcastIP        string              `json:"broadcast_ip,omitempty" yaml:"broadcast_ip,omitempty"`
+	MonitoringInterval int                 `json:"monitoring_interval,omitempty" yaml:"monitoring_interval,omitempty"`
+	StateDir           string              `json:"state_dir,omitempty" yaml:"state_dir,omitempty"`
+	DHCPLeases         []string            `json:"dhcp_leases,omitempty" yaml:"dhcp_leases,omitempty"`
+	Relays             []RelayConfig       `json:"relays,omitempty" yaml:"relays,omitempty"`
+	Site               string              `json:"site,omitempty" yaml:"site,omitempty"`
+	Federation         *FederationConfig   `json:"federation,omitempty" yaml:"federation,omitempty"`
+	Peers              []PeerConfig        `json:"peers,omitempty" yaml:"peers,omitempty"`
+	Maintenance        []MaintenanceWindow `json:"maintenance,omitempty" yaml:"maintenance,omitempty"`
+	Timezone           string              `json:"timezone,omitempty" yaml:"timezone,omitempty"`
+	Templates          map[string]string   `json:"templates,omitempty" yaml:"templates,omitempty"`
+	Report             *ReportConfig       `json:"report,omitempty" yaml:"report,omitempty"`
+	Host               *HostConfig         `json:"host,omitempty" yaml:"host,omitempty"`
+	Audit              *AuditConfig        `json:"audit,omitempty" yaml:"audit,omitempty"`
+	Log                *LogConfig          `json:"log,omitempty" yaml:"log,omitempty"`
+}
+
+// Load reads a YAML or JSON config file, applies the WOT_BOT_TOKEN,
+// WOT_ADMIN_CHAT_ID and WOT_MQTT_PASSWORD environment overrides and
+// validates the result.
+func Load(filename string) (*Config, error) {
+	data, err := os.ReadFile(filename)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read config file: %w", err)
+	}
+
+	config, err := Parse(data)
+	if err != nil {
+		return nil, err
+	}
+
+	// Override with environment variables if present
+	if botToken := os.Getenv("WOT_BOT_TOKEN"); botToken != "" {
+		config.Telegram.BotToken = botToken
+		slog.Info("Using bot token from WOT_BOT_TOKEN environment variable")
+	}
+
+	if adminChatID := os.Getenv("WOT_ADMIN_CHAT_ID"); adminChatID != "" {
+		if chatID, err := strconv.ParseInt(adminChatID, 10, 64); err == nil {
+			config.Telegram.AdminChatID = chatID
+			slog.Info("Using admin chat ID from WOT_ADMIN_CHAT_ID environment variable")
+		} else {
+			slog.Warn("Ignoring WOT_ADMIN_CHAT_ID: not a number", "value", adminChatID)
+		}
+	}
+
+	if mqttPassword := os.Getenv("WOT_MQTT_PASSWORD"); mqttPassword != "" && config.MQTT != nil {
+		config.MQTT.Password = mqttPassword
+		slog.Info("Using MQTT password from WOT_MQTT_PASSWORD environment variable")
+	}
+
+	if err := config.Validate(); err != nil {
+		return nil, fmt.Errorf("invalid config: %w", err)
+	}
+
+	return config, nil
+}
+
+// Parse decodes a config from YAML, or JSON as a fallback, without
+// validating it.
+func Parse(data []byte) (*Config, error) {
+	var config Config
+
+	// Try YAML first, then JSON as fallback
+	err := yaml.Unmarshal(data, &config)
+	if err != nil {
+		// Try JSON as fallback
+		config = Config{}
+		err = json.Unmarshal(data, &config)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse config file as YAML or JSON: %w", err)
+		}
+	}
+
+	return &config, nil
+}
+
+// Validate checks the parts of a config that would otherwise only fail at
+// runtime, so a bad edit is rejected before anything is applied. Notifier
+// types, severities and message templates are checked by the bot, which
+// knows them.
+func (c *Config) Validate() error {
+	relays := make(map[string]bool)
+	for i, relay := range c.Relays {
+		if err := validateEndpoint(relay.URL, relay.Secret); err != nil {
+			return fmt.Errorf("relays[%d]: %w", i, err)
+		}
+		key := strings.ToLower(relay.Name)
+		if relays[key] {
+			return fmt.Errorf("relays[%d]: duplicate relay name '%s'", i, relay.Name)
+		}
+		relays[key] = true
+	}
+
+	names := make(map[string]bool)
+	for i, server := range c.Servers {
+		if err := server.Validate(); err != nil {
+			return fmt.Errorf("servers[%d]: %w", i, err)
+		}
+		key := strings.ToLower(server.Name)
+		if names[key] {
+			return fmt.Errorf("servers[%d]: duplicate server name '%s'", i, server.Name)
+		}
+		names[key] = true
+		if server.Relay != "" && !relays[strings.ToLower(server.Relay)] {
+			return fmt.Errorf("servers[%d]: unknown relay '%s'", i, server.Relay)
+		}
+	}
+	// Aliases share the namespace of the server names
+	for i, server := range c.Servers {
+		for _, alias := range server.Aliases {
+			key := strings.ToLower(alias)
+			if names[key] {
+				return fmt.Errorf("servers[%d]: alias '%s' is already the name or an alias of a server", i, alias)
+			}
+			names[key] = true
+		}
+	}
+
+	if c.BroadcastIP != "" && net.ParseIP(c.BroadcastIP) == nil {
+		return fmt.Errorf("broadcast_ip '%s' is not a valid IP address", c.BroadcastIP)
+	}
+	if c.MonitoringInterval < 0 {
+		return fmt.Errorf("monitoring_interval must not be negative")
+	}
+	if c.Telegram.APIEndpoint != "" {
+		parsed, err := url.Parse(c.Telegram.APIEndpoint)
+		if err != nil || (parsed.Scheme != "https" && parsed.Scheme != "http") || parsed.Host == "" {
+			return fmt.Errorf("telegram.api_endpoint must be an http(s) URL")
+		}
+	}
+	for group, thread := range c.Telegram.Topics {
+		if thread <= 0 {
+			return fmt.Errorf("telegram.topics: topic of group '%s' must be a positive message thread ID", group)
+		}
+	}
+	if c.Telegram.Webhook != nil {
+		if err := c.Telegram.Webhook.validate(); err != nil {
+			return err
+		}
+	}
+	if c.MQTT != nil && c.MQTT.Broker == "" {
+		return fmt.Errorf("mqtt.broker is required when the mqtt section is present")
+	}
+	if err := c.validateFederation(); err != nil {
+		return err
+	}
+	if c.Timezone != "" {
+		if _, err := time.LoadLocation(c.Timezone); err != nil {
+			return fmt.Errorf("timezone: %w", err)
+		}
+	}
+	if c.Report != nil {
+		if err := c.Report.validate(); err != nil {
+			return err
+		}
+	}
+	if c.Host != nil {
+		if err := c.Host.validate(); err != nil {
+			return err
+		}
+	}
+	if c.Audit != nil {
+		if err := c.Audit.validate(); err != nil {
+			return err
+		}
+	}
+	if c.Log != nil {
+		if err := c.Log.validate(); err != nil {
+			return err
+		}
+	}
+	for i, window := range c.Maintenance {
+		if err := window.validate(c.Servers); err != nil {
+			return fmt.Errorf("maintenance[%d]: %w", i, err)
+		}
+	}
+
+	return nil
+}
+
+func (c *Config) validateFederation() error {
+	if strings.Contains(c.Site, "/") {
+		return fmt.Errorf("site '%s' must not contain '/'", c.Site)
+	}
+	if f := c.Federation; f != nil {
+		if f.Listen == "" {
+			return fmt.Errorf("federation.listen is required")
+		}
+		if len(f.Secret) < 16 {
+			return fmt.Errorf("federation.secret must be at least 16 characters")
+		}
+		if (f.TLSCert == "") != (f.TLSKey == "") {
+			return fmt.Errorf("federation.tls_cert and federation.tls_key must be set together")
+		}
+	}
+
+	names := map[string]bool{strings.ToLower(c.SiteName()): true}
+	for i, peer := range c.Peers {
+		if peer.Name == "" || strings.Contains(peer.Name, "/") {
+			return fmt.Errorf("peers[%d]: name is required and must not contain '/'", i)
+		}
+		if names[strings.ToLower(peer.Name)] {
+			return fmt.Errorf("peers[%d]: duplicate site name '%s'", i, peer.Name)
+		}
+		names[strings.ToLower(peer.Name)] = true
+		if err := validateEndpoint(peer.URL, peer.Secret); err != nil {
+			return fmt.Errorf("peers[%d]: %w", i, err)
+		}
+	}
+	return nil
+}
+
+// validateEndpoint checks the URL and shared secret of a relay or peer.
+func validateEndpoint(rawURL, secret string) error {
+	parsed, err := url.Parse(rawURL)
+	if err != nil || (parsed.Scheme != "https" && parsed.Scheme != "http") || parsed.Host == "" {
+		return fmt.Errorf("url must be an http(s) URL")
+	}
+	if len(secret) < 16 {
+		return fmt.Errorf("secret must be at least 16 characters")
+	}
+	return nil
+}
+
+// FindServer returns the server with the given name, ignoring case.
+func FindServer(servers []Server, name string) *Server {
+	for i := range servers {
+		if strings.EqualFold(servers[i].Name, name) {
+			return &servers[i]
+		}
+	}
+	return nil
+}
+
+// Interval returns how often servers are checked.
+func (c *Config) Interval() time.Duration {
+	if c.MonitoringInterval > 0 {
+		return time.Duration(c.MonitoringInterval) * time.Minute
+	}
+	return DefaultInterval
+}
+
+// StateDirectory returns where persistent state is kept: state_dir from the
+// config, the systemd StateDirectory, or the working directory.
+func (c *Config) StateDirectory() string {
+	if c.StateDir != "" {
+		return c.StateDir
+	}
+	if dirs := os.Getenv("STATE_DIRECTORY"); dirs != "" {
+		return strings.Split(dirs, ":")[0]
+	}
+	return "."
+}
+
+// SiteName is the name this instance uses for its own servers in federated
+// status messages.
+func (c *Config) SiteName() string {
+	if c.Site != "" {
+		return c.Site
+	}
+	return "local"
+}
@@ -0,0 +1,302 @@
+package config
+
+import (
+	"encoding/json"
+	"os"
+	"slices"
+	"strings"
+	"testing"
+
+	"gopkg.in/yaml.v3"
+)
+
+func TestLoadConfig(t *testing.T) {
+	testConfig := Config{
+		Servers: []Server{
+			{
+				Name:       "test-server",
+				MACAddress: "aa:bb:cc:dd:ee:ff",
+				IPAddress:  "192.168.1.100",
+				TCPPorts:   []int{22, 80, 443},
+			},
+		},
+		BroadcastIP: "255.255.255.255",
+		Telegram: TelegramConfig{
+			BotToken:    "test-token",
+			AdminChatID: 12345,
+		},
+	}
+
+	// Test YAML format
+	t.Run("YAML", func(t *testing.T) {
+		tmpFile, err := os.CreateTemp("", "test-config-*.yaml")
+		if err != nil {
+			t.Fatalf("Failed to create temp file: %v", err)
+		}
+		defer os.Remove(tmpFile.Name())
+
+		configData, err := yaml.Marshal(testConfig)
+		if err != nil {
+			t.Fatalf("Failed to marshal YAML config: %v", err)
+		}
+
+		if _, err := tmpFile.Write(configData); err != nil {
+			t.Fatalf("Failed to write config: %v", err)
+		}
+		tmpFile.Close()
+
+		loadedConfig, err := Load(tmpFile.Name())
+		if err != nil {
+			t.Fatalf("Failed to load YAML config: %v", err)
+		}
+
+		verifyConfig(t, loadedConfig)
+	})
+
+	// Test JSON format
+	t.Run("JSON", func(t *testing.T) {
+		tmpFile, err := os.CreateTemp("", "test-config-*.json")
+		if err != nil {
+			t.Fatalf("Failed to create temp file: %v", err)
+		}
+		defer os.Remove(tmpFile.Name())
+
+		configData, err := json.Marshal(testConfig)
+		if err != nil {
+			t.Fatalf("Failed to marshal JSON config: %v", err)
+		}
+
+		if _, err := tmpFile.Write(configData); err != nil {
+			t.Fatalf("Failed to write config: %v", err)
+		}
+		tmpFile.Close()
+
+		loadedConfig, err := Load(tmpFile.Name())
+		if err != nil {
+			t.Fatalf("Failed to load JSON config: %v", err)
+		}
+
+		verifyConfig(t, loadedConfig)
+	})
+}
+
+func verifyConfig(t *testing.T, config *Config) {
+	if len(config.Servers) != 1 {
+		t.Errorf("Expected 1 server, got %d", len(config.Servers))
+	}
+
+	if config.Servers[0].Name != "test-server" {
+		t.Errorf("Expected server name 'test-server', got '%s'", config.Servers[0].Name)
+	}
+
+	if config.BroadcastIP != "255.255.255.255" {
+		t.Errorf("Expected broadcast IP '255.255.255.255', got '%s'", config.BroadcastIP)
+	}
+
+	expectedPorts := []int{22, 80, 443}
+	if len(config.Servers[0].TCPPorts) != len(expectedPorts) {
+		t.Errorf("Expected %d TCP ports, got %d", len(expectedPorts), len(config.Servers[0].TCPPorts))
+	}
+	for i, port := range expectedPorts {
+		if i < len(config.Servers[0].TCPPorts) && config.Servers[0].TCPPorts[i] != port {
+			t.Errorf("Expected TCP port %d at index %d, got %d", port, i, config.Servers[0].TCPPorts[i])
+		}
+	}
+}
+
+func TestEnvironmentVariables(t *testing.T) {
+	// Create a temporary config file
+	testConfig := Config{
+		Servers: []Server{
+			{
+				Name:       "test-server",
+				MACAddress: "aa:bb:cc:dd:ee:ff",
+				IPAddress:  "192.168.1.100",
+				TCPPorts:   []int{22, 80, 443},
+			},
+		},
+		Telegram: TelegramConfig{
+			BotToken:    "config-token",
+			AdminChatID: 12345,
+		},
+	}
+
+	tmpFile, err := os.CreateTemp("", "test-env-config-*.json")
+	if err != nil {
+		t.Fatalf("Failed to create temp file: %v", err)
+	}
+	defer os.Remove(tmpFile.Name())
+
+	configData, err := json.Marshal(testConfig)
+	if err != nil {
+		t.Fatalf("Failed to marshal config: %v", err)
+	}
+
+	if _, err := tmpFile.Write(configData); err != nil {
+		t.Fatalf("Failed to write config: %v", err)
+	}
+	tmpFile.Close()
+
+	// Test environment variable override
+	os.Setenv("WOT_BOT_TOKEN", "env-token")
+	os.Setenv("WOT_ADMIN_CHAT_ID", "67890")
+	defer func() {
+		os.Unsetenv("WOT_BOT_TOKEN")
+		os.Unsetenv("WOT_ADMIN_CHAT_ID")
+	}()
+
+	// Load config with environment variables
+	loadedConfig, err := Load(tmpFile.Name())
+	if err != nil {
+		t.Fatalf("Failed to load config: %v", err)
+	}
+
+	// Verify environment variables override config file values
+	if loadedConfig.Telegram.BotToken != "env-token" {
+		t.Errorf("Expected bot token 'env-token', got '%s'", loadedConfig.Telegram.BotToken)
+	}
+
+	if loadedConfig.Telegram.AdminChatID != 67890 {
+		t.Errorf("Expected admin chat ID 67890, got %d", loadedConfig.Telegram.AdminChatID)
+	}
+}
+
+func TestValidateConfig(t *testing.T) {
+	valid := Config{
+		Servers: []Server{
+			{Name: "server1", MACAddress: "00:11:22:33:44:55", IPAddress: "192.168.1.100", TCPPorts: []int{22}},
+			{Name: "server2", MACAddress: "aa-bb-cc-dd-ee-ff"},
+		},
+		BroadcastIP: "192.168.1.255",
+	}
+	if err := valid.Validate(); err != nil {
+		t.Errorf("Expected valid config, got %v", err)
+	}
+
+	invalid := map[string]Config{
+		"missing name":      {Servers: []Server{{MACAddress: "00:11:22:33:44:55"}}},
+		"bad mac":           {Servers: []Server{{Name: "a", MACAddress: "00:11:22"}}},
+		"bad ip":            {Servers: []Server{{Name: "a", MACAddress: "00:11:22:33:44:55", IPAddress: "300.1.1.1"}}},
+		"bad port":          {Servers: []Server{{Name: "a", MACAddress: "00:11:22:33:44:55", TCPPorts: []int{70000}}}},
+		"duplicate name":    {Servers: []Server{{Name: "a", MACAddress: "00:11:22:33:44:55"}, {Name: "A", MACAddress: "00:11:22:33:44:56"}}},
+		"bad broadcast":     {BroadcastIP: "broadcast"},
+		"negative interval": {MonitoringInterval: -1},
+		"unknown relay":     {Servers: []Server{{Name: "a", MACAddress: "00:11:22:33:44:55", Relay: "attic"}}},
+		"bad timezone":      {Timezone: "Mars/Olympus"},
+		"bad api endpoint":  {Telegram: TelegramConfig{APIEndpoint: "localhost:8081"}},
+		"bad topic":         {Telegram: TelegramConfig{Topics: map[string]int{"media": 0}}},
+		"alias of another":  {Servers: []Server{{Name: "a", MACAddress: "00:11:22:33:44:55"}, {Name: "b", MACAddress: "00:11:22:33:44:56", Aliases: []string{"A"}}}},
+		"bad audit size":    {Audit: &AuditConfig{MaxSizeMB: -1}},
+		"bad log level":     {Log: &LogConfig{Level: "verbose"}},
+		"bad log format":    {Log: &LogConfig{Format: "xml"}},
+		"bad alias":         {Servers: []Server{{Name: "a", MACAddress: "00:11:22:33:44:55", Aliases: []string{"my nas"}}}},
+	}
+	for name, config := range invalid {
+		if err := config.Validate(); err == nil {
+			t.Errorf("%s: expected validation error", name)
+		}
+	}
+}
+
+func TestTelegramTopicsAndUsers(t *testing.T) {
+	telegram := TelegramConfig{Topics: map[string]int{"Media": 12}}
+	if topic := telegram.TopicFor(&Server{Name: "nas", Group: "media"}); topic != 12 {
+		t.Errorf("topic of a grouped server = %d", topic)
+	}
+	if topic := telegram.TopicFor(&Server{Name: "pc"}); topic != 0 {
+		t.Errorf("topic of an ungrouped server = %d", topic)
+	}
+	if topic := telegram.TopicFor(nil); topic != 0 {
+		t.Errorf("topic of an unknown server = %d", topic)
+	}
+
+	if !telegram.UserAllowed(5) {
+		t.Error("without allowed_users everyone is allowed")
+	}
+	telegram.AllowedUsers = []int64{7}
+	if !telegram.UserAllowed(7) || telegram.UserAllowed(5) {
+		t.Error("allowed_users not applied")
+	}
+}
+
+func TestValidateWebhook(t *testing.T) {
+	valid := WebhookConfig{
+		URL:            "https://wot.example.com/telegram",
+		Listen:         "127.0.0.1:8443",
+		Secret:         "s3cret_token-1",
+		TrustedProxies: []string{"127.0.0.1", "10.0.0.0/8"},
+	}
+	if err := valid.validate(); err != nil {
+		t.Errorf("Expected valid webhook, got %v", err)
+	}
+	prefixes, _ := valid.TrustedPrefixes()
+	if len(prefixes) != 2 || prefixes[0].String() != "127.0.0.1/32" || prefixes[1].String() != "10.0.0.0/8" {
+		t.Errorf("TrustedPrefixes = %v", prefixes)
+	}
+
+	invalid := map[string]func(w *WebhookConfig){
+		"http url":         func(w *WebhookConfig) { w.URL = "http://wot.example.com/telegram" },
+		"missing listen":   func(w *WebhookConfig) { w.Listen = "" },
+		"bad secret":       func(w *WebhookConfig) { w.Secret = "no spaces" },
+		"cert without key": func(w *WebhookConfig) { w.TLSCert = "wot.crt" },
+		"no tls or proxy":  func(w *WebhookConfig) { w.TrustedProxies = nil },
+		"bad proxy":        func(w *WebhookConfig) { w.TrustedProxies = []string{"proxy.lan"} },
+		"self signed":      func(w *WebhookConfig) { w.SelfSigned = true },
+	}
+	for name, change := range invalid {
+		webhook := valid
+		change(&webhook)
+		config := Config{Telegram: TelegramConfig{Webhook: &webhook}}
+		if err := config.Validate(); err == nil {
+			t.Errorf("%s: expected validation error", name)
+		}
+	}
+}
+
+func TestValidateFederation(t *testing.T) {
+	valid := PeerConfig{Name: "cottage", URL: "https://cottage.example:8443", Secret: "correct horse battery staple"}
+	tests := []struct {
+		name    string
+		config  Config
+		wantErr string
+	}{
+		{"valid", Config{Site: "home", Peers: []PeerConfig{valid}}, ""},
+		{"slash in site", Config{Site: "home/2"}, "must not contain"},
+		{"duplicate peer", Config{Peers: []PeerConfig{valid, valid}}, "duplicate site"},
+		{"peer named like own site", Config{Site: "Cottage", Peers: []PeerConfig{valid}}, "duplicate site"},
+		{"short secret", Config{Federation: &FederationConfig{Listen: ":8443", Secret: "short"}}, "at least 16"},
+		{"cert without key", Config{Federation: &FederationConfig{Listen: ":8443", Secret: valid.Secret, TLSCert: "cert.pem"}}, "set together"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.config.validateFederation()
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Errorf("unexpected error: %v", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("expected error containing %q, got %v", tt.wantErr, err)
+			}
+		})
+	}
+}
+
+func TestSecrets(t *testing.T) {
+	cfg := Config{Notifiers: []NotifierConfig{
+		{Type: "slack", URL: "https://hooks.slack.com/services/T0/B0/secret"},
+		{Type: "webhook", URL: "https://example.com/hook", Headers: map[string]string{"X-Api-Key": "api-key-value"}},
+		{Type: "gotify", URL: "https://gotify.example.com", Token: "app-token"},
+	}}
+	secrets := cfg.Secrets()
+	for _, want := range []string{"https://hooks.slack.com/services/T0/B0/secret", "https://example.com/hook", "api-key-value", "app-token"} {
+		if !slices.Contains(secrets, want) {
+			t.Errorf("Secrets() is missing %q", want)
+		}
+	}
+	// A server URL is not a secret
+	if slices.Contains(secrets, "https://gotify.example.com") {
+		t.Error("Secrets() contains the gotify server URL")
+	}
+}
@@ -0,0 +1,335 @@
+package config
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/tsolodov/wot/internal/atomicfile"
+	"gopkg.in/yaml.v3"
+)
+
+// configDocument is a config file loaded as a YAML node tree. JSON files are
+// parsed the same way (JSON is valid YAML), which keeps key order for both
+// formats and comments for YAML when the file is written back.
+type configDocument struct {
+	json bool
+	root *yaml.Node
+}
+
+func readConfigDocument(path string) (*configDocument, os.FileMode, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to read config file: %w", err)
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to read config file: %w", err)
+	}
+
+	var root yaml.Node
+	if err := yaml.Unmarshal(data, &root); err != nil {
+		return nil, 0, fmt.Errorf("failed to parse config file: %w", err)
+	}
+	if root.Kind != yaml.DocumentNode || len(root.Content) == 0 || root.Content[0].Kind != yaml.MappingNode {
+		return nil, 0, fmt.Errorf("config file must contain a mapping at the top level")
+	}
+
+	isJSON := strings.EqualFold(filepath.Ext(path), ".json") || bytes.HasPrefix(bytes.TrimSpace(data), []byte("{"))
+	return &configDocument{json: isJSON, root: &root}, info.Mode().Perm(), nil
+}
+
+func (doc *configDocument) encode() ([]byte, error) {
+	if doc.json {
+		var buf bytes.Buffer
+		if err := encodeJSONNode(&buf, doc.root.Content[0]); err != nil {
+			return nil, err
+		}
+		var indented bytes.Buffer
+		if err := json.Indent(&indented, buf.Bytes(), "", "  "); err != nil {
+			return nil, err
+		}
+		indented.WriteByte('\n')
+		return indented.Bytes(), nil
+	}
+
+	var buf bytes.Buffer
+	encoder := yaml.NewEncoder(&buf)
+	encoder.SetIndent(2)
+	if err := encoder.Encode(doc.root); err != nil {
+		return nil, err
+	}
+	if err := encoder.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// serversNode returns the servers sequence, creating it if necessary.
+func (doc *configDocument) serversNode() *yaml.Node {
+	top := doc.root.Content[0]
+	if node := mappingValue(top, "servers"); node != nil {
+		if node.Kind != yaml.SequenceNode {
+			// "servers:" with no entries decodes as null
+			*node = yaml.Node{Kind: yaml.SequenceNode, Tag: "!!seq"}
+		}
+		return node
+	}
+
+	node := &yaml.Node{Kind: yaml.SequenceNode, Tag: "!!seq"}
+	top.Content = append([]*yaml.Node{scalarNode("servers", 0), node}, top.Content...)
+	return node
+}
+
+// findServer returns the index of the server called name (case-insensitive)
+// in the servers sequence, or -1.
+func (doc *configDocument) findServer(name string) (int, *yaml.Node) {
+	for i, node := range doc.serversNode().Content {
+		if value := mappingValue(node, "name"); value != nil && strings.EqualFold(value.Value, name) {
+			return i, node
+		}
+	}
+	return -1, nil
+}
+
+func mappingValue(mapping *yaml.Node, key string) *yaml.Node {
+	if mapping.Kind != yaml.MappingNode {
+		return nil
+	}
+	for i := 0; i+1 < len(mapping.Content); i += 2 {
+		if mapping.Content[i].Value == key {
+			return mapping.Content[i+1]
+		}
+	}
+	return nil
+}
+
+func setMappingValue(mapping *yaml.Node, key string, value *yaml.Node) {
+	for i := 0; i+1 < len(mapping.Content); i += 2 {
+		if mapping.Content[i].Value == key {
+			// Keep any comment attached to the old value
+			value.LineComment = mapping.Content[i+1].LineComment
+			mapping.Content[i+1] = value
+			return
+		}
+	}
+	mapping.Content = append(mapping.Content, scalarNode(key, 0), value)
+}
+
+func deleteMappingKey(mapping *yaml.Node, key string) {
+	for i := 0; i+1 < len(mapping.Content); i += 2 {
+		if mapping.Content[i].Value == key {
+			mapping.Content = append(mapping.Content[:i], mapping.Content[i+2:]...)
+			return
+		}
+	}
+}
+
+func scalarNode(value string, style yaml.Style) *yaml.Node {
+	return &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!str", Value: value, Style: style}
+}
+
+func portsNode(ports []int) *yaml.Node {
+	node := &yaml.Node{Kind: yaml.SequenceNode, Tag: "!!seq", Style: yaml.FlowStyle}
+	for _, port := range ports {
+		node.Content = append(node.Content, &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!int", Value: strconv.Itoa(port)})
+	}
+	return node
+}
+
+func serverNode(server Server) *yaml.Node {
+	node := &yaml.Node{Kind: yaml.MappingNode, Tag: "!!map"}
+	setMappingValue(node, "name", scalarNode(server.Name, 0))
+	setMappingValue(node, "mac_address", scalarNode(server.MACAddress, yaml.DoubleQuotedStyle))
+	if server.IPAddress != "" {
+		setMappingValue(node, "ip_address", scalarNode(server.IPAddress, yaml.DoubleQuotedStyle))
+	}
+	if server.Host != "" {
+		setMappingValue(node, "host", scalarNode(server.Host, 0))
+	}
+	if len(server.TCPPorts) > 0 {
+		setMappingValue(node, "tcp_ports", portsNode(server.TCPPorts))
+	}
+	return node
+}
+
+// encodeJSONNode writes a YAML node tree as compact JSON, keeping key order.
+func encodeJSONNode(buf *bytes.Buffer, node *yaml.Node) error {
+	switch node.Kind {
+	case yaml.DocumentNode:
+		return encodeJSONNode(buf, node.Content[0])
+	case yaml.AliasNode:
+		return encodeJSONNode(buf, node.Alias)
+	case yaml.MappingNode:
+		buf.WriteByte('{')
+		for i := 0; i+1 < len(node.Content); i += 2 {
+			if i > 0 {
+				buf.WriteByte(',')
+			}
+			key, _ := json.Marshal(node.Content[i].Value)
+			buf.Write(key)
+			buf.WriteByte(':')
+			if err := encodeJSONNode(buf, node.Content[i+1]); err != nil {
+				return err
+			}
+		}
+		buf.WriteByte('}')
+	case yaml.SequenceNode:
+		buf.WriteByte('[')
+		for i, item := range node.Content {
+			if i > 0 {
+				buf.WriteByte(',')
+			}
+			if err := encodeJSONNode(buf, item); err != nil {
+				return err
+			}
+		}
+		buf.WriteByte(']')
+	case yaml.ScalarNode:
+		switch node.ShortTag() {
+		case "!!int", "!!float", "!!bool":
+			buf.WriteString(node.Value)
+		case "!!null":
+			buf.WriteString("null")
+		default:
+			value, err := json.Marshal(node.Value)
+			if err != nil {
+				return err
+			}
+			buf.Write(value)
+		}
+	default:
+		return fmt.Errorf("unsupported YAML node kind %d", node.Kind)
+	}
+	return nil
+}
+
+// updateConfigFile applies mutate to the config file at path, validates the
+// result with the same rules as Load and atomically replaces the file.
+// Nothing is written if mutate or validation fails.
+func updateConfigFile(path string, mutate func(doc *configDocument) error) error {
+	doc, perm, err := readConfigDocument(path)
+	if err != nil {
+		return err
+	}
+	if err := mutate(doc); err != nil {
+		return err
+	}
+
+	data, err := doc.encode()
+	if err != nil {
+		return fmt.Errorf("failed to encode config: %w", err)
+	}
+
+	updated, err := Parse(data)
+	if err != nil {
+		return err
+	}
+	if err := updated.Validate(); err != nil {
+		return err
+	}
+
+	if err := atomicfile.WriteFile(path, data, perm); err != nil {
+		return fmt.Errorf("failed to write config file: %w", err)
+	}
+	return nil
+}
+
+// AddServer appends server to the config file at path, keeping the rest of
+// the file including comments.
+func AddServer(path string, server Server) error {
+	return updateConfigFile(path, func(doc *configDocument) error {
+		if i, _ := doc.findServer(server.Name); i >= 0 {
+			return fmt.Errorf("server '%s' already exists", server.Name)
+		}
+		servers := doc.serversNode()
+		servers.Content = append(servers.Content, serverNode(server))
+		return nil
+	})
+}
+
+// RemoveServer deletes the named server from the config file at path.
+func RemoveServer(path, name string) error {
+	return updateConfigFile(path, func(doc *configDocument) error {
+		i, _ := doc.findServer(name)
+		if i < 0 {
+			return fmt.Errorf("server '%s' not found in configuration", name)
+		}
+		servers := doc.serversNode()
+		servers.Content = append(servers.Content[:i], servers.Content[i+1:]...)
+		return nil
+	})
+}
+
+// EditServer sets one field of a server in the config file at path. A value of "-" clears the
+// optional fields ip_address, host and tcp_ports. Setting ip_address removes
+// host and vice versa.
+func EditServer(path, name, field, value string) error {
+	return updateConfigFile(path, func(doc *configDocument) error {
+		_, node := doc.findServer(name)
+		if node == nil {
+			return fmt.Errorf("server '%s' not found in configuration", name)
+		}
+
+		switch strings.ToLower(field) {
+		case "name":
+			if i, _ := doc.findServer(value); i >= 0 && !strings.EqualFold(value, name) {
+				return fmt.Errorf("server '%s' already exists", value)
+			}
+			setMappingValue(node, "name", scalarNode(value, 0))
+		case "mac", "mac_address":
+			setMappingValue(node, "mac_address", scalarNode(value, yaml.DoubleQuotedStyle))
+		case "ip", "ip_address":
+			if value == "-" {
+				deleteMappingKey(node, "ip_address")
+			} else {
+				setMappingValue(node, "ip_address", scalarNode(value, yaml.DoubleQuotedStyle))
+				deleteMappingKey(node, "host")
+			}
+		case "host":
+			if value == "-" {
+				deleteMappingKey(node, "host")
+			} else {
+				setMappingValue(node, "host", scalarNode(value, 0))
+				deleteMappingKey(node, "ip_address")
+			}
+		case "ports", "tcp_ports":
+			if value == "-" {
+				deleteMappingKey(node, "tcp_ports")
+				return nil
+			}
+			ports, err := ParsePorts(value)
+			if err != nil {
+				return err
+			}
+			setMappingValue(node, "tcp_ports", portsNode(ports))
+		default:
+			return fmt.Errorf("unknown field '%s' (expected name, mac, ip, host or ports)", field)
+		}
+		return nil
+	})
+}
+
+// ParsePorts parses a comma separated port list such as "22,80,443".
+func ParsePorts(value string) ([]int, error) {
+	var ports []int
+	for _, part := range strings.Split(value, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+		port, err := strconv.Atoi(part)
+		if err != nil {
+			return nil, fmt.Errorf("invalid port '%s'", part)
+		}
+		ports = append(ports, port)
+	}
+	if len(ports) == 0 {
+		return nil, fmt.Errorf("no ports given")
+	}
+	return ports, nil
+}
@@ -0,0 +1,148 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+const commentedConfig = `# Home lab
+servers:
+  # the NAS in the closet
+  - name: "nas"
+    mac_address: "aa:bb:cc:dd:ee:01"
+    ip_address: "192.168.1.10" # static lease
+    tcp_ports: [22, 445]
+  - name: "desktop"
+    mac_address: "aa:bb:cc:dd:ee:02"
+
+broadcast_ip: "192.168.1.255" # LAN broadcast
+`
+
+func writeConfigFile(t *testing.T, name, content string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), name)
+	if err := os.WriteFile(path, []byte(content), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chmod(path, 0640); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func readConfigFile(t *testing.T, path string) string {
+	t.Helper()
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(data)
+}
+
+func TestConfigEditPreservesYAMLComments(t *testing.T) {
+	path := writeConfigFile(t, "config.yaml", commentedConfig)
+
+	err := AddServer(path, Server{Name: "printer", MACAddress: "aa:bb:cc:dd:ee:03", IPAddress: "192.168.1.30", TCPPorts: []int{631}})
+	if err != nil {
+		t.Fatalf("add: %v", err)
+	}
+	if err := EditServer(path, "NAS", "ip", "192.168.1.11"); err != nil {
+		t.Fatalf("edit: %v", err)
+	}
+	if err := RemoveServer(path, "desktop"); err != nil {
+		t.Fatalf("remove: %v", err)
+	}
+
+	content := readConfigFile(t, path)
+	for _, want := range []string{"# Home lab", "# the NAS in the closet", "# static lease", "# LAN broadcast"} {
+		if !strings.Contains(content, want) {
+			t.Errorf("comment %q lost:\n%s", want, content)
+		}
+	}
+
+	config, err := Load(path)
+	if err != nil {
+		t.Fatalf("edited config does not load: %v", err)
+	}
+	if len(config.Servers) != 2 {
+		t.Fatalf("expected 2 servers, got %+v", config.Servers)
+	}
+	if config.Servers[0].IPAddress != "192.168.1.11" {
+		t.Errorf("edit not applied: %+v", config.Servers[0])
+	}
+	printer := config.Servers[1]
+	if printer.Name != "printer" || printer.IPAddress != "192.168.1.30" || len(printer.TCPPorts) != 1 || printer.TCPPorts[0] != 631 {
+		t.Errorf("unexpected added server: %+v", printer)
+	}
+
+	info, err := os.Stat(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Mode().Perm() != 0640 {
+		t.Errorf("file mode changed to %v", info.Mode().Perm())
+	}
+}
+
+func TestConfigEditKeepsJSONFormat(t *testing.T) {
+	path := writeConfigFile(t, "config.json", `{
+  "servers": [
+    {"name": "nas", "mac_address": "aa:bb:cc:dd:ee:01", "tcp_ports": [22]}
+  ],
+  "broadcast_ip": "192.168.1.255",
+  "monitoring_interval": 60
+}
+`)
+
+	if err := EditServer(path, "nas", "ports", "22,80"); err != nil {
+		t.Fatalf("edit: %v", err)
+	}
+
+	content := readConfigFile(t, path)
+	if !strings.HasPrefix(content, "{") {
+		t.Fatalf("config is no longer JSON:\n%s", content)
+	}
+	if strings.Index(content, `"servers"`) > strings.Index(content, `"broadcast_ip"`) ||
+		strings.Index(content, `"broadcast_ip"`) > strings.Index(content, `"monitoring_interval"`) {
+		t.Errorf("key order changed:\n%s", content)
+	}
+	if !strings.Contains(content, `"monitoring_interval": 60`) {
+		t.Errorf("numeric value not kept as a number:\n%s", content)
+	}
+
+	config, err := Load(path)
+	if err != nil {
+		t.Fatalf("edited config does not load: %v", err)
+	}
+	if ports := config.Servers[0].TCPPorts; len(ports) != 2 || ports[1] != 80 {
+		t.Errorf("unexpected ports: %v", ports)
+	}
+}
+
+func TestConfigEditRejectsInvalidChanges(t *testing.T) {
+	path := writeConfigFile(t, "config.yaml", commentedConfig)
+
+	tests := []struct {
+		name string
+		edit func() error
+	}{
+		{"bad mac", func() error { return AddServer(path, Server{Name: "bad", MACAddress: "not-a-mac"}) }},
+		{"duplicate", func() error { return AddServer(path, Server{Name: "Desktop", MACAddress: "aa:bb:cc:dd:ee:09"}) }},
+		{"bad ip", func() error { return EditServer(path, "nas", "ip", "999.1.1.1") }},
+		{"bad port", func() error { return EditServer(path, "nas", "ports", "70000") }},
+		{"rename clash", func() error { return EditServer(path, "nas", "name", "desktop") }},
+		{"unknown field", func() error { return EditServer(path, "nas", "color", "red") }},
+		{"unknown server", func() error { return RemoveServer(path, "missing") }},
+	}
+	for _, tt := range tests {
+		if err := tt.edit(); err == nil {
+			t.Errorf("%s: expected an error", tt.name)
+		}
+	}
+
+	if content := readConfigFile(t, path); content != commentedConfig {
+		t.Errorf("rejected edits modified the file:\n%s", content)
+	}
+}
@@ -0,0 +1,49 @@
+package config
+
+import "fmt"
+
+// HostConfig sets the alert thresholds for the machine WoT runs on. All
+// alerts are on with the defaults unless disabled.
+type HostConfig struct {
+	// SoC temperature in °C (default 80)
+	MaxTemperature float64 `json:"max_temperature,omitempty" yaml:"max_temperature,omitempty"`
+	// Free disk and available memory in percent (default 10)
+	MinDiskFree        float64 `json:"min_disk_free,omitempty" yaml:"min_disk_free,omitempty"`
+	MinMemoryAvailable float64 `json:"min_memory_available,omitempty" yaml:"min_memory_available,omitempty"`
+	// 5 minute load average per CPU (default 0, no alert)
+	MaxLoad float64 `json:"max_load,omitempty" yaml:"max_load,omitempty"`
+	// File system to watch (default: the state directory)
+	DiskPath      string `json:"disk_path,omitempty" yaml:"disk_path,omitempty"`
+	DisableAlerts bool   `json:"disable_alerts,omitempty" yaml:"disable_alerts,omitempty"`
+}
+
+func (h *HostConfig) validate() error {
+	if h.MaxTemperature < 0 || h.MinDiskFree < 0 || h.MinMemoryAvailable < 0 || h.MaxLoad < 0 {
+		return fmt.Errorf("host: thresholds must not be negative")
+	}
+	if h.MinDiskFree >= 100 || h.MinMemoryAvailable >= 100 {
+		return fmt.Errorf("host: min_disk_free and min_memory_available are percentages below 100")
+	}
+	return nil
+}
+
+// HostLimits returns the host section of c with defaults filled in.
+func (c *Config) HostLimits() HostConfig {
+	var host HostConfig
+	if c.Host != nil {
+		host = *c.Host
+	}
+	if host.MaxTemperature == 0 {
+		host.MaxTemperature = 80
+	}
+	if host.MinDiskFree == 0 {
+		host.MinDiskFree = 10
+	}
+	if host.MinMemoryAvailable == 0 {
+		host.MinMemoryAvailable = 10
+	}
+	if host.DiskPath == "" {
+		host.DiskPath = c.StateDirectory()
+	}
+	return host
+}
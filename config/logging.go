@@ -0,0 +1,100 @@
+package config
+
+import (
+	"fmt"
+	"log/slog"
+	"strings"
+)
+
+// LogConfig sets how much WoT logs and where. Without File it logs to
+// stderr, which systemd passes on to the journal.
+type LogConfig struct {
+	// Level is debug, info (default), warn or error
+	Level string `json:"level,omitempty" yaml:"level,omitempty"`
+	// Format is text (default) or json
+	Format string `json:"format,omitempty" yaml:"format,omitempty"`
+	File   string `json:"file,omitempty" yaml:"file,omitempty"`
+	// The file is rotated once it reaches MaxSizeMB (default 10), keeping
+	// MaxFiles rotated files (default 3)
+	MaxSizeMB int `json:"max_size_mb,omitempty" yaml:"max_size_mb,omitempty"`
+	MaxFiles  int `json:"max_files,omitempty" yaml:"max_files,omitempty"`
+}
+
+func (l *LogConfig) validate() error {
+	if _, err := ParseLogLevel(l.Level); err != nil {
+		return fmt.Errorf("log: %w", err)
+	}
+	if l.Format != "" && l.Format != "text" && l.Format != "json" {
+		return fmt.Errorf("log: format must be text or json, not %q", l.Format)
+	}
+	if l.MaxSizeMB < 0 || l.MaxFiles < 0 {
+		return fmt.Errorf("log: max_size_mb and max_files must not be negative")
+	}
+	return nil
+}
+
+// ParseLogLevel parses debug, info, warn or error; empty means info.
+func ParseLogLevel(level string) (slog.Level, error) {
+	switch strings.ToLower(level) {
+	case "debug":
+		return slog.LevelDebug, nil
+	case "", "info":
+		return slog.LevelInfo, nil
+	case "warn", "warning":
+		return slog.LevelWarn, nil
+	case "error":
+		return slog.LevelError, nil
+	}
+	return 0, fmt.Errorf("unknown log level %q (use debug, info, warn or error)", level)
+}
+
+// Logging returns the log section of c with defaults filled in.
+func (c *Config) Logging() LogConfig {
+	var logging LogConfig
+	if c.Log != nil {
+		logging = *c.Log
+	}
+	if logging.Format == "" {
+		logging.Format = "text"
+	}
+	if logging.MaxSizeMB == 0 {
+		logging.MaxSizeMB = 10
+	}
+	if logging.MaxFiles == 0 {
+		logging.MaxFiles = 3
+	}
+	return logging
+}
+
+// Secrets returns the tokens, passwords and shared secrets in c, which must
+// not show up in logs.
+func (c *Config) Secrets() []string {
+	secrets := []string{c.Telegram.BotToken}
+	if c.Telegram.Webhook != nil {
+		secrets = append(secrets, c.Telegram.Webhook.Secret)
+	}
+	if c.MQTT != nil {
+		secrets = append(secrets, c.MQTT.Password)
+	}
+	for _, notifier := range c.Notifiers {
+		secrets = append(secrets, notifier.Token, notifier.Password)
+		// The URL is the credential of webhooks and the topic name of ntfy
+		switch notifier.Type {
+		case "slack", "discord", "ntfy", "webhook":
+			secrets = append(secrets, notifier.URL)
+		}
+		for _, value := range notifier.Headers {
+			secrets = append(secrets, value)
+		}
+	}
+	for _, relay := range c.Relays {
+		secrets = append(secrets, relay.Secret)
+	}
+	if c.Federation != nil {
+		secrets = append(secrets, c.Federation.Secret)
+	}
+	for _, peer := range c.Peers {
+		secrets = append(secrets, peer.Secret)
+	}
+	return secrets
+}
@@ -0,0 +1,109 @@
+package config
+
+import (
+	"sort"
+	"strings"
+)
+
+// maxSuggestions bounds the "did you mean" suggestions for an unknown name.
+const maxSuggestions = 3
+
+// ServerMatch is the result of looking up a server by a name a user typed.
+type ServerMatch struct {
+	// Server is set if the name identifies a single server
+	Server *Server
+	// Ambiguous is set if the name is a prefix of several servers, which
+	// are then the Candidates. Otherwise Candidates are the servers with a
+	// name close to the one typed, closest first.
+	Ambiguous  bool
+	Candidates []Server
+}
+
+// MatchServer looks up a server by its name or one of its aliases, ignoring
+// case. A prefix is enough if it matches a single server.
+func MatchServer(servers []Server, name string) ServerMatch {
+	name = strings.ToLower(strings.TrimSpace(name))
+	if name == "" {
+		return ServerMatch{}
+	}
+	if server := FindServer(servers, name); server != nil {
+		return ServerMatch{Server: server}
+	}
+	for i, server := range servers {
+		for _, alias := range server.Aliases {
+			if strings.EqualFold(alias, name) {
+				return ServerMatch{Server: &servers[i]}
+			}
+		}
+	}
+
+	var prefixed []int
+	for i, server := range servers {
+		for _, known := range server.names() {
+			if strings.HasPrefix(strings.ToLower(known), name) {
+				prefixed = append(prefixed, i)
+				break
+			}
+		}
+	}
+	switch len(prefixed) {
+	case 0:
+		return ServerMatch{Candidates: closestServers(servers, name)}
+	case 1:
+		return ServerMatch{Server: &servers[prefixed[0]]}
+	}
+	match := ServerMatch{Ambiguous: true}
+	for _, i := range prefixed {
+		match.Candidates = append(match.Candidates, servers[i])
+	}
+	return match
+}
+
+// closestServers returns the servers with a name or alias within a few typos
+// of name, closest first.
+func closestServers(servers []Server, name string) []Server {
+	type candidate struct {
+		server   Server
+		distance int
+	}
+	limit := max(2, len(name)/3)
+	var candidates []candidate
+	for _, server := range servers {
+		best := limit + 1
+		for _, known := range server.names() {
+			best = min(best, editDistance(strings.ToLower(known), name))
+		}
+		if best <= limit {
+			candidates = append(candidates, candidate{server, best})
+		}
+	}
+	sort.SliceStable(candidates, func(i, j int) bool { return candidates[i].distance < candidates[j].distance })
+
+	var closest []Server
+	for _, candidate := range candidates[:min(len(candidates), maxSuggestions)] {
+		closest = append(closest, candidate.server)
+	}
+	return closest
+}
+
+// editDistance is the Levenshtein distance between a and b.
+func editDistance(a, b string) int {
+	ra, rb := []rune(a), []rune(b)
+	previous := make([]int, len(rb)+1)
+	current := make([]int, len(rb)+1)
+	for j := range previous {
+		previous[j] = j
+	}
+	for i := 1; i <= len(ra); i++ {
+		current[0] = i
+		for j := 1; j <= len(rb); j++ {
+			cost := 1
+			if ra[i-1] == rb[j-1] {
+				cost = 0
+			}
+			current[j] = min(previous[j]+1, current[j-1]+1, previous[j-1]+cost)
+		}
+		previous, current = current, previous
+	}
+	return previous[len(rb)]
+}
@@ -0,0 +1,70 @@
+package config
+
+import "testing"
+
+func TestMatchServer(t *testing.T) {
+	servers := []Server{
+		{Name: "k8s-master", Aliases: []string{"master"}},
+		{Name: "k8s-worker"},
+		{Name: "nas", Aliases: []string{"storage"}},
+		{Name: "nas-backup"},
+	}
+	names := func(servers []Server) []string {
+		var names []string
+		for _, server := range servers {
+			names = append(names, server.Name)
+		}
+		return names
+	}
+
+	tests := []struct {
+		name       string
+		server     string
+		ambiguous  bool
+		candidates []string
+	}{
+		{name: "NAS", server: "nas"},
+		{name: "storage", server: "nas"},
+		{name: "k8s-m", server: "k8s-master"},
+		{name: "mast", server: "k8s-master"},
+		{name: "nas-", server: "nas-backup"},
+		{name: "k8s", ambiguous: true, candidates: []string{"k8s-master", "k8s-worker"}},
+		{name: "k8smaster", candidates: []string{"k8s-master"}},
+		{name: "k8s_worker", candidates: []string{"k8s-worker"}},
+		{name: "storge", candidates: []string{"nas"}},
+		{name: "printer"},
+		{name: ""},
+	}
+	for _, test := range tests {
+		match := MatchServer(servers, test.name)
+		server := ""
+		if match.Server != nil {
+			server = match.Server.Name
+		}
+		got := names(match.Candidates)
+		if server != test.server || match.Ambiguous != test.ambiguous || len(got) != len(test.candidates) {
+			t.Errorf("MatchServer(%q) = %q, ambiguous %v, candidates %v", test.name, server, match.Ambiguous, got)
+			continue
+		}
+		for i := range got {
+			if got[i] != test.candidates[i] {
+				t.Errorf("MatchServer(%q) candidates %v, want %v", test.name, got, test.candidates)
+			}
+		}
+	}
+}
+
+func TestEditDistance(t *testing.T) {
+	tests := map[[2]string]int{
+		{"", ""}:                    0,
+		{"nas", ""}:                 3,
+		{"k8smaster", "k8s-master"}: 1,
+		{"kitten", "sitting"}:       3,
+		{"ноут", "нoут"}:            1,
+	}
+	for pair, want := range tests {
+		if got := editDistance(pair[0], pair[1]); got != want {
+			t.Errorf("editDistance(%q, %q) = %d, want %d", pair[0], pair[1], got, want)
+		}
+	}
+}
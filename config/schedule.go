@@ -0,0 +1,173 @@
+package config
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// MaintenanceWindow is a recurring maintenance period, e.g. every Sunday from
+// 03:00 for two hours.
+type MaintenanceWindow struct {
+	Servers  []string `json:"servers" yaml:"servers"`
+	Days     []string `json:"days,omitempty" yaml:"days,omitempty"`
+	Start    string   `json:"start" yaml:"start"`
+	Duration string   `json:"duration" yaml:"duration"`
+	Reason   string   `json:"reason,omitempty" yaml:"reason,omitempty"`
+}
+
+// ReportConfig schedules the digest report in the admin chat.
+type ReportConfig struct {
+	// Schedule is daily or weekly
+	Schedule string `json:"schedule" yaml:"schedule"`
+	// Time of day (HH:MM, default 08:00) and, for weekly reports, the day
+	// (default Monday) in the configured time zone
+	Time string `json:"time,omitempty" yaml:"time,omitempty"`
+	Day  string `json:"day,omitempty" yaml:"day,omitempty"`
+}
+
+// ParseWeekday accepts English day names, full or abbreviated to three
+// letters.
+func ParseWeekday(name string) (time.Weekday, bool) {
+	for day := time.Sunday; day <= time.Saturday; day++ {
+		full := strings.ToLower(day.String())
+		if strings.EqualFold(name, full) || strings.EqualFold(name, full[:3]) {
+			return day, true
+		}
+	}
+	return 0, false
+}
+
+// ParseDuration parses Go durations such as "90m" or "2h30m" and whole days
+// such as "3d".
+func ParseDuration(value string) (time.Duration, error) {
+	var duration time.Duration
+	var err error
+	if days, ok := strings.CutSuffix(value, "d"); ok {
+		var n int
+		n, err = strconv.Atoi(days)
+		duration = time.Duration(n) * 24 * time.Hour
+	} else {
+		duration, err = time.ParseDuration(value)
+	}
+	if err != nil || duration <= 0 {
+		return 0, fmt.Errorf("invalid duration '%s', use e.g. 30m, 2h or 1d", value)
+	}
+	return duration, nil
+}
+
+func (w MaintenanceWindow) validate(servers []Server) error {
+	if len(w.Servers) == 0 {
+		return fmt.Errorf("servers is required")
+	}
+	for _, name := range w.Servers {
+		if name != "*" && FindServer(servers, name) == nil {
+			return fmt.Errorf("unknown server '%s'", name)
+		}
+	}
+	for _, day := range w.Days {
+		if _, ok := ParseWeekday(day); !ok {
+			return fmt.Errorf("invalid day '%s'", day)
+		}
+	}
+	if _, err := time.Parse("15:04", w.Start); err != nil {
+		return fmt.Errorf("invalid start '%s', expected HH:MM", w.Start)
+	}
+	duration, err := ParseDuration(w.Duration)
+	if err != nil {
+		return err
+	}
+	if duration > 7*24*time.Hour {
+		return fmt.Errorf("duration must not exceed a week")
+	}
+	return nil
+}
+
+// ActiveAt returns the end of the window occurrence that covers now for
+// server, if any. Start times are taken in the location of now.
+func (w MaintenanceWindow) ActiveAt(server string, now time.Time) (time.Time, bool) {
+	matches := false
+	for _, name := range w.Servers {
+		if name == "*" || strings.EqualFold(name, server) {
+			matches = true
+		}
+	}
+	start, err := time.Parse("15:04", w.Start)
+	duration, durationErr := ParseDuration(w.Duration)
+	if !matches || err != nil || durationErr != nil {
+		return time.Time{}, false
+	}
+
+	// Occurrences that started up to the window length ago can still be running
+	for back := 0; back <= int(duration/(24*time.Hour))+1; back++ {
+		day := now.AddDate(0, 0, -back)
+		begin := time.Date(day.Year(), day.Month(), day.Day(), start.Hour(), start.Minute(), 0, 0, now.Location())
+		if !w.onDay(begin.Weekday()) {
+			continue
+		}
+		end := begin.Add(duration)
+		if !now.Before(begin) && now.Before(end) {
+			return end, true
+		}
+	}
+	return time.Time{}, false
+}
+
+func (w MaintenanceWindow) onDay(weekday time.Weekday) bool {
+	if len(w.Days) == 0 {
+		return true
+	}
+	for _, day := range w.Days {
+		if d, ok := ParseWeekday(day); ok && d == weekday {
+			return true
+		}
+	}
+	return false
+}
+
+func (r *ReportConfig) validate() error {
+	if r.Schedule != "daily" && r.Schedule != "weekly" {
+		return fmt.Errorf("report.schedule must be daily or weekly")
+	}
+	if r.Time != "" {
+		if _, err := time.Parse("15:04", r.Time); err != nil {
+			return fmt.Errorf("report.time '%s' must be HH:MM", r.Time)
+		}
+	}
+	if r.Day != "" {
+		if _, ok := ParseWeekday(r.Day); !ok {
+			return fmt.Errorf("report.day '%s' is not a day of the week", r.Day)
+		}
+	}
+	return nil
+}
+
+// Period is the time a report covers: a day or a week.
+func (r *ReportConfig) Period() time.Duration {
+	if r.Schedule == "weekly" {
+		return 7 * 24 * time.Hour
+	}
+	return 24 * time.Hour
+}
+
+// LastRun returns the most recent scheduled report time at or before now.
+func (r *ReportConfig) LastRun(now time.Time) time.Time {
+	at, err := time.Parse("15:04", r.Time)
+	if err != nil {
+		at = time.Date(0, 1, 1, 8, 0, 0, 0, time.UTC)
+	}
+	weekday := time.Monday
+	if day, ok := ParseWeekday(r.Day); ok {
+		weekday = day
+	}
+
+	for back := 0; ; back++ {
+		day := now.AddDate(0, 0, -back)
+		run := time.Date(day.Year(), day.Month(), day.Day(), at.Hour(), at.Minute(), 0, 0, now.Location())
+		if run.After(now) || r.Schedule == "weekly" && run.Weekday() != weekday {
+			continue
+		}
+		return run
+	}
+}
@@ -0,0 +1,97 @@
+package config
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestMaintenanceWindowActive(t *testing.T) {
+	servers := []Server{{Name: "nas", MACAddress: "aa:bb:cc:dd:ee:01"}}
+	sunday := MaintenanceWindow{Servers: []string{"nas"}, Days: []string{"Sunday"}, Start: "03:00", Duration: "2h"}
+	overnight := MaintenanceWindow{Servers: []string{"*"}, Days: []string{"mon"}, Start: "23:00", Duration: "3h"}
+	for _, window := range []MaintenanceWindow{sunday, overnight} {
+		if err := window.validate(servers); err != nil {
+			t.Fatalf("validateMaintenanceWindow: %v", err)
+		}
+	}
+
+	// 2024-05-05 is a Sunday
+	at := func(day, hour, minute int) time.Time {
+		return time.Date(2024, 5, day, hour, minute, 0, 0, time.UTC)
+	}
+	tests := []struct {
+		window MaintenanceWindow
+		server string
+		now    time.Time
+		until  time.Time
+		active bool
+	}{
+		{sunday, "nas", at(5, 4, 0), at(5, 5, 0), true},
+		{sunday, "NAS", at(5, 3, 0), at(5, 5, 0), true},
+		{sunday, "nas", at(5, 5, 0), time.Time{}, false},
+		{sunday, "nas", at(6, 4, 0), time.Time{}, false},
+		{sunday, "printer", at(5, 4, 0), time.Time{}, false},
+		{overnight, "printer", at(7, 1, 30), at(7, 2, 0), true},
+		{overnight, "printer", at(6, 22, 59), time.Time{}, false},
+	}
+	for _, tt := range tests {
+		until, active := tt.window.ActiveAt(tt.server, tt.now)
+		if active != tt.active || !until.Equal(tt.until) {
+			t.Errorf("%s at %v: got %v %v, want %v %v", tt.server, tt.now, active, until, tt.active, tt.until)
+		}
+	}
+}
+
+func TestValidateMaintenanceWindow(t *testing.T) {
+	servers := []Server{{Name: "nas", MACAddress: "aa:bb:cc:dd:ee:01"}}
+	tests := []struct {
+		window  MaintenanceWindow
+		wantErr string
+	}{
+		{MaintenanceWindow{Start: "03:00", Duration: "1h"}, "servers is required"},
+		{MaintenanceWindow{Servers: []string{"web"}, Start: "03:00", Duration: "1h"}, "unknown server"},
+		{MaintenanceWindow{Servers: []string{"nas"}, Days: []string{"someday"}, Start: "03:00", Duration: "1h"}, "invalid day"},
+		{MaintenanceWindow{Servers: []string{"nas"}, Start: "3am", Duration: "1h"}, "invalid start"},
+		{MaintenanceWindow{Servers: []string{"nas"}, Start: "03:00", Duration: "soon"}, "invalid duration"},
+		{MaintenanceWindow{Servers: []string{"nas"}, Start: "03:00", Duration: "8d"}, "a week"},
+	}
+	for _, tt := range tests {
+		err := tt.window.validate(servers)
+		if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+			t.Errorf("%+v: expected error containing %q, got %v", tt.window, tt.wantErr, err)
+		}
+	}
+}
+
+func TestParseDuration(t *testing.T) {
+	for value, want := range map[string]time.Duration{"30m": 30 * time.Minute, "2h30m": 150 * time.Minute, "1d": 24 * time.Hour} {
+		if got, err := ParseDuration(value); err != nil || got != want {
+			t.Errorf("%s: got %v (%v), want %v", value, got, err, want)
+		}
+	}
+	for _, value := range []string{"", "0m", "-1h", "xd", "2 hours"} {
+		if _, err := ParseDuration(value); err == nil {
+			t.Errorf("%q: expected an error", value)
+		}
+	}
+}
+
+func TestReportLastRun(t *testing.T) {
+	// 2024-05-01 is a Wednesday
+	now := time.Date(2024, 5, 1, 7, 30, 0, 0, time.UTC)
+	daily := &ReportConfig{Schedule: "daily", Time: "08:00"}
+	if got := daily.LastRun(now); !got.Equal(time.Date(2024, 4, 30, 8, 0, 0, 0, time.UTC)) {
+		t.Errorf("daily: %v", got)
+	}
+	weekly := &ReportConfig{Schedule: "weekly", Day: "fri"}
+	if got := weekly.LastRun(now); !got.Equal(time.Date(2024, 4, 26, 8, 0, 0, 0, time.UTC)) {
+		t.Errorf("weekly: %v", got)
+	}
+
+	for _, report := range []ReportConfig{{Schedule: "hourly"}, {Schedule: "daily", Time: "8am"}, {Schedule: "weekly", Day: "someday"}} {
+		if err := report.validate(); err == nil {
+			t.Errorf("%+v: expected an error", report)
+		}
+	}
+}
@@ -0,0 +1,105 @@
+package config
+
+import (
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+
+	"github.com/tsolodov/wot/probe"
+	"github.com/tsolodov/wot/wol"
+)
+
+// AutoAddress as ip_address means the IP is looked up from the MAC address,
+// the same as leaving ip_address empty.
+const AutoAddress = "auto"
+
+type Server struct {
+	Name       string `json:"name" yaml:"name"`
+	MACAddress string `json:"mac_address" yaml:"mac_address"`
+	IPAddress  string `json:"ip_address,omitempty" yaml:"ip_address,omitempty"`
+	Host       string `json:"host,omitempty" yaml:"host,omitempty"`
+	Relay      string `json:"relay,omitempty" yaml:"relay,omitempty"`
+	TCPPorts   []int  `json:"tcp_ports,omitempty" yaml:"tcp_ports,omitempty"`
+	// Group names a set of servers, e.g. for routing their alerts to a
+	// Telegram forum topic
+	Group string `json:"group,omitempty" yaml:"group,omitempty"`
+	// Aliases are further names commands accept for the server
+	Aliases []string `json:"aliases,omitempty" yaml:"aliases,omitempty"`
+}
+
+// names returns the name and the aliases of the server.
+func (s Server) names() []string {
+	return append([]string{s.Name}, s.Aliases...)
+}
+
+// Validate checks the fields of a single server.
+func (s Server) Validate() error {
+	if strings.TrimSpace(s.Name) == "" {
+		return fmt.Errorf("name is required")
+	}
+	if _, err := wol.ParseMAC(s.MACAddress); err != nil {
+		return fmt.Errorf("server '%s': %w", s.Name, err)
+	}
+	if s.Host != "" {
+		if s.IPAddress != "" {
+			return fmt.Errorf("server '%s': set either host or ip_address, not both", s.Name)
+		}
+		if strings.ContainsAny(s.Host, " /:@") && net.ParseIP(s.Host) == nil {
+			return fmt.Errorf("server '%s': host '%s' is not a valid host name", s.Name, s.Host)
+		}
+	} else if !s.UsesAutoAddress() && net.ParseIP(s.IPAddress) == nil {
+		return fmt.Errorf("server '%s': ip_address '%s' is not a valid IP address", s.Name, s.IPAddress)
+	}
+	for _, alias := range s.Aliases {
+		if strings.TrimSpace(alias) == "" || strings.ContainsAny(alias, " /") {
+			return fmt.Errorf("server '%s': alias '%s' must be a single word", s.Name, alias)
+		}
+	}
+	for _, port := range s.TCPPorts {
+		if port < 1 || port > 65535 {
+			return fmt.Errorf("server '%s': tcp port %d out of range", s.Name, port)
+		}
+	}
+	return nil
+}
+
+// UsesAutoAddress reports whether the server's IP address is looked up from
+// its MAC address instead of being configured.
+func (s Server) UsesAutoAddress() bool {
+	return s.Host == "" && (s.IPAddress == "" || strings.EqualFold(s.IPAddress, AutoAddress))
+}
+
+// DisplayAddress formats the address of a server for messages, including
+// the host name it was resolved from.
+func (s Server) DisplayAddress(address string) string {
+	switch {
+	case s.Host != "" && address != "":
+		return fmt.Sprintf("%s → %s", s.Host, address)
+	case s.Host != "":
+		return s.Host
+	case address != "":
+		return address
+	default:
+		return "unknown"
+	}
+}
+
+// ProbeDescription names the checks run for the server, for DOWN
+// notifications.
+func (s Server) ProbeDescription() string {
+	ports := s.TCPPorts
+	if len(ports) == 0 {
+		ports = probe.DefaultTCPPorts()
+	}
+	list := make([]string, len(ports))
+	for i, port := range ports {
+		list[i] = strconv.Itoa(port)
+	}
+
+	description := "ping and TCP ports " + strings.Join(list, ", ")
+	if s.Relay != "" {
+		description += " via relay " + s.Relay
+	}
+	return description
+}
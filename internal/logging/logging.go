@@ -0,0 +1,170 @@
+// Package logging sets up the default slog logger of WoT: text or JSON
+// records at a level that can change while running, written to stderr or a
+// rotated file, with secrets such as the bot token redacted.
+package logging
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"slices"
+	"strings"
+	"sync"
+
+	"github.com/tsolodov/wot/config"
+	"github.com/tsolodov/wot/internal/rotate"
+)
+
+// Redacted replaces secrets in log records.
+const Redacted = "[REDACTED]"
+
+var (
+	level slog.LevelVar
+	// levelFlag is set if the level was given on the command line, which
+	// takes precedence over the config file
+	levelFlag bool
+
+	secretsMutex sync.RWMutex
+	secrets      []string
+)
+
+// Setup makes the default logger write as configured by cfg, at the level
+// of flagLevel instead if it is set. The returned Closer closes the log file.
+func Setup(cfg config.LogConfig, flagLevel string) (io.Closer, error) {
+	name := cfg.Level
+	if flagLevel != "" {
+		name, levelFlag = flagLevel, true
+	}
+	parsed, err := config.ParseLogLevel(name)
+	if err != nil {
+		return nil, err
+	}
+	level.Set(parsed)
+
+	var out io.Writer = os.Stderr
+	var closer io.Closer = io.NopCloser(nil)
+	if cfg.File != "" {
+		file := rotate.Open(cfg.File, int64(cfg.MaxSizeMB)<<20, cfg.MaxFiles)
+		out, closer = file, file
+	}
+	// The journal timestamps what a service writes to stderr itself
+	journal := cfg.File == "" && os.Getenv("JOURNAL_STREAM") != ""
+	slog.SetDefault(slog.New(NewHandler(out, cfg.Format, journal)))
+	return closer, nil
+}
+
+// SetLevel changes the level after the config was reloaded, unless it was
+// given on the command line.
+func SetLevel(name string) error {
+	if levelFlag {
+		return nil
+	}
+	parsed, err := config.ParseLogLevel(name)
+	if err != nil {
+		return err
+	}
+	if parsed != level.Level() {
+		level.Set(parsed)
+		slog.Info("Log level changed", "level", parsed)
+	}
+	return nil
+}
+
+// NewHandler returns a handler writing text or JSON records to out at the
+// current level, without timestamps for the journal. Durations are written
+// as e.g. "5m0s" in both formats.
+func NewHandler(out io.Writer, format string, journal bool) slog.Handler {
+	options := &slog.HandlerOptions{Level: &level}
+	options.ReplaceAttr = func(groups []string, attr slog.Attr) slog.Attr {
+		if journal && len(groups) == 0 && attr.Key == slog.TimeKey {
+			return slog.Attr{}
+		}
+		if attr.Value.Kind() == slog.KindDuration {
+			return slog.String(attr.Key, attr.Value.Duration().String())
+		}
+		return attr
+	}
+	if format == "json" {
+		return redactingHandler{slog.NewJSONHandler(out, options)}
+	}
+	return redactingHandler{slog.NewTextHandler(out, options)}
+}
+
+// AddSecrets adds values to the secrets redacted from every log record.
+func AddSecrets(values ...string) {
+	secretsMutex.Lock()
+	defer secretsMutex.Unlock()
+	for _, value := range values {
+		// Very short values would redact ordinary words
+		if len(value) >= 6 && !slices.Contains(secrets, value) {
+			secrets = append(secrets, value)
+		}
+	}
+}
+
+// Redact replaces the secrets in s.
+func Redact(s string) string {
+	secretsMutex.RLock()
+	defer secretsMutex.RUnlock()
+	for _, secret := range secrets {
+		s = strings.ReplaceAll(s, secret, Redacted)
+	}
+	return s
+}
+
+// redactingHandler redacts secrets from the message and the string, error
+// and Stringer attributes of records before passing them on.
+type redactingHandler struct {
+	slog.Handler
+}
+
+func (h redactingHandler) Handle(ctx context.Context, record slog.Record) error {
+	redacted := slog.NewRecord(record.Time, record.Level, Redact(record.Message), record.PC)
+	record.Attrs(func(attr slog.Attr) bool {
+		redacted.AddAttrs(redactAttr(attr))
+		return true
+	})
+	return h.Handler.Handle(ctx, redacted)
+}
+
+func (h redactingHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	for i, attr := range attrs {
+		attrs[i] = redactAttr(attr)
+	}
+	return redactingHandler{h.Handler.WithAttrs(attrs)}
+}
+
+func (h redactingHandler) WithGroup(name string) slog.Handler {
+	return redactingHandler{h.Handler.WithGroup(name)}
+}
+
+func redactAttr(attr slog.Attr) slog.Attr {
+	value := attr.Value.Resolve()
+	switch value.Kind() {
+	case slog.KindString:
+		return slog.String(attr.Key, Redact(value.String()))
+	case slog.KindGroup:
+		group := value.Group()
+		redacted := make([]any, len(group))
+		for i, member := range group {
+			redacted[i] = redactAttr(member)
+		}
+		return slog.Group(attr.Key, redacted...)
+	case slog.KindAny:
+		switch v := value.Any().(type) {
+		case error:
+			return slog.String(attr.Key, Redact(v.Error()))
+		case fmt.Stringer:
+			return slog.String(attr.Key, Redact(v.String()))
+		}
+	}
+	return slog.Attr{Key: attr.Key, Value: value}
+}
+
+// Fatal logs msg as an error and exits.
+func Fatal(msg string, args ...any) {
+	slog.Error(msg, args...)
+	os.Exit(1)
+}
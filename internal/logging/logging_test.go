@@ -0,0 +1,51 @@
+package logging
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestHandler(t *testing.T) {
+	token := "123456:secret-bot-token"
+	AddSecrets(token, "", "short")
+	defer func() { secrets = nil }()
+	level.Set(slog.LevelInfo)
+
+	var out bytes.Buffer
+	logger := slog.New(NewHandler(&out, "json", true)).With("url", "https://api.telegram.org/bot"+token+"/getMe")
+	logger.Debug("hidden")
+	logger.Warn("Telegram API unreachable: bot"+token, "error", errors.New("Post bot"+token+": timeout"), slog.Group("probe", "target", token), "chat_id", 42, "retry_in", 5*time.Second)
+
+	var record map[string]any
+	if err := json.Unmarshal(out.Bytes(), &record); err != nil {
+		t.Fatalf("%v: %s", err, out.String())
+	}
+	if strings.Contains(out.String(), token) || !strings.Contains(out.String(), "bot"+Redacted+"/getMe") {
+		t.Errorf("token not redacted: %s", out.String())
+	}
+	if _, ok := record["time"]; ok {
+		t.Errorf("time logged for the journal: %s", out.String())
+	}
+	if record["level"] != "WARN" || record["chat_id"] != 42.0 || record["retry_in"] != "5s" || record["probe"].(map[string]any)["target"] != Redacted {
+		t.Errorf("record %v", record)
+	}
+
+	// Short values are not treated as secrets, and the level can change
+	out.Reset()
+	if err := SetLevel("debug"); err != nil {
+		t.Fatal(err)
+	}
+	defer level.Set(slog.LevelInfo)
+	slog.New(NewHandler(&out, "text", false)).Debug("short text", "server", "nas")
+	if line := out.String(); !strings.Contains(line, "level=DEBUG msg=\"short text\" server=nas") || !strings.HasPrefix(line, "time=") {
+		t.Errorf("text record %q", line)
+	}
+	if err := SetLevel("verbose"); err == nil {
+		t.Error("SetLevel accepted an unknown level")
+	}
+}
@@ -0,0 +1,115 @@
+// Package rotate appends to a log file and rotates it by size. Rotated files
+// are kept as path.1 (the newest) up to path.N.
+package rotate
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+// File is a size-rotated log file. It is safe for concurrent use, and each
+// Write lands in one file, so whole lines are never split across files.
+type File struct {
+	path     string
+	maxSize  int64
+	maxFiles int
+
+	mutex sync.Mutex
+	file  *os.File
+	size  int64
+}
+
+// Open returns the rotated file at path, which is created on the first
+// write. Once a write would grow it beyond maxSize bytes it is rotated,
+// keeping maxFiles old files.
+func Open(path string, maxSize int64, maxFiles int) *File {
+	return &File{path: path, maxSize: maxSize, maxFiles: maxFiles}
+}
+
+func (f *File) Write(p []byte) (int, error) {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	if f.file == nil {
+		if err := f.open(); err != nil {
+			return 0, err
+		}
+	}
+	if f.size > 0 && f.size+int64(len(p)) > f.maxSize {
+		if err := f.rotate(); err != nil {
+			return 0, err
+		}
+	}
+	n, err := f.file.Write(p)
+	f.size += int64(n)
+	return n, err
+}
+
+func (f *File) open() error {
+	if err := os.MkdirAll(filepath.Dir(f.path), 0700); err != nil {
+		return err
+	}
+	file, err := os.OpenFile(f.path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0600)
+	if err != nil {
+		return err
+	}
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return err
+	}
+	f.file, f.size = file, info.Size()
+	return nil
+}
+
+// rotate shifts the old files up by one, dropping the oldest, and starts a
+// new file.
+func (f *File) rotate() error {
+	f.file.Close()
+	f.file = nil
+	os.Remove(f.rotated(f.maxFiles))
+	for i := f.maxFiles - 1; i >= 1; i-- {
+		os.Rename(f.rotated(i), f.rotated(i+1))
+	}
+	if f.maxFiles > 0 {
+		if err := os.Rename(f.path, f.rotated(1)); err != nil {
+			return err
+		}
+	} else if err := os.Remove(f.path); err != nil {
+		return err
+	}
+	return f.open()
+}
+
+func (f *File) rotated(i int) string {
+	if i == 0 {
+		return f.path
+	}
+	return fmt.Sprintf("%s.%d", f.path, i)
+}
+
+// Paths returns the current file and the rotated ones that exist, newest
+// first.
+func (f *File) Paths() []string {
+	var paths []string
+	for i := 0; i <= f.maxFiles; i++ {
+		if _, err := os.Stat(f.rotated(i)); err == nil {
+			paths = append(paths, f.rotated(i))
+		}
+	}
+	return paths
+}
+
+// Close closes the current file; a later Write opens it again.
+func (f *File) Close() error {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	if f.file == nil {
+		return nil
+	}
+	err := f.file.Close()
+	f.file = nil
+	return err
+}
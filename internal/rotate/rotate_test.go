@@ -0,0 +1,43 @@
+package rotate
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+)
+
+func TestRotate(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "logs", "audit.jsonl")
+	file := Open(path, 10, 2)
+	defer file.Close()
+
+	for _, line := range []string{"one\n", "two\n", "three\n", "four\n", "five\n"} {
+		if _, err := file.Write([]byte(line)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// Writes are never split, and only two old files are kept
+	want := map[string]string{path: "four\nfive\n", path + ".1": "three\n", path + ".2": "one\ntwo\n"}
+	for name, content := range want {
+		data, err := os.ReadFile(name)
+		if err != nil || string(data) != content {
+			t.Errorf("%s = %q, %v; want %q", filepath.Base(name), data, err, content)
+		}
+	}
+	if _, err := os.Stat(path + ".3"); !os.IsNotExist(err) {
+		t.Errorf("expected no third rotated file, got %v", err)
+	}
+	if got := file.Paths(); !slices.Equal(got, []string{path, path + ".1", path + ".2"}) {
+		t.Errorf("Paths() = %v", got)
+	}
+
+	// An existing file is appended to after a restart
+	file.Close()
+	file = Open(path, 100, 2)
+	file.Write([]byte("six\n"))
+	if data, _ := os.ReadFile(path); string(data) != "four\nfive\nsix\n" {
+		t.Errorf("reopened file = %q", data)
+	}
+}
@@ -0,0 +1,177 @@
+// Package simnet simulates a network segment for tests. Its hosts answer
+// pings and accept connections while they are up, and boot a configurable
+// time after a magic packet for their MAC address arrives. Time is read from
+// a clock, so with a virtual clock the boot happens when the test advances
+// it.
+package simnet
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"slices"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/tsolodov/wot/clock"
+	"github.com/tsolodov/wot/probe"
+	"github.com/tsolodov/wot/wol"
+)
+
+// Network implements probe.Pinger, probe.Dialer and wol.PacketSender on top
+// of its simulated hosts.
+type Network struct {
+	clock clock.Clock
+
+	mutex   sync.Mutex
+	hosts   map[string]*Host
+	packets []net.HardwareAddr
+}
+
+// Host is a simulated machine on the network.
+type Host struct {
+	network *Network
+	address string
+	mac     net.HardwareAddr
+
+	// BootDelay is how long after a magic packet the host comes up; Ports
+	// are the TCP ports it accepts connections on; NoPing makes it ignore
+	// pings. Set them before the host is probed.
+	BootDelay time.Duration
+	Ports     []int
+	NoPing    bool
+
+	up     bool
+	bootAt time.Time
+}
+
+// New returns an empty network that tells the time by clk.
+func New(clk clock.Clock) *Network {
+	return &Network{clock: clk, hosts: make(map[string]*Host)}
+}
+
+// AddHost adds a powered-off host with the given address and MAC address.
+func (n *Network) AddHost(address, mac string) *Host {
+	hardware, err := wol.ParseMAC(mac)
+	if err != nil {
+		panic(fmt.Sprintf("simnet: %v", err))
+	}
+	host := &Host{network: n, address: address, mac: hardware}
+	n.mutex.Lock()
+	defer n.mutex.Unlock()
+	n.hosts[address] = host
+	return host
+}
+
+// Prober returns a probe.Prober for the simulated hosts.
+func (n *Network) Prober() probe.Prober {
+	return probe.Prober{Pinger: n, Dialer: n}
+}
+
+// PowerOn brings the host up immediately.
+func (h *Host) PowerOn() {
+	h.network.mutex.Lock()
+	defer h.network.mutex.Unlock()
+	h.up, h.bootAt = true, time.Time{}
+}
+
+// PowerOff shuts the host down, cancelling a boot in progress.
+func (h *Host) PowerOff() {
+	h.network.mutex.Lock()
+	defer h.network.mutex.Unlock()
+	h.up, h.bootAt = false, time.Time{}
+}
+
+// Up reports whether the host is running.
+func (h *Host) Up() bool {
+	h.network.mutex.Lock()
+	defer h.network.mutex.Unlock()
+	return h.running(h.network.clock.Now())
+}
+
+// running finishes a boot that is due. Callers must hold the network mutex.
+func (h *Host) running(now time.Time) bool {
+	if !h.bootAt.IsZero() && !now.Before(h.bootAt) {
+		h.up, h.bootAt = true, time.Time{}
+	}
+	return h.up
+}
+
+// Ping reports whether host is up and answers pings.
+func (n *Network) Ping(ctx context.Context, host string) bool {
+	if ctx.Err() != nil {
+		return false
+	}
+	n.mutex.Lock()
+	defer n.mutex.Unlock()
+	h, ok := n.hosts[host]
+	return ok && !h.NoPing && h.running(n.clock.Now())
+}
+
+// DialContext connects to a TCP port of a running host. The connection is
+// closed by the host right away.
+func (n *Network) DialContext(ctx context.Context, network, address string) (net.Conn, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	host, portText, err := net.SplitHostPort(address)
+	if err != nil {
+		return nil, err
+	}
+	port, err := strconv.Atoi(portText)
+	if err != nil {
+		return nil, fmt.Errorf("invalid port %q", portText)
+	}
+
+	n.mutex.Lock()
+	h, ok := n.hosts[host]
+	running := ok && h.running(n.clock.Now())
+	open := running && slices.Contains(h.Ports, port)
+	n.mutex.Unlock()
+
+	if !running {
+		return nil, &net.OpError{Op: "dial", Net: network, Err: errors.New("no route to host")}
+	}
+	if !open {
+		return nil, &net.OpError{Op: "dial", Net: network, Err: errors.New("connection refused")}
+	}
+	client, server := net.Pipe()
+	server.Close()
+	return client, nil
+}
+
+// SendPacket delivers a magic packet to every host with its MAC address,
+// wherever it was addressed to. Hosts that are down start booting.
+func (n *Network) SendPacket(ctx context.Context, address string, payload []byte) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	mac, err := wol.ParseMagicPacket(payload)
+	if err != nil {
+		return err
+	}
+
+	n.mutex.Lock()
+	defer n.mutex.Unlock()
+	n.packets = append(n.packets, mac)
+	now := n.clock.Now()
+	for _, h := range n.hosts {
+		if slices.Equal(h.mac, mac) && !h.running(now) && h.bootAt.IsZero() {
+			h.bootAt = now.Add(h.BootDelay)
+		}
+	}
+	return nil
+}
+
+// MagicPackets returns the MAC addresses of the magic packets sent so far.
+func (n *Network) MagicPackets() []string {
+	n.mutex.Lock()
+	defer n.mutex.Unlock()
+	macs := make([]string, len(n.packets))
+	for i, mac := range n.packets {
+		macs[i] = mac.String()
+	}
+	return macs
+}
@@ -0,0 +1,60 @@
+package simnet
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/tsolodov/wot/clock"
+	"github.com/tsolodov/wot/wol"
+)
+
+func TestHostBootsAfterMagicPacket(t *testing.T) {
+	ctx := context.Background()
+	clk := clock.NewVirtual(time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC))
+	network := New(clk)
+	nas := network.AddHost("192.168.1.10", "aa:bb:cc:dd:ee:01")
+	nas.BootDelay = 90 * time.Second
+	nas.Ports = []int{22}
+	network.AddHost("192.168.1.11", "aa:bb:cc:dd:ee:02").PowerOn()
+	prober := network.Prober()
+
+	if prober.Host(ctx, "192.168.1.10", nil) {
+		t.Fatal("powered-off host is up")
+	}
+	if err := wol.SendVia(ctx, network, "aa:bb:cc:dd:ee:01", ""); err != nil {
+		t.Fatal(err)
+	}
+	clk.Advance(time.Minute)
+	if nas.Up() {
+		t.Fatal("host came up before its boot delay")
+	}
+	clk.Advance(30 * time.Second)
+	if !network.Ping(ctx, "192.168.1.10") || !prober.TCP(ctx, "192.168.1.10", []int{80, 22}) {
+		t.Error("booted host does not answer")
+	}
+	if prober.TCP(ctx, "192.168.1.10", []int{80}) {
+		t.Error("closed port accepted a connection")
+	}
+	if !prober.Host(ctx, "192.168.1.11", nil) || prober.Host(ctx, "192.168.1.12", nil) {
+		t.Error("wrong status for the other hosts")
+	}
+
+	// Only hosts that are down are booted by a packet
+	nas.PowerOff()
+	nas.NoPing = true
+	if err := wol.SendVia(ctx, network, "aa:bb:cc:dd:ee:01", "192.168.1.255"); err != nil {
+		t.Fatal(err)
+	}
+	clk.Advance(nas.BootDelay)
+	if network.Ping(ctx, "192.168.1.10") || !prober.TCP(ctx, "192.168.1.10", []int{22}) {
+		t.Error("host ignoring pings did not boot")
+	}
+	if got := network.MagicPackets(); len(got) != 2 || got[0] != "aa:bb:cc:dd:ee:01" {
+		t.Errorf("magic packets %v", got)
+	}
+
+	if err := network.SendPacket(ctx, "192.168.1.255:9", []byte("hello")); err == nil {
+		t.Error("accepted a packet that is not a magic packet")
+	}
+}
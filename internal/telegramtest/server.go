@@ -0,0 +1,925 @@
+// Package telegramtest provides a fake Telegram Bot API server. Messages
+// queued with SendText and PressButton reach the bot through getUpdates, and
+// everything the bot sends is recorded, so command flows can be driven
+// end-to-end without a network or a real bot token.
+//
+// The server implements getMe, getUpdates, sendMessage, editMessageText,
+// answerCallbackQuery, answerInlineQuery, leaveChat, getChatMember, the
+// command menu and the webhook methods. Like Telegram, it rejects
+// legacy Markdown whose entities are not closed, and while a webhook is set
+// it posts updates there instead of returning them from getUpdates.
+package telegramtest
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+// BotUser is the account getMe reports.
+var BotUser = tgbotapi.User{ID: 1000, IsBot: true, FirstName: "WoT", UserName: "wot_test_bot"}
+
+const (
+	// maxPollTimeout caps how long getUpdates waits for updates
+	maxPollTimeout = 60 * time.Second
+	// webhookTimeout bounds each delivery to the webhook, and failed
+	// deliveries are retried after webhookRetryDelay
+	webhookTimeout    = 10 * time.Second
+	webhookRetryDelay = 100 * time.Millisecond
+)
+
+// Message is a message sent by the bot.
+type Message struct {
+	ID        int
+	ChatID    int64
+	Text      string
+	ParseMode string
+	// ThreadID is the forum topic the message was posted in, given
+	// explicitly or taken from the message it replies to
+	ThreadID int
+	ReplyTo  int
+	// Buttons are the inline keyboard rows
+	Buttons [][]Button
+	// Edits counts editMessageText calls for the message
+	Edits int
+}
+
+// Button is an inline keyboard button.
+type Button struct {
+	Text string
+	Data string
+}
+
+// Incoming is a message from a user to the bot.
+type Incoming struct {
+	ChatID int64
+	// ChatType is "private" if empty; groups are "group" or "supergroup"
+	ChatType string
+	// ThreadID is the forum topic of a supergroup the message is posted in
+	ThreadID int
+	// UserID is the sender, the same as ChatID if zero
+	UserID   int64
+	Username string
+	Text     string
+}
+
+// CallbackAnswer is an answerCallbackQuery call.
+type CallbackAnswer struct {
+	QueryID string
+	Text    string
+}
+
+// InlineAnswer is an answerInlineQuery call.
+type InlineAnswer struct {
+	QueryID string
+	Results []InlineResult
+}
+
+// InlineResult is an article offered as an inline query result.
+type InlineResult struct {
+	ID          string
+	Title       string
+	Description string
+	// Text is the message sent to the chat when the result is chosen
+	Text string
+}
+
+// Server is a fake Bot API for a single bot. It is an http.Handler; serve it
+// with httptest.NewServer or http.Server and point the bot's API endpoint at
+// it.
+type Server struct {
+	// Token is the only bot token accepted. Any token is accepted if empty.
+	Token string
+	// OnMessage is called for every message the bot sends or edits. It must
+	// be set before the server is used.
+	OnMessage func(Message)
+
+	mutex       sync.Mutex
+	updates     []tgbotapi.Update
+	nextUpdate  int
+	nextMessage int
+	nextQuery   int
+	messages    []Message
+	answers     []CallbackAnswer
+	inline      []InlineAnswer
+	left        []int64
+	// members are the statuses set with SetMemberStatus, by chat and user
+	members map[[2]int64]string
+	// commands are the command menus by scope, see scopeKey
+	commands map[string][]tgbotapi.BotCommand
+	// threads are the forum topics of incoming messages, by chat and ID
+	threads map[[2]int64]int
+	closed  bool
+	webhook *webhook
+	// changed is closed and replaced whenever something happens, to wake
+	// pending getUpdates calls and waiters
+	changed chan struct{}
+}
+
+// webhook is where updates are pushed while one is set.
+type webhook struct {
+	url    string
+	secret string
+	client *http.Client
+	// lastError describes the last failed delivery, as getWebhookInfo does
+	lastError string
+}
+
+func NewServer(token string) *Server {
+	return &Server{Token: token, nextUpdate: 1, nextMessage: 1, threads: make(map[[2]int64]int), members: make(map[[2]int64]string), commands: make(map[string][]tgbotapi.BotCommand), changed: make(chan struct{})}
+}
+
+// Close ends pending getUpdates calls and makes further ones return at once,
+// so an HTTP server in front of it can shut down without waiting for long
+// polls to time out.
+func (s *Server) Close() {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.closed = true
+	s.notify()
+}
+
+// notify wakes everything waiting for a change. Callers must hold s.mutex.
+func (s *Server) notify() {
+	close(s.changed)
+	s.changed = make(chan struct{})
+}
+
+// SendText delivers text to the bot as a message from the user in the
+// private chat chatID and returns the message ID.
+func (s *Server) SendText(chatID int64, username, text string) int {
+	return s.Send(Incoming{ChatID: chatID, Username: username, Text: text})
+}
+
+// Send delivers a message to the bot and returns its ID. A leading command
+// gets a bot_command entity, as Telegram adds.
+func (s *Server) Send(in Incoming) int {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if in.ChatType == "" {
+		in.ChatType = "private"
+	}
+	if in.UserID == 0 {
+		in.UserID = in.ChatID
+	}
+	chat := &tgbotapi.Chat{ID: in.ChatID, Type: in.ChatType}
+	if in.ChatType == "private" {
+		chat.UserName = in.Username
+	} else {
+		chat.Title = "WoT group"
+	}
+	message := &tgbotapi.Message{
+		MessageID: s.nextMessage,
+		From:      &tgbotapi.User{ID: in.UserID, FirstName: in.Username, UserName: in.Username},
+		Date:      int(time.Now().Unix()),
+		Chat:      chat,
+		Text:      in.Text,
+	}
+	if strings.HasPrefix(in.Text, "/") {
+		command, _, _ := strings.Cut(in.Text, " ")
+		message.Entities = []tgbotapi.MessageEntity{{Type: "bot_command", Offset: 0, Length: len(command)}}
+	}
+	s.nextMessage++
+	if in.ThreadID != 0 {
+		s.threads[[2]int64{in.ChatID, int64(message.MessageID)}] = in.ThreadID
+	}
+	s.queue(tgbotapi.Update{Message: message})
+	return message.MessageID
+}
+
+// AddToChat delivers the my_chat_member update Telegram sends when the user
+// adds the bot to a group.
+func (s *Server) AddToChat(chatID int64, chatType string, userID int64, username string) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	bot := BotUser
+	s.queue(tgbotapi.Update{MyChatMember: &tgbotapi.ChatMemberUpdated{
+		Chat:          tgbotapi.Chat{ID: chatID, Type: chatType, Title: "WoT group"},
+		From:          tgbotapi.User{ID: userID, FirstName: username, UserName: username},
+		Date:          int(time.Now().Unix()),
+		OldChatMember: tgbotapi.ChatMember{User: &bot, Status: "left"},
+		NewChatMember: tgbotapi.ChatMember{User: &bot, Status: "member"},
+	}})
+}
+
+// SetMemberStatus sets the status getChatMember reports for a user of a
+// chat, such as "administrator" or "creator". Users are "member" otherwise.
+func (s *Server) SetMemberStatus(chatID, userID int64, status string) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.members[[2]int64{chatID, userID}] = status
+}
+
+// LeftChats returns the chats the bot has left.
+func (s *Server) LeftChats() []int64 {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return append([]int64(nil), s.left...)
+}
+
+// PressButton delivers a press of the inline keyboard button with callback
+// data to the bot, as if the user in chatID pressed it on the most recent
+// message that has it. It returns the callback query ID.
+func (s *Server) PressButton(chatID int64, username, data string) (string, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	for i := len(s.messages) - 1; i >= 0; i-- {
+		message := s.messages[i]
+		if message.ChatID != chatID || !hasButton(message, data) {
+			continue
+		}
+
+		s.nextQuery++
+		id := strconv.Itoa(s.nextQuery)
+		from := &tgbotapi.User{ID: chatID, FirstName: username, UserName: username}
+		s.queue(tgbotapi.Update{CallbackQuery: &tgbotapi.CallbackQuery{
+			ID:   id,
+			From: from,
+			Message: &tgbotapi.Message{
+				MessageID: message.ID,
+				From:      &BotUser,
+				Chat:      &tgbotapi.Chat{ID: chatID, Type: "private", UserName: username},
+				Text:      message.Text,
+			},
+			Data: data,
+		}})
+		return id, nil
+	}
+	return "", fmt.Errorf("no message in chat %d has a button with data %q", chatID, data)
+}
+
+// SendInlineQuery delivers an inline query, as typed after the bot's name
+// by the user, and returns its ID.
+func (s *Server) SendInlineQuery(userID int64, username, query string) string {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	s.nextQuery++
+	id := strconv.Itoa(s.nextQuery)
+	s.queue(tgbotapi.Update{InlineQuery: &tgbotapi.InlineQuery{
+		ID:       id,
+		From:     &tgbotapi.User{ID: userID, FirstName: username, UserName: username},
+		Query:    query,
+		ChatType: "sender",
+	}})
+	return id
+}
+
+func hasButton(message Message, data string) bool {
+	for _, row := range message.Buttons {
+		for _, button := range row {
+			if button.Data == data {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// queue adds an update for getUpdates. Callers must hold s.mutex.
+func (s *Server) queue(update tgbotapi.Update) {
+	update.UpdateID = s.nextUpdate
+	s.nextUpdate++
+	s.updates = append(s.updates, update)
+	s.notify()
+}
+
+// Messages returns the messages the bot has sent so far.
+func (s *Server) Messages() []Message {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return append([]Message(nil), s.messages...)
+}
+
+// Answers returns the callback queries the bot has answered so far.
+func (s *Server) Answers() []CallbackAnswer {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return append([]CallbackAnswer(nil), s.answers...)
+}
+
+// InlineAnswers returns the inline queries the bot has answered so far.
+func (s *Server) InlineAnswers() []InlineAnswer {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return append([]InlineAnswer(nil), s.inline...)
+}
+
+// Commands returns the command menu the bot registered for scope.
+func (s *Server) Commands(scope tgbotapi.BotCommandScope) []tgbotapi.BotCommand {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return s.commands[scopeKey(scope)]
+}
+
+// WaitForMessages waits until the bot has sent at least count messages and
+// returns all of them, or fails after timeout.
+func (s *Server) WaitForMessages(count int, timeout time.Duration) ([]Message, error) {
+	return s.wait(timeout, func() bool { return len(s.messages) >= count }, func() error {
+		return fmt.Errorf("expected %d messages, got %d", count, len(s.messages))
+	})
+}
+
+// WaitForAnswers waits until the bot has answered at least count callback
+// queries and returns all answers, or fails after timeout.
+func (s *Server) WaitForAnswers(count int, timeout time.Duration) ([]CallbackAnswer, error) {
+	_, err := s.wait(timeout, func() bool { return len(s.answers) >= count }, func() error {
+		return fmt.Errorf("expected %d callback answers, got %d", count, len(s.answers))
+	})
+	return s.Answers(), err
+}
+
+// WaitForInlineAnswers waits until the bot has answered at least count
+// inline queries and returns all answers, or fails after timeout.
+func (s *Server) WaitForInlineAnswers(count int, timeout time.Duration) ([]InlineAnswer, error) {
+	_, err := s.wait(timeout, func() bool { return len(s.inline) >= count }, func() error {
+		return fmt.Errorf("expected %d inline answers, got %d", count, len(s.inline))
+	})
+	return s.InlineAnswers(), err
+}
+
+func (s *Server) wait(timeout time.Duration, done func() bool, failure func() error) ([]Message, error) {
+	deadline := time.After(timeout)
+	for {
+		s.mutex.Lock()
+		if done() {
+			messages := append([]Message(nil), s.messages...)
+			s.mutex.Unlock()
+			return messages, nil
+		}
+		changed := s.changed
+		s.mutex.Unlock()
+
+		select {
+		case <-changed:
+		case <-deadline:
+			s.mutex.Lock()
+			defer s.mutex.Unlock()
+			return append([]Message(nil), s.messages...), failure()
+		}
+	}
+}
+
+// apiError is returned to the bot as an unsuccessful API response.
+type apiError struct {
+	code        int
+	description string
+}
+
+func (e *apiError) Error() string { return e.description }
+
+func badRequest(format string, args ...any) *apiError {
+	return &apiError{code: http.StatusBadRequest, description: "Bad Request: " + fmt.Sprintf(format, args...)}
+}
+
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	token, method, ok := strings.Cut(strings.TrimPrefix(r.URL.Path, "/bot"), "/")
+	if !ok || !strings.HasPrefix(r.URL.Path, "/bot") {
+		writeResponse(w, nil, &apiError{code: http.StatusNotFound, description: "Not Found"})
+		return
+	}
+	if s.Token != "" && token != s.Token {
+		writeResponse(w, nil, &apiError{code: http.StatusUnauthorized, description: "Unauthorized"})
+		return
+	}
+	if err := r.ParseMultipartForm(1 << 20); err != nil && !errors.Is(err, http.ErrNotMultipart) {
+		writeResponse(w, nil, badRequest("%v", err))
+		return
+	}
+
+	var result any
+	var err error
+	switch method {
+	case "getMe":
+		result = BotUser
+	case "getUpdates":
+		result, err = s.getUpdates(r)
+	case "sendMessage":
+		result, err = s.sendMessage(r)
+	case "editMessageText":
+		result, err = s.editMessageText(r)
+	case "answerCallbackQuery":
+		result, err = s.answerCallbackQuery(r)
+	case "answerInlineQuery":
+		result, err = s.answerInlineQuery(r)
+	case "leaveChat":
+		result, err = s.leaveChat(r)
+	case "getChatMember":
+		result, err = s.getChatMember(r)
+	case "setMyCommands":
+		result, err = s.setMyCommands(r)
+	case "deleteMyCommands":
+		result, err = s.deleteMyCommands(r)
+	case "setWebhook":
+		result, err = s.setWebhook(r)
+	case "deleteWebhook":
+		result, err = s.deleteWebhook(r)
+	case "getWebhookInfo":
+		result = s.webhookInfo()
+	default:
+		err = &apiError{code: http.StatusNotFound, description: "Not Found: method not found"}
+	}
+	writeResponse(w, result, err)
+}
+
+func writeResponse(w http.ResponseWriter, result any, err error) {
+	response := tgbotapi.APIResponse{Ok: err == nil}
+	status := http.StatusOK
+	if err != nil {
+		apiErr, ok := err.(*apiError)
+		if !ok {
+			apiErr = badRequest("%v", err)
+		}
+		status = apiErr.code
+		response.ErrorCode = apiErr.code
+		response.Description = apiErr.description
+	} else {
+		response.Result, _ = json.Marshal(result)
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(response)
+}
+
+// getUpdates confirms the updates before offset and returns the remaining
+// ones, waiting up to the requested timeout for new ones to arrive.
+func (s *Server) getUpdates(r *http.Request) ([]tgbotapi.Update, error) {
+	offset, _ := strconv.Atoi(r.Form.Get("offset"))
+	limit, _ := strconv.Atoi(r.Form.Get("limit"))
+	seconds, _ := strconv.Atoi(r.Form.Get("timeout"))
+	timeout := min(time.Duration(seconds)*time.Second, maxPollTimeout)
+	deadline := time.After(timeout)
+
+	for {
+		s.mutex.Lock()
+		if s.webhook != nil {
+			s.mutex.Unlock()
+			return nil, &apiError{code: http.StatusConflict, description: "Conflict: can't use getUpdates method while webhook is active; use deleteWebhook to delete the webhook first"}
+		}
+		for len(s.updates) > 0 && s.updates[0].UpdateID < offset {
+			s.updates = s.updates[1:]
+		}
+		if len(s.updates) > 0 || s.closed {
+			updates := s.updates
+			if limit > 0 && len(updates) > limit {
+				updates = updates[:limit]
+			}
+			updates = append([]tgbotapi.Update{}, updates...)
+			s.mutex.Unlock()
+			return updates, nil
+		}
+		changed := s.changed
+		s.mutex.Unlock()
+
+		select {
+		case <-changed:
+		case <-deadline:
+			return []tgbotapi.Update{}, nil
+		case <-r.Context().Done():
+			return []tgbotapi.Update{}, nil
+		}
+	}
+}
+
+// Webhook returns the URL updates are pushed to, or "" without a webhook.
+func (s *Server) Webhook() string {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if s.webhook == nil {
+		return ""
+	}
+	return s.webhook.url
+}
+
+// setWebhook starts pushing updates to the given HTTPS URL. An uploaded
+// certificate is trusted for it, as Telegram does for self-signed ones.
+func (s *Server) setWebhook(r *http.Request) (bool, error) {
+	url := r.Form.Get("url")
+	if !strings.HasPrefix(url, "https://") {
+		return false, badRequest("bad webhook: An HTTPS URL must be provided for webhook")
+	}
+
+	client := &http.Client{Timeout: webhookTimeout}
+	if file, _, err := r.FormFile("certificate"); err == nil {
+		defer file.Close()
+		pem, _ := io.ReadAll(file)
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return false, badRequest("bad webhook: Failed to parse the certificate")
+		}
+		client.Transport = &http.Transport{TLSClientConfig: &tls.Config{RootCAs: pool}}
+	}
+
+	hook := &webhook{url: url, secret: r.Form.Get("secret_token"), client: client}
+	s.mutex.Lock()
+	s.webhook = hook
+	s.notify()
+	s.mutex.Unlock()
+
+	go s.pushUpdates(hook)
+	return true, nil
+}
+
+func (s *Server) deleteWebhook(r *http.Request) (bool, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.webhook = nil
+	if r.Form.Get("drop_pending_updates") == "true" {
+		s.updates = nil
+	}
+	s.notify()
+	return true, nil
+}
+
+func (s *Server) webhookInfo() tgbotapi.WebhookInfo {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	info := tgbotapi.WebhookInfo{PendingUpdateCount: len(s.updates)}
+	if s.webhook != nil {
+		info.URL = s.webhook.url
+		info.LastErrorMessage = s.webhook.lastError
+	}
+	return info
+}
+
+// pushUpdates posts queued updates to hook one at a time until the webhook
+// is replaced or deleted. An update stays queued until the bot answers with
+// a 2xx status.
+func (s *Server) pushUpdates(hook *webhook) {
+	for {
+		s.mutex.Lock()
+		if s.closed || s.webhook != hook {
+			s.mutex.Unlock()
+			return
+		}
+		if len(s.updates) == 0 {
+			changed := s.changed
+			s.mutex.Unlock()
+			<-changed
+			continue
+		}
+		update := s.updates[0]
+		s.mutex.Unlock()
+
+		err := hook.post(update)
+
+		s.mutex.Lock()
+		if err != nil {
+			hook.lastError = err.Error()
+		} else if len(s.updates) > 0 && s.updates[0].UpdateID == update.UpdateID {
+			s.updates = s.updates[1:]
+			s.notify()
+		}
+		changed := s.changed
+		s.mutex.Unlock()
+
+		if err != nil {
+			select {
+			case <-changed:
+			case <-time.After(webhookRetryDelay):
+			}
+		}
+	}
+}
+
+func (hook *webhook) post(update tgbotapi.Update) error {
+	body, err := json.Marshal(update)
+	if err != nil {
+		return err
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), webhookTimeout)
+	defer cancel()
+	request, err := http.NewRequestWithContext(ctx, http.MethodPost, hook.url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	request.Header.Set("Content-Type", "application/json")
+	if hook.secret != "" {
+		request.Header.Set("X-Telegram-Bot-Api-Secret-Token", hook.secret)
+	}
+	response, err := hook.client.Do(request)
+	if err != nil {
+		return err
+	}
+	response.Body.Close()
+	if response.StatusCode/100 != 2 {
+		return fmt.Errorf("Wrong response from the webhook: %s", response.Status)
+	}
+	return nil
+}
+
+func (s *Server) sendMessage(r *http.Request) (*tgbotapi.Message, error) {
+	chatID, err := strconv.ParseInt(r.Form.Get("chat_id"), 10, 64)
+	if err != nil {
+		return nil, badRequest("chat not found")
+	}
+	message := Message{ChatID: chatID, Text: r.Form.Get("text"), ParseMode: r.Form.Get("parse_mode")}
+	if err := checkText(message.Text, message.ParseMode); err != nil {
+		return nil, err
+	}
+	if message.Buttons, err = parseKeyboard(r.Form.Get("reply_markup")); err != nil {
+		return nil, err
+	}
+	message.ThreadID, _ = strconv.Atoi(r.Form.Get("message_thread_id"))
+	message.ReplyTo, _ = strconv.Atoi(r.Form.Get("reply_to_message_id"))
+
+	s.mutex.Lock()
+	if thread, ok := s.threads[[2]int64{chatID, int64(message.ReplyTo)}]; ok && message.ThreadID == 0 {
+		message.ThreadID = thread
+	}
+	message.ID = s.nextMessage
+	s.nextMessage++
+	if message.ThreadID != 0 {
+		s.threads[[2]int64{chatID, int64(message.ID)}] = message.ThreadID
+	}
+	s.messages = append(s.messages, message)
+	s.notify()
+	s.mutex.Unlock()
+
+	s.sent(message)
+	return botMessage(message), nil
+}
+
+func (s *Server) editMessageText(r *http.Request) (*tgbotapi.Message, error) {
+	chatID, _ := strconv.ParseInt(r.Form.Get("chat_id"), 10, 64)
+	messageID, _ := strconv.Atoi(r.Form.Get("message_id"))
+	text, parseMode := r.Form.Get("text"), r.Form.Get("parse_mode")
+	if err := checkText(text, parseMode); err != nil {
+		return nil, err
+	}
+	buttons, err := parseKeyboard(r.Form.Get("reply_markup"))
+	if err != nil {
+		return nil, err
+	}
+
+	s.mutex.Lock()
+	var edited *Message
+	for i := range s.messages {
+		if s.messages[i].ChatID == chatID && s.messages[i].ID == messageID {
+			edited = &s.messages[i]
+		}
+	}
+	if edited == nil {
+		s.mutex.Unlock()
+		return nil, badRequest("message to edit not found")
+	}
+	if edited.Text == text && edited.ParseMode == parseMode {
+		s.mutex.Unlock()
+		return nil, badRequest("message is not modified")
+	}
+	edited.Text, edited.ParseMode, edited.Buttons = text, parseMode, buttons
+	edited.Edits++
+	message := *edited
+	s.notify()
+	s.mutex.Unlock()
+
+	s.sent(message)
+	return botMessage(message), nil
+}
+
+func (s *Server) answerCallbackQuery(r *http.Request) (bool, error) {
+	id := r.Form.Get("callback_query_id")
+	if id == "" {
+		return false, badRequest("query is too old and response timeout expired or query ID is invalid")
+	}
+
+	s.mutex.Lock()
+	s.answers = append(s.answers, CallbackAnswer{QueryID: id, Text: r.Form.Get("text")})
+	s.notify()
+	s.mutex.Unlock()
+	return true, nil
+}
+
+func (s *Server) answerInlineQuery(r *http.Request) (bool, error) {
+	id := r.Form.Get("inline_query_id")
+	if id == "" {
+		return false, badRequest("query is too old and response timeout expired or query ID is invalid")
+	}
+	var results []struct {
+		Type                string `json:"type"`
+		ID                  string `json:"id"`
+		Title               string `json:"title"`
+		Description         string `json:"description"`
+		InputMessageContent struct {
+			MessageText string `json:"message_text"`
+		} `json:"input_message_content"`
+	}
+	if err := json.Unmarshal([]byte(r.Form.Get("results")), &results); err != nil || results == nil {
+		return false, badRequest("can't parse inline query results JSON object")
+	}
+	if len(results) > 50 {
+		return false, badRequest("RESULTS_TOO_MUCH")
+	}
+
+	answer := InlineAnswer{QueryID: id}
+	for _, result := range results {
+		if result.Type != "article" || result.ID == "" || len(result.ID) > 64 || result.Title == "" {
+			return false, badRequest("RESULT_ID_INVALID")
+		}
+		if err := checkText(result.InputMessageContent.MessageText, ""); err != nil {
+			return false, err
+		}
+		answer.Results = append(answer.Results, InlineResult{
+			ID:          result.ID,
+			Title:       result.Title,
+			Description: result.Description,
+			Text:        result.InputMessageContent.MessageText,
+		})
+	}
+
+	s.mutex.Lock()
+	s.inline = append(s.inline, answer)
+	s.notify()
+	s.mutex.Unlock()
+	return true, nil
+}
+
+// scopeKey identifies a command menu scope.
+func scopeKey(scope tgbotapi.BotCommandScope) string {
+	if scope.Type == "" {
+		scope.Type = "default"
+	}
+	return fmt.Sprintf("%s:%d:%d", scope.Type, scope.ChatID, scope.UserID)
+}
+
+func formScope(r *http.Request) (string, error) {
+	var scope tgbotapi.BotCommandScope
+	if value := r.Form.Get("scope"); value != "" {
+		if err := json.Unmarshal([]byte(value), &scope); err != nil {
+			return "", badRequest("can't parse BotCommandScope JSON object")
+		}
+	}
+	return scopeKey(scope), nil
+}
+
+func (s *Server) setMyCommands(r *http.Request) (bool, error) {
+	key, err := formScope(r)
+	if err != nil {
+		return false, err
+	}
+	var commands []tgbotapi.BotCommand
+	if err := json.Unmarshal([]byte(r.Form.Get("commands")), &commands); err != nil {
+		return false, badRequest("can't parse commands JSON object")
+	}
+	for _, command := range commands {
+		if command.Command == "" || len(command.Command) > 32 || strings.ToLower(command.Command) != command.Command {
+			return false, badRequest("BOT_COMMAND_INVALID")
+		}
+		if len(command.Description) < 1 || len(command.Description) > 256 {
+			return false, badRequest("BOT_COMMAND_DESCRIPTION_INVALID")
+		}
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.commands[key] = commands
+	return true, nil
+}
+
+func (s *Server) deleteMyCommands(r *http.Request) (bool, error) {
+	key, err := formScope(r)
+	if err != nil {
+		return false, err
+	}
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	delete(s.commands, key)
+	return true, nil
+}
+
+func (s *Server) leaveChat(r *http.Request) (bool, error) {
+	chatID, err := strconv.ParseInt(r.Form.Get("chat_id"), 10, 64)
+	if err != nil {
+		return false, badRequest("chat not found")
+	}
+	s.mutex.Lock()
+	s.left = append(s.left, chatID)
+	s.notify()
+	s.mutex.Unlock()
+	return true, nil
+}
+
+func (s *Server) getChatMember(r *http.Request) (tgbotapi.ChatMember, error) {
+	chatID, err := strconv.ParseInt(r.Form.Get("chat_id"), 10, 64)
+	if err != nil {
+		return tgbotapi.ChatMember{}, badRequest("chat not found")
+	}
+	userID, err := strconv.ParseInt(r.Form.Get("user_id"), 10, 64)
+	if err != nil {
+		return tgbotapi.ChatMember{}, badRequest("user not found")
+	}
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	status, ok := s.members[[2]int64{chatID, userID}]
+	if !ok {
+		status = "member"
+	}
+	return tgbotapi.ChatMember{User: &tgbotapi.User{ID: userID}, Status: status}, nil
+}
+
+func (s *Server) sent(message Message) {
+	if s.OnMessage != nil {
+		s.OnMessage(message)
+	}
+}
+
+func botMessage(message Message) *tgbotapi.Message {
+	return &tgbotapi.Message{
+		MessageID: message.ID,
+		From:      &BotUser,
+		Date:      int(time.Now().Unix()),
+		Chat:      &tgbotapi.Chat{ID: message.ChatID, Type: "private"},
+		Text:      message.Text,
+	}
+}
+
+func parseKeyboard(markup string) ([][]Button, error) {
+	if markup == "" {
+		return nil, nil
+	}
+	var keyboard tgbotapi.InlineKeyboardMarkup
+	if err := json.Unmarshal([]byte(markup), &keyboard); err != nil {
+		return nil, badRequest("can't parse reply keyboard markup JSON object")
+	}
+
+	var rows [][]Button
+	for _, row := range keyboard.InlineKeyboard {
+		var buttons []Button
+		for _, button := range row {
+			data := ""
+			if button.CallbackData != nil {
+				data = *button.CallbackData
+			}
+			if len(data) > 64 {
+				return nil, badRequest("BUTTON_DATA_INVALID")
+			}
+			buttons = append(buttons, Button{Text: button.Text, Data: data})
+		}
+		rows = append(rows, buttons)
+	}
+	return rows, nil
+}
+
+func checkText(text, parseMode string) error {
+	if strings.TrimSpace(text) == "" {
+		return badRequest("message text is empty")
+	}
+	if len([]rune(text)) > 4096 {
+		return badRequest("message is too long")
+	}
+	if parseMode == tgbotapi.ModeMarkdown {
+		if err := checkMarkdown(text); err != nil {
+			return badRequest("can't parse entities: %v", err)
+		}
+	}
+	return nil
+}
+
+// checkMarkdown checks that every *bold*, _italic_, `code` and ```pre```
+// entity of legacy Markdown is closed. Entities do not nest, and characters
+// can be escaped with a backslash outside of code.
+func checkMarkdown(text string) error {
+	var open string
+	openAt := 0
+	for i := 0; i < len(text); i++ {
+		switch {
+		case open == "```":
+			if strings.HasPrefix(text[i:], "```") {
+				open, i = "", i+2
+			}
+		case open == "`":
+			if text[i] == '`' {
+				open = ""
+			}
+		case text[i] == '\\':
+			i++
+		case open != "":
+			if text[i] == open[0] {
+				open = ""
+			}
+		case strings.HasPrefix(text[i:], "```"):
+			open, openAt, i = "```", i, i+2
+		case text[i] == '`' || text[i] == '*' || text[i] == '_':
+			open, openAt = text[i:i+1], i
+		}
+	}
+	if open != "" {
+		return fmt.Errorf("can't find end of the entity starting at byte offset %d", openAt)
+	}
+	return nil
+}
@@ -0,0 +1,206 @@
+package telegramtest
+
+import (
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+func startServer(t *testing.T, token string) (*Server, *tgbotapi.BotAPI) {
+	t.Helper()
+	fake := NewServer(token)
+	ts := httptest.NewServer(fake)
+	t.Cleanup(func() {
+		fake.Close()
+		ts.Close()
+	})
+
+	bot, err := tgbotapi.NewBotAPIWithAPIEndpoint("123:secret", ts.URL+"/bot%s/%s")
+	if err != nil {
+		t.Fatalf("NewBotAPI: %v", err)
+	}
+	return fake, bot
+}
+
+func TestServerMessages(t *testing.T) {
+	fake, bot := startServer(t, "123:secret")
+	if bot.Self.UserName != BotUser.UserName {
+		t.Errorf("getMe returned %+v", bot.Self)
+	}
+
+	fake.SendText(42, "alice", "/status")
+	updates, err := bot.GetUpdates(tgbotapi.UpdateConfig{Timeout: 1})
+	if err != nil || len(updates) != 1 {
+		t.Fatalf("getUpdates: %v %+v", err, updates)
+	}
+	message := updates[0].Message
+	if message.Text != "/status" || !message.IsCommand() || message.Chat.ID != 42 || message.From.UserName != "alice" {
+		t.Errorf("unexpected message %+v", message)
+	}
+
+	// Confirmed updates are not returned again
+	updates, err = bot.GetUpdates(tgbotapi.UpdateConfig{Offset: updates[0].UpdateID + 1})
+	if err != nil || len(updates) != 0 {
+		t.Errorf("confirmed update returned again: %v %+v", err, updates)
+	}
+
+	reply := tgbotapi.NewMessage(42, "*nas* is UP")
+	reply.ParseMode = tgbotapi.ModeMarkdown
+	reply.ReplyMarkup = tgbotapi.NewInlineKeyboardMarkup(tgbotapi.NewInlineKeyboardRow(
+		tgbotapi.NewInlineKeyboardButtonData("Wake", "wake:nas"),
+	))
+	sent, err := bot.Send(reply)
+	if err != nil {
+		t.Fatalf("sendMessage: %v", err)
+	}
+	edit := tgbotapi.NewEditMessageText(42, sent.MessageID, "*nas* is DOWN")
+	edit.ParseMode = tgbotapi.ModeMarkdown
+	if _, err := bot.Send(edit); err != nil {
+		t.Fatalf("editMessageText: %v", err)
+	}
+	messages := fake.Messages()
+	if len(messages) != 1 || messages[0].Text != "*nas* is DOWN" || messages[0].Edits != 1 {
+		t.Errorf("unexpected messages %+v", messages)
+	}
+
+	// Unclosed Markdown entities are rejected like Telegram does
+	broken := tgbotapi.NewMessage(42, "*k8s_master is UP")
+	broken.ParseMode = tgbotapi.ModeMarkdown
+	_, err = bot.Send(broken)
+	var apiErr *tgbotapi.Error
+	if !errors.As(err, &apiErr) || apiErr.Code != 400 {
+		t.Errorf("expected a 400 for broken Markdown, got %v", err)
+	}
+}
+
+func TestServerButtons(t *testing.T) {
+	fake, bot := startServer(t, "")
+
+	if _, err := fake.PressButton(42, "alice", "wake:nas"); err == nil {
+		t.Error("pressed a button that was never sent")
+	}
+
+	reply := tgbotapi.NewMessage(42, "Wake nas?")
+	reply.ReplyMarkup = tgbotapi.NewInlineKeyboardMarkup(tgbotapi.NewInlineKeyboardRow(
+		tgbotapi.NewInlineKeyboardButtonData("Wake", "wake:nas"),
+	))
+	if _, err := bot.Send(reply); err != nil {
+		t.Fatal(err)
+	}
+	id, err := fake.PressButton(42, "alice", "wake:nas")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	updates, err := bot.GetUpdates(tgbotapi.UpdateConfig{Timeout: 1})
+	if err != nil || len(updates) != 1 || updates[0].CallbackQuery == nil {
+		t.Fatalf("getUpdates: %v %+v", err, updates)
+	}
+	query := updates[0].CallbackQuery
+	if query.ID != id || query.Data != "wake:nas" || query.Message.Text != "Wake nas?" {
+		t.Errorf("unexpected callback query %+v", query)
+	}
+
+	if _, err := bot.Request(tgbotapi.NewCallback(query.ID, "Waking nas")); err != nil {
+		t.Fatalf("answerCallbackQuery: %v", err)
+	}
+	answers, err := fake.WaitForAnswers(1, time.Second)
+	if err != nil || answers[0].Text != "Waking nas" {
+		t.Errorf("answers %+v: %v", answers, err)
+	}
+}
+
+func TestServerWebhook(t *testing.T) {
+	fake, bot := startServer(t, "")
+	received := make(chan tgbotapi.Update, 2)
+	failures := 1
+	hook := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("X-Telegram-Bot-Api-Secret-Token") != "s3cret" {
+			t.Errorf("secret token %q", r.Header.Get("X-Telegram-Bot-Api-Secret-Token"))
+		}
+		if failures > 0 {
+			failures--
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		var update tgbotapi.Update
+		json.NewDecoder(r.Body).Decode(&update)
+		received <- update
+	}))
+	defer hook.Close()
+
+	certificate := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: hook.Certificate().Raw})
+	params := tgbotapi.Params{"url": hook.URL + "/telegram", "secret_token": "s3cret"}
+	files := []tgbotapi.RequestFile{{Name: "certificate", Data: tgbotapi.FileBytes{Name: "hook.pem", Bytes: certificate}}}
+	if _, err := bot.UploadFiles("setWebhook", params, files); err != nil {
+		t.Fatalf("setWebhook: %v", err)
+	}
+	if fake.Webhook() != hook.URL+"/telegram" {
+		t.Errorf("webhook = %q", fake.Webhook())
+	}
+
+	// Updates are pushed, and retried until the bot accepts them
+	fake.SendText(42, "alice", "/status")
+	select {
+	case update := <-received:
+		if update.Message.Text != "/status" {
+			t.Errorf("pushed update %+v", update)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("update not pushed to the webhook")
+	}
+
+	var apiErr *tgbotapi.Error
+	if _, err := bot.GetUpdates(tgbotapi.UpdateConfig{}); !errors.As(err, &apiErr) || apiErr.Code != 409 {
+		t.Errorf("expected getUpdates to conflict with the webhook, got %v", err)
+	}
+	if _, err := bot.Request(tgbotapi.DeleteWebhookConfig{}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := bot.MakeRequest("setWebhook", tgbotapi.Params{"url": "http://insecure.example"}); err == nil {
+		t.Error("accepted a webhook without HTTPS")
+	}
+	if info, err := bot.GetWebhookInfo(); err != nil || info.URL != "" {
+		t.Errorf("webhook info %+v: %v", info, err)
+	}
+}
+
+func TestServerRejectsWrongToken(t *testing.T) {
+	fake := NewServer("456:other")
+	ts := httptest.NewServer(fake)
+	defer ts.Close()
+
+	_, err := tgbotapi.NewBotAPIWithAPIEndpoint("123:secret", ts.URL+"/bot%s/%s")
+	var apiErr *tgbotapi.Error
+	if !errors.As(err, &apiErr) || apiErr.Code != 401 {
+		t.Errorf("expected a 401, got %v", err)
+	}
+}
+
+func TestCheckMarkdown(t *testing.T) {
+	valid := []string{
+		"plain text",
+		`*k8s\_master* is now *UP*`,
+		"IP: `192.168.1_10`",
+		"```\n*not bold\n```",
+		"/wake [server] - Wake server(s)",
+	}
+	for _, text := range valid {
+		if err := checkMarkdown(text); err != nil {
+			t.Errorf("%q: %v", text, err)
+		}
+	}
+
+	invalid := []string{"*bold", "k8s_master", "`code", "```pre"}
+	for _, text := range invalid {
+		if err := checkMarkdown(text); err == nil {
+			t.Errorf("%q: expected an error", text)
+		}
+	}
+}
@@ -0,0 +1,467 @@
+// Package monitor periodically probes servers, tracks whether each is up and
+// reports changes. Probing, notifications and the event log are supplied by
+// the caller through small interfaces.
+package monitor
+
+import (
+	"context"
+	"log/slog"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/tsolodov/wot/clock"
+	"github.com/tsolodov/wot/config"
+)
+
+// A server coming up later than this after a wake is not attributed to it
+const wakeAttributionWindow = 30 * time.Minute
+
+// Prober checks a server. The address is empty if it could not be
+// determined; err is set only when the status is unknown, e.g. because a
+// host name does not resolve.
+type Prober interface {
+	Probe(ctx context.Context, server config.Server) (address string, up bool, err error)
+}
+
+// ProberFunc adapts a function to the Prober interface.
+type ProberFunc func(ctx context.Context, server config.Server) (string, bool, error)
+
+func (f ProberFunc) Probe(ctx context.Context, server config.Server) (string, bool, error) {
+	return f(ctx, server)
+}
+
+// Notifier announces status changes that are not silenced.
+type Notifier interface {
+	StatusChanged(change StatusChange)
+	StatusUnknown(server config.Server, err error, at time.Time)
+}
+
+// Recorder keeps a log of what the monitor observed, e.g. for availability
+// reports. Heartbeat is called after every round of checks.
+type Recorder interface {
+	RecordState(server string, up bool, at time.Time)
+	RecordWake(server, by string, err error, at time.Time)
+	Heartbeat(at time.Time)
+}
+
+// Silencer tells whether notifications about a server are suppressed.
+type Silencer interface {
+	Silenced(server string) bool
+}
+
+// StatusChange describes a server that went up or down.
+type StatusChange struct {
+	Server  string
+	Address string
+	Up      bool
+	Time    time.Time
+
+	// UP: how long the server was down and, if it came up after a wake, who
+	// sent the wake packet
+	Downtime         time.Duration
+	DownSinceStartup bool
+	WokenBy          string
+	WokenAt          time.Time
+
+	// DOWN: the probes that got no answer and the last check that succeeded
+	Probes string
+	LastUp time.Time
+}
+
+type ServerState struct {
+	Name    string
+	Address string
+	IsUp    bool
+	// Unknown is set while the status cannot be determined because the
+	// host name does not resolve or the server's relay is unreachable
+	Unknown     bool
+	LastChecked time.Time
+	LastChanged time.Time
+	CheckCount  int
+	// LastUp is the last check that found the server up, DownSince when it
+	// last went down
+	LastUp    time.Time
+	DownSince time.Time
+
+	// downSinceStartup is set when the server was already down when
+	// monitoring started, so its downtime is only known to be at least that
+	downSinceStartup bool
+
+	// notifiedUp is the state last announced. It lags behind IsUp while
+	// notifications are suppressed, so a server that is still down when its
+	// maintenance ends is reported then.
+	notifiedUp bool
+}
+
+// StatusListener is called whenever a monitored server changes state. It
+// runs without the monitor's lock, so a slow listener does not hold up
+// status queries.
+type StatusListener func(server config.Server, isUp bool, timestamp time.Time)
+
+// ServerMonitor checks its servers every interval. Notifier, Recorder and
+// Silencer are optional and must be set before Start.
+type ServerMonitor struct {
+	Notifier Notifier
+	Recorder Recorder
+	Silencer Silencer
+
+	prober    Prober
+	clock     clock.Clock
+	states    map[string]*ServerState
+	servers   []config.Server
+	mutex     sync.RWMutex
+	interval  time.Duration
+	listeners []StatusListener
+	reset     chan struct{}
+	wakes     map[string]wakeRecord
+	// rounds keeps calls of CheckAll from overlapping, since they probe
+	// without holding mutex
+	rounds sync.Mutex
+
+	// cancel and done are set by Start so that Stop can end the checks
+	cancel context.CancelFunc
+	done   chan struct{}
+}
+
+// wakeRecord remembers who last woke a server so its UP notification can
+// say so.
+type wakeRecord struct {
+	by string
+	at time.Time
+}
+
+// New probes every server once, so monitoring starts from their real state
+// instead of announcing them all as coming UP.
+func New(ctx context.Context, servers []config.Server, interval time.Duration, prober Prober) *ServerMonitor {
+	return NewWithClock(ctx, servers, interval, prober, clock.Real{})
+}
+
+// NewWithClock is New with the time of checks and the interval between them
+// taken from clk, e.g. a clock.Virtual in tests.
+func NewWithClock(ctx context.Context, servers []config.Server, interval time.Duration, prober Prober, clk clock.Clock) *ServerMonitor {
+	monitor := &ServerMonitor{
+		prober:   prober,
+		clock:    clk,
+		states:   make(map[string]*ServerState),
+		servers:  servers,
+		interval: interval,
+		reset:    make(chan struct{}, 1),
+		wakes:    make(map[string]wakeRecord),
+	}
+
+	now := clk.Now()
+	for _, server := range servers {
+		address, initialState, err := prober.Probe(ctx, server)
+		monitor.states[server.Name] = newServerState(server.Name, address, initialState, err != nil, now)
+	}
+
+	return monitor
+}
+
+// newServerState is the state of a server after its first check.
+func newServerState(name, address string, isUp, unknown bool, now time.Time) *ServerState {
+	state := &ServerState{
+		Name:        name,
+		Address:     address,
+		IsUp:        isUp,
+		Unknown:     unknown,
+		LastChecked: now,
+		LastChanged: now,
+		CheckCount:  1,
+		notifiedUp:  isUp,
+	}
+	if isUp {
+		state.LastUp = now
+	} else {
+		state.DownSince = now
+		state.downSinceStartup = true
+	}
+	return state
+}
+
+// Start records the initial states, runs a first round of checks and keeps
+// checking in the background until ctx is done or Stop is called.
+func (sm *ServerMonitor) Start(ctx context.Context) {
+	slog.Info("Starting server monitoring", "interval", sm.interval)
+	ctx, sm.cancel = context.WithCancel(ctx)
+	sm.done = make(chan struct{})
+
+	sm.mutex.RLock()
+	for _, state := range sm.states {
+		sm.recordState(state)
+	}
+	sm.mutex.RUnlock()
+	sm.CheckAll(ctx)
+
+	ticker := sm.clock.NewTicker(sm.Interval())
+	go func() {
+		defer close(sm.done)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C():
+				sm.CheckAll(ctx)
+			case <-sm.reset:
+				ticker.Reset(sm.Interval())
+			}
+		}
+	}()
+}
+
+// Stop ends background checking and waits until a round of checks in
+// progress has been abandoned. It does nothing if Start was not called.
+func (sm *ServerMonitor) Stop() {
+	if sm.cancel == nil {
+		return
+	}
+	sm.cancel()
+	<-sm.done
+}
+
+func (sm *ServerMonitor) Interval() time.Duration {
+	sm.mutex.RLock()
+	defer sm.mutex.RUnlock()
+	return sm.interval
+}
+
+// UpdateServers replaces the monitored servers and interval after a config
+// reload. State is carried over for servers whose names survive; servers
+// that are new get an initial check so they start with their real status
+// instead of announcing themselves as coming UP.
+func (sm *ServerMonitor) UpdateServers(ctx context.Context, servers []config.Server, interval time.Duration) {
+	sm.mutex.RLock()
+	known := make(map[string]bool, len(sm.states))
+	for name := range sm.states {
+		known[name] = true
+	}
+	sm.mutex.RUnlock()
+
+	now := sm.clock.Now()
+	initial := make(map[string]*ServerState)
+	for _, server := range servers {
+		if known[server.Name] {
+			continue
+		}
+		address, isUp, err := sm.prober.Probe(ctx, server)
+		initial[server.Name] = newServerState(server.Name, address, isUp, err != nil, now)
+	}
+
+	sm.mutex.Lock()
+	states := make(map[string]*ServerState, len(servers))
+	for _, server := range servers {
+		if state, ok := sm.states[server.Name]; ok {
+			states[server.Name] = state
+		} else if state, ok := initial[server.Name]; ok {
+			states[server.Name] = state
+			sm.recordState(state)
+		}
+	}
+	sm.states = states
+	sm.servers = servers
+	intervalChanged := sm.interval != interval
+	sm.interval = interval
+	sm.mutex.Unlock()
+
+	if intervalChanged {
+		select {
+		case sm.reset <- struct{}{}:
+		default:
+		}
+	}
+}
+
+// CheckAll probes every server once and reports what changed. Start calls
+// it every interval. A relay probe can take seconds, so the lock is only
+// taken to apply each result and status queries are not held up meanwhile.
+func (sm *ServerMonitor) CheckAll(ctx context.Context) {
+	sm.rounds.Lock()
+	defer sm.rounds.Unlock()
+
+	sm.mutex.RLock()
+	servers := sm.servers
+	sm.mutex.RUnlock()
+
+	now := sm.clock.Now()
+	for _, server := range servers {
+		address, currentStatus, err := sm.prober.Probe(ctx, server)
+		if ctx.Err() != nil {
+			// A cancelled probe says nothing about the server
+			return
+		}
+		sm.mutex.Lock()
+		changed := sm.applyCheck(server, address, currentStatus, err, now)
+		listeners := sm.listeners
+		sm.mutex.Unlock()
+
+		// Listeners may block, e.g. on an MQTT broker, so they run without
+		// the lock that status queries and reloads need
+		if changed {
+			for _, listener := range listeners {
+				listener(server, currentStatus, now)
+			}
+		}
+	}
+
+	if sm.Recorder != nil {
+		sm.Recorder.Heartbeat(now)
+	}
+}
+
+// applyCheck updates the state of server with the outcome of a probe,
+// notifies about any change and reports whether the server went up or
+// down, so the caller can tell the listeners. Callers must hold sm.mutex.
+func (sm *ServerMonitor) applyCheck(server config.Server, address string, currentStatus bool, err error, now time.Time) bool {
+	if !slices.ContainsFunc(sm.servers, func(s config.Server) bool { return s.Name == server.Name }) {
+		// Removed by a reload while it was probed
+		return false
+	}
+
+	state, exists := sm.states[server.Name]
+	if !exists {
+		state = &ServerState{
+			Name:             server.Name,
+			IsUp:             false,
+			LastChecked:      now,
+			LastChanged:      now,
+			DownSince:        now,
+			downSinceStartup: true,
+			CheckCount:       0,
+		}
+		sm.states[server.Name] = state
+	}
+
+	if address != "" {
+		state.Address = address
+	}
+	state.LastChecked = now
+	state.CheckCount++
+
+	// An unresolvable name or unreachable relay says nothing about the
+	// server itself
+	if err != nil {
+		if !state.Unknown {
+			slog.Warn("Server status unknown", "server", server.Name, "error", err)
+			state.Unknown = true
+			if sm.Notifier != nil && !sm.silenced(server.Name) {
+				sm.Notifier.StatusUnknown(server, err, now)
+			}
+		}
+		return false
+	}
+	if state.Unknown {
+		slog.Info("Server status known again", "server", server.Name)
+		state.Unknown = false
+	}
+
+	if currentStatus {
+		state.LastUp = now
+	}
+
+	changed := currentStatus != state.IsUp
+	if changed {
+		slog.Info("Server status changed", "server", server.Name, "up", currentStatus, "address", state.Address)
+
+		state.IsUp = currentStatus
+		state.LastChanged = now
+		sm.recordState(state)
+		if !currentStatus {
+			state.DownSince = now
+			state.downSinceStartup = false
+		}
+	}
+
+	if state.IsUp != state.notifiedUp && !sm.silenced(server.Name) {
+		sm.announce(server, state, now)
+		state.notifiedUp = state.IsUp
+	}
+	return changed
+}
+
+func (sm *ServerMonitor) silenced(name string) bool {
+	return sm.Silencer != nil && sm.Silencer.Silenced(name)
+}
+
+// recordState adds the known state of a server to the log.
+func (sm *ServerMonitor) recordState(state *ServerState) {
+	if state.Unknown || sm.Recorder == nil {
+		return
+	}
+	sm.Recorder.RecordState(state.Name, state.IsUp, state.LastChanged)
+}
+
+// announce passes the current state of server to the notifier. Callers must
+// hold sm.mutex.
+func (sm *ServerMonitor) announce(server config.Server, state *ServerState, timestamp time.Time) {
+	change := StatusChange{
+		Server:  server.Name,
+		Address: server.DisplayAddress(state.Address),
+		Up:      state.IsUp,
+		Time:    timestamp,
+	}
+	if state.IsUp {
+		if !state.DownSince.IsZero() {
+			change.Downtime = state.LastChanged.Sub(state.DownSince)
+			change.DownSinceStartup = state.downSinceStartup
+		}
+		if wake, ok := sm.wakes[server.Name]; ok {
+			sinceWake := state.LastChanged.Sub(wake.at)
+			if !wake.at.Before(state.DownSince) && sinceWake >= 0 && sinceWake <= wakeAttributionWindow {
+				change.WokenBy, change.WokenAt = wake.by, wake.at
+			}
+			delete(sm.wakes, server.Name)
+		}
+	} else {
+		change.Probes = server.ProbeDescription()
+		change.LastUp = state.LastUp
+	}
+
+	if sm.Notifier != nil {
+		sm.Notifier.StatusChanged(change)
+	}
+}
+
+// RecordWake notes that by sent a wake packet to the named server, or failed
+// to with err. Successful wakes are mentioned when the server comes up.
+func (sm *ServerMonitor) RecordWake(name, by string, err error) {
+	if sm == nil {
+		return
+	}
+
+	now := sm.clock.Now()
+	if sm.Recorder != nil {
+		sm.Recorder.RecordWake(name, by, err, now)
+	}
+	if err != nil {
+		return
+	}
+
+	sm.mutex.Lock()
+	defer sm.mutex.Unlock()
+	sm.wakes[name] = wakeRecord{by: by, at: now}
+}
+
+// OnStatusChange registers a listener for server state changes. Listeners
+// must be registered before Start is called.
+func (sm *ServerMonitor) OnStatusChange(listener StatusListener) {
+	sm.mutex.Lock()
+	defer sm.mutex.Unlock()
+
+	sm.listeners = append(sm.listeners, listener)
+}
+
+// GetServerStates returns a copy of the current state of every server.
+func (sm *ServerMonitor) GetServerStates() map[string]*ServerState {
+	sm.mutex.RLock()
+	defer sm.mutex.RUnlock()
+
+	states := make(map[string]*ServerState)
+	for name, state := range sm.states {
+		stateCopy := *state
+		states[name] = &stateCopy
+	}
+	return states
+}
@@ -0,0 +1,298 @@
+package monitor
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/tsolodov/wot/clock"
+	"github.com/tsolodov/wot/config"
+	"github.com/tsolodov/wot/internal/simnet"
+	"github.com/tsolodov/wot/wol"
+)
+
+// fakeProber reports servers as up or down from a map; servers missing from
+// it have an unknown status.
+type fakeProber struct {
+	mutex sync.Mutex
+	up    map[string]bool
+}
+
+func (p *fakeProber) set(name string, up bool) {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	p.up[name] = up
+}
+
+func (p *fakeProber) Probe(ctx context.Context, server config.Server) (string, bool, error) {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	up, ok := p.up[server.Name]
+	if !ok {
+		return "", false, errors.New("NXDOMAIN")
+	}
+	return "192.168.1.10", up, nil
+}
+
+type recorder struct {
+	changes  []StatusChange
+	unknown  []string
+	states   []bool
+	wakes    []string
+	silenced map[string]bool
+
+	heartbeats chan time.Time
+}
+
+func (r *recorder) StatusChanged(change StatusChange) { r.changes = append(r.changes, change) }
+func (r *recorder) StatusUnknown(server config.Server, err error, at time.Time) {
+	r.unknown = append(r.unknown, server.Name)
+}
+func (r *recorder) RecordState(server string, up bool, at time.Time) { r.states = append(r.states, up) }
+func (r *recorder) RecordWake(server, by string, err error, at time.Time) {
+	r.wakes = append(r.wakes, by)
+}
+func (r *recorder) Heartbeat(at time.Time) {
+	if r.heartbeats != nil {
+		r.heartbeats <- at
+	}
+}
+func (r *recorder) Silenced(server string) bool { return r.silenced[server] }
+
+func TestServerMonitor(t *testing.T) {
+	ctx := context.Background()
+	prober := &fakeProber{up: map[string]bool{"nas": true}}
+	servers := []config.Server{{Name: "nas", MACAddress: "aa:bb:cc:dd:ee:01", TCPPorts: []int{22, 445}}}
+	sm := New(ctx, servers, time.Minute, prober)
+	r := &recorder{silenced: map[string]bool{}}
+	sm.Notifier, sm.Recorder, sm.Silencer = r, r, r
+
+	if state := sm.GetServerStates()["nas"]; state == nil || !state.IsUp || state.Address != "192.168.1.10" {
+		t.Fatalf("initial state = %+v", state)
+	}
+	sm.CheckAll(ctx)
+	if len(r.changes) != 0 {
+		t.Fatalf("unchanged server announced: %+v", r.changes)
+	}
+
+	prober.set("nas", false)
+	sm.CheckAll(ctx)
+	if len(r.changes) != 1 || r.changes[0].Up || r.changes[0].Probes != "ping and TCP ports 22, 445" {
+		t.Fatalf("DOWN change = %+v", r.changes)
+	}
+
+	sm.RecordWake("nas", "@alice", nil)
+	prober.set("nas", true)
+	sm.CheckAll(ctx)
+	if len(r.changes) != 2 || !r.changes[1].Up || r.changes[1].WokenBy != "@alice" {
+		t.Fatalf("UP change = %+v", r.changes)
+	}
+	if len(r.wakes) != 1 || len(r.states) != 2 {
+		t.Errorf("recorded wakes %v, states %v", r.wakes, r.states)
+	}
+
+	// Silenced changes are announced once the server is no longer silenced
+	r.silenced["nas"] = true
+	prober.set("nas", false)
+	sm.CheckAll(ctx)
+	if len(r.changes) != 2 {
+		t.Fatalf("silenced change announced: %+v", r.changes)
+	}
+	r.silenced["nas"] = false
+	sm.CheckAll(ctx)
+	if len(r.changes) != 3 || r.changes[2].Up {
+		t.Fatalf("change not announced after silence: %+v", r.changes)
+	}
+
+	// An unknown status is reported once and is not a change
+	prober.mutex.Lock()
+	delete(prober.up, "nas")
+	prober.mutex.Unlock()
+	sm.CheckAll(ctx)
+	sm.CheckAll(ctx)
+	if state := sm.GetServerStates()["nas"]; !state.Unknown {
+		t.Errorf("state = %+v", state)
+	}
+	if len(r.unknown) != 1 || len(r.changes) != 3 {
+		t.Errorf("unknown %v, changes %+v", r.unknown, r.changes)
+	}
+
+	// Servers added later start from their probed state
+	prober.set("web", true)
+	sm.UpdateServers(ctx, append(servers, config.Server{Name: "web"}), 2*time.Minute)
+	if state := sm.GetServerStates()["web"]; state == nil || !state.IsUp {
+		t.Errorf("web state = %+v", state)
+	}
+	if sm.Interval() != 2*time.Minute {
+		t.Errorf("interval = %v", sm.Interval())
+	}
+}
+
+func TestServerMonitorWithoutHooks(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	prober := &fakeProber{up: map[string]bool{"nas": false}}
+	sm := New(ctx, []config.Server{{Name: "nas"}}, time.Minute, prober)
+
+	changes := 0
+	sm.OnStatusChange(func(config.Server, bool, time.Time) { changes++ })
+	sm.Start(ctx)
+	prober.set("nas", true)
+	sm.CheckAll(ctx)
+	sm.RecordWake("nas", "@bob", nil)
+	if changes != 1 {
+		t.Errorf("listener called %d times", changes)
+	}
+
+	// A cancelled check leaves the state alone
+	cancel()
+	prober.set("nas", false)
+	sm.CheckAll(ctx)
+	if !sm.GetServerStates()["nas"].IsUp {
+		t.Error("state changed by a cancelled check")
+	}
+}
+
+func TestServerMonitorStop(t *testing.T) {
+	var blocking atomic.Bool
+	probing := make(chan struct{}, 1)
+	prober := ProberFunc(func(ctx context.Context, server config.Server) (string, bool, error) {
+		if blocking.Load() {
+			select {
+			case probing <- struct{}{}:
+			default:
+			}
+			<-ctx.Done()
+		}
+		return "", true, nil
+	})
+
+	sm := New(context.Background(), []config.Server{{Name: "nas"}}, time.Millisecond, prober)
+	sm.Start(context.Background())
+	blocking.Store(true)
+	<-probing
+
+	// A hanging probe does not hold up status queries
+	queried := make(chan struct{})
+	go func() {
+		sm.GetServerStates()
+		close(queried)
+	}()
+	select {
+	case <-queried:
+	case <-time.After(5 * time.Second):
+		t.Fatal("GetServerStates waited for the probe in progress")
+	}
+
+	// Stop cancels the probe in progress and waits for the loop to exit
+	stopped := make(chan struct{})
+	go func() {
+		sm.Stop()
+		close(stopped)
+	}()
+	select {
+	case <-stopped:
+	case <-time.After(5 * time.Second):
+		t.Fatal("Stop did not return")
+	}
+	if state := sm.GetServerStates()["nas"]; !state.IsUp {
+		t.Errorf("state changed by a cancelled check: %+v", state)
+	}
+
+	// Stopping a monitor that was never started is harmless
+	New(context.Background(), nil, time.Minute, prober).Stop()
+}
+
+func TestServerMonitorSlowListener(t *testing.T) {
+	prober := &fakeProber{up: map[string]bool{"nas": true}}
+	sm := New(context.Background(), []config.Server{{Name: "nas"}}, time.Minute, prober)
+	called := make(chan struct{})
+	release := make(chan struct{})
+	sm.OnStatusChange(func(config.Server, bool, time.Time) {
+		close(called)
+		<-release
+	})
+
+	prober.set("nas", false)
+	go sm.CheckAll(context.Background())
+	<-called
+
+	// A listener stuck on e.g. an MQTT broker does not block status queries
+	queried := make(chan map[string]*ServerState)
+	go func() { queried <- sm.GetServerStates() }()
+	select {
+	case states := <-queried:
+		if states["nas"].IsUp {
+			t.Errorf("state not updated before the listener ran: %+v", states["nas"])
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("GetServerStates waited for the listener")
+	}
+	close(release)
+}
+
+func TestServerMonitorSimulatedWake(t *testing.T) {
+	ctx := context.Background()
+	start := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	clk := clock.NewVirtual(start)
+	network := simnet.New(clk)
+	nas := network.AddHost("192.168.1.10", "aa:bb:cc:dd:ee:01")
+	nas.BootDelay = 3 * time.Minute
+	nas.Ports = []int{445}
+	prober := ProberFunc(func(ctx context.Context, server config.Server) (string, bool, error) {
+		return server.IPAddress, network.Prober().Host(ctx, server.IPAddress, server.TCPPorts), nil
+	})
+
+	server := config.Server{Name: "nas", MACAddress: "aa:bb:cc:dd:ee:01", IPAddress: "192.168.1.10", TCPPorts: []int{445}}
+	sm := NewWithClock(ctx, []config.Server{server}, time.Minute, prober, clk)
+	r := &recorder{heartbeats: make(chan time.Time, 1)}
+	sm.Notifier, sm.Recorder = r, r
+	sm.Start(ctx)
+	defer sm.Stop()
+	<-r.heartbeats
+
+	// tick runs one round of checks on the monitor's own ticker. Advancing
+	// further at once could leave a second tick for the next call.
+	tick := func() {
+		t.Helper()
+		clk.Advance(time.Minute)
+		select {
+		case <-r.heartbeats:
+		case <-time.After(5 * time.Second):
+			t.Fatal("no check after the interval")
+		}
+	}
+
+	for i := 0; i < 10; i++ {
+		tick()
+	}
+	err := wol.SendVia(ctx, network, server.MACAddress, "")
+	sm.RecordWake("nas", "@alice", err)
+	tick()
+	tick()
+	if len(r.changes) != 0 {
+		t.Fatalf("host announced before it booted: %+v", r.changes)
+	}
+	tick()
+	if len(r.changes) != 1 || !r.changes[0].Up || r.changes[0].WokenBy != "@alice" {
+		t.Fatalf("UP change = %+v", r.changes)
+	}
+	if change := r.changes[0]; change.Downtime != 13*time.Minute || !change.WokenAt.Equal(start.Add(10*time.Minute)) {
+		t.Errorf("downtime %v, woken at %v", change.Downtime, change.WokenAt)
+	}
+
+	// A server coming up long after a wake was not woken by it
+	nas.PowerOff()
+	tick()
+	sm.RecordWake("nas", "@bob", nil)
+	for i := time.Duration(0); i < wakeAttributionWindow; i += time.Minute {
+		tick()
+	}
+	nas.PowerOn()
+	tick()
+	if len(r.changes) != 3 || !r.changes[2].Up || r.changes[2].WokenBy != "" {
+		t.Errorf("changes = %+v", r.changes)
+	}
+}
@@ -0,0 +1,151 @@
+// Package probe checks whether hosts are up, with an ICMP echo request where
+// the process may send one and TCP connection attempts otherwise.
+package probe
+
+import (
+	"context"
+	"log/slog"
+	"net"
+	"os"
+	"strconv"
+	"time"
+
+	"golang.org/x/net/icmp"
+	"golang.org/x/net/ipv4"
+)
+
+const (
+	// PingTimeout bounds an ICMP echo unless the context ends earlier
+	PingTimeout = 2 * time.Second
+	// DialTimeout bounds each TCP connection attempt
+	DialTimeout = time.Second
+)
+
+// DefaultTCPPorts returns the ports tried for hosts without their own list.
+func DefaultTCPPorts() []int {
+	return []int{22, 80, 443}
+}
+
+// Pinger sends an ICMP echo request to host and reports whether it answered.
+type Pinger interface {
+	Ping(ctx context.Context, host string) bool
+}
+
+// PingerFunc adapts a function to the Pinger interface.
+type PingerFunc func(ctx context.Context, host string) bool
+
+func (f PingerFunc) Ping(ctx context.Context, host string) bool {
+	return f(ctx, host)
+}
+
+// Dialer opens TCP connections; *net.Dialer is one.
+type Dialer interface {
+	DialContext(ctx context.Context, network, address string) (net.Conn, error)
+}
+
+// Prober checks hosts through its Pinger and Dialer, so that tests can
+// replace the network with simulated hosts.
+type Prober struct {
+	Pinger Pinger
+	Dialer Dialer
+}
+
+// NewDefault returns a Prober for the real network.
+func NewDefault() Prober {
+	return Prober{Pinger: PingerFunc(Ping), Dialer: &net.Dialer{Timeout: DialTimeout}}
+}
+
+// Host reports whether host answers a ping or accepts a connection on one of
+// ports (DefaultTCPPorts if empty).
+func Host(ctx context.Context, host string, ports []int) bool {
+	return NewDefault().Host(ctx, host, ports)
+}
+
+// TCP reports whether host accepts a connection on any of ports, trying
+// DefaultTCPPorts if the list is empty.
+func TCP(ctx context.Context, host string, ports []int) bool {
+	return NewDefault().TCP(ctx, host, ports)
+}
+
+// Host reports whether host answers a ping or accepts a connection on one of
+// ports (DefaultTCPPorts if empty).
+func (p Prober) Host(ctx context.Context, host string, ports []int) bool {
+	if p.Pinger.Ping(ctx, host) {
+		slog.Debug("Host answered", "probe", "icmp", "host", host)
+		return true
+	}
+	return p.TCP(ctx, host, ports)
+}
+
+// Ping sends an ICMP echo request to host and waits for any reply. It needs
+// a raw socket, so without CAP_NET_RAW it always reports false.
+func Ping(ctx context.Context, host string) bool {
+	if ctx.Err() != nil {
+		return false
+	}
+	conn, err := icmp.ListenPacket("ip4:icmp", "0.0.0.0")
+	if err != nil {
+		return false
+	}
+	defer conn.Close()
+
+	var resolver net.Resolver
+	addresses, err := resolver.LookupIP(ctx, "ip4", host)
+	if err != nil || len(addresses) == 0 {
+		return false
+	}
+	dst := &net.IPAddr{IP: addresses[0]}
+
+	msg := &icmp.Message{
+		Type: ipv4.ICMPTypeEcho,
+		Code: 0,
+		Body: &icmp.Echo{
+			ID:   os.Getpid() & 0xffff,
+			Seq:  1,
+			Data: []byte("WoT"),
+		},
+	}
+	msgBytes, err := msg.Marshal(nil)
+	if err != nil {
+		return false
+	}
+
+	deadline := time.Now().Add(PingTimeout)
+	if ctxDeadline, ok := ctx.Deadline(); ok && ctxDeadline.Before(deadline) {
+		deadline = ctxDeadline
+	}
+	conn.SetDeadline(deadline)
+	stop := context.AfterFunc(ctx, func() { conn.SetDeadline(time.Now()) })
+	defer stop()
+
+	if _, err := conn.WriteTo(msgBytes, dst); err != nil {
+		return false
+	}
+
+	// Any reply counts; a basic ICMP header is 8 bytes
+	reply := make([]byte, 1500)
+	n, _, err := conn.ReadFrom(reply)
+	return err == nil && n > 8
+}
+
+// TCP reports whether host accepts a connection on any of ports, trying
+// DefaultTCPPorts if the list is empty.
+func (p Prober) TCP(ctx context.Context, host string, ports []int) bool {
+	if len(ports) == 0 {
+		ports = DefaultTCPPorts()
+	}
+
+	for _, port := range ports {
+		if ctx.Err() != nil {
+			return false
+		}
+		conn, err := p.Dialer.DialContext(ctx, "tcp", net.JoinHostPort(host, strconv.Itoa(port)))
+		if err == nil {
+			conn.Close()
+			slog.Debug("Host answered", "probe", "tcp", "host", host, "port", port)
+			return true
+		}
+	}
+	slog.Debug("Host did not answer", "probe", "tcp", "host", host, "ports", ports)
+	return false
+}
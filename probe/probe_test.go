@@ -0,0 +1,100 @@
+package probe
+
+import (
+	"context"
+	"errors"
+	"net"
+	"testing"
+)
+
+func listen(t *testing.T) int {
+	t.Helper()
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { listener.Close() })
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			conn.Close()
+		}
+	}()
+	return listener.Addr().(*net.TCPAddr).Port
+}
+
+func closedPort(t *testing.T) int {
+	t.Helper()
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	port := listener.Addr().(*net.TCPAddr).Port
+	listener.Close()
+	return port
+}
+
+func TestTCP(t *testing.T) {
+	open, closed := listen(t), closedPort(t)
+	ctx := context.Background()
+
+	if !TCP(ctx, "127.0.0.1", []int{closed, open}) {
+		t.Error("open port not found")
+	}
+	if TCP(ctx, "127.0.0.1", []int{closed}) {
+		t.Error("closed port reported as open")
+	}
+
+	cancelled, cancel := context.WithCancel(ctx)
+	cancel()
+	if TCP(cancelled, "127.0.0.1", []int{open}) {
+		t.Error("probe ran with a cancelled context")
+	}
+	if Host(cancelled, "127.0.0.1", []int{open}) {
+		t.Error("host probe ran with a cancelled context")
+	}
+}
+
+func TestDefaultTCPPorts(t *testing.T) {
+	ports := DefaultTCPPorts()
+	ports[0] = 1
+	if DefaultTCPPorts()[0] != 22 {
+		t.Error("DefaultTCPPorts returned shared state")
+	}
+}
+
+type fakeDialer map[string]bool
+
+func (d fakeDialer) DialContext(ctx context.Context, network, address string) (net.Conn, error) {
+	if !d[address] {
+		return nil, errors.New("connection refused")
+	}
+	client, server := net.Pipe()
+	server.Close()
+	return client, nil
+}
+
+func TestProber(t *testing.T) {
+	ctx := context.Background()
+	pinged := ""
+	prober := Prober{
+		Pinger: PingerFunc(func(ctx context.Context, host string) bool {
+			pinged = host
+			return host == "10.0.0.1"
+		}),
+		Dialer: fakeDialer{"10.0.0.2:443": true},
+	}
+
+	if !prober.Host(ctx, "10.0.0.1", nil) || pinged != "10.0.0.1" {
+		t.Error("host answering pings not found")
+	}
+	if !prober.Host(ctx, "10.0.0.2", nil) {
+		t.Error("host with a default port open not found")
+	}
+	if prober.Host(ctx, "10.0.0.2", []int{22}) || prober.Host(ctx, "10.0.0.3", nil) {
+		t.Error("host reported up without answering")
+	}
+}
@@ -0,0 +1,101 @@
+// Package wol builds and sends Wake-on-LAN magic packets.
+package wol
+
+import (
+	"bytes"
+	"context"
+	"encoding/hex"
+	"fmt"
+	"net"
+	"strings"
+)
+
+const (
+	// DefaultPort is the UDP port magic packets are sent to
+	DefaultPort = 9
+	// DefaultBroadcast is used when no broadcast address is given
+	DefaultBroadcast = "255.255.255.255"
+)
+
+// ParseMAC accepts MAC addresses with ':', '-' or no separators.
+func ParseMAC(mac string) (net.HardwareAddr, error) {
+	cleaned := strings.NewReplacer(":", "", "-", "").Replace(strings.TrimSpace(mac))
+	raw, err := hex.DecodeString(cleaned)
+	if err != nil {
+		return nil, fmt.Errorf("invalid MAC address: %w", err)
+	}
+	if len(raw) != 6 {
+		return nil, fmt.Errorf("MAC address must be 6 bytes long")
+	}
+	return net.HardwareAddr(raw), nil
+}
+
+// MagicPacket returns the 102 byte payload that wakes mac: six 0xFF bytes
+// followed by the address repeated 16 times.
+func MagicPacket(mac net.HardwareAddr) []byte {
+	packet := make([]byte, 0, 102)
+	for i := 0; i < 6; i++ {
+		packet = append(packet, 0xFF)
+	}
+	for i := 0; i < 16; i++ {
+		packet = append(packet, mac...)
+	}
+	return packet
+}
+
+// PacketSender transmits a UDP payload to address ("host:port").
+type PacketSender interface {
+	SendPacket(ctx context.Context, address string, payload []byte) error
+}
+
+// UDP sends packets over the network.
+type UDP struct{}
+
+func (UDP) SendPacket(ctx context.Context, address string, payload []byte) error {
+	var dialer net.Dialer
+	conn, err := dialer.DialContext(ctx, "udp", address)
+	if err != nil {
+		return fmt.Errorf("failed to dial UDP: %w", err)
+	}
+	defer conn.Close()
+
+	if deadline, ok := ctx.Deadline(); ok {
+		conn.SetWriteDeadline(deadline)
+	}
+	if _, err := conn.Write(payload); err != nil {
+		return fmt.Errorf("failed to send magic packet: %w", err)
+	}
+	return nil
+}
+
+// Send broadcasts a magic packet for mac to broadcastIP, or to
+// DefaultBroadcast if it is empty, on DefaultPort.
+func Send(ctx context.Context, mac, broadcastIP string) error {
+	return SendVia(ctx, UDP{}, mac, broadcastIP)
+}
+
+// SendVia is Send with the packet handed to sender.
+func SendVia(ctx context.Context, sender PacketSender, mac, broadcastIP string) error {
+	hardware, err := ParseMAC(mac)
+	if err != nil {
+		return err
+	}
+	if broadcastIP == "" {
+		broadcastIP = DefaultBroadcast
+	}
+	return sender.SendPacket(ctx, net.JoinHostPort(broadcastIP, fmt.Sprint(DefaultPort)), MagicPacket(hardware))
+}
+
+// ParseMagicPacket returns the MAC address a magic packet wakes.
+func ParseMagicPacket(packet []byte) (net.HardwareAddr, error) {
+	if len(packet) != 102 || !bytes.Equal(packet[:6], []byte{0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF}) {
+		return nil, fmt.Errorf("not a magic packet")
+	}
+	mac := net.HardwareAddr(bytes.Clone(packet[6:12]))
+	for i := 1; i < 16; i++ {
+		if !bytes.Equal(packet[6+i*6:12+i*6], mac) {
+			return nil, fmt.Errorf("not a magic packet")
+		}
+	}
+	return mac, nil
+}
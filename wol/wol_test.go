@@ -0,0 +1,85 @@
+package wol
+
+import (
+	"bytes"
+	"context"
+	"testing"
+)
+
+func TestParseMAC(t *testing.T) {
+	for _, mac := range []string{"aa:bb:cc:dd:ee:ff", "AA-BB-CC-DD-EE-FF", "aabbccddeeff"} {
+		hardware, err := ParseMAC(mac)
+		if err != nil {
+			t.Errorf("ParseMAC(%q) failed: %v", mac, err)
+			continue
+		}
+		if hardware.String() != "aa:bb:cc:dd:ee:ff" {
+			t.Errorf("ParseMAC(%q) = %s", mac, hardware)
+		}
+	}
+	for _, mac := range []string{"invalid-mac", "aa:bb:cc:dd:ee", "aa:bb:cc:dd:ee:ff:00"} {
+		if _, err := ParseMAC(mac); err == nil {
+			t.Errorf("ParseMAC(%q) succeeded", mac)
+		}
+	}
+}
+
+func TestMagicPacket(t *testing.T) {
+	mac, _ := ParseMAC("00:11:22:33:44:55")
+	packet := MagicPacket(mac)
+	if len(packet) != 102 {
+		t.Fatalf("packet length = %d", len(packet))
+	}
+	if !bytes.Equal(packet[:6], []byte{0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF}) {
+		t.Errorf("header = %x", packet[:6])
+	}
+	for i := 0; i < 16; i++ {
+		if !bytes.Equal(packet[6+i*6:12+i*6], mac) {
+			t.Errorf("repetition %d = %x", i, packet[6+i*6:12+i*6])
+		}
+	}
+}
+
+func TestSend(t *testing.T) {
+	if err := Send(context.Background(), "invalid-mac", ""); err == nil {
+		t.Error("expected error for invalid MAC address")
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if err := Send(ctx, "aa:bb:cc:dd:ee:ff", "127.0.0.1"); err == nil {
+		t.Error("expected error for a cancelled context")
+	}
+}
+
+type capturingSender struct {
+	address string
+	payload []byte
+}
+
+func (s *capturingSender) SendPacket(ctx context.Context, address string, payload []byte) error {
+	s.address, s.payload = address, payload
+	return nil
+}
+
+func TestSendVia(t *testing.T) {
+	sender := &capturingSender{}
+	if err := SendVia(context.Background(), sender, "aa-bb-cc-dd-ee-ff", ""); err != nil {
+		t.Fatal(err)
+	}
+	if sender.address != "255.255.255.255:9" {
+		t.Errorf("sent to %s", sender.address)
+	}
+	mac, err := ParseMagicPacket(sender.payload)
+	if err != nil || mac.String() != "aa:bb:cc:dd:ee:ff" {
+		t.Errorf("ParseMagicPacket = %v, %v", mac, err)
+	}
+
+	sender.payload[101] ^= 1
+	if _, err := ParseMagicPacket(sender.payload); err == nil {
+		t.Error("accepted a corrupted magic packet")
+	}
+	if _, err := ParseMagicPacket([]byte("WoT")); err == nil {
+		t.Error("accepted a short packet")
+	}
+}